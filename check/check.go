@@ -1,8 +1,17 @@
 package check
 
 import (
+	"fmt"
+	"rovo2api/common/audit"
 	"rovo2api/common/config"
+	"rovo2api/common/ipfilter"
 	logger "rovo2api/common/loggger"
+	"rovo2api/common/moderation"
+	"rovo2api/common/scheduler"
+	"rovo2api/common/state"
+	"rovo2api/cycletls"
+	"strconv"
+	"strings"
 )
 
 func CheckEnvVariable() {
@@ -12,5 +21,155 @@ func CheckEnvVariable() {
 		logger.FatalLog("环境变量 RV_COOKIE 未设置")
 	}
 
+	profiles := []string{config.TLSProfile}
+	for _, profile := range config.CredentialTLSProfiles {
+		profiles = append(profiles, profile)
+	}
+	for _, profile := range config.ProxyTLSProfiles {
+		profiles = append(profiles, profile)
+	}
+	for _, profile := range profiles {
+		if _, ok := cycletls.GetProfile(profile); !ok {
+			logger.FatalLog(fmt.Sprintf("环境变量 TLS_PROFILE 配置错误, 未知的指纹配置: %s (可选: %s)", profile, strings.Join(cycletls.ProfileNames(), ",")))
+		}
+	}
+	config.ApplySettings()
+
+	if err := logger.SetLevel(config.LogLevel); err != nil {
+		logger.FatalLog(fmt.Sprintf("环境变量 LOG_LEVEL 配置错误: %v", err))
+	}
+	if !config.IsLogFormat(config.LogFormat) {
+		logger.FatalLog(fmt.Sprintf("环境变量 LOG_FORMAT 配置错误: %s (可选: text,json,logfmt)", config.LogFormat))
+	}
+
+	if config.TracingSampleRatio < 0 || config.TracingSampleRatio > 1 {
+		logger.FatalLog(fmt.Sprintf("环境变量 TRACING_SAMPLE_RATIO 配置错误, 需在0到1之间: %v", config.TracingSampleRatio))
+	}
+
+	if config.ShutdownTimeout < 0 {
+		logger.FatalLog(fmt.Sprintf("环境变量 SHUTDOWN_TIMEOUT 配置错误, 不能为负数: %d", config.ShutdownTimeout))
+	}
+
+	if !config.IsContextStrategy(config.ContextStrategy) {
+		logger.FatalLog(fmt.Sprintf("环境变量 CONTEXT_STRATEGY 配置错误: %s (可选: off,reject,truncate,summarize)", config.ContextStrategy))
+	}
+	if config.ContextStrategy == config.ContextStrategySummarize {
+		if _, ok := config.GetModelInfo(config.ContextSummaryModel); !ok {
+			logger.FatalLog(fmt.Sprintf("环境变量 CONTEXT_SUMMARY_MODEL 配置错误, 模型不存在: %s", config.ContextSummaryModel))
+		}
+	}
+	if config.ContextSafetyMargin < 0 || config.ContextSafetyMargin >= 1 {
+		logger.FatalLog(fmt.Sprintf("环境变量 CONTEXT_SAFETY_MARGIN 配置错误, 需在0到1之间(不含1): %v", config.ContextSafetyMargin))
+	}
+
+	if config.ReadyMinCredentials < 0 {
+		logger.FatalLog(fmt.Sprintf("环境变量 READY_MIN_CREDENTIALS 配置错误, 不能为负数: %d", config.ReadyMinCredentials))
+	}
+
+	switch strings.ToLower(config.StateBackend) {
+	case state.BackendMemory:
+	case state.BackendRedis:
+		if config.RedisUrl == "" {
+			logger.FatalLog("环境变量 STATE_BACKEND 为 redis 时需配置 REDIS_URL")
+		}
+	default:
+		logger.FatalLog(fmt.Sprintf("环境变量 STATE_BACKEND 配置错误: %s (可选: %s,%s)", config.StateBackend, state.BackendMemory, state.BackendRedis))
+	}
+
+	for name, list := range map[string][]string{
+		"TRUSTED_PROXIES":     config.TrustedProxies,
+		"IP_ALLOW_LIST":       config.IpAllowList,
+		"IP_DENY_LIST":        config.IpDenyList,
+		"API_IP_ALLOW_LIST":   config.ApiIpAllowList,
+		"API_IP_DENY_LIST":    config.ApiIpDenyList,
+		"ADMIN_IP_ALLOW_LIST": config.AdminIpAllowList,
+		"ADMIN_IP_DENY_LIST":  config.AdminIpDenyList,
+	} {
+		if _, err := ipfilter.ParseList(list); err != nil {
+			logger.FatalLog(fmt.Sprintf("环境变量 %s 配置错误: %v", name, err))
+		}
+	}
+	if err := config.ApplyIPAccess(); err != nil {
+		logger.FatalLog(fmt.Sprintf("IP 访问控制配置错误: %v", err))
+	}
+
+	for key, weight := range config.SchedulerKeyWeights {
+		if value, err := strconv.ParseFloat(weight, 64); err != nil || value <= 0 {
+			logger.FatalLog(fmt.Sprintf("环境变量 SCHEDULER_KEY_WEIGHTS 配置错误, %s 的权重需为正数: %s", key, weight))
+		}
+	}
+	for key, priority := range config.SchedulerKeyPriorities {
+		if _, ok := scheduler.ParsePriority(priority); !ok {
+			logger.FatalLog(fmt.Sprintf("环境变量 SCHEDULER_KEY_PRIORITIES 配置错误, %s 的优先级未知: %s (可选: interactive,batch)", key, priority))
+		}
+	}
+
+	for name, value := range map[string]int{
+		"BATCH_CONCURRENCY":   config.BatchConcurrency,
+		"BATCH_MAX_FILE_SIZE": config.BatchMaxFileSize,
+		"BATCH_MAX_REQUESTS":  config.BatchMaxRequests,
+	} {
+		if value <= 0 {
+			logger.FatalLog(fmt.Sprintf("环境变量 %s 配置错误, 需大于0: %d", name, value))
+		}
+	}
+
+	if _, err := audit.ResolveRules(config.AuditRedactRules, nil); err != nil {
+		logger.FatalLog(fmt.Sprintf("环境变量 AUDIT_REDACT_RULES 配置错误: %v", err))
+	}
+
+	if err := config.ApplyModelRegistry(); err != nil {
+		logger.FatalLog(fmt.Sprintf("环境变量 MODEL_ALIASES 或 MODEL_FALLBACKS 配置错误: %v", err))
+	}
+
+	for name, action := range map[string]string{
+		"MODERATION_INPUT_ACTION":  config.ModerationInputAction,
+		"MODERATION_OUTPUT_ACTION": config.ModerationOutputAction,
+	} {
+		if !moderation.IsAction(action) {
+			logger.FatalLog(fmt.Sprintf("环境变量 %s 配置错误: %s (可选: off,block,redact,flag)", name, action))
+		}
+	}
+	if config.ModerationWebhookTimeout <= 0 {
+		logger.FatalLog(fmt.Sprintf("环境变量 MODERATION_WEBHOOK_TIMEOUT 配置错误, 需大于0: %d", config.ModerationWebhookTimeout))
+	}
+	if config.ModerationStreamBuffer <= 0 {
+		logger.FatalLog(fmt.Sprintf("环境变量 MODERATION_STREAM_BUFFER 配置错误, 需大于0: %d", config.ModerationStreamBuffer))
+	}
+	if err := config.ApplyModeration(); err != nil {
+		logger.FatalLog(fmt.Sprintf("环境变量 MODERATION_RULES_JSON 或 MODERATION_WEBHOOK_URL 配置错误: %v", err))
+	}
+
+	if err := config.ApplyPIIRedaction(); err != nil {
+		logger.FatalLog(fmt.Sprintf("环境变量 PII_REDACT_RULES、PII_CUSTOM_RULES_JSON 或 PII_KEY_POLICIES 配置错误: %v", err))
+	}
+
+	if err := config.ApplyHooks(); err != nil {
+		logger.FatalLog(fmt.Sprintf("环境变量 HOOKS_JSON 配置错误: %v", err))
+	}
+
+	if config.EventPoolMinHealthy < 0 {
+		logger.FatalLog(fmt.Sprintf("环境变量 EVENT_POOL_MIN_HEALTHY 配置错误, 不能小于0: %d", config.EventPoolMinHealthy))
+	}
+	if config.EventErrorSpikeCount < 0 {
+		logger.FatalLog(fmt.Sprintf("环境变量 EVENT_ERROR_SPIKE_COUNT 配置错误, 不能小于0: %d", config.EventErrorSpikeCount))
+	}
+	if config.EventErrorSpikeWindow <= 0 {
+		logger.FatalLog(fmt.Sprintf("环境变量 EVENT_ERROR_SPIKE_WINDOW 配置错误, 需大于0: %d", config.EventErrorSpikeWindow))
+	}
+	if config.EventQuotaDailyTokens < 0 {
+		logger.FatalLog(fmt.Sprintf("环境变量 EVENT_QUOTA_DAILY_TOKENS 配置错误, 不能小于0: %d", config.EventQuotaDailyTokens))
+	}
+	if config.EventQuotaThreshold <= 0 || config.EventQuotaThreshold >= 1 {
+		logger.FatalLog(fmt.Sprintf("环境变量 EVENT_QUOTA_THRESHOLD 配置错误, 需在0到1之间: %v", config.EventQuotaThreshold))
+	}
+	if err := config.ApplyEvents(); err != nil {
+		logger.FatalLog(fmt.Sprintf("环境变量 EVENT_WEBHOOKS_JSON 配置错误: %v", err))
+	}
+
+	if err := config.ApplyPromptPolicies(); err != nil {
+		logger.FatalLog(fmt.Sprintf("环境变量 PROMPT_POLICIES_JSON 配置错误: %v", err))
+	}
+
 	logger.SysLog("environment variable check passed.")
 }
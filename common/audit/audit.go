@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"rovo2api/common/rotate"
+	"sync/atomic"
+	"time"
+)
+
+// Message 脱敏后的请求消息
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request 脱敏后的请求
+type Request struct {
+	Stream      bool      `json:"stream"`
+	Temperature float64   `json:"temperature"`
+	TopP        float64   `json:"top_p,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Messages    []Message `json:"messages"`
+}
+
+// Usage token 用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Record 一次对话请求的审计记录
+type Record struct {
+	Time       time.Time      `json:"time"`
+	RequestID  string         `json:"request_id"`
+	APIKey     string         `json:"api_key,omitempty"` // 接口密钥的哈希标识, 不含密钥本身
+	ClientIP   string         `json:"client_ip"`
+	UserAgent  string         `json:"user_agent,omitempty"`
+	Model      string         `json:"model"`
+	UsedModel  string         `json:"used_model,omitempty"`
+	Credential string         `json:"credential,omitempty"` // 凭证标识(邮箱), 不含令牌
+	Request    Request        `json:"request"`
+	Response   string         `json:"response,omitempty"`
+	Usage      Usage          `json:"usage"`
+	Cache      string         `json:"cache,omitempty"`
+	Moderation []string       `json:"moderation,omitempty"` // 内容审核命中的记录
+	Redactions map[string]int `json:"redactions,omitempty"` // 发送到上游前各规则脱敏的不同原文数
+	Status     int            `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	LatencyMs  int64          `json:"latency_ms"`
+}
+
+// KeyID 返回接口密钥的稳定标识, 便于追溯调用方而不泄露密钥
+func KeyID(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// Options 审计日志配置
+type Options struct {
+	Dir      string
+	MaxBytes int64
+	MaxAge   time.Duration
+	MaxFiles int
+	Rules    []RedactRule
+}
+
+// Logger 以 JSONL 格式写入审计记录
+type Logger struct {
+	writer   *rotate.Writer
+	redactor atomic.Pointer[Redactor]
+}
+
+// NewLogger 创建审计日志, 文件按大小及日期轮转
+func NewLogger(options Options) (*Logger, error) {
+	redactor, err := NewRedactor(options.Rules)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := rotate.New(rotate.Options{
+		Dir:      options.Dir,
+		Name:     "audit.jsonl",
+		MaxBytes: options.MaxBytes,
+		Daily:    true,
+		MaxAge:   options.MaxAge,
+		MaxFiles: options.MaxFiles,
+	})
+	if err != nil {
+		return nil, err
+	}
+	l := &Logger{writer: writer}
+	l.redactor.Store(redactor)
+	return l, nil
+}
+
+// SetRules 替换脱敏规则
+func (l *Logger) SetRules(rules []RedactRule) error {
+	redactor, err := NewRedactor(rules)
+	if err != nil {
+		return err
+	}
+	l.redactor.Store(redactor)
+	return nil
+}
+
+// Write 脱敏后写入一条记录
+func (l *Logger) Write(record Record) error {
+	redactor := l.redactor.Load()
+	for i := range record.Request.Messages {
+		record.Request.Messages[i].Content = redactor.Redact(record.Request.Messages[i].Content)
+	}
+	record.Response = redactor.Redact(record.Response)
+	record.Error = redactor.Redact(record.Error)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = l.writer.Write(append(data, '\n'))
+	return err
+}
+
+// Close 关闭审计日志
+func (l *Logger) Close() error {
+	return l.writer.Close()
+}
@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactRule 脱敏规则, Pattern 为正则表达式, 匹配内容替换为 Replacement
+type RedactRule struct {
+	Name        string `yaml:"name" json:"name"`
+	Pattern     string `yaml:"pattern" json:"pattern"`
+	Replacement string `yaml:"replacement" json:"replacement"`
+}
+
+// BuiltinRules 内置脱敏规则, 按顺序应用(凭证需先于邮箱匹配)
+var BuiltinRules = []RedactRule{
+	{Name: "credential", Pattern: `[\w.+-]+@[\w-]+(?:\.[\w-]+)+:[A-Za-z0-9_=\-]{8,}`, Replacement: "[CREDENTIAL]"},
+	{Name: "atlassian_token", Pattern: `ATATT[A-Za-z0-9_=\-]{20,}`, Replacement: "[ATLASSIAN_TOKEN]"},
+	{Name: "bearer", Pattern: `(?i)\bbearer\s+[A-Za-z0-9._~+/=\-]+`, Replacement: "Bearer [REDACTED]"},
+	{Name: "api_key", Pattern: `\b(?:sk|pk|rk)-[A-Za-z0-9_\-]{16,}|\bAKIA[0-9A-Z]{16}\b|\bgh[pousr]_[A-Za-z0-9]{36,}`, Replacement: "[API_KEY]"},
+	{Name: "email", Pattern: `[\w.+-]+@[\w-]+(?:\.[\w-]+)+`, Replacement: "[EMAIL]"},
+	{Name: "card", Pattern: `\b(?:\d[ -]?){12,18}\d\b`, Replacement: "[CARD]"},
+	{Name: "phone", Pattern: `(?:\+?\d{1,3}[\s-]?)?\(?\d{3}\)?[\s-]?\d{3}[\s-]?\d{4}\b|\b1[3-9]\d{9}\b`, Replacement: "[PHONE]"},
+}
+
+// BuiltinRuleNames 返回所有内置规则名
+func BuiltinRuleNames() []string {
+	names := make([]string, 0, len(BuiltinRules))
+	for _, rule := range BuiltinRules {
+		names = append(names, rule.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveRules 按名称选择内置规则(保持内置顺序)并追加自定义规则
+func ResolveRules(builtin []string, custom []RedactRule) ([]RedactRule, error) {
+	enabled := make(map[string]bool)
+	for _, name := range builtin {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			for _, rule := range BuiltinRules {
+				enabled[rule.Name] = true
+			}
+			continue
+		}
+		if !isBuiltinRule(name) {
+			return nil, fmt.Errorf("unknown redact rule %q (available: all,%s)", name, strings.Join(BuiltinRuleNames(), ","))
+		}
+		enabled[name] = true
+	}
+	var rules []RedactRule
+	for _, rule := range BuiltinRules {
+		if enabled[rule.Name] {
+			rules = append(rules, rule)
+		}
+	}
+	return append(rules, custom...), nil
+}
+
+func isBuiltinRule(name string) bool {
+	for _, rule := range BuiltinRules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type compiledRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Redactor 按规则脱敏文本
+type Redactor struct {
+	rules []compiledRule
+}
+
+// NewRedactor 编译脱敏规则
+func NewRedactor(rules []RedactRule) (*Redactor, error) {
+	redactor := &Redactor{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %s: %v", rule.Name, err)
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		redactor.rules = append(redactor.rules, compiledRule{re: re, replacement: replacement})
+	}
+	return redactor, nil
+}
+
+// Redact 返回脱敏后的文本
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, rule := range r.rules {
+		s = rule.re.ReplaceAllLiteralString(s, rule.replacement)
+	}
+	return s
+}
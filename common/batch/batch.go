@@ -0,0 +1,528 @@
+// Package batch 兼容 OpenAI Batch API 的批量任务: 上传 JSONL 文件后创建批量任务, 由后台按顺序异步处理,
+// 结果写入输出文件及错误文件; 文件及处理进度保存在本地目录, 重启后继续处理
+package batch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 文件用途
+const (
+	PurposeBatch       = "batch"
+	PurposeBatchOutput = "batch_output"
+)
+
+// 批量任务状态
+const (
+	StatusValidating = "validating"
+	StatusFailed     = "failed"
+	StatusInProgress = "in_progress"
+	StatusFinalizing = "finalizing"
+	StatusCompleted  = "completed"
+	StatusExpired    = "expired"
+	StatusCancelling = "cancelling"
+	StatusCancelled  = "cancelled"
+)
+
+// CompletionWindow 支持的完成时间窗口
+const CompletionWindow = "24h"
+
+const (
+	completionWindow = 24 * time.Hour
+	maxMetadata      = 16
+	// 列表默认及最大返回数
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// File 上传的文件或批量任务的结果文件
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+// RequestCounts 批量任务中各状态的请求数
+type RequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// Errors 校验输入文件的错误
+type Errors struct {
+	Object string       `json:"object"`
+	Data   []ErrorEntry `json:"data"`
+}
+
+type ErrorEntry struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// Batch 批量任务, 未发生的时间及未生成的文件为 null
+type Batch struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Endpoint         string            `json:"endpoint"`
+	Errors           *Errors           `json:"errors"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           string            `json:"status"`
+	OutputFileID     *string           `json:"output_file_id"`
+	ErrorFileID      *string           `json:"error_file_id"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     *int64            `json:"in_progress_at"`
+	ExpiresAt        int64             `json:"expires_at"`
+	FinalizingAt     *int64            `json:"finalizing_at"`
+	CompletedAt      *int64            `json:"completed_at"`
+	FailedAt         *int64            `json:"failed_at"`
+	ExpiredAt        *int64            `json:"expired_at"`
+	CancellingAt     *int64            `json:"cancelling_at"`
+	CancelledAt      *int64            `json:"cancelled_at"`
+	RequestCounts    RequestCounts     `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+func (b *Batch) active() bool {
+	switch b.Status {
+	case StatusValidating, StatusInProgress, StatusFinalizing, StatusCancelling:
+		return true
+	}
+	return false
+}
+
+// Request 输入文件中的一行
+type Request struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// Response 一个请求的响应
+type Response struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// Result 输出文件及错误文件中的一行
+type Result struct {
+	ID       string       `json:"id"`
+	CustomID string       `json:"custom_id"`
+	Response *Response    `json:"response"`
+	Error    *ResultError `json:"error"`
+}
+
+type ResultError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Executor 执行一个请求, owner 为创建批量任务的 API-KEY 标识; 返回错误表示请求未能完成
+type Executor func(ctx context.Context, owner string, req Request) (Response, error)
+
+// Options 批量任务配置
+type Options struct {
+	Dir          string   // 保存文件及进度的目录
+	Concurrency  int      // 同时执行的请求数
+	MaxFileBytes int64    // 上传文件的大小上限
+	MaxRequests  int      // 每个批量任务的请求数上限
+	Endpoints    []string // 支持的接口, 如 /v1/chat/completions
+	Execute      Executor
+	Idle         func() bool     // 是否有空闲的处理能力, 为 false 时暂停派发请求; 为 nil 时不等待
+	OnError      func(err error) // 读写文件出错时调用
+}
+
+// ErrNotFound 文件或批量任务不存在, 或不属于调用方
+var ErrNotFound = errors.New("not found")
+
+// InvalidError 请求参数错误
+type InvalidError struct {
+	Param   string
+	Message string
+}
+
+func (e *InvalidError) Error() string {
+	return e.Param + ": " + e.Message
+}
+
+func invalid(param, format string, args ...any) error {
+	return &InvalidError{Param: param, Message: fmt.Sprintf(format, args...)}
+}
+
+// 保存在磁盘上的文件信息
+type fileRecord struct {
+	File
+	Owner string `json:"owner,omitempty"`
+}
+
+// 保存在磁盘上的批量任务及进度
+type batchRecord struct {
+	Batch
+	Owner    string   `json:"owner,omitempty"`
+	Progress progress `json:"progress"`
+}
+
+// progress 已处理到的位置, 重启后从该位置继续; 结果文件中超出记录长度的内容在继续前截断
+type progress struct {
+	Offset       int64  `json:"offset"` // 输入文件中下一行的位置
+	OutputFileID string `json:"output_file_id"`
+	ErrorFileID  string `json:"error_file_id"`
+	OutputBytes  int64  `json:"output_bytes"`
+	ErrorBytes   int64  `json:"error_bytes"`
+}
+
+// Manager 管理文件及批量任务, 并在后台处理批量任务
+type Manager struct {
+	options Options
+
+	mutex   sync.Mutex
+	files   map[string]*fileRecord
+	batches map[string]*batchRecord
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Open 读取目录中的文件及批量任务, 并开始处理未完成的批量任务
+func Open(options Options) (*Manager, error) {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	for _, sub := range []string{filesDir, batchesDir} {
+		if err := os.MkdirAll(filepath.Join(options.Dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	m := &Manager{
+		options: options,
+		files:   make(map[string]*fileRecord),
+		batches: make(map[string]*batchRecord),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	go m.run()
+	return m, nil
+}
+
+// Close 停止处理, 进行中的请求被取消, 其结果不保存, 重启后重新执行; ctx 结束时不再等待
+func (m *Manager) Close(ctx context.Context) error {
+	m.cancel()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func (m *Manager) reportError(err error) {
+	if err != nil && m.options.OnError != nil {
+		m.options.OnError(err)
+	}
+}
+
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// CreateFile 保存上传的文件, 目前只支持 batch 用途
+func (m *Manager) CreateFile(owner, filename, purpose string, r io.Reader) (File, error) {
+	if purpose != PurposeBatch {
+		return File{}, invalid("purpose", "unsupported purpose %q, expected %q", purpose, PurposeBatch)
+	}
+	id := newID("file-")
+	path := m.contentPath(id)
+	f, err := os.Create(path)
+	if err != nil {
+		return File{}, err
+	}
+	var limited io.Reader = r
+	if m.options.MaxFileBytes > 0 {
+		limited = io.LimitReader(r, m.options.MaxFileBytes+1)
+	}
+	n, err := io.Copy(f, limited)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && m.options.MaxFileBytes > 0 && n > m.options.MaxFileBytes {
+		err = invalid("file", "file exceeds the maximum size of %d bytes", m.options.MaxFileBytes)
+	}
+	if err != nil {
+		os.Remove(path)
+		return File{}, err
+	}
+
+	record := &fileRecord{
+		File: File{
+			ID:        id,
+			Object:    "file",
+			Bytes:     n,
+			CreatedAt: time.Now().Unix(),
+			Filename:  filepath.Base(filename),
+			Purpose:   purpose,
+		},
+		Owner: owner,
+	}
+	if err := m.saveFile(record); err != nil {
+		os.Remove(path)
+		return File{}, err
+	}
+	m.mutex.Lock()
+	m.files[id] = record
+	m.mutex.Unlock()
+	return record.File, nil
+}
+
+func (m *Manager) ownedFile(owner, id string) (*fileRecord, error) {
+	record, ok := m.files[id]
+	if !ok || record.Owner != owner {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// GetFile 返回文件信息
+func (m *Manager) GetFile(owner, id string) (File, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record, err := m.ownedFile(owner, id)
+	if err != nil {
+		return File{}, err
+	}
+	return record.File, nil
+}
+
+// ListFiles 按创建时间倒序返回文件, purpose 为空时返回所有用途的文件
+func (m *Manager) ListFiles(owner, purpose string) []File {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	files := make([]File, 0)
+	for _, record := range m.files {
+		if record.Owner == owner && (purpose == "" || record.Purpose == purpose) {
+			files = append(files, record.File)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].CreatedAt != files[j].CreatedAt {
+			return files[i].CreatedAt > files[j].CreatedAt
+		}
+		return files[i].ID > files[j].ID
+	})
+	return files
+}
+
+// OpenFile 打开文件内容, 调用方负责关闭
+func (m *Manager) OpenFile(owner, id string) (*os.File, File, error) {
+	m.mutex.Lock()
+	record, err := m.ownedFile(owner, id)
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, File{}, err
+	}
+	f, err := os.Open(m.contentPath(id))
+	if err != nil {
+		return nil, File{}, err
+	}
+	return f, record.File, nil
+}
+
+// DeleteFile 删除文件, 正在处理的批量任务使用的输入文件不能删除
+func (m *Manager) DeleteFile(owner, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.ownedFile(owner, id); err != nil {
+		return err
+	}
+	for _, record := range m.batches {
+		if record.InputFileID == id && record.active() {
+			return invalid("file_id", "file %s is used by batch %s, which is still %s", id, record.ID, record.Status)
+		}
+	}
+	delete(m.files, id)
+	if err := os.Remove(m.metaPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(m.contentPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CreateBatch 创建批量任务, 输入文件在后台校验
+func (m *Manager) CreateBatch(owner, inputFileID, endpoint, window string, metadata map[string]string) (Batch, error) {
+	if !slices.Contains(m.options.Endpoints, endpoint) {
+		return Batch{}, invalid("endpoint", "unsupported endpoint %q, expected one of %s", endpoint, strings.Join(m.options.Endpoints, ", "))
+	}
+	if window != CompletionWindow {
+		return Batch{}, invalid("completion_window", "unsupported completion window %q, expected %q", window, CompletionWindow)
+	}
+	if len(metadata) > maxMetadata {
+		return Batch{}, invalid("metadata", "at most %d pairs are allowed", maxMetadata)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	input, err := m.ownedFile(owner, inputFileID)
+	if err != nil {
+		return Batch{}, invalid("input_file_id", "no such file: %s", inputFileID)
+	}
+	if input.Purpose != PurposeBatch {
+		return Batch{}, invalid("input_file_id", "file %s has purpose %q, expected %q", inputFileID, input.Purpose, PurposeBatch)
+	}
+	now := time.Now()
+	record := &batchRecord{
+		Batch: Batch{
+			ID:               newID("batch_"),
+			Object:           "batch",
+			Endpoint:         endpoint,
+			InputFileID:      inputFileID,
+			CompletionWindow: window,
+			Status:           StatusValidating,
+			CreatedAt:        now.Unix(),
+			ExpiresAt:        now.Add(completionWindow).Unix(),
+			Metadata:         metadata,
+		},
+		Owner: owner,
+		Progress: progress{
+			OutputFileID: newID("file-"),
+			ErrorFileID:  newID("file-"),
+		},
+	}
+	if err := m.saveBatch(record); err != nil {
+		return Batch{}, err
+	}
+	m.batches[record.ID] = record
+	m.notify()
+	return record.Batch, nil
+}
+
+func (m *Manager) ownedBatch(owner, id string) (*batchRecord, error) {
+	record, ok := m.batches[id]
+	if !ok || record.Owner != owner {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// GetBatch 返回批量任务
+func (m *Manager) GetBatch(owner, id string) (Batch, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record, err := m.ownedBatch(owner, id)
+	if err != nil {
+		return Batch{}, err
+	}
+	return record.Batch, nil
+}
+
+// ListBatches 按创建时间倒序返回 after 之后的最多 limit 个批量任务, 及之后是否还有
+func (m *Manager) ListBatches(owner, after string, limit int) ([]Batch, bool) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	limit = min(limit, MaxListLimit)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	records := make([]*batchRecord, 0)
+	for _, record := range m.batches {
+		if record.Owner == owner {
+			records = append(records, record)
+		}
+	}
+	sortBatches(records)
+	slices.Reverse(records)
+	start := 0
+	if after != "" {
+		for i, record := range records {
+			if record.ID == after {
+				start = i + 1
+				break
+			}
+		}
+	}
+	records = records[start:]
+	hasMore := len(records) > limit
+	if hasMore {
+		records = records[:limit]
+	}
+	batches := make([]Batch, len(records))
+	for i, record := range records {
+		batches[i] = record.Batch
+	}
+	return batches, hasMore
+}
+
+// CancelBatch 取消批量任务, 进行中的请求完成后以已完成的结果结束
+func (m *Manager) CancelBatch(owner, id string) (Batch, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record, err := m.ownedBatch(owner, id)
+	if err != nil {
+		return Batch{}, err
+	}
+	switch record.Status {
+	case StatusValidating, StatusInProgress:
+	case StatusCancelling:
+		return record.Batch, nil
+	default:
+		return Batch{}, invalid("batch_id", "cannot cancel batch with status %s", record.Status)
+	}
+	record.Status = StatusCancelling
+	record.CancellingAt = timestamp(time.Now())
+	if err := m.saveBatch(record); err != nil {
+		return Batch{}, err
+	}
+	m.notify()
+	return record.Batch, nil
+}
+
+func timestamp(t time.Time) *int64 {
+	unix := t.Unix()
+	return &unix
+}
+
+// 按创建时间排序, 先创建的先处理
+func sortBatches(records []*batchRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CreatedAt != records[j].CreatedAt {
+			return records[i].CreatedAt < records[j].CreatedAt
+		}
+		return records[i].ID < records[j].ID
+	})
+}
@@ -0,0 +1,102 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 目录结构: files/<id>.jsonl 为文件内容, files/<id>.json 为文件信息; batches/<id>.json 为批量任务及进度.
+// 批量任务的结果文件在处理过程中只有内容, 结束时写入文件信息
+const (
+	filesDir   = "files"
+	batchesDir = "batches"
+)
+
+func (m *Manager) contentPath(id string) string {
+	return filepath.Join(m.options.Dir, filesDir, id+".jsonl")
+}
+
+func (m *Manager) metaPath(id string) string {
+	return filepath.Join(m.options.Dir, filesDir, id+".json")
+}
+
+func (m *Manager) batchPath(id string) string {
+	return filepath.Join(m.options.Dir, batchesDir, id+".json")
+}
+
+// writeJSON 先写入临时文件再替换, 避免中断时留下不完整的文件
+func writeJSON(path string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (m *Manager) saveFile(record *fileRecord) error {
+	return writeJSON(m.metaPath(record.ID), record)
+}
+
+func (m *Manager) saveBatch(record *batchRecord) error {
+	return writeJSON(m.batchPath(record.ID), record)
+}
+
+// load 读取保存的文件及批量任务, 无法解析的跳过并报告
+func (m *Manager) load() error {
+	entries, err := os.ReadDir(filepath.Join(m.options.Dir, filesDir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		var record fileRecord
+		if err := readJSON(filepath.Join(m.options.Dir, filesDir, name), &record); err != nil {
+			m.reportError(err)
+			continue
+		}
+		if _, err := os.Stat(m.contentPath(record.ID)); err != nil {
+			m.reportError(fmt.Errorf("file %s: %v", record.ID, err))
+			continue
+		}
+		m.files[record.ID] = &record
+	}
+
+	entries, err = os.ReadDir(filepath.Join(m.options.Dir, batchesDir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		var record batchRecord
+		if err := readJSON(filepath.Join(m.options.Dir, batchesDir, name), &record); err != nil {
+			m.reportError(err)
+			continue
+		}
+		m.batches[record.ID] = &record
+	}
+	return nil
+}
+
+func readJSON(path string, value any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,499 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	maxValidationErrors = 100
+	maxAttempts         = 3 // 每个请求的最多执行次数, 429 及 5xx 时重试
+	retryBackoff        = 2 * time.Second
+	idlePoll            = time.Second
+)
+
+// run 按创建顺序逐个处理批量任务
+func (m *Manager) run() {
+	defer close(m.done)
+	for {
+		record := m.next()
+		if record == nil {
+			select {
+			case <-m.wake:
+				continue
+			case <-m.ctx.Done():
+				return
+			}
+		}
+		if err := m.process(record); err != nil {
+			if m.ctx.Err() != nil {
+				return
+			}
+			m.reportError(fmt.Errorf("batch %s: %v", record.ID, err))
+			m.reportError(m.update(record, func(r *batchRecord) {
+				r.Status = StatusFailed
+				r.FailedAt = timestamp(time.Now())
+				r.Errors = &Errors{Object: "list", Data: []ErrorEntry{{Code: "internal_error", Message: err.Error()}}}
+			}))
+		}
+	}
+}
+
+// next 最早创建的未结束的批量任务
+func (m *Manager) next() *batchRecord {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var active []*batchRecord
+	for _, record := range m.batches {
+		if record.active() {
+			active = append(active, record)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	sortBatches(active)
+	return active[0]
+}
+
+func (m *Manager) status(record *batchRecord) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return record.Status
+}
+
+// update 修改批量任务并保存
+func (m *Manager) update(record *batchRecord, change func(r *batchRecord)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	change(record)
+	return m.saveBatch(record)
+}
+
+func (m *Manager) process(record *batchRecord) error {
+	switch m.status(record) {
+	case StatusValidating:
+		return m.validate(record)
+	case StatusInProgress:
+		return m.processRequests(record)
+	case StatusFinalizing:
+		return m.finalize(record, StatusCompleted)
+	case StatusCancelling:
+		return m.finalize(record, StatusCancelled)
+	}
+	return nil
+}
+
+// validate 校验输入文件的每一行, 有错误时批量任务失败, 否则开始处理
+func (m *Manager) validate(record *batchRecord) error {
+	f, err := os.Open(m.contentPath(record.InputFileID))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var errs []ErrorEntry
+	addErr := func(line int, code, param, format string, args ...any) {
+		if len(errs) < maxValidationErrors {
+			errs = append(errs, ErrorEntry{Code: code, Param: param, Line: line, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+	customIDs := make(map[string]bool)
+	reader := bufio.NewReader(f)
+	total := 0
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			total++
+			var req Request
+			var body map[string]any
+			switch {
+			case json.Unmarshal(data, &req) != nil:
+				addErr(line, "invalid_json_line", "", "line %d is not a valid JSON object", line)
+			case req.CustomID == "":
+				addErr(line, "missing_required_parameter", "custom_id", "custom_id is required")
+			case customIDs[req.CustomID]:
+				addErr(line, "duplicate_custom_id", "custom_id", "custom_id %q is duplicated", req.CustomID)
+			case req.Method != http.MethodPost:
+				addErr(line, "invalid_method", "method", "method must be POST, got %q", req.Method)
+			case req.URL != record.Endpoint:
+				addErr(line, "mismatched_endpoint", "url", "url %q does not match the batch endpoint %s", req.URL, record.Endpoint)
+			case json.Unmarshal(req.Body, &body) != nil || body == nil:
+				addErr(line, "invalid_body", "body", "body must be a JSON object")
+			}
+			customIDs[req.CustomID] = true
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if line%1000 == 0 && m.ctx.Err() != nil {
+			return m.ctx.Err()
+		}
+	}
+	switch {
+	case total == 0:
+		addErr(0, "empty_file", "input_file_id", "the input file contains no requests")
+	case m.options.MaxRequests > 0 && total > m.options.MaxRequests:
+		addErr(0, "too_many_requests", "input_file_id", "the input file contains %d requests, the maximum is %d", total, m.options.MaxRequests)
+	}
+
+	err = m.update(record, func(r *batchRecord) {
+		r.RequestCounts.Total = total
+		if len(errs) > 0 {
+			r.Errors = &Errors{Object: "list", Data: errs}
+		}
+		if r.Status != StatusValidating {
+			// 校验过程中被取消
+			return
+		}
+		if len(errs) > 0 {
+			r.Status, r.FailedAt = StatusFailed, timestamp(time.Now())
+		} else {
+			r.Status, r.InProgressAt = StatusInProgress, timestamp(time.Now())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 && m.status(record) == StatusCancelling {
+		return m.update(record, func(r *batchRecord) {
+			r.Status, r.CancelledAt = StatusCancelled, timestamp(time.Now())
+		})
+	}
+	return nil
+}
+
+// resultFile 打开结果文件并截断到已记录的长度, 去掉上次中断时未记录进度的结果
+func (m *Manager) resultFile(id string, size int64) (*os.File, error) {
+	f, err := os.OpenFile(m.contentPath(id), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// processRequests 从记录的位置继续, 每次并发执行 Concurrency 个请求, 全部完成后写入结果并保存进度
+func (m *Manager) processRequests(record *batchRecord) error {
+	m.mutex.Lock()
+	owner, p, expiresAt := record.Owner, record.Progress, record.ExpiresAt
+	inputPath := m.contentPath(record.InputFileID)
+	m.mutex.Unlock()
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	if _, err := input.Seek(p.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	output, err := m.resultFile(p.OutputFileID, p.OutputBytes)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	errorFile, err := m.resultFile(p.ErrorFileID, p.ErrorBytes)
+	if err != nil {
+		return err
+	}
+	defer errorFile.Close()
+
+	reader := bufio.NewReader(input)
+	for {
+		if m.status(record) == StatusCancelling {
+			return m.finalize(record, StatusCancelled)
+		}
+		if time.Now().Unix() >= expiresAt {
+			return m.expire(record, reader, p, errorFile)
+		}
+
+		var window [][]byte
+		offset := p.Offset
+		for len(window) < m.options.Concurrency {
+			data, readErr := reader.ReadBytes('\n')
+			if readErr != nil && readErr != io.EOF {
+				return readErr
+			}
+			offset += int64(len(data))
+			if data = bytes.TrimSpace(data); len(data) > 0 {
+				window = append(window, data)
+			}
+			if readErr == io.EOF {
+				break
+			}
+		}
+		if len(window) == 0 {
+			err := m.update(record, func(r *batchRecord) {
+				if r.Status == StatusInProgress {
+					r.Status, r.FinalizingAt = StatusFinalizing, timestamp(time.Now())
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return m.process(record)
+		}
+
+		results := m.executeWindow(owner, window)
+		if m.ctx.Err() != nil {
+			// 本次未保存进度, 重启后重新执行
+			return m.ctx.Err()
+		}
+		completed, failed := 0, 0
+		for _, result := range results {
+			line, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			line = append(line, '\n')
+			if result.Error == nil {
+				_, err = output.Write(line)
+				p.OutputBytes += int64(len(line))
+				completed++
+			} else {
+				_, err = errorFile.Write(line)
+				p.ErrorBytes += int64(len(line))
+				failed++
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := errors.Join(output.Sync(), errorFile.Sync()); err != nil {
+			return err
+		}
+		p.Offset = offset
+		err := m.update(record, func(r *batchRecord) {
+			r.Progress = p
+			r.RequestCounts.Completed += completed
+			r.RequestCounts.Failed += failed
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// expire 超出完成时间窗口, 未执行的请求以 batch_expired 写入错误文件
+func (m *Manager) expire(record *batchRecord, reader *bufio.Reader, p progress, errorFile *os.File) error {
+	failed := 0
+	for {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		p.Offset += int64(len(data))
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			var req Request
+			_ = json.Unmarshal(data, &req)
+			line, err := json.Marshal(Result{
+				ID:       newID("batch_req_"),
+				CustomID: req.CustomID,
+				Error:    &ResultError{Code: "batch_expired", Message: "This request could not be executed before the completion window expired."},
+			})
+			if err != nil {
+				return err
+			}
+			line = append(line, '\n')
+			if _, err := errorFile.Write(line); err != nil {
+				return err
+			}
+			p.ErrorBytes += int64(len(line))
+			failed++
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if err := errorFile.Sync(); err != nil {
+		return err
+	}
+	err := m.update(record, func(r *batchRecord) {
+		r.Progress = p
+		r.RequestCounts.Failed += failed
+	})
+	if err != nil {
+		return err
+	}
+	return m.finalize(record, StatusExpired)
+}
+
+// finalize 为非空的结果文件写入文件信息并结束批量任务
+func (m *Manager) finalize(record *batchRecord, status string) error {
+	m.mutex.Lock()
+	owner, batchID, p := record.Owner, record.ID, record.Progress
+	m.mutex.Unlock()
+
+	now := time.Now()
+	var outputFileID, errorFileID *string
+	for _, result := range []struct {
+		id     string
+		suffix string
+		target **string
+	}{
+		{p.OutputFileID, "output", &outputFileID},
+		{p.ErrorFileID, "error", &errorFileID},
+	} {
+		stat, err := os.Stat(m.contentPath(result.id))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if stat.Size() == 0 {
+			os.Remove(m.contentPath(result.id))
+			continue
+		}
+		file := &fileRecord{
+			File: File{
+				ID:        result.id,
+				Object:    "file",
+				Bytes:     stat.Size(),
+				CreatedAt: now.Unix(),
+				Filename:  batchID + "_" + result.suffix + ".jsonl",
+				Purpose:   PurposeBatchOutput,
+			},
+			Owner: owner,
+		}
+		if err := m.saveFile(file); err != nil {
+			return err
+		}
+		m.mutex.Lock()
+		m.files[file.ID] = file
+		m.mutex.Unlock()
+		id := result.id
+		*result.target = &id
+	}
+
+	return m.update(record, func(r *batchRecord) {
+		r.Status = status
+		r.OutputFileID, r.ErrorFileID = outputFileID, errorFileID
+		switch status {
+		case StatusCompleted:
+			r.CompletedAt = timestamp(now)
+		case StatusCancelled:
+			r.CancelledAt = timestamp(now)
+		case StatusExpired:
+			r.ExpiredAt = timestamp(now)
+		}
+	})
+}
+
+// executeWindow 并发执行一组请求, 按输入顺序返回结果
+func (m *Manager) executeWindow(owner string, window [][]byte) []Result {
+	results := make([]Result, len(window))
+	var wg sync.WaitGroup
+	for i, data := range window {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = m.execute(owner, data)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// waitIdle 等待有空闲的处理能力
+func (m *Manager) waitIdle() error {
+	for m.options.Idle != nil && !m.options.Idle() {
+		select {
+		case <-time.After(idlePoll):
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		}
+	}
+	return m.ctx.Err()
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// execute 执行一个请求, 429 及 5xx 时退避重试
+func (m *Manager) execute(owner string, data []byte) Result {
+	result := Result{ID: newID("batch_req_")}
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		result.Error = &ResultError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+	result.CustomID = req.CustomID
+
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		if err := m.waitIdle(); err != nil {
+			result.Error = &ResultError{Code: "cancelled", Message: err.Error()}
+			return result
+		}
+		resp, err := m.options.Execute(m.ctx, owner, req)
+		if err == nil && (!retryable(resp.StatusCode) || attempt >= maxAttempts) {
+			result.Response = &resp
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				result.Error = responseError(resp)
+			}
+			return result
+		}
+		if err != nil && attempt >= maxAttempts {
+			result.Error = &ResultError{Code: "request_failed", Message: err.Error()}
+			return result
+		}
+		select {
+		case <-time.After(backoff):
+		case <-m.ctx.Done():
+		}
+		backoff *= 2
+	}
+}
+
+// responseError 从错误响应中取出错误信息, 兼容 {"error": {...}} 及 {"error": "..."}
+func responseError(resp Response) *ResultError {
+	result := &ResultError{Code: fmt.Sprintf("http_%d", resp.StatusCode), Message: http.StatusText(resp.StatusCode)}
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(resp.Body, &body) != nil || len(body.Error) == 0 {
+		return result
+	}
+	var detail struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	var message string
+	switch {
+	case json.Unmarshal(body.Error, &detail) == nil:
+		if detail.Code != "" {
+			result.Code = detail.Code
+		}
+		if detail.Message != "" {
+			result.Message = detail.Message
+		}
+	case json.Unmarshal(body.Error, &message) == nil && message != "":
+		result.Message = message
+	}
+	return result
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry 缓存条目
+type Entry struct {
+	Value     []byte
+	StoredAt  time.Time
+	ExpiresAt time.Time
+}
+
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// Options 缓存大小限制, 0 表示不限制
+type Options struct {
+	MaxEntries   int
+	MaxBytes     int64
+	Dir          string // 磁盘缓存目录, 为空时只使用内存
+	DiskMaxBytes int64
+}
+
+// Stats 缓存命中统计
+type Stats struct {
+	Hits       int64 `json:"hits"`
+	MemoryHits int64 `json:"memory_hits"`
+	DiskHits   int64 `json:"disk_hits"`
+	Misses     int64 `json:"misses"`
+	Stores     int64 `json:"stores"`
+	Evictions  int64 `json:"evictions"`
+	Entries    int   `json:"entries"`
+	Bytes      int64 `json:"bytes"`
+	DiskFiles  int   `json:"disk_files"`
+	DiskBytes  int64 `json:"disk_bytes"`
+}
+
+// Cache 内存 LRU 缓存, 配置 Dir 时未命中内存的请求会继续查找磁盘缓存
+type Cache struct {
+	mu      sync.Mutex
+	options Options
+	items   map[string]*list.Element
+	order   *list.List // 最近使用的在前
+	bytes   int64
+	disk    *diskStore
+
+	hits, memoryHits, diskHits, misses, stores, evictions atomic.Int64
+}
+
+type lruItem struct {
+	key   string
+	entry Entry
+}
+
+// New 创建缓存, Dir 不可用时返回错误
+func New(options Options) (*Cache, error) {
+	c := &Cache{
+		options: options,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+	if options.Dir != "" {
+		disk, err := newDiskStore(options.Dir, options.DiskMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		c.disk = disk
+	}
+	return c, nil
+}
+
+// Key 对任意可序列化的值计算稳定的哈希, map 的键会按字典序序列化
+func Key(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get 查找缓存, 返回条目及来源(memory/disk)
+func (c *Cache) Get(key string) (Entry, string, bool) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		item := elem.Value.(*lruItem)
+		if !item.entry.expired(now) {
+			c.order.MoveToFront(elem)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			c.memoryHits.Add(1)
+			return item.entry, "memory", true
+		}
+		c.removeElement(elem)
+	}
+	c.mu.Unlock()
+
+	if c.disk != nil {
+		if entry, ok := c.disk.get(key, now); ok {
+			// 提升到内存中
+			c.setMemory(key, entry)
+			c.hits.Add(1)
+			c.diskHits.Add(1)
+			return entry, "disk", true
+		}
+	}
+	c.misses.Add(1)
+	return Entry{}, "", false
+}
+
+// Set 写入缓存, ttl <= 0 表示不过期
+func (c *Cache) Set(key string, value []byte, ttl time.Duration) {
+	entry := Entry{Value: value, StoredAt: time.Now()}
+	if ttl > 0 {
+		entry.ExpiresAt = entry.StoredAt.Add(ttl)
+	}
+	c.setMemory(key, entry)
+	if c.disk != nil {
+		c.disk.set(key, entry)
+	}
+	c.stores.Add(1)
+}
+
+func (c *Cache) setMemory(key string, entry Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.options.MaxBytes > 0 && int64(len(entry.Value)) > c.options.MaxBytes {
+		return
+	}
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	c.items[key] = c.order.PushFront(&lruItem{key: key, entry: entry})
+	c.bytes += int64(len(entry.Value))
+
+	for (c.options.MaxEntries > 0 && c.order.Len() > c.options.MaxEntries) ||
+		(c.options.MaxBytes > 0 && c.bytes > c.options.MaxBytes) {
+		c.removeElement(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *Cache) removeElement(elem *list.Element) {
+	item := c.order.Remove(elem).(*lruItem)
+	delete(c.items, item.key)
+	c.bytes -= int64(len(item.entry.Value))
+}
+
+// Delete 删除指定缓存
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	c.mu.Unlock()
+	if c.disk != nil {
+		c.disk.delete(key)
+	}
+}
+
+// Purge 清空所有缓存
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+	c.bytes = 0
+	c.mu.Unlock()
+	if c.disk != nil {
+		c.disk.purge()
+	}
+}
+
+// Stats 返回缓存统计
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	stats := Stats{Entries: c.order.Len(), Bytes: c.bytes}
+	c.mu.Unlock()
+	stats.Hits = c.hits.Load()
+	stats.MemoryHits = c.memoryHits.Load()
+	stats.DiskHits = c.diskHits.Load()
+	stats.Misses = c.misses.Load()
+	stats.Stores = c.stores.Load()
+	stats.Evictions = c.evictions.Load()
+	if c.disk != nil {
+		stats.DiskFiles, stats.DiskBytes = c.disk.usage()
+	}
+	return stats
+}
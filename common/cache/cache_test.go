@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, options Options) *Cache {
+	t.Helper()
+	c, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// get 返回缓存的值, 未命中时返回空字符串
+func get(c *Cache, key string) string {
+	entry, _, ok := c.Get(key)
+	if !ok {
+		return ""
+	}
+	return string(entry.Value)
+}
+
+func TestKeyIgnoresMapOrder(t *testing.T) {
+	a, err := Key(map[string]interface{}{"model": "m", "messages": []string{"hi"}, "temperature": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Key(map[string]interface{}{"temperature": 0, "messages": []string{"hi"}, "model": "m"})
+	c, _ := Key(map[string]interface{}{"temperature": 0, "messages": []string{"hello"}, "model": "m"})
+	if a != b {
+		t.Fatalf("keys differ for the same map: %s, %s", a, b)
+	}
+	if a == c {
+		t.Fatal("different messages produced the same key")
+	}
+}
+
+// 超出条目数时淘汰最久未使用的条目
+func TestCacheEvictsLeastRecentlyUsedEntry(t *testing.T) {
+	c := newTestCache(t, Options{MaxEntries: 2})
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+	if get(c, "a") != "1" {
+		t.Fatal("a missing")
+	}
+	c.Set("c", []byte("3"), 0)
+
+	if get(c, "b") != "" {
+		t.Fatal("b was not evicted")
+	}
+	if get(c, "a") != "1" || get(c, "c") != "3" {
+		t.Fatal("recently used entries were evicted")
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Fatalf("stats = %+v, want 2 entries and 1 eviction", stats)
+	}
+}
+
+// 超出字节数时淘汰, 单个条目超过上限时不写入内存
+func TestCacheEvictsByBytes(t *testing.T) {
+	c := newTestCache(t, Options{MaxBytes: 10})
+	c.Set("a", []byte("aaaa"), 0)
+	c.Set("b", []byte("bbbb"), 0)
+	c.Set("c", []byte("cccc"), 0)
+	if get(c, "a") != "" {
+		t.Fatal("a was not evicted")
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Bytes != 8 {
+		t.Fatalf("stats = %+v, want 2 entries of 8 bytes", stats)
+	}
+
+	c.Set("large", []byte("0123456789x"), 0)
+	if get(c, "large") != "" {
+		t.Fatal("entry larger than MaxBytes was stored")
+	}
+	if get(c, "b") != "bbbb" || get(c, "c") != "cccc" {
+		t.Fatal("an oversized entry evicted existing entries")
+	}
+}
+
+// 覆盖写入时按新值计算大小
+func TestCacheReplaceUpdatesBytes(t *testing.T) {
+	c := newTestCache(t, Options{})
+	c.Set("a", []byte("aaaa"), 0)
+	c.Set("a", []byte("aa"), 0)
+	if stats := c.Stats(); stats.Entries != 1 || stats.Bytes != 2 {
+		t.Fatalf("stats = %+v, want 1 entry of 2 bytes", stats)
+	}
+	if get(c, "a") != "aa" {
+		t.Fatal("value was not replaced")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := newTestCache(t, Options{})
+	c.Set("short", []byte("1"), 20*time.Millisecond)
+	c.Set("forever", []byte("2"), 0)
+	if get(c, "short") != "1" {
+		t.Fatal("entry expired early")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if get(c, "short") != "" {
+		t.Fatal("expired entry was returned")
+	}
+	if get(c, "forever") != "2" {
+		t.Fatal("entry without ttl expired")
+	}
+	if stats := c.Stats(); stats.Entries != 1 || stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("stats = %+v, want 1 entry, 2 hits and 1 miss", stats)
+	}
+}
+
+func TestCacheDeleteAndPurge(t *testing.T) {
+	c := newTestCache(t, Options{})
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+	c.Delete("a")
+	if get(c, "a") != "" || get(c, "b") != "2" {
+		t.Fatal("Delete removed the wrong entry")
+	}
+	c.Purge()
+	if get(c, "b") != "" {
+		t.Fatal("Purge kept an entry")
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Fatalf("stats = %+v after Purge", stats)
+	}
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskStore 将每个条目保存为 dir/<key前两位>/<key>.json
+type diskStore struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+}
+
+type diskEntry struct {
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Value     []byte    `json:"value"`
+}
+
+func newDiskStore(dir string, maxBytes int64) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &diskStore{dir: dir, maxBytes: maxBytes}, nil
+}
+
+func (d *diskStore) path(key string) string {
+	return filepath.Join(d.dir, key[:2], key+".json")
+}
+
+func (d *diskStore) get(key string, now time.Time) (Entry, bool) {
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return Entry{}, false
+	}
+	var stored diskEntry
+	if err := json.Unmarshal(data, &stored); err != nil {
+		_ = os.Remove(d.path(key))
+		return Entry{}, false
+	}
+	entry := Entry{Value: stored.Value, StoredAt: stored.StoredAt, ExpiresAt: stored.ExpiresAt}
+	if entry.expired(now) {
+		_ = os.Remove(d.path(key))
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+func (d *diskStore) set(key string, entry Entry) {
+	data, err := json.Marshal(diskEntry{StoredAt: entry.StoredAt, ExpiresAt: entry.ExpiresAt, Value: entry.Value})
+	if err != nil {
+		return
+	}
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	// 先写临时文件再重命名, 避免读到写了一半的条目
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+	if d.maxBytes > 0 {
+		d.trim()
+	}
+}
+
+func (d *diskStore) delete(key string) {
+	_ = os.Remove(d.path(key))
+}
+
+func (d *diskStore) purge() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, file := range d.files() {
+		_ = os.Remove(file.path)
+	}
+}
+
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (d *diskStore) files() []diskFile {
+	var files []diskFile
+	_ = filepath.WalkDir(d.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, diskFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return files
+}
+
+func (d *diskStore) usage() (int, int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var total int64
+	files := d.files()
+	for _, file := range files {
+		total += file.size
+	}
+	return len(files), total
+}
+
+// trim 超出大小限制时按写入时间删除最旧的条目
+func (d *diskStore) trim() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files := d.files()
+	var total int64
+	for _, file := range files {
+		total += file.size
+	}
+	if total <= d.maxBytes {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, file := range files {
+		if total <= d.maxBytes {
+			break
+		}
+		if os.Remove(file.path) == nil {
+			total -= file.size
+		}
+	}
+}
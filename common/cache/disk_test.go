@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 重启后从磁盘读取缓存, 并提升到内存
+func TestDiskReload(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCache(t, Options{Dir: dir})
+	c.Set("aa01", []byte("stored"), time.Hour)
+
+	reopened := newTestCache(t, Options{Dir: dir})
+	entry, source, ok := reopened.Get("aa01")
+	if !ok || string(entry.Value) != "stored" || source != "disk" {
+		t.Fatalf("Get = %q, %s, %v, want stored from disk", entry.Value, source, ok)
+	}
+	if _, source, _ := reopened.Get("aa01"); source != "memory" {
+		t.Fatalf("second Get source = %s, want memory", source)
+	}
+	if stats := reopened.Stats(); stats.DiskHits != 1 || stats.MemoryHits != 1 || stats.DiskFiles != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+// 内存中被淘汰的条目仍可从磁盘读取
+func TestDiskServesEvictedEntries(t *testing.T) {
+	c := newTestCache(t, Options{MaxEntries: 1, Dir: t.TempDir()})
+	c.Set("aa01", []byte("1"), 0)
+	c.Set("aa02", []byte("2"), 0)
+	if _, source, ok := c.Get("aa01"); !ok || source != "disk" {
+		t.Fatalf("Get = %s, %v, want a disk hit", source, ok)
+	}
+}
+
+func TestDiskExpiry(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCache(t, Options{Dir: dir})
+	c.Set("aa01", []byte("1"), 20*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	reopened := newTestCache(t, Options{Dir: dir})
+	if _, _, ok := reopened.Get("aa01"); ok {
+		t.Fatal("expired disk entry was returned")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "aa", "aa01.json")); !os.IsNotExist(err) {
+		t.Fatalf("expired entry file still exists: %v", err)
+	}
+}
+
+// 损坏的条目视为未命中并被删除
+func TestDiskCorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "aa", "aa01.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCache(t, Options{Dir: dir})
+	if _, _, ok := c.Get("aa01"); ok {
+		t.Fatal("corrupt entry was returned")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("corrupt entry file still exists: %v", err)
+	}
+}
+
+// 磁盘缓存超出大小时删除最早写入的条目
+func TestDiskSizeLimit(t *testing.T) {
+	value := []byte("0123456789")
+	probe := newTestCache(t, Options{Dir: t.TempDir()})
+	probe.Set("aa00", value, 0)
+	size := probe.Stats().DiskBytes
+
+	dir := t.TempDir()
+	c := newTestCache(t, Options{MaxEntries: 1, Dir: dir, DiskMaxBytes: size*2 + size/2})
+	for _, key := range []string{"aa01", "aa02", "aa03"} {
+		c.Set(key, value, 0)
+		// 按修改时间排序, 避免同一时刻写入
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := c.Stats(); stats.DiskFiles != 2 || stats.DiskBytes > size*2+size/2 {
+		t.Fatalf("stats = %+v, want 2 files within %d bytes", stats, size*2+size/2)
+	}
+	if _, _, ok := c.Get("aa01"); ok {
+		t.Fatal("oldest entry was kept")
+	}
+	if _, _, ok := c.Get("aa02"); !ok {
+		t.Fatal("newer entry was removed")
+	}
+}
+
+func TestDiskPurge(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCache(t, Options{Dir: dir})
+	c.Set("aa01", []byte("1"), 0)
+	c.Set("bb01", []byte("2"), 0)
+	c.Purge()
+	if stats := c.Stats(); stats.DiskFiles != 0 {
+		t.Fatalf("disk files = %d after Purge", stats.DiskFiles)
+	}
+	if _, _, ok := newTestCache(t, Options{Dir: dir}).Get("aa01"); ok {
+		t.Fatal("purged entry was returned after reload")
+	}
+}
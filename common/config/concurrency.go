@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrCredentialsBusy 所有可用凭证均达到并发上限且排队超时
+var ErrCredentialsBusy = errors.New("all credentials are busy, please try again later")
+
+// 每个凭证进行中的请求数, 仅统计当前实例; 名额释放时关闭 changed 通知排队的请求
+var credentialSlots = struct {
+	sync.Mutex
+	inflight map[string]int
+	changed  chan struct{}
+}{
+	inflight: make(map[string]int),
+	changed:  make(chan struct{}),
+}
+
+// CredentialInflight 返回凭证在当前实例中进行中的请求数
+func CredentialInflight(cookie string) int {
+	credentialSlots.Lock()
+	defer credentialSlots.Unlock()
+	return credentialSlots.inflight[cookie]
+}
+
+func releaseCredential(cookie string) {
+	credentialSlots.Lock()
+	defer credentialSlots.Unlock()
+	if credentialSlots.inflight[cookie]--; credentialSlots.inflight[cookie] <= 0 {
+		delete(credentialSlots.inflight, cookie)
+	}
+	close(credentialSlots.changed)
+	credentialSlots.changed = make(chan struct{})
+}
+
+// 从未尝试过的 cookie 中选择进行中请求最少且未达上限的一个并占用名额, 多个时随机选择;
+// 返回 cookie 为空及等待通知时表示均达到上限
+func (cm *CookieManager) tryAcquire() (string, <-chan struct{}, error) {
+	credentialSlots.Lock()
+	defer credentialSlots.Unlock()
+
+	limit := GetSettings().CredentialMaxConcurrency
+	untried := 0
+	least := -1
+	var candidates []string
+	for _, cookie := range cm.Cookies {
+		if cm.tried[cookie] {
+			continue
+		}
+		untried++
+		n := credentialSlots.inflight[cookie]
+		if limit > 0 && n >= limit {
+			continue
+		}
+		if least == -1 || n < least {
+			least = n
+			candidates = candidates[:0]
+		}
+		if n == least {
+			candidates = append(candidates, cookie)
+		}
+	}
+	if untried == 0 {
+		return "", nil, errors.New("no cookies available")
+	}
+	if len(candidates) == 0 {
+		return "", credentialSlots.changed, nil
+	}
+	cookie := candidates[rand.Intn(len(candidates))]
+	credentialSlots.inflight[cookie]++
+	cm.tried[cookie] = true
+	return cookie, nil, nil
+}
+
+// Acquire 选择一个本次请求未尝试过的 cookie 并占用一个并发名额, 优先选择空闲的 cookie;
+// 均达到 CREDENTIAL_MAX_CONCURRENCY 时排队等待, 超过 CREDENTIAL_QUEUE_TIMEOUT 返回 ErrCredentialsBusy.
+// 请求结束或切换 cookie 时需调用返回的 release 释放名额
+func (cm *CookieManager) Acquire(ctx context.Context) (string, func(), error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var timeout <-chan time.Time
+	for {
+		cookie, changed, err := cm.tryAcquire()
+		if err != nil {
+			return "", nil, err
+		}
+		if cookie != "" {
+			var once sync.Once
+			return cookie, func() { once.Do(func() { releaseCredential(cookie) }) }, nil
+		}
+		if timeout == nil {
+			timer := time.NewTimer(time.Duration(GetSettings().CredentialQueueTimeout) * time.Second)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			return "", nil, ErrCredentialsBusy
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
+	}
+}
+
+// CredentialIdle 当前实例是否有空闲的凭证: 配置了 CREDENTIAL_MAX_CONCURRENCY 时为有凭证未达上限, 否则为有凭证没有进行中的请求
+func CredentialIdle() bool {
+	cookies := GetRVCookies()
+	limit := max(GetSettings().CredentialMaxConcurrency, 1)
+	credentialSlots.Lock()
+	defer credentialSlots.Unlock()
+	for _, cookie := range cookies {
+		if credentialSlots.inflight[cookie] < limit {
+			return true
+		}
+	}
+	return false
+}
@@ -2,31 +2,116 @@ package config
 
 import (
 	"errors"
-	"math/rand"
+	"fmt"
 	"os"
+	"rovo2api/common/audit"
 	"rovo2api/common/env"
+	"rovo2api/common/events"
+	"rovo2api/common/prompt"
 	"strings"
 	"sync"
 	"time"
 )
 
+var Port = env.String("PORT", "10111")
+
+// 收到 SIGTERM/SIGINT 后等待进行中的请求(含流式响应)结束的最长时间(秒), 超时后取消
+var ShutdownTimeout = env.Int("SHUTDOWN_TIMEOUT", 30)
+
+// 就绪检查(/readyz): 至少需要的可用凭证数(为0时不检查), 是否检查上游(配置了代理时为代理)可连接
+var (
+	ReadyMinCredentials = env.Int("READY_MIN_CREDENTIALS", 1)
+	ReadyCheckUpstream  = env.Bool("READY_CHECK_UPSTREAM", true)
+)
 var BackendSecret = os.Getenv("BACKEND_SECRET")
 var RVCookie = os.Getenv("RV_COOKIE")
-var IpBlackList = strings.Split(os.Getenv("IP_BLACK_LIST"), ",")
+
+// IP 访问控制, 每项为 IP 或 CIDR, 多个以,分隔; 拒绝列表优先, 允许列表非空时只允许列表中的地址.
+// 全局列表作用于所有接口, API/ADMIN 列表分别作用于 /v1 及 /api 接口
+var (
+	IpAllowList      = splitList(env.String("IP_ALLOW_LIST", ""))
+	IpDenyList       = append(splitList(env.String("IP_DENY_LIST", "")), splitList(os.Getenv("IP_BLACK_LIST"))...)
+	ApiIpAllowList   = splitList(env.String("API_IP_ALLOW_LIST", ""))
+	ApiIpDenyList    = splitList(env.String("API_IP_DENY_LIST", ""))
+	AdminIpAllowList = splitList(env.String("ADMIN_IP_ALLOW_LIST", ""))
+	AdminIpDenyList  = splitList(env.String("ADMIN_IP_DENY_LIST", ""))
+)
+
+// 受信任的代理(IP 或 CIDR), 只有来自这些地址的 X-Forwarded-For/X-Real-IP 才会被采信, 默认不信任任何代理
+var TrustedProxies = splitList(env.String("TRUSTED_PROXIES", ""))
 var ProxyUrl = env.String("PROXY_URL", "")
-var UserAgent = env.String("USER_AGENT", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome")
+
+// Rovo 上游地址, 可指向本地 mock 服务
+const defaultRovoApiBaseUrl = "https://api.atlassian.com/rovodev/v2/proxy/ai"
+
+var RovoApiBaseUrl = strings.TrimSuffix(env.String("RV_API_BASE_URL", defaultRovoApiBaseUrl), "/")
+
+// 上游请求超时(秒)
+var UpstreamTimeout = env.Int("UPSTREAM_TIMEOUT", 10*60*60)
+
+// 上下文窗口管理的处理方式
+const (
+	ContextStrategyOff       = "off"       // 不检查, 原样发送
+	ContextStrategyReject    = "reject"    // 返回 context_length_exceeded 错误
+	ContextStrategyTruncate  = "truncate"  // 保留 system 消息, 丢弃最早的对话轮次
+	ContextStrategySummarize = "summarize" // 用 CONTEXT_SUMMARY_MODEL 总结最早的对话轮次
+)
+
+// 提示词超过模型上下文窗口(扣除 max_tokens 及安全余量)时的处理方式;
+// 安全余量为上下文窗口的比例, 弥补本地 tokenizer 与上游计数的差异
+var (
+	ContextStrategy     = env.String("CONTEXT_STRATEGY", ContextStrategyReject)
+	ContextSummaryModel = env.String("CONTEXT_SUMMARY_MODEL", "anthropic:claude-3-5-sonnet-v2@20241022")
+	ContextSafetyMargin = env.Float64("CONTEXT_SAFETY_MARGIN", 0.05)
+)
+
+// IsContextStrategy 是否为有效的上下文窗口处理方式
+func IsContextStrategy(strategy string) bool {
+	switch strategy {
+	case ContextStrategyOff, ContextStrategyReject, ContextStrategyTruncate, ContextStrategySummarize:
+		return true
+	}
+	return false
+}
+
+// 设置后覆盖指纹配置中的 User-Agent
+var UserAgent = env.String("USER_AGENT", "")
+
+// TLS/HTTP2 指纹配置 全局默认值
+var TLSProfile = env.String("TLS_PROFILE", "chrome_121")
+
+// 按凭证(邮箱)指定指纹 email=profile,多个以,分隔
+var CredentialTLSProfiles = parseKeyValueList(env.String("CREDENTIAL_TLS_PROFILES", ""))
+
+// 按代理指定指纹 proxyUrl=profile,多个以,分隔
+var ProxyTLSProfiles = parseKeyValueList(env.String("PROXY_TLS_PROFILES", ""))
 var ApiSecret = os.Getenv("API_SECRET")
 var ApiSecrets = strings.Split(os.Getenv("API_SECRET"), ",")
 var CustomHeaderKeyEnabled = env.Bool("CUSTOM_HEADER_KEY_ENABLED", false)
 
 var RateLimitCookieLockDuration = env.Int("RATE_LIMIT_COOKIE_LOCK_DURATION", 10*60)
 
+// 每个凭证同时进行的请求数上限(当前实例内), 0 为不限制; 均达到上限时排队等待的最长时间(秒)
+var (
+	CredentialMaxConcurrency = env.Int("CREDENTIAL_MAX_CONCURRENCY", 0)
+	CredentialQueueTimeout   = env.Int("CREDENTIAL_QUEUE_TIMEOUT", 30)
+)
+
 // 隐藏思考过程
 var ReasoningHide = env.Int("REASONING_HIDE", 0)
 
 // 前置message
 var PRE_MESSAGES_JSON = env.String("PRE_MESSAGES_JSON", "")
 
+// 模型注册表(内置模型 + 配置文件中的 models.registry)
+var ModelRegistry = DefaultModels
+
+// 模型别名, 格式: 别名=模型id, 如 gpt-4o=anthropic:claude-sonnet-4@20250514
+var ModelAliases = parseKeyValueList(env.String("MODEL_ALIASES", ""))
+
+// 备用模型链, 格式: 模型=备用1|备用2, 当前模型的所有凭证均不可用或上游故障时依次尝试
+var ModelFallbacks = parseFallbackList(env.String("MODEL_FALLBACKS", ""))
+
 // 路由前缀
 var RoutePrefix = env.String("ROUTE_PREFIX", "")
 var SwaggerEnable = os.Getenv("SWAGGER_ENABLE")
@@ -34,64 +119,186 @@ var BackendApiEnable = env.Int("BACKEND_API_ENABLE", 1)
 
 var DebugEnabled = os.Getenv("DEBUG") == "true"
 
-var RateLimitKeyExpirationDuration = 20 * time.Minute
+// 日志, LOG_LEVEL 为空时开启 DEBUG 则为 debug, 否则为 info
+var (
+	LogLevel    = env.String("LOG_LEVEL", "")
+	LogFormat   = env.String("LOG_FORMAT", "text")
+	LogDir      = env.String("LOG_DIR", "")
+	LogMaxSize  = env.Int("LOG_MAX_SIZE", 100) // MB
+	LogMaxAge   = env.Int("LOG_MAX_AGE", 7)    // 天
+	LogMaxFiles = env.Int("LOG_MAX_FILES", 0)
+	LogCompress = env.Bool("LOG_COMPRESS", true)
+)
+
+// 链路追踪(OpenTelemetry), 通过 OTLP/HTTP 导出, 修改后需重启生效
+var (
+	TracingEnabled     = env.Bool("TRACING_ENABLED", false)
+	TracingEndpoint    = env.String("TRACING_ENDPOINT", "")
+	TracingServiceName = env.String("TRACING_SERVICE_NAME", "rovo2api")
+	TracingSampleRatio = env.Float64("TRACING_SAMPLE_RATIO", 1)
+)
 
 var RequestOutTimeDuration = 5 * time.Minute
 
+// 响应缓存, 仅缓存 temperature 为 0 的请求
 var (
-	RequestRateLimitNum            = env.Int("REQUEST_RATE_LIMIT", 60)
-	RequestRateLimitDuration int64 = 1 * 60
+	ResponseCacheEnabled      = env.Bool("RESPONSE_CACHE_ENABLED", false)
+	ResponseCacheTTL          = env.Int("RESPONSE_CACHE_TTL", 60*60)
+	ResponseCacheMaxEntries   = env.Int("RESPONSE_CACHE_MAX_ENTRIES", 1000)
+	ResponseCacheMaxBytes     = env.Int("RESPONSE_CACHE_MAX_BYTES", 64<<20)
+	ResponseCacheDir          = env.String("RESPONSE_CACHE_DIR", "")
+	ResponseCacheDiskMaxBytes = env.Int("RESPONSE_CACHE_DISK_MAX_BYTES", 1<<30)
 )
 
-type RateLimitCookie struct {
-	ExpirationTime time.Time // 过期时间
-}
+// 审计日志
+var (
+	AuditLogEnabled  = env.Bool("AUDIT_LOG_ENABLED", false)
+	AuditLogDir      = env.String("AUDIT_LOG_DIR", "./data/audit")
+	AuditLogMaxSize  = env.Int("AUDIT_LOG_MAX_SIZE", 100) // MB
+	AuditLogMaxAge   = env.Int("AUDIT_LOG_MAX_AGE", 30)   // 天
+	AuditLogMaxFiles = env.Int("AUDIT_LOG_MAX_FILES", 0)
+	AuditRedactRules = splitList(env.String("AUDIT_REDACT_RULES", "all"))
+	AuditCustomRules []audit.RedactRule
+)
+
+// 运行状态后端, 多实例部署时使用 redis 共享凭证状态、用量计数及限流窗口, 修改后需重启生效
+var (
+	StateBackend   = env.String("STATE_BACKEND", "memory")
+	RedisUrl       = env.String("REDIS_URL", "")
+	StateKeyPrefix = env.String("STATE_KEY_PREFIX", "rovo2api:")
+	StateFile      = env.String("STATE_FILE", "./data/state.json") // memory 后端退出时保存状态的文件, 启动时恢复, 为空时不保存
+)
+
+// 请求调度: 同时派发到上游的请求数达到 SCHEDULER_MAX_CONCURRENCY 时按优先级及 API-KEY 公平排队, 0 为不启用
+var (
+	SchedulerMaxConcurrency = env.Int("SCHEDULER_MAX_CONCURRENCY", 0)
+	SchedulerMaxQueue       = env.Int("SCHEDULER_MAX_QUEUE", 100)
+	SchedulerMaxQueuePerKey = env.Int("SCHEDULER_MAX_QUEUE_PER_KEY", 20)
+	SchedulerQueueTimeout   = env.Int("SCHEDULER_QUEUE_TIMEOUT", 60) // 排队等待的最长时间(秒)
+	// API-KEY=权重, 多个以,分隔, 默认权重为 1; 以 API-KEY 的标识为键
+	SchedulerKeyWeights = parseKeyMap(env.String("SCHEDULER_KEY_WEIGHTS", ""))
+	// API-KEY=interactive|batch, 多个以,分隔, 默认为 interactive; 以 API-KEY 的标识为键
+	SchedulerKeyPriorities = parseKeyMap(env.String("SCHEDULER_KEY_PRIORITIES", ""))
+)
 
+// 批量任务: /v1/files 及 /v1/batches, 在凭证空闲时以 batch 优先级处理, 修改后需重启生效
 var (
-	rateLimitCookies sync.Map // 使用 sync.Map 管理限速 Cookie
+	BatchEnabled     = env.Bool("BATCH_ENABLED", true)
+	BatchDir         = env.String("BATCH_DIR", "./data/batches")
+	BatchConcurrency = env.Int("BATCH_CONCURRENCY", 2)         // 同时执行的请求数
+	BatchMaxFileSize = env.Int("BATCH_MAX_FILE_SIZE", 100<<20) // 上传文件的大小上限(字节)
+	BatchMaxRequests = env.Int("BATCH_MAX_REQUESTS", 50000)    // 每个批量任务的请求数上限
 )
 
-func AddRateLimitCookie(cookie string, expirationTime time.Time) {
+// 按 API-KEY(未配置 API_SECRET 时按 IP)的令牌桶限流, 0 为不限制
+var (
+	RequestRateLimitNum = env.Int("REQUEST_RATE_LIMIT", 60) // 每分钟请求数
+	TokenRateLimitNum   = env.Int("TOKEN_RATE_LIMIT", 0)    // 每分钟 token 数
+)
+
+// 限速按 凭证+模型 记录, 某个模型被限速时凭证仍可用于其他(备用)模型
+func rateLimitCookieKey(cookie, modelId string) string {
+	return modelId + "|" + CredentialKey(cookie)
+}
+
+func AddRateLimitCookie(cookie, modelId string, expirationTime time.Time) {
 	if CustomHeaderKeyEnabled {
 		return
 	}
-	rateLimitCookies.Store(cookie, RateLimitCookie{
-		ExpirationTime: expirationTime,
-	})
-	//fmt.Printf("Storing cookie: %s with value: %+v\n", cookie, RateLimitCookie{ExpirationTime: expirationTime})
+	ctx, cancel := stateContext()
+	defer cancel()
+	reportStateError(State.SetCooldown(ctx, rateLimitCookieKey(cookie, modelId), expirationTime))
 }
 
 var (
-	RVCookies    []string   // 存储所有的 cookies
-	cookiesMutex sync.Mutex // 保护 RVCookies 的互斥锁
+	RVCookies      []string   // 存储所有的 cookies
+	runtimeCookies []string   // 通过管理接口添加的 cookies, 仅保存在当前实例内存中
+	cookiesMutex   sync.Mutex // 保护 RVCookies 的互斥锁
 )
 
 func InitSGCookies() {
 	cookiesMutex.Lock()
-	defer cookiesMutex.Unlock()
-
+	previous := strings.Join(RVCookies, ",")
 	RVCookies = []string{}
 
-	// 从环境变量中读取 RV_COOKIE 并拆分为切片
-	cookieStr := os.Getenv("RV_COOKIE")
+	// 从环境变量或配置文件读取 RV_COOKIE 并拆分为切片
+	cookieStr := RVCookie
 	if cookieStr != "" {
 
 		for _, cookie := range strings.Split(cookieStr, ",") {
 			RVCookies = append(RVCookies, cookie)
 		}
 	}
+	for _, cookie := range runtimeCookies {
+		if !containsCookie(RVCookies, cookie) {
+			RVCookies = append(RVCookies, cookie)
+		}
+	}
+
+	changed := previous != "" && previous != strings.Join(RVCookies, ",")
+	cookiesMutex.Unlock()
+
+	// 热加载修改了凭证时清除失效标记(手动停用的除外), 重新校验所有凭证;
+	// 不持有锁, 错误处理中的日志脱敏会读取凭证
+	if changed {
+		reportStateError(ClearInvalidCredentials())
+	}
+}
+
+func containsCookie(cookies []string, cookie string) bool {
+	for _, c := range cookies {
+		if strings.TrimSpace(c) == cookie {
+			return true
+		}
+	}
+	return false
+}
+
+func isRuntimeCookie(cookie string) bool {
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+	return containsCookie(runtimeCookies, cookie)
+}
+
+// AddCredential 在运行时添加凭证, 重启或其他实例中需写入 RV_COOKIE 才能保留
+func AddCredential(cookie string) error {
+	cookie = strings.TrimSpace(cookie)
+	if cookie == "" {
+		return errors.New("credential is empty")
+	}
+	if strings.Contains(cookie, ",") {
+		return errors.New("credential must not contain ','")
+	}
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+	if containsCookie(RVCookies, cookie) {
+		return errors.New("credential already exists")
+	}
+	runtimeCookies = append(runtimeCookies, cookie)
+	RVCookies = append(RVCookies, cookie)
+	return nil
+}
+
+// FindCredential 按 CredentialKey 查找凭证
+func FindCredential(key string) (string, bool) {
+	for _, cookie := range GetRVCookies() {
+		if cookie = strings.TrimSpace(cookie); cookie != "" && CredentialKey(cookie) == key {
+			return cookie, true
+		}
+	}
+	return "", false
 }
 
 type CookieManager struct {
-	Cookies      []string
-	currentIndex int
-	mu           sync.Mutex
+	Cookies []string
+	tried   map[string]bool // 本次请求已尝试过的 cookie
+	mu      sync.Mutex
 }
 
 // GetSGCookies 获取 RVCookies 的副本
 func GetRVCookies() []string {
-	//cookiesMutex.Lock()
-	//defer cookiesMutex.Unlock()
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
 
 	// 返回 RVCookies 的副本，避免外部直接修改
 	cookiesCopy := make([]string, len(RVCookies))
@@ -99,85 +306,140 @@ func GetRVCookies() []string {
 	return cookiesCopy
 }
 
-func NewCookieManager() *CookieManager {
-	var validCookies []string
-	// 遍历 RVCookies
+// NewCookieManager 返回该模型可用的 cookie, 跳过失效及冷却中的 cookie;
+// 状态后端不可用时不做过滤
+func NewCookieManager(modelId string) *CookieManager {
+	var cookies []string
+	var keys []string
 	for _, cookie := range GetRVCookies() {
 		cookie = strings.TrimSpace(cookie)
 		if cookie == "" {
 			continue // 忽略空字符串
 		}
+		cookies = append(cookies, cookie)
+		keys = append(keys, rateLimitCookieKey(cookie, modelId))
+	}
 
-		// 检查是否在 RateLimitCookies 中
-		if value, ok := rateLimitCookies.Load(cookie); ok {
-			rateLimitCookie, ok := value.(RateLimitCookie) // 正确转换为 RateLimitCookie
-			if !ok {
-				continue
-			}
-			if rateLimitCookie.ExpirationTime.After(time.Now()) {
-				// 如果未过期，忽略该 cookie
-				continue
-			} else {
-				// 如果已过期，从 RateLimitCookies 中删除
-				rateLimitCookies.Delete(cookie)
-			}
-		}
+	ctx, cancel := stateContext()
+	defer cancel()
+	cooldowns, err := State.Cooldowns(ctx, keys)
+	reportStateError(err)
+	invalid, err := State.InvalidCredentials(ctx)
+	reportStateError(err)
 
+	var validCookies []string
+	for i, cookie := range cookies {
+		if _, ok := cooldowns[keys[i]]; ok {
+			continue
+		}
+		if _, ok := invalid[CredentialKey(cookie)]; ok {
+			continue
+		}
 		// 添加到有效 cookie 列表
 		validCookies = append(validCookies, cookie)
 	}
 
 	return &CookieManager{
-		Cookies:      validCookies,
-		currentIndex: 0,
+		Cookies: validCookies,
+		tried:   make(map[string]bool),
 	}
 }
 
-func (cm *CookieManager) GetRandomCookie() (string, error) {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
-
-	if len(cm.Cookies) == 0 {
-		return "", errors.New("no cookies available")
+// RemoveCookie 将 cookie 标记为失效, 所有实例均不再使用, 凭证变更或手动清除后恢复
+func RemoveCookie(cookieToRemove string, reason string) {
+	if CustomHeaderKeyEnabled {
+		return
+	}
+	ctx, cancel := stateContext()
+	defer cancel()
+	// 仅在凭证由可用变为失效时通知
+	notify := false
+	if EventsEnabled() {
+		invalid, err := State.InvalidCredentials(ctx)
+		reportStateError(err)
+		_, wasInvalid := invalid[CredentialKey(cookieToRemove)]
+		notify = err == nil && !wasInvalid
+	}
+	if err := State.MarkInvalid(ctx, CredentialKey(cookieToRemove), reason); err != nil {
+		reportStateError(err)
+		return
+	}
+	if notify {
+		PublishEvent(events.CredentialInvalidated,
+			fmt.Sprintf("credential %s invalidated: %s", CredentialName(cookieToRemove), reason),
+			map[string]any{
+				"credential": CredentialName(cookieToRemove),
+				"key":        CredentialKey(cookieToRemove),
+				"reason":     reason,
+			})
 	}
-
-	// 生成随机索引
-	randomIndex := rand.Intn(len(cm.Cookies))
-	// 更新当前索引
-	cm.currentIndex = randomIndex
-
-	return cm.Cookies[randomIndex], nil
 }
 
-func (cm *CookieManager) GetNextCookie() (string, error) {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
-
-	if len(cm.Cookies) == 0 {
-		return "", errors.New("no cookies available")
+// parseKeyValueList 解析 key=value,key=value 格式的配置, 以最后一个=为分隔
+func parseKeyValueList(raw string) map[string]string {
+	result := make(map[string]string)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		idx := strings.LastIndex(item, "=")
+		if idx <= 0 {
+			continue
+		}
+		result[strings.TrimSpace(item[:idx])] = strings.TrimSpace(item[idx+1:])
 	}
-
-	cm.currentIndex = (cm.currentIndex + 1) % len(cm.Cookies)
-	return cm.Cookies[cm.currentIndex], nil
+	return result
 }
 
-// RemoveCookie 删除指定的 cookie（支持并发）
-func RemoveCookie(cookieToRemove string) {
-	if CustomHeaderKeyEnabled {
-		return
+// parseKeyMap 解析 API-KEY=值 列表, API-KEY 统一转换为标识, 也可直接配置标识(key-xxxx)
+func parseKeyMap(raw string) map[string]string {
+	result := make(map[string]string)
+	for key, value := range parseKeyValueList(raw) {
+		result[prompt.KeyID(key)] = value
 	}
+	return result
+}
 
-	cookiesMutex.Lock()
-	defer cookiesMutex.Unlock()
+// splitList 解析逗号分隔的列表, 忽略空项
+func splitList(raw string) []string {
+	var result []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
 
-	// 创建一个新的切片，过滤掉需要删除的 cookie
-	var newCookies []string
-	for _, cookie := range GetRVCookies() {
-		if cookie != cookieToRemove {
-			newCookies = append(newCookies, cookie)
+// parseFallbackList 解析 模型=备用1|备用2,模型=备用1 格式的备用模型链
+func parseFallbackList(raw string) map[string][]string {
+	result := make(map[string][]string)
+	for name, chain := range parseKeyValueList(raw) {
+		var targets []string
+		for _, target := range strings.Split(chain, "|") {
+			if target = strings.TrimSpace(target); target != "" {
+				targets = append(targets, target)
+			}
 		}
+		result[name] = targets
 	}
+	return result
+}
 
-	// 更新 GSCookies
-	RVCookies = newCookies
+// CredentialName 返回凭证的可读标识(邮箱部分), 不包含密钥
+func CredentialName(cookie string) string {
+	cookie = strings.TrimSpace(cookie)
+	if idx := strings.Index(cookie, ":"); idx > 0 {
+		return cookie[:idx]
+	}
+	if len(cookie) > 8 {
+		return cookie[:4] + "****" + cookie[len(cookie)-4:]
+	}
+	return "****"
+}
+
+// TrimRoutePrefix 去掉请求路径中的 ROUTE_PREFIX
+func TrimRoutePrefix(path string) string {
+	if prefix := strings.Trim(RoutePrefix, "/"); prefix != "" {
+		path = strings.TrimPrefix(path, "/"+prefix)
+	}
+	return path
 }
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"rovo2api/common/audit"
+	"rovo2api/common/env"
+	"rovo2api/common/prompt"
+	"strings"
+)
+
+// 管理面板, 需同时开启 BACKEND_API_ENABLE 并设置 BACKEND_SECRET, 修改后需重启生效
+var DashboardEnable = env.Bool("DASHBOARD_ENABLE", true)
+
+// redactUrl 去掉地址中的用户名密码
+func redactUrl(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User("***")
+	return u.String()
+}
+
+func redactKeyPolicies(values map[string][]string) map[string]string {
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[prompt.KeyID(key)] = strings.Join(value, "|")
+	}
+	return result
+}
+
+// EffectiveConfig 当前生效的配置, 供管理面板展示; API-KEY 以哈希标识代替, 凭证只返回名称, 地址中的密码被隐藏
+func EffectiveConfig() map[string]any {
+	// 热加载在 configMutex 中写入全局配置
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	settings := GetSettings()
+	var apiKeys []string
+	for _, secret := range settings.ApiSecrets {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			apiKeys = append(apiKeys, audit.KeyID(secret))
+		}
+	}
+	var credentials []string
+	for _, cookie := range GetRVCookies() {
+		if cookie = strings.TrimSpace(cookie); cookie != "" {
+			credentials = append(credentials, CredentialName(cookie))
+		}
+	}
+
+	return map[string]any{
+		"server": map[string]any{
+			"port":               Port,
+			"shutdown_timeout":   ShutdownTimeout,
+			"route_prefix":       RoutePrefix,
+			"backend_api_enable": BackendApiEnable == 1,
+			"swagger_enable":     SwaggerEnable == "" || SwaggerEnable == "1",
+			"dashboard_enable":   DashboardEnable,
+			"debug":              DebugEnabled,
+		},
+		"auth": map[string]any{
+			"api_keys":                  apiKeys,
+			"backend_secret_set":        settings.BackendSecret != "",
+			"custom_header_key_enabled": CustomHeaderKeyEnabled,
+		},
+		"credentials": credentials,
+		"health": map[string]any{
+			"min_credentials": ReadyMinCredentials,
+			"check_upstream":  ReadyCheckUpstream,
+		},
+		"upstream": map[string]any{
+			"base_url":                settings.RovoApiBaseUrl,
+			"timeout":                 UpstreamTimeout,
+			"proxy_url":               redactUrl(settings.ProxyUrl),
+			"tls_profile":             settings.TLSProfile,
+			"user_agent":              settings.UserAgent,
+			"credential_tls_profiles": settings.CredentialTLSProfiles,
+		},
+		"models": map[string]any{
+			"aliases":        ModelAliases,
+			"fallbacks":      ModelFallbacks,
+			"reasoning_hide": ReasoningHide == 1,
+		},
+		"context": map[string]any{
+			"strategy":      ContextStrategy,
+			"summary_model": ContextSummaryModel,
+			"safety_margin": ContextSafetyMargin,
+		},
+		"moderation": map[string]any{
+			"input_action":    ModerationInputAction,
+			"output_action":   ModerationOutputAction,
+			"categories":      GetModerationEngine().Categories(),
+			"webhook_url":     redactUrl(ModerationWebhookUrl),
+			"webhook_timeout": ModerationWebhookTimeout,
+			"fail_open":       ModerationFailOpen,
+			"stream_buffer":   ModerationStreamBuffer,
+		},
+		"pii": map[string]any{
+			"enabled":      PIIRedactEnabled,
+			"rules":        PIIRedactRules,
+			"key_policies": redactKeyPolicies(PIIKeyPolicies),
+			"restore":      PIIRestore,
+		},
+		"hooks": GetHookBindings(),
+		"events": map[string]any{
+			"webhooks":           GetEventWebhooks(),
+			"pool_min_healthy":   EventPoolMinHealthy,
+			"error_spike_count":  EventErrorSpikeCount,
+			"error_spike_window": EventErrorSpikeWindow,
+			"quota_daily_tokens": EventQuotaDailyTokens,
+			"quota_threshold":    EventQuotaThreshold,
+		},
+		"prompts": map[string]any{
+			"policies": promptPolicyNames(),
+		},
+		"rate_limit": map[string]any{
+			"requests_per_minute":        RequestRateLimitNum,
+			"tokens_per_minute":          TokenRateLimitNum,
+			"cookie_lock_duration":       RateLimitCookieLockDuration,
+			"credential_max_concurrency": CredentialMaxConcurrency,
+			"credential_queue_timeout":   CredentialQueueTimeout,
+		},
+		"scheduler": map[string]any{
+			"max_concurrency":   SchedulerMaxConcurrency,
+			"max_queue":         SchedulerMaxQueue,
+			"max_queue_per_key": SchedulerMaxQueuePerKey,
+			"queue_timeout":     SchedulerQueueTimeout,
+			"key_weights":       SchedulerKeyWeights, // 已以 API-KEY 的标识为键
+			"key_priorities":    SchedulerKeyPriorities,
+		},
+		"batch": map[string]any{
+			"enabled":       BatchEnabled,
+			"dir":           BatchDir,
+			"concurrency":   BatchConcurrency,
+			"max_file_size": BatchMaxFileSize,
+			"max_requests":  BatchMaxRequests,
+		},
+		"cache": map[string]any{
+			"enabled":        ResponseCacheEnabled,
+			"ttl":            ResponseCacheTTL,
+			"max_entries":    ResponseCacheMaxEntries,
+			"max_bytes":      ResponseCacheMaxBytes,
+			"dir":            ResponseCacheDir,
+			"disk_max_bytes": ResponseCacheDiskMaxBytes,
+		},
+		"audit": map[string]any{
+			"enabled":      AuditLogEnabled,
+			"dir":          AuditLogDir,
+			"redact_rules": AuditRedactRules,
+		},
+		"logging": map[string]any{
+			"level":  LogLevel,
+			"format": LogFormat,
+			"dir":    LogDir,
+		},
+		"tracing": map[string]any{
+			"enabled":      TracingEnabled,
+			"endpoint":     TracingEndpoint,
+			"sample_ratio": TracingSampleRatio,
+		},
+		"state": map[string]any{
+			"backend":    StateBackend,
+			"redis_url":  redactUrl(RedisUrl),
+			"key_prefix": StateKeyPrefix,
+			"file":       StateFile,
+		},
+		"ip_access":   GetIPAccess().Lists,
+		"config_file": ConfigFile,
+	}
+}
+
+func promptPolicyNames() []string {
+	policies, _ := GetPromptPolicies()
+	names := make([]string, 0, len(policies))
+	for i, policy := range policies {
+		if policy.Name == "" {
+			policy.Name = fmt.Sprintf("policies[%d]", i)
+		}
+		names = append(names, policy.Name)
+	}
+	return names
+}
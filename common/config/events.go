@@ -0,0 +1,205 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"rovo2api/common/env"
+	"rovo2api/common/events"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventWebhook 接收事件通知的 webhook
+type EventWebhook struct {
+	Name       string   `yaml:"name" json:"name,omitempty"`
+	Url        string   `yaml:"url" json:"url"`
+	Secret     string   `yaml:"secret" json:"secret,omitempty"`           // 签名密钥, 为空时不签名
+	Format     string   `yaml:"format" json:"format,omitempty"`           // json、slack 或 telegram
+	ChatID     string   `yaml:"chat_id" json:"chat_id,omitempty"`         // telegram 格式的 chat_id
+	Events     []string `yaml:"events" json:"events,omitempty"`           // 为空时接收所有事件
+	Template   string   `yaml:"template" json:"template,omitempty"`       // slack、telegram 格式的消息文本
+	Timeout    Duration `yaml:"timeout" json:"timeout,omitempty"`         // 每次发送的超时, 默认 10s
+	MaxRetries int      `yaml:"max_retries" json:"max_retries,omitempty"` // 默认 3, -1 表示不重试
+}
+
+func (w EventWebhook) options() events.WebhookOptions {
+	return events.WebhookOptions{
+		Name:       w.Name,
+		URL:        w.Url,
+		Secret:     w.Secret,
+		Format:     w.Format,
+		ChatID:     w.ChatID,
+		Events:     w.Events,
+		Template:   w.Template,
+		Timeout:    time.Duration(w.Timeout),
+		MaxRetries: w.MaxRetries,
+	}
+}
+
+// 事件通知: webhook(JSON 数组, 同配置文件 events.webhooks)及各事件的触发条件
+var (
+	EventWebhooksJSON     = env.String("EVENT_WEBHOOKS_JSON", "")
+	EventPoolMinHealthy   = env.Int("EVENT_POOL_MIN_HEALTHY", 1)      // 可用凭证数低于该值时通知
+	EventErrorSpikeCount  = env.Int("EVENT_ERROR_SPIKE_COUNT", 10)    // 时间窗口内上游错误数达到该值时通知, 0 表示不通知
+	EventErrorSpikeWindow = env.Int("EVENT_ERROR_SPIKE_WINDOW", 60)   // 上游错误的统计窗口, 秒
+	EventQuotaDailyTokens = env.Int("EVENT_QUOTA_DAILY_TOKENS", 0)    // 每个凭证每天(UTC)的 token 额度, 0 表示不通知
+	EventQuotaThreshold   = env.Float64("EVENT_QUOTA_THRESHOLD", 0.2) // 剩余额度低于该比例时通知
+)
+
+// EventErrorHandler 事件投递失败时调用
+var EventErrorHandler = func(err error) {}
+
+// 停止旧的事件总线时等待已发布事件投递的时间
+const eventCloseTimeout = 30 * time.Second
+
+var (
+	eventMutex    sync.RWMutex
+	eventBus      *events.Bus
+	eventWebhooks []EventWebhook
+)
+
+func parseEventWebhooks(raw string) ([]EventWebhook, error) {
+	var webhooks []EventWebhook
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &webhooks); err != nil {
+			return nil, err
+		}
+	}
+	return webhooks, nil
+}
+
+// validateEventWebhooks 校验 webhook 配置, 返回带下标的错误
+func validateEventWebhooks(webhooks []EventWebhook) []string {
+	var errs []string
+	for i, webhook := range webhooks {
+		if _, err := events.NewWebhook(webhook.options()); err != nil {
+			errs = append(errs, fmt.Sprintf("[%d].%v", i, err))
+		}
+	}
+	return errs
+}
+
+// compileEvents 解析 webhook 配置并创建事件总线, 未配置 webhook 时总线为 nil
+func compileEvents(raw string) ([]EventWebhook, *events.Bus, error) {
+	webhooks, err := parseEventWebhooks(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	options := events.Options{
+		Source:  eventSource(),
+		OnError: func(err error) { EventErrorHandler(err) },
+	}
+	for _, webhook := range webhooks {
+		options.Webhooks = append(options.Webhooks, webhook.options())
+	}
+	bus, err := events.NewBus(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return webhooks, bus, nil
+}
+
+// storeEvents 替换事件总线, 旧总线中的事件投递完成后停止
+func storeEvents(webhooks []EventWebhook, bus *events.Bus) {
+	eventMutex.Lock()
+	previous := eventBus
+	eventBus, eventWebhooks = bus, webhooks
+	eventMutex.Unlock()
+	if previous != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), eventCloseTimeout)
+			defer cancel()
+			previous.Close(ctx)
+		}()
+	}
+}
+
+// ApplyEvents 使用 EventWebhooksJSON 重建事件总线, 校验失败时保留原配置; 旧总线中的事件投递完成后停止
+func ApplyEvents() error {
+	webhooks, bus, err := compileEvents(EventWebhooksJSON)
+	if err != nil {
+		return err
+	}
+	storeEvents(webhooks, bus)
+	return nil
+}
+
+func eventSource() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// EventsEnabled 是否配置了 webhook
+func EventsEnabled() bool {
+	eventMutex.RLock()
+	defer eventMutex.RUnlock()
+	return eventBus != nil
+}
+
+// PublishEvent 发布事件, 未配置 webhook 时忽略
+func PublishEvent(eventType, message string, data map[string]any) {
+	eventMutex.RLock()
+	defer eventMutex.RUnlock()
+	eventBus.Publish(events.New(eventType, message, data))
+}
+
+// CloseEvents 停止接收事件并等待已发布事件投递完成
+func CloseEvents(ctx context.Context) error {
+	eventMutex.Lock()
+	bus := eventBus
+	eventBus = nil
+	eventMutex.Unlock()
+	return bus.Close(ctx)
+}
+
+// GetEventWebhooks 当前的 webhook 配置, 不含密钥及地址的路径
+func GetEventWebhooks() []map[string]any {
+	eventMutex.RLock()
+	defer eventMutex.RUnlock()
+	result := make([]map[string]any, 0, len(eventWebhooks))
+	for _, webhook := range eventWebhooks {
+		result = append(result, map[string]any{
+			"name":   webhook.Name,
+			"url":    webhookHost(webhook.Url),
+			"format": stringOr(webhook.Format, events.FormatJSON),
+			"events": webhook.Events,
+			"signed": webhook.Secret != "",
+		})
+	}
+	return result
+}
+
+// webhookHost 只保留地址的协议及主机, 路径中可能包含 token(如 Telegram)
+func webhookHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// publishQuotaLow 凭证当天用量由 previous 增加到 total 时, 首次达到额度阈值则通知
+func publishQuotaLow(cookie string, previous, total int64) {
+	settings := GetSettings()
+	if settings.EventQuotaDailyTokens <= 0 {
+		return
+	}
+	limit := int64(settings.EventQuotaDailyTokens)
+	trigger := int64(float64(limit) * (1 - settings.EventQuotaThreshold))
+	if previous >= trigger || total < trigger {
+		return
+	}
+	PublishEvent(events.CredentialQuotaLow,
+		fmt.Sprintf("credential %s used %d of %d daily tokens", CredentialName(cookie), total, limit),
+		map[string]any{
+			"credential":   CredentialName(cookie),
+			"key":          CredentialKey(cookie),
+			"tokens_today": total,
+			"daily_tokens": limit,
+			"remaining":    max(limit-total, 0),
+		})
+}
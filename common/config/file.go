@@ -0,0 +1,1006 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"rovo2api/common/audit"
+	"rovo2api/common/env"
+	"rovo2api/common/ipfilter"
+	"rovo2api/common/moderation"
+	"rovo2api/common/pii"
+	"rovo2api/common/prompt"
+	"rovo2api/common/scheduler"
+	"rovo2api/common/state"
+	"rovo2api/cycletls"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile 配置文件路径, 由 --config 参数或 CONFIG_FILE 环境变量指定
+var ConfigFile = env.String("CONFIG_FILE", "")
+
+// FileConfig 配置文件结构, 环境变量优先级高于配置文件
+type FileConfig struct {
+	Debug        *bool              `yaml:"debug"`
+	Server       ServerConfig       `yaml:"server"`
+	Auth         AuthConfig         `yaml:"auth"`
+	Credentials  []CredentialConfig `yaml:"credentials"`
+	Proxy        ProxyConfig        `yaml:"proxy"`
+	TLS          TLSConfig          `yaml:"tls"`
+	Upstream     UpstreamConfig     `yaml:"upstream"`
+	Models       ModelsConfig       `yaml:"models"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	Timeouts     TimeoutsConfig     `yaml:"timeouts"`
+	Context      ContextConfig      `yaml:"context"`
+	Prompts      PromptsConfig      `yaml:"prompts"`
+	Moderation   ModerationConfig   `yaml:"moderation"`
+	PII          PIIConfig          `yaml:"pii"`
+	Hooks        []HookBinding      `yaml:"hooks"`
+	Events       EventsConfig       `yaml:"events"`
+	Cache        CacheConfig        `yaml:"cache"`
+	Audit        AuditConfig        `yaml:"audit"`
+	Logging      LoggingConfig      `yaml:"logging"`
+	Tracing      TracingConfig      `yaml:"tracing"`
+	State        StateConfig        `yaml:"state"`
+	Scheduler    SchedulerConfig    `yaml:"scheduler"`
+	Batch        BatchConfig        `yaml:"batch"`
+	Routing      RoutingConfig      `yaml:"routing"`
+	Health       HealthConfig       `yaml:"health"`
+	IpAccess     IpAccessConfig     `yaml:"ip_access"`
+	IpBlackList  []string           `yaml:"ip_black_list"` // 同 ip_access.deny
+	ReloadPeriod Duration           `yaml:"reload_period"`
+}
+
+type ServerConfig struct {
+	Port            int      `yaml:"port"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+}
+
+type HealthConfig struct {
+	MinCredentials *int  `yaml:"min_credentials"`
+	CheckUpstream  *bool `yaml:"check_upstream"`
+}
+
+type AuthConfig struct {
+	ApiKeys                []string `yaml:"api_keys"`
+	BackendSecret          string   `yaml:"backend_secret"`
+	CustomHeaderKeyEnabled *bool    `yaml:"custom_header_key_enabled"`
+}
+
+type CredentialConfig struct {
+	Value      string `yaml:"value"`
+	TLSProfile string `yaml:"tls_profile"`
+}
+
+type ProxyConfig struct {
+	Url         string            `yaml:"url"`
+	TLSProfiles map[string]string `yaml:"tls_profiles"`
+}
+
+type TLSConfig struct {
+	Profile   string `yaml:"profile"`
+	UserAgent string `yaml:"user_agent"`
+}
+
+type UpstreamConfig struct {
+	BaseUrl string `yaml:"base_url"`
+}
+
+type ModelsConfig struct {
+	PreMessages   []map[string]interface{} `yaml:"pre_messages"`
+	ReasoningHide *bool                    `yaml:"reasoning_hide"`
+	Registry      []ModelInfo              `yaml:"registry"`
+	Aliases       map[string]string        `yaml:"aliases"`
+	Fallbacks     map[string][]string      `yaml:"fallbacks"`
+}
+
+type RateLimitConfig struct {
+	RequestsPerMinute        int      `yaml:"requests_per_minute"`
+	TokensPerMinute          int      `yaml:"tokens_per_minute"`
+	CookieLockDuration       Duration `yaml:"cookie_lock_duration"`
+	CredentialMaxConcurrency int      `yaml:"credential_max_concurrency"`
+	CredentialQueueTimeout   Duration `yaml:"credential_queue_timeout"`
+}
+
+type TimeoutsConfig struct {
+	Upstream Duration `yaml:"upstream"`
+}
+
+type ContextConfig struct {
+	Strategy     string   `yaml:"strategy"`
+	SummaryModel string   `yaml:"summary_model"`
+	SafetyMargin *float64 `yaml:"safety_margin"`
+}
+
+type PromptsConfig struct {
+	KeyNames map[string]string `yaml:"key_names"`
+	Policies []prompt.Policy   `yaml:"policies"`
+}
+
+type ModerationConfig struct {
+	InputAction  string            `yaml:"input_action"`
+	OutputAction string            `yaml:"output_action"`
+	Rules        []moderation.Rule `yaml:"rules"`
+	Webhook      struct {
+		Url     string   `yaml:"url"`
+		Secret  string   `yaml:"secret"`
+		Model   string   `yaml:"model"`
+		Timeout Duration `yaml:"timeout"`
+	} `yaml:"webhook"`
+	FailOpen     *bool `yaml:"fail_open"`
+	StreamBuffer int   `yaml:"stream_buffer"`
+}
+
+type PIIConfig struct {
+	Enabled     *bool               `yaml:"enabled"`
+	Rules       []string            `yaml:"rules"`
+	CustomRules []pii.Rule          `yaml:"custom_rules"`
+	KeyPolicies map[string][]string `yaml:"key_policies"`
+	Restore     *bool               `yaml:"restore"`
+}
+
+type EventsConfig struct {
+	Webhooks       []EventWebhook `yaml:"webhooks"`
+	PoolMinHealthy *int           `yaml:"pool_min_healthy"`
+	ErrorSpike     struct {
+		Count  *int     `yaml:"count"`
+		Window Duration `yaml:"window"`
+	} `yaml:"error_spike"`
+	Quota struct {
+		DailyTokens int      `yaml:"daily_tokens"`
+		Threshold   *float64 `yaml:"threshold"`
+	} `yaml:"quota"`
+}
+
+type CacheConfig struct {
+	Enabled      *bool    `yaml:"enabled"`
+	TTL          Duration `yaml:"ttl"`
+	MaxEntries   int      `yaml:"max_entries"`
+	MaxBytes     int      `yaml:"max_bytes"`
+	Dir          string   `yaml:"dir"`
+	DiskMaxBytes int      `yaml:"disk_max_bytes"`
+}
+
+type AuditConfig struct {
+	Enabled     *bool              `yaml:"enabled"`
+	Dir         string             `yaml:"dir"`
+	MaxSizeMB   int                `yaml:"max_size_mb"`
+	MaxAge      Duration           `yaml:"max_age"`
+	MaxFiles    int                `yaml:"max_files"`
+	RedactRules []string           `yaml:"redact_rules"`
+	CustomRules []audit.RedactRule `yaml:"custom_rules"`
+}
+
+type LoggingConfig struct {
+	Level     string   `yaml:"level"`
+	Format    string   `yaml:"format"`
+	Dir       string   `yaml:"dir"`
+	MaxSizeMB int      `yaml:"max_size_mb"`
+	MaxAge    Duration `yaml:"max_age"`
+	MaxFiles  int      `yaml:"max_files"`
+	Compress  *bool    `yaml:"compress"`
+}
+
+type BatchConfig struct {
+	Enabled     *bool  `yaml:"enabled"`
+	Dir         string `yaml:"dir"`
+	Concurrency int    `yaml:"concurrency"`
+	MaxFileSize int    `yaml:"max_file_size"`
+	MaxRequests int    `yaml:"max_requests"`
+}
+
+type SchedulerConfig struct {
+	MaxConcurrency int                `yaml:"max_concurrency"`
+	MaxQueue       int                `yaml:"max_queue"`
+	MaxQueuePerKey int                `yaml:"max_queue_per_key"`
+	QueueTimeout   Duration           `yaml:"queue_timeout"`
+	KeyWeights     map[string]float64 `yaml:"key_weights"`
+	KeyPriorities  map[string]string  `yaml:"key_priorities"`
+}
+
+type IpAccessConfig struct {
+	TrustedProxies []string     `yaml:"trusted_proxies"`
+	Allow          []string     `yaml:"allow"`
+	Deny           []string     `yaml:"deny"`
+	Api            IpListConfig `yaml:"api"`
+	Admin          IpListConfig `yaml:"admin"`
+}
+
+type IpListConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+type TracingConfig struct {
+	Enabled     *bool    `yaml:"enabled"`
+	Endpoint    string   `yaml:"endpoint"`
+	ServiceName string   `yaml:"service_name"`
+	SampleRatio *float64 `yaml:"sample_ratio"`
+}
+
+type StateConfig struct {
+	Backend   string `yaml:"backend"`
+	RedisUrl  string `yaml:"redis_url"`
+	KeyPrefix string `yaml:"key_prefix"`
+	File      string `yaml:"file"`
+}
+
+type RoutingConfig struct {
+	RoutePrefix     string `yaml:"route_prefix"`
+	SwaggerEnable   *bool  `yaml:"swagger_enable"`
+	DashboardEnable *bool  `yaml:"dashboard_enable"`
+}
+
+// Duration 支持 "10m"、"30s" 形式以及纯数字(秒)
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	if seconds, err := strconv.Atoi(value.Value); err == nil {
+		*d = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q, expected e.g. \"30s\" or \"10m\"", value.Line, value.Value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON 同 UnmarshalYAML, 用于以 JSON 传递的配置
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds int
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected e.g. \"30s\" or \"10m\"", raw)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+var (
+	configMutex        sync.Mutex
+	configModTime      time.Time
+	configReloadPeriod time.Duration
+	configStarted      bool // 已加载过配置文件, 之后只热加载可在运行中修改的配置
+)
+
+// LoadConfigFile 读取配置文件并编译全部配置, 全部校验通过后才写入全局配置, 失败时保留当前配置
+func LoadConfigFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	fc, err := ParseConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	ConfigFile = path
+	configModTime = stat.ModTime()
+	inputs := fileReloadInputs(fc)
+	next, err := inputs.compile()
+	if err != nil {
+		return err
+	}
+	if !configStarted {
+		applyStartupConfig(fc)
+		configStarted = true
+	}
+	applyFileConfig(fc, inputs)
+	next.store()
+	return nil
+}
+
+// ParseConfigFile 解析配置文件并返回全部校验错误
+func ParseConfigFile(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+	var fc FileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fc); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+	if errs := fc.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("config file %s is invalid:\n  %s", path, strings.Join(errs, "\n  "))
+	}
+	return &fc, nil
+}
+
+// Validate 校验整个配置, 返回带字段路径的错误列表
+func (fc *FileConfig) Validate() []string {
+	var errs []string
+	addErr := func(field string, format string, a ...any) {
+		errs = append(errs, field+": "+fmt.Sprintf(format, a...))
+	}
+
+	if fc.Server.Port < 0 || fc.Server.Port > 65535 {
+		addErr("server.port", "must be between 1 and 65535, got %d", fc.Server.Port)
+	}
+	if fc.Server.ShutdownTimeout < 0 {
+		addErr("server.shutdown_timeout", "must not be negative")
+	}
+	if fc.Health.MinCredentials != nil && *fc.Health.MinCredentials < 0 {
+		addErr("health.min_credentials", "must not be negative")
+	}
+
+	for i, key := range fc.Auth.ApiKeys {
+		if strings.TrimSpace(key) == "" {
+			addErr(fmt.Sprintf("auth.api_keys[%d]", i), "must not be empty")
+		} else if strings.Contains(key, ",") {
+			addErr(fmt.Sprintf("auth.api_keys[%d]", i), "must not contain ','")
+		}
+	}
+
+	seen := make(map[string]int)
+	for i, credential := range fc.Credentials {
+		field := fmt.Sprintf("credentials[%d]", i)
+		value := strings.TrimSpace(credential.Value)
+		if value == "" {
+			addErr(field+".value", "must not be empty")
+			continue
+		}
+		if idx := strings.Index(value, ":"); idx <= 0 || idx == len(value)-1 {
+			addErr(field+".value", "must be in \"email:api_token\" form")
+		}
+		if strings.Contains(value, ",") {
+			addErr(field+".value", "must not contain ','")
+		}
+		if j, ok := seen[value]; ok {
+			addErr(field+".value", "duplicates credentials[%d]", j)
+		}
+		seen[value] = i
+		if credential.TLSProfile != "" {
+			validateProfile(field+".tls_profile", credential.TLSProfile, addErr)
+		}
+	}
+
+	if fc.Proxy.Url != "" {
+		validateUrl("proxy.url", fc.Proxy.Url, []string{"http", "https", "socks5", "socks5h", "socks4"}, addErr)
+	}
+	for proxyUrl, profile := range fc.Proxy.TLSProfiles {
+		validateProfile(fmt.Sprintf("proxy.tls_profiles[%s]", proxyUrl), profile, addErr)
+	}
+
+	if fc.TLS.Profile != "" {
+		validateProfile("tls.profile", fc.TLS.Profile, addErr)
+	}
+
+	if fc.Upstream.BaseUrl != "" {
+		validateUrl("upstream.base_url", fc.Upstream.BaseUrl, []string{"http", "https"}, addErr)
+	}
+
+	for i, message := range fc.Models.PreMessages {
+		field := fmt.Sprintf("models.pre_messages[%d]", i)
+		role, _ := message["role"].(string)
+		if role != "system" && role != "user" && role != "assistant" {
+			addErr(field+".role", "must be one of system, user, assistant, got %q", role)
+		}
+		if _, ok := message["content"]; !ok {
+			addErr(field+".content", "is required")
+		}
+	}
+
+	errs = append(errs, ValidateModels(MergeModels(DefaultModels, fc.Models.Registry), fc.Models.Aliases, fc.Models.Fallbacks)...)
+
+	if fc.RateLimit.RequestsPerMinute < 0 {
+		addErr("rate_limit.requests_per_minute", "must not be negative, got %d", fc.RateLimit.RequestsPerMinute)
+	}
+	if fc.RateLimit.TokensPerMinute < 0 {
+		addErr("rate_limit.tokens_per_minute", "must not be negative, got %d", fc.RateLimit.TokensPerMinute)
+	}
+	if fc.RateLimit.CookieLockDuration < 0 {
+		addErr("rate_limit.cookie_lock_duration", "must not be negative")
+	}
+	if fc.RateLimit.CredentialMaxConcurrency < 0 {
+		addErr("rate_limit.credential_max_concurrency", "must not be negative, got %d", fc.RateLimit.CredentialMaxConcurrency)
+	}
+	if fc.RateLimit.CredentialQueueTimeout < 0 {
+		addErr("rate_limit.credential_queue_timeout", "must not be negative")
+	}
+	if fc.Timeouts.Upstream < 0 {
+		addErr("timeouts.upstream", "must not be negative")
+	} else if fc.Timeouts.Upstream > 0 && time.Duration(fc.Timeouts.Upstream) < time.Second {
+		addErr("timeouts.upstream", "must be at least 1s")
+	}
+	if _, promptErrs := prompt.Compile(fc.Prompts.Policies, fc.Prompts.KeyNames); len(promptErrs) > 0 {
+		for _, err := range promptErrs {
+			errs = append(errs, "prompts."+err)
+		}
+	}
+	for field, action := range map[string]string{
+		"moderation.input_action":  fc.Moderation.InputAction,
+		"moderation.output_action": fc.Moderation.OutputAction,
+	} {
+		if action != "" && !moderation.IsAction(action) {
+			addErr(field, "unknown action %q (expected off, block, redact or flag)", action)
+		}
+	}
+	if _, ruleErrs := moderation.CompileRules(fc.Moderation.Rules); len(ruleErrs) > 0 {
+		for _, err := range ruleErrs {
+			errs = append(errs, "moderation."+err)
+		}
+	}
+	if fc.Moderation.Webhook.Url != "" {
+		validateUrl("moderation.webhook.url", fc.Moderation.Webhook.Url, []string{"http", "https"}, addErr)
+	}
+	if fc.Moderation.Webhook.Timeout < 0 {
+		addErr("moderation.webhook.timeout", "must not be negative")
+	}
+	if fc.Moderation.StreamBuffer < 0 {
+		addErr("moderation.stream_buffer", "must not be negative, got %d", fc.Moderation.StreamBuffer)
+	}
+	if _, err := NewPIIRedactor(fc.PII.Rules, fc.PII.CustomRules); err != nil {
+		addErr("pii.rules", "%v", err)
+	}
+	for key, policy := range fc.PII.KeyPolicies {
+		if strings.ContainsAny(key, ",=") {
+			addErr("pii.key_policies", "key must not contain ',' or '='")
+		}
+		if _, err := NewPIIRedactor(policy, nil); err != nil {
+			addErr("pii.key_policies", "%v", err)
+		}
+	}
+	for _, err := range validateHookBindings(fc.Hooks) {
+		errs = append(errs, "hooks"+err)
+	}
+	for _, err := range validateEventWebhooks(fc.Events.Webhooks) {
+		errs = append(errs, "events.webhooks"+err)
+	}
+	if fc.Events.PoolMinHealthy != nil && *fc.Events.PoolMinHealthy < 0 {
+		addErr("events.pool_min_healthy", "must not be negative, got %d", *fc.Events.PoolMinHealthy)
+	}
+	if fc.Events.ErrorSpike.Count != nil && *fc.Events.ErrorSpike.Count < 0 {
+		addErr("events.error_spike.count", "must not be negative, got %d", *fc.Events.ErrorSpike.Count)
+	}
+	if fc.Events.ErrorSpike.Window < 0 {
+		addErr("events.error_spike.window", "must not be negative")
+	}
+	if fc.Events.Quota.DailyTokens < 0 {
+		addErr("events.quota.daily_tokens", "must not be negative, got %d", fc.Events.Quota.DailyTokens)
+	}
+	if fc.Events.Quota.Threshold != nil && (*fc.Events.Quota.Threshold <= 0 || *fc.Events.Quota.Threshold >= 1) {
+		addErr("events.quota.threshold", "must be in (0, 1), got %v", *fc.Events.Quota.Threshold)
+	}
+	if fc.Context.Strategy != "" && !IsContextStrategy(fc.Context.Strategy) {
+		addErr("context.strategy", "unknown strategy %q (expected off, reject, truncate or summarize)", fc.Context.Strategy)
+	}
+	if fc.Context.SafetyMargin != nil && (*fc.Context.SafetyMargin < 0 || *fc.Context.SafetyMargin >= 1) {
+		addErr("context.safety_margin", "must be in [0, 1), got %v", *fc.Context.SafetyMargin)
+	}
+	if fc.ReloadPeriod < 0 {
+		addErr("reload_period", "must not be negative")
+	}
+	if fc.Batch.Concurrency < 0 {
+		addErr("batch.concurrency", "must not be negative, got %d", fc.Batch.Concurrency)
+	}
+	if fc.Batch.MaxFileSize < 0 {
+		addErr("batch.max_file_size", "must not be negative, got %d", fc.Batch.MaxFileSize)
+	}
+	if fc.Batch.MaxRequests < 0 {
+		addErr("batch.max_requests", "must not be negative, got %d", fc.Batch.MaxRequests)
+	}
+	if fc.Audit.MaxSizeMB < 0 {
+		addErr("audit.max_size_mb", "must not be negative, got %d", fc.Audit.MaxSizeMB)
+	}
+	if fc.Audit.MaxAge < 0 {
+		addErr("audit.max_age", "must not be negative")
+	}
+	if fc.Audit.MaxFiles < 0 {
+		addErr("audit.max_files", "must not be negative, got %d", fc.Audit.MaxFiles)
+	}
+	if _, err := audit.ResolveRules(fc.Audit.RedactRules, nil); err != nil {
+		addErr("audit.redact_rules", "%v", err)
+	}
+	for i, rule := range fc.Audit.CustomRules {
+		field := fmt.Sprintf("audit.custom_rules[%d]", i)
+		if rule.Pattern == "" {
+			addErr(field+".pattern", "is required")
+		} else if _, err := regexp.Compile(rule.Pattern); err != nil {
+			addErr(field+".pattern", "%v", err)
+		}
+	}
+	if !IsLogLevel(fc.Logging.Level) {
+		addErr("logging.level", "must be one of debug, info, warn, error, got %q", fc.Logging.Level)
+	}
+	if !IsLogFormat(fc.Logging.Format) {
+		addErr("logging.format", "must be one of text, json, logfmt, got %q", fc.Logging.Format)
+	}
+	if fc.Logging.MaxSizeMB < 0 {
+		addErr("logging.max_size_mb", "must not be negative, got %d", fc.Logging.MaxSizeMB)
+	}
+	if fc.Logging.MaxAge < 0 {
+		addErr("logging.max_age", "must not be negative")
+	}
+	if fc.Logging.MaxFiles < 0 {
+		addErr("logging.max_files", "must not be negative, got %d", fc.Logging.MaxFiles)
+	}
+	if fc.Tracing.Endpoint != "" {
+		validateUrl("tracing.endpoint", fc.Tracing.Endpoint, []string{"http", "https"}, addErr)
+	}
+	if fc.Tracing.SampleRatio != nil && (*fc.Tracing.SampleRatio < 0 || *fc.Tracing.SampleRatio > 1) {
+		addErr("tracing.sample_ratio", "must be between 0 and 1, got %v", *fc.Tracing.SampleRatio)
+	}
+	switch strings.ToLower(fc.State.Backend) {
+	case "", state.BackendMemory:
+	case state.BackendRedis:
+		if fc.State.RedisUrl == "" {
+			addErr("state.redis_url", "is required when state.backend is redis")
+		} else {
+			validateUrl("state.redis_url", fc.State.RedisUrl, []string{"redis", "rediss"}, addErr)
+		}
+	default:
+		addErr("state.backend", "must be one of memory, redis, got %q", fc.State.Backend)
+	}
+	if fc.Scheduler.MaxConcurrency < 0 {
+		addErr("scheduler.max_concurrency", "must not be negative, got %d", fc.Scheduler.MaxConcurrency)
+	}
+	if fc.Scheduler.MaxQueue < 0 {
+		addErr("scheduler.max_queue", "must not be negative, got %d", fc.Scheduler.MaxQueue)
+	}
+	if fc.Scheduler.MaxQueuePerKey < 0 {
+		addErr("scheduler.max_queue_per_key", "must not be negative, got %d", fc.Scheduler.MaxQueuePerKey)
+	}
+	if fc.Scheduler.QueueTimeout < 0 {
+		addErr("scheduler.queue_timeout", "must not be negative")
+	}
+	for key, weight := range fc.Scheduler.KeyWeights {
+		if weight <= 0 {
+			addErr("scheduler.key_weights", "weight of a key must be positive, got %v", weight)
+		}
+		if strings.ContainsAny(key, ",=") {
+			addErr("scheduler.key_weights", "key must not contain ',' or '='")
+		}
+	}
+	for key, priority := range fc.Scheduler.KeyPriorities {
+		if _, ok := scheduler.ParsePriority(priority); !ok {
+			addErr("scheduler.key_priorities", "must be one of interactive, batch, got %q", priority)
+		}
+		if strings.ContainsAny(key, ",=") {
+			addErr("scheduler.key_priorities", "key must not contain ',' or '='")
+		}
+	}
+	if fc.Cache.TTL < 0 {
+		addErr("cache.ttl", "must not be negative")
+	}
+	if fc.Cache.MaxEntries < 0 {
+		addErr("cache.max_entries", "must not be negative, got %d", fc.Cache.MaxEntries)
+	}
+	if fc.Cache.MaxBytes < 0 {
+		addErr("cache.max_bytes", "must not be negative, got %d", fc.Cache.MaxBytes)
+	}
+	if fc.Cache.DiskMaxBytes < 0 {
+		addErr("cache.disk_max_bytes", "must not be negative, got %d", fc.Cache.DiskMaxBytes)
+	}
+
+	if strings.ContainsAny(fc.Routing.RoutePrefix, " ?#") {
+		addErr("routing.route_prefix", "must be a plain path segment, got %q", fc.Routing.RoutePrefix)
+	}
+
+	for field, list := range map[string][]string{
+		"ip_access.trusted_proxies": fc.IpAccess.TrustedProxies,
+		"ip_access.allow":           fc.IpAccess.Allow,
+		"ip_access.deny":            fc.IpAccess.Deny,
+		"ip_access.api.allow":       fc.IpAccess.Api.Allow,
+		"ip_access.api.deny":        fc.IpAccess.Api.Deny,
+		"ip_access.admin.allow":     fc.IpAccess.Admin.Allow,
+		"ip_access.admin.deny":      fc.IpAccess.Admin.Deny,
+		"ip_black_list":             fc.IpBlackList,
+	} {
+		if _, err := ipfilter.ParseList(list); err != nil {
+			addErr(field, "%v", err)
+		}
+	}
+
+	return errs
+}
+
+func validateProfile(field string, profile string, addErr func(string, string, ...any)) {
+	if _, ok := cycletls.GetProfile(profile); !ok {
+		addErr(field, "unknown TLS profile %q, available: %s", profile, strings.Join(cycletls.ProfileNames(), ", "))
+	}
+}
+
+func validateUrl(field string, raw string, schemes []string, addErr func(string, string, ...any)) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		addErr(field, "invalid URL: %v", err)
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			if u.Host == "" {
+				addErr(field, "missing host in %q", raw)
+			}
+			return
+		}
+	}
+	addErr(field, "unsupported scheme %q, expected one of %s", u.Scheme, strings.Join(schemes, ", "))
+}
+
+// IsLogLevel 是否为有效的日志级别, 为空表示按 DEBUG 选择默认级别
+func IsLogLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "", "debug", "info", "warn", "warning", "error":
+		return true
+	}
+	return false
+}
+
+// IsLogFormat 是否为有效的日志格式
+func IsLogFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case "", "text", "json", "logfmt":
+		return true
+	}
+	return false
+}
+
+// applyStartupConfig 写入启动时生效的配置: 端口、路由、认证方式及各类存储的目录等,
+// 在启动时读取或创建后不再读取, 热加载时不写入, 修改后需重启生效
+func applyStartupConfig(fc *FileConfig) {
+	Port = env.String("PORT", intOr(fc.Server.Port, "10111"))
+	ShutdownTimeout = env.Int("SHUTDOWN_TIMEOUT", positiveOr(int(time.Duration(fc.Server.ShutdownTimeout).Seconds()), 30))
+
+	CustomHeaderKeyEnabled = env.Bool("CUSTOM_HEADER_KEY_ENABLED", boolOr(fc.Auth.CustomHeaderKeyEnabled, false))
+
+	ResponseCacheMaxEntries = env.Int("RESPONSE_CACHE_MAX_ENTRIES", positiveOr(fc.Cache.MaxEntries, 1000))
+	ResponseCacheMaxBytes = env.Int("RESPONSE_CACHE_MAX_BYTES", positiveOr(fc.Cache.MaxBytes, 64<<20))
+	ResponseCacheDir = env.String("RESPONSE_CACHE_DIR", fc.Cache.Dir)
+	ResponseCacheDiskMaxBytes = env.Int("RESPONSE_CACHE_DISK_MAX_BYTES", positiveOr(fc.Cache.DiskMaxBytes, 1<<30))
+
+	AuditLogDir = env.String("AUDIT_LOG_DIR", stringOr(fc.Audit.Dir, "./data/audit"))
+	AuditLogMaxSize = env.Int("AUDIT_LOG_MAX_SIZE", positiveOr(fc.Audit.MaxSizeMB, 100))
+	AuditLogMaxAge = env.Int("AUDIT_LOG_MAX_AGE", positiveOr(int(time.Duration(fc.Audit.MaxAge).Hours()/24), 30))
+	AuditLogMaxFiles = env.Int("AUDIT_LOG_MAX_FILES", fc.Audit.MaxFiles)
+
+	LogFormat = env.String("LOG_FORMAT", stringOr(fc.Logging.Format, "text"))
+	LogDir = env.String("LOG_DIR", fc.Logging.Dir)
+	LogMaxSize = env.Int("LOG_MAX_SIZE", positiveOr(fc.Logging.MaxSizeMB, 100))
+	LogMaxAge = env.Int("LOG_MAX_AGE", positiveOr(int(time.Duration(fc.Logging.MaxAge).Hours()/24), 7))
+	LogMaxFiles = env.Int("LOG_MAX_FILES", fc.Logging.MaxFiles)
+	LogCompress = env.Bool("LOG_COMPRESS", boolOr(fc.Logging.Compress, true))
+
+	TracingEnabled = env.Bool("TRACING_ENABLED", boolOr(fc.Tracing.Enabled, false))
+	TracingEndpoint = env.String("TRACING_ENDPOINT", fc.Tracing.Endpoint)
+	TracingServiceName = env.String("TRACING_SERVICE_NAME", stringOr(fc.Tracing.ServiceName, "rovo2api"))
+	sampleRatio := 1.0
+	if fc.Tracing.SampleRatio != nil {
+		sampleRatio = *fc.Tracing.SampleRatio
+	}
+	TracingSampleRatio = env.Float64("TRACING_SAMPLE_RATIO", sampleRatio)
+
+	StateBackend = env.String("STATE_BACKEND", stringOr(fc.State.Backend, state.BackendMemory))
+	RedisUrl = env.String("REDIS_URL", fc.State.RedisUrl)
+	StateKeyPrefix = env.String("STATE_KEY_PREFIX", stringOr(fc.State.KeyPrefix, "rovo2api:"))
+	StateFile = env.String("STATE_FILE", stringOr(fc.State.File, "./data/state.json"))
+
+	BatchEnabled = env.Bool("BATCH_ENABLED", boolOr(fc.Batch.Enabled, true))
+	BatchDir = env.String("BATCH_DIR", stringOr(fc.Batch.Dir, "./data/batches"))
+	BatchConcurrency = env.Int("BATCH_CONCURRENCY", positiveOr(fc.Batch.Concurrency, 2))
+	BatchMaxFileSize = env.Int("BATCH_MAX_FILE_SIZE", positiveOr(fc.Batch.MaxFileSize, 100<<20))
+	BatchMaxRequests = env.Int("BATCH_MAX_REQUESTS", positiveOr(fc.Batch.MaxRequests, 50000))
+
+	RoutePrefix = env.String("ROUTE_PREFIX", fc.Routing.RoutePrefix)
+	swaggerEnable := ""
+	if fc.Routing.SwaggerEnable != nil && !*fc.Routing.SwaggerEnable {
+		swaggerEnable = "0"
+	}
+	SwaggerEnable = env.String("SWAGGER_ENABLE", swaggerEnable)
+	DashboardEnable = env.Bool("DASHBOARD_ENABLE", boolOr(fc.Routing.DashboardEnable, true))
+}
+
+// applyFileConfig 将配置文件及已校验的 inputs 写入全局配置并生成新的配置快照, 已设置的环境变量仍然优先;
+// 请求中通过 GetSettings 读取, 不会读到写入一半的配置
+func applyFileConfig(fc *FileConfig, inputs reloadInputs) {
+	DebugEnabled = env.Bool("DEBUG", boolOr(fc.Debug, false))
+
+	ApiSecret = env.String("API_SECRET", strings.Join(fc.Auth.ApiKeys, ","))
+	ApiSecrets = strings.Split(ApiSecret, ",")
+	BackendSecret = env.String("BACKEND_SECRET", fc.Auth.BackendSecret)
+
+	var credentials []string
+	credentialProfiles := make([]string, 0)
+	for _, credential := range fc.Credentials {
+		credentials = append(credentials, strings.TrimSpace(credential.Value))
+		if credential.TLSProfile != "" {
+			credentialProfiles = append(credentialProfiles, CredentialName(credential.Value)+"="+credential.TLSProfile)
+		}
+	}
+	RVCookie = env.String("RV_COOKIE", strings.Join(credentials, ","))
+	CredentialTLSProfiles = parseKeyValueList(env.String("CREDENTIAL_TLS_PROFILES", strings.Join(credentialProfiles, ",")))
+
+	ProxyUrl = env.String("PROXY_URL", fc.Proxy.Url)
+	proxyProfiles := make([]string, 0, len(fc.Proxy.TLSProfiles))
+	for proxyUrl, profile := range fc.Proxy.TLSProfiles {
+		proxyProfiles = append(proxyProfiles, proxyUrl+"="+profile)
+	}
+	ProxyTLSProfiles = parseKeyValueList(env.String("PROXY_TLS_PROFILES", strings.Join(proxyProfiles, ",")))
+
+	TLSProfile = env.String("TLS_PROFILE", stringOr(fc.TLS.Profile, cycletls.DefaultProfile))
+	UserAgent = env.String("USER_AGENT", fc.TLS.UserAgent)
+
+	RovoApiBaseUrl = strings.TrimSuffix(env.String("RV_API_BASE_URL", stringOr(fc.Upstream.BaseUrl, defaultRovoApiBaseUrl)), "/")
+
+	preMessages := ""
+	if len(fc.Models.PreMessages) > 0 {
+		if data, err := json.Marshal(fc.Models.PreMessages); err == nil {
+			preMessages = string(data)
+		}
+	}
+	PRE_MESSAGES_JSON = env.String("PRE_MESSAGES_JSON", preMessages)
+	reasoningHide := 0
+	if boolOr(fc.Models.ReasoningHide, false) {
+		reasoningHide = 1
+	}
+	ReasoningHide = env.Int("REASONING_HIDE", reasoningHide)
+
+	RequestRateLimitNum = env.Int("REQUEST_RATE_LIMIT", positiveOr(fc.RateLimit.RequestsPerMinute, 60))
+	TokenRateLimitNum = env.Int("TOKEN_RATE_LIMIT", fc.RateLimit.TokensPerMinute)
+	RateLimitCookieLockDuration = env.Int("RATE_LIMIT_COOKIE_LOCK_DURATION", positiveOr(int(time.Duration(fc.RateLimit.CookieLockDuration).Seconds()), 10*60))
+	CredentialMaxConcurrency = env.Int("CREDENTIAL_MAX_CONCURRENCY", fc.RateLimit.CredentialMaxConcurrency)
+	CredentialQueueTimeout = env.Int("CREDENTIAL_QUEUE_TIMEOUT", positiveOr(int(time.Duration(fc.RateLimit.CredentialQueueTimeout).Seconds()), 30))
+	UpstreamTimeout = env.Int("UPSTREAM_TIMEOUT", positiveOr(int(time.Duration(fc.Timeouts.Upstream).Seconds()), 10*60*60))
+
+	ContextStrategy = env.String("CONTEXT_STRATEGY", stringOr(fc.Context.Strategy, ContextStrategyReject))
+	ContextSummaryModel = env.String("CONTEXT_SUMMARY_MODEL", stringOr(fc.Context.SummaryModel, "anthropic:claude-3-5-sonnet-v2@20241022"))
+	safetyMargin := 0.05
+	if fc.Context.SafetyMargin != nil {
+		safetyMargin = *fc.Context.SafetyMargin
+	}
+	ContextSafetyMargin = env.Float64("CONTEXT_SAFETY_MARGIN", safetyMargin)
+
+	ModerationInputAction = env.String("MODERATION_INPUT_ACTION", stringOr(fc.Moderation.InputAction, moderation.ActionOff))
+	ModerationOutputAction = env.String("MODERATION_OUTPUT_ACTION", stringOr(fc.Moderation.OutputAction, moderation.ActionOff))
+	ModerationFailOpen = env.Bool("MODERATION_FAIL_OPEN", boolOr(fc.Moderation.FailOpen, true))
+	ModerationStreamBuffer = env.Int("MODERATION_STREAM_BUFFER", positiveOr(fc.Moderation.StreamBuffer, moderation.DefaultStreamBuffer))
+
+	PIIRestore = env.Bool("PII_RESTORE", boolOr(fc.PII.Restore, true))
+
+	poolMinHealthy := 1
+	if fc.Events.PoolMinHealthy != nil {
+		poolMinHealthy = *fc.Events.PoolMinHealthy
+	}
+	EventPoolMinHealthy = env.Int("EVENT_POOL_MIN_HEALTHY", poolMinHealthy)
+	errorSpikeCount := 10
+	if fc.Events.ErrorSpike.Count != nil {
+		errorSpikeCount = *fc.Events.ErrorSpike.Count
+	}
+	EventErrorSpikeCount = env.Int("EVENT_ERROR_SPIKE_COUNT", errorSpikeCount)
+	EventErrorSpikeWindow = env.Int("EVENT_ERROR_SPIKE_WINDOW", positiveOr(int(time.Duration(fc.Events.ErrorSpike.Window).Seconds()), 60))
+	EventQuotaDailyTokens = env.Int("EVENT_QUOTA_DAILY_TOKENS", fc.Events.Quota.DailyTokens)
+	quotaThreshold := 0.2
+	if fc.Events.Quota.Threshold != nil {
+		quotaThreshold = *fc.Events.Quota.Threshold
+	}
+	EventQuotaThreshold = env.Float64("EVENT_QUOTA_THRESHOLD", quotaThreshold)
+
+	ResponseCacheEnabled = env.Bool("RESPONSE_CACHE_ENABLED", boolOr(fc.Cache.Enabled, false))
+	ResponseCacheTTL = env.Int("RESPONSE_CACHE_TTL", positiveOr(int(time.Duration(fc.Cache.TTL).Seconds()), 60*60))
+
+	AuditLogEnabled = env.Bool("AUDIT_LOG_ENABLED", boolOr(fc.Audit.Enabled, false))
+
+	redactRules := "all"
+	if fc.Audit.RedactRules != nil {
+		redactRules = strings.Join(fc.Audit.RedactRules, ",")
+	}
+	AuditRedactRules = splitList(env.String("AUDIT_REDACT_RULES", redactRules))
+	AuditCustomRules = fc.Audit.CustomRules
+
+	LogLevel = env.String("LOG_LEVEL", fc.Logging.Level)
+	SchedulerMaxConcurrency = env.Int("SCHEDULER_MAX_CONCURRENCY", fc.Scheduler.MaxConcurrency)
+	SchedulerMaxQueue = env.Int("SCHEDULER_MAX_QUEUE", positiveOr(fc.Scheduler.MaxQueue, 100))
+	SchedulerMaxQueuePerKey = env.Int("SCHEDULER_MAX_QUEUE_PER_KEY", positiveOr(fc.Scheduler.MaxQueuePerKey, 20))
+	SchedulerQueueTimeout = env.Int("SCHEDULER_QUEUE_TIMEOUT", positiveOr(int(time.Duration(fc.Scheduler.QueueTimeout).Seconds()), 60))
+	keyWeights := make([]string, 0, len(fc.Scheduler.KeyWeights))
+	for key, weight := range fc.Scheduler.KeyWeights {
+		keyWeights = append(keyWeights, key+"="+strconv.FormatFloat(weight, 'f', -1, 64))
+	}
+	SchedulerKeyWeights = parseKeyMap(env.String("SCHEDULER_KEY_WEIGHTS", strings.Join(keyWeights, ",")))
+	keyPriorities := make([]string, 0, len(fc.Scheduler.KeyPriorities))
+	for key, priority := range fc.Scheduler.KeyPriorities {
+		keyPriorities = append(keyPriorities, key+"="+priority)
+	}
+	SchedulerKeyPriorities = parseKeyMap(env.String("SCHEDULER_KEY_PRIORITIES", strings.Join(keyPriorities, ",")))
+
+	readyMinCredentials := 1
+	if fc.Health.MinCredentials != nil {
+		readyMinCredentials = *fc.Health.MinCredentials
+	}
+	ReadyMinCredentials = env.Int("READY_MIN_CREDENTIALS", readyMinCredentials)
+	ReadyCheckUpstream = env.Bool("READY_CHECK_UPSTREAM", boolOr(fc.Health.CheckUpstream, true))
+
+	configReloadPeriod = time.Duration(fc.ReloadPeriod)
+	inputs.assign()
+
+	InitSGCookies()
+	ApplySettings()
+}
+
+// fileReloadInputs 配置文件中需要编译校验的配置, 已设置的环境变量仍然优先
+func fileReloadInputs(fc *FileConfig) reloadInputs {
+	var in reloadInputs
+	in.models = MergeModels(DefaultModels, fc.Models.Registry)
+	modelAliases := make([]string, 0, len(fc.Models.Aliases))
+	for alias, target := range fc.Models.Aliases {
+		modelAliases = append(modelAliases, alias+"="+target)
+	}
+	in.modelAliases = parseKeyValueList(env.String("MODEL_ALIASES", strings.Join(modelAliases, ",")))
+	modelFallbacks := make([]string, 0, len(fc.Models.Fallbacks))
+	for name, chain := range fc.Models.Fallbacks {
+		modelFallbacks = append(modelFallbacks, name+"="+strings.Join(chain, "|"))
+	}
+	in.modelFallbacks = parseFallbackList(env.String("MODEL_FALLBACKS", strings.Join(modelFallbacks, ",")))
+
+	promptPolicies := ""
+	if len(fc.Prompts.Policies) > 0 {
+		if data, err := json.Marshal(fc.Prompts.Policies); err == nil {
+			promptPolicies = string(data)
+		}
+	}
+	in.promptPoliciesJSON = env.String("PROMPT_POLICIES_JSON", promptPolicies)
+	keyNames := make([]string, 0, len(fc.Prompts.KeyNames))
+	for key, name := range fc.Prompts.KeyNames {
+		keyNames = append(keyNames, key+"="+name)
+	}
+	in.promptKeyNames = parseKeyValueList(env.String("PROMPT_KEY_NAMES", strings.Join(keyNames, ",")))
+
+	moderationRules := ""
+	if len(fc.Moderation.Rules) > 0 {
+		if data, err := json.Marshal(fc.Moderation.Rules); err == nil {
+			moderationRules = string(data)
+		}
+	}
+	in.moderationRulesJSON = env.String("MODERATION_RULES_JSON", moderationRules)
+	in.moderationWebhookUrl = env.String("MODERATION_WEBHOOK_URL", fc.Moderation.Webhook.Url)
+	in.moderationWebhookSecret = env.String("MODERATION_WEBHOOK_SECRET", fc.Moderation.Webhook.Secret)
+	in.moderationWebhookModel = env.String("MODERATION_WEBHOOK_MODEL", fc.Moderation.Webhook.Model)
+	in.moderationWebhookTimeout = env.Int("MODERATION_WEBHOOK_TIMEOUT", positiveOr(int(time.Duration(fc.Moderation.Webhook.Timeout).Seconds()), 5))
+
+	in.piiRedactEnabled = env.Bool("PII_REDACT_ENABLED", boolOr(fc.PII.Enabled, false))
+	piiRules := strings.Join(pii.DefaultRules, ",")
+	if fc.PII.Rules != nil {
+		piiRules = strings.Join(fc.PII.Rules, ",")
+	}
+	in.piiRedactRules = splitList(env.String("PII_REDACT_RULES", piiRules))
+	piiCustomRules := ""
+	if len(fc.PII.CustomRules) > 0 {
+		if data, err := json.Marshal(fc.PII.CustomRules); err == nil {
+			piiCustomRules = string(data)
+		}
+	}
+	in.piiCustomRulesJSON = env.String("PII_CUSTOM_RULES_JSON", piiCustomRules)
+	piiKeyPolicies := make([]string, 0, len(fc.PII.KeyPolicies))
+	for key, policy := range fc.PII.KeyPolicies {
+		piiKeyPolicies = append(piiKeyPolicies, key+"="+strings.Join(policy, "|"))
+	}
+	in.piiKeyPolicies = parseFallbackList(env.String("PII_KEY_POLICIES", strings.Join(piiKeyPolicies, ",")))
+
+	hooks := ""
+	if fc.Hooks != nil {
+		if data, err := json.Marshal(fc.Hooks); err == nil {
+			hooks = string(data)
+		}
+	}
+	in.hooksJSON = env.String("HOOKS_JSON", hooks)
+
+	eventWebhooks := ""
+	if len(fc.Events.Webhooks) > 0 {
+		if data, err := json.Marshal(fc.Events.Webhooks); err == nil {
+			eventWebhooks = string(data)
+		}
+	}
+	in.eventWebhooksJSON = env.String("EVENT_WEBHOOKS_JSON", eventWebhooks)
+
+	in.ipAccess.Allow = splitList(env.String("IP_ALLOW_LIST", strings.Join(fc.IpAccess.Allow, ",")))
+	in.ipAccess.Deny = append(splitList(env.String("IP_DENY_LIST", strings.Join(fc.IpAccess.Deny, ","))),
+		splitList(env.String("IP_BLACK_LIST", strings.Join(fc.IpBlackList, ",")))...)
+	in.ipAccess.Api.Allow = splitList(env.String("API_IP_ALLOW_LIST", strings.Join(fc.IpAccess.Api.Allow, ",")))
+	in.ipAccess.Api.Deny = splitList(env.String("API_IP_DENY_LIST", strings.Join(fc.IpAccess.Api.Deny, ",")))
+	in.ipAccess.Admin.Allow = splitList(env.String("ADMIN_IP_ALLOW_LIST", strings.Join(fc.IpAccess.Admin.Allow, ",")))
+	in.ipAccess.Admin.Deny = splitList(env.String("ADMIN_IP_DENY_LIST", strings.Join(fc.IpAccess.Admin.Deny, ",")))
+	in.ipAccess.TrustedProxies = splitList(env.String("TRUSTED_PROXIES", strings.Join(fc.IpAccess.TrustedProxies, ",")))
+	return in
+}
+
+func boolOr(value *bool, defaultValue bool) bool {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+func stringOr(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func intOr(value int, defaultValue string) string {
+	if value == 0 {
+		return defaultValue
+	}
+	return strconv.Itoa(value)
+}
+
+func positiveOr(value int, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// WatchConfigFile 收到 SIGHUP 或检测到配置文件变更时重新加载配置.
+// 校验失败时保留当前配置; 进行中的请求持有各自的凭证副本, 不受影响.
+// 路由前缀、端口等启动时生效的配置(见 applyStartupConfig)需重启后生效.
+func WatchConfigFile(onReload func(reason string, err error)) {
+	if ConfigFile == "" {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	period := configReloadPeriod
+	if period <= 0 {
+		period = 10 * time.Second
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			onReload("SIGHUP", LoadConfigFile(ConfigFile))
+		case <-ticker.C:
+			stat, err := os.Stat(ConfigFile)
+			if err != nil {
+				continue
+			}
+			configMutex.Lock()
+			changed := !stat.ModTime().Equal(configModTime)
+			configMutex.Unlock()
+			if changed {
+				err = LoadConfigFile(ConfigFile)
+				if err != nil {
+					// 避免对同一个错误版本重复报错
+					configMutex.Lock()
+					configModTime = stat.ModTime()
+					configMutex.Unlock()
+				}
+				onReload("file change", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"rovo2api/common/prompt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testConfigA = `
+auth:
+  api_keys: [key-a]
+credentials:
+  - value: a@example.com:token-a
+models:
+  aliases:
+    alias-a: anthropic:claude-sonnet-4@20250514
+rate_limit:
+  requests_per_minute: 10
+  credential_max_concurrency: 1
+context:
+  strategy: reject
+moderation:
+  input_action: block
+cache:
+  enabled: true
+scheduler:
+  max_concurrency: 1
+  key_weights:
+    key-a: 2
+events:
+  quota:
+    daily_tokens: 1000
+`
+
+const testConfigB = `
+auth:
+  api_keys: [key-b]
+credentials:
+  - value: b@example.com:token-b
+models:
+  aliases:
+    alias-b: anthropic:claude-sonnet-4@20250514
+rate_limit:
+  requests_per_minute: 20
+  credential_max_concurrency: 2
+context:
+  strategy: truncate
+moderation:
+  input_action: flag
+cache:
+  enabled: false
+scheduler:
+  max_concurrency: 2
+  key_weights:
+    key-b: 3
+events:
+  quota:
+    daily_tokens: 2000
+`
+
+// 编译失败的配置不会部分生效
+func TestLoadConfigFileKeepsConfigOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, testConfigA)
+	if err := LoadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfigFile(t, path, testConfigB)
+	// 环境变量优先于配置文件, 配置文件的校验无法发现
+	t.Setenv("HOOKS_JSON", `[{"routes":["/v1/chat/completions"]}]`)
+	if err := LoadConfigFile(path); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if ApiSecret != "key-a" || GetSettings().ApiSecret != "key-a" {
+		t.Fatalf("api key = %q, settings = %q, want key-a", ApiSecret, GetSettings().ApiSecret)
+	}
+	if cookies := GetRVCookies(); len(cookies) != 1 || cookies[0] != "a@example.com:token-a" {
+		t.Fatalf("credentials = %v", cookies)
+	}
+	if _, ok := GetModelInfo("alias-a"); !ok {
+		t.Fatal("alias-a was removed")
+	}
+	if _, ok := GetModelInfo("alias-b"); ok {
+		t.Fatal("alias-b was applied")
+	}
+	if HooksJSON != "" {
+		t.Fatalf("HOOKS_JSON = %q", HooksJSON)
+	}
+}
+
+// 热加载与请求并发读取配置, 使用 -race 运行
+func TestLoadConfigFileConcurrentReload(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")}
+	writeConfigFile(t, paths[0], testConfigA)
+	writeConfigFile(t, paths[1], testConfigB)
+	if err := LoadConfigFile(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	loop := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				fn(i)
+			}
+		}()
+	}
+	loop(func(i int) {
+		if err := LoadConfigFile(paths[i%2]); err != nil {
+			t.Error(err)
+		}
+	})
+	// 各读取方使用不同的锁, 分别运行以免彼此建立同步关系掩盖数据竞争
+	// 请求中读取的配置来自同一个快照, 不会混合两个版本
+	loop(func(int) {
+		settings := GetSettings()
+		got := []any{settings.RequestRateLimitNum, settings.CredentialMaxConcurrency, settings.ContextStrategy,
+			settings.ModerationInputAction, settings.ResponseCacheEnabled, settings.SchedulerMaxConcurrency,
+			settings.SchedulerKeyWeights[prompt.KeyID(settings.ApiSecret)], settings.EventQuotaDailyTokens}
+		want := map[string][]any{
+			"key-a": {10, 1, ContextStrategyReject, "block", true, 1, "2", 1000},
+			"key-b": {20, 2, ContextStrategyTruncate, "flag", false, 2, "3", 2000},
+		}[settings.ApiSecret]
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("settings of %q = %v, want %v", settings.ApiSecret, got, want)
+		}
+	})
+	// 配置包内在请求中读取配置的函数
+	loop(func(int) { CredentialIdle() })
+	loop(func(int) { publishQuotaLow("a@example.com:token-a", 0, 0) })
+	loop(func(int) { GetRVCookies() })
+	loop(func(int) { GetModelInfo("alias-a") })
+	loop(func(int) { GetHookBindings() })
+	loop(func(int) { EffectiveConfig() })
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+// 调度权重及优先级可以使用 API-KEY 或其标识配置, 统一以标识为键
+func TestSchedulerKeysUseKeyID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `
+scheduler:
+  key_weights:
+    sk-heavy: 3
+  key_priorities:
+    `+prompt.KeyID("sk-batch")+`: batch
+`)
+	if err := LoadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	settings := GetSettings()
+	if weight := settings.SchedulerKeyWeights[prompt.KeyID("sk-heavy")]; weight != "3" {
+		t.Fatalf("weights = %v", settings.SchedulerKeyWeights)
+	}
+	if priority := settings.SchedulerKeyPriorities[prompt.KeyID("sk-batch")]; priority != "batch" {
+		t.Fatalf("priorities = %v", settings.SchedulerKeyPriorities)
+	}
+	if _, ok := settings.SchedulerKeyWeights["sk-heavy"]; ok {
+		t.Fatal("raw API-KEY kept as a key")
+	}
+}
+
+// 热加载不修改启动时生效的配置
+func TestLoadConfigFileKeepsStartupConfig(t *testing.T) {
+	previousStarted, previousPort, previousPrefix := configStarted, Port, RoutePrefix
+	t.Cleanup(func() { configStarted, Port, RoutePrefix = previousStarted, previousPort, previousPrefix })
+	configStarted = false
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, testConfigA+`
+server:
+  port: 8001
+routing:
+  route_prefix: /a
+`)
+	if err := LoadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	writeConfigFile(t, path, testConfigB+`
+server:
+  port: 8002
+routing:
+  route_prefix: /b
+`)
+	if err := LoadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if Port != "8001" || RoutePrefix != "/a" {
+		t.Fatalf("port = %s, route prefix = %s, want the values loaded at startup", Port, RoutePrefix)
+	}
+	if settings := GetSettings(); settings.ApiSecret != "key-b" || settings.RequestRateLimitNum != 20 {
+		t.Fatalf("reloadable settings were not applied: %q, %d", settings.ApiSecret, settings.RequestRateLimitNum)
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rovo2api/common/env"
+	"rovo2api/common/prompt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// HookBinding 启用的插件及其适用范围, routes、keys 为空时适用于所有接口、API-KEY
+type HookBinding struct {
+	Name   string   `yaml:"name" json:"name"`
+	Routes []string `yaml:"routes" json:"routes,omitempty"` // 接口路径, 不含 ROUTE_PREFIX, 如 /v1/chat/completions
+	Keys   []string `yaml:"keys" json:"keys,omitempty"`     // API-KEY 或其标识 key-xxxx
+}
+
+// DefaultHooks 未配置插件时按顺序启用的内置插件
+var DefaultHooks = []string{"prompt", "pii", "stop"}
+
+// 按顺序启用的插件(JSON 数组, 同配置文件 hooks), 为空时启用 DefaultHooks
+var HooksJSON = env.String("HOOKS_JSON", "")
+
+// HookRegistered 检查插件是否已注册, 由注册插件的包设置, 为 nil 时不检查
+var HookRegistered func(name string) bool
+
+var (
+	hookMutex    sync.RWMutex
+	hookBindings []HookBinding
+)
+
+// validateHookBindings 校验插件配置, 返回带下标的错误
+func validateHookBindings(bindings []HookBinding) []string {
+	var errs []string
+	for i, binding := range bindings {
+		switch {
+		case binding.Name == "":
+			errs = append(errs, fmt.Sprintf("[%d].name: is required", i))
+		case HookRegistered != nil && !HookRegistered(binding.Name):
+			errs = append(errs, fmt.Sprintf("[%d].name: unknown hook %q", i, binding.Name))
+		}
+		for _, route := range binding.Routes {
+			if !strings.HasPrefix(route, "/") {
+				errs = append(errs, fmt.Sprintf("[%d].routes: %q must start with /", i, route))
+			}
+		}
+	}
+	return errs
+}
+
+// compileHooks 解析并校验插件配置, 未配置时使用 DefaultHooks
+func compileHooks(raw string) ([]HookBinding, error) {
+	var bindings []HookBinding
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &bindings); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, name := range DefaultHooks {
+			bindings = append(bindings, HookBinding{Name: name})
+		}
+	}
+	if errs := validateHookBindings(bindings); len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	for i := range bindings {
+		keys := make([]string, 0, len(bindings[i].Keys))
+		for _, key := range bindings[i].Keys {
+			keys = append(keys, prompt.KeyID(key))
+		}
+		bindings[i].Keys = keys
+	}
+	return bindings, nil
+}
+
+func storeHooks(bindings []HookBinding) {
+	hookMutex.Lock()
+	defer hookMutex.Unlock()
+	hookBindings = bindings
+}
+
+// ApplyHooks 使用 HooksJSON 重建插件配置, 校验失败时保留原配置
+func ApplyHooks() error {
+	bindings, err := compileHooks(HooksJSON)
+	if err != nil {
+		return err
+	}
+	storeHooks(bindings)
+	return nil
+}
+
+// GetHookBindings 当前的插件配置, API-KEY 已转换为标识
+func GetHookBindings() []HookBinding {
+	hookMutex.RLock()
+	defer hookMutex.RUnlock()
+	return hookBindings
+}
+
+// HookNames 适用于指定接口及 API-KEY 标识的插件, 按配置顺序
+func HookNames(route, keyID string) []string {
+	hookMutex.RLock()
+	defer hookMutex.RUnlock()
+	var names []string
+	for _, binding := range hookBindings {
+		if len(binding.Routes) > 0 && !slices.Contains(binding.Routes, route) {
+			continue
+		}
+		if len(binding.Keys) > 0 && (keyID == "" || !slices.Contains(binding.Keys, keyID)) {
+			continue
+		}
+		names = append(names, binding.Name)
+	}
+	return names
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"rovo2api/common/ipfilter"
+	"sync/atomic"
+)
+
+// IPLists 允许及拒绝的 IP 或 CIDR
+type IPLists struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// IPAccessLists IP 访问控制的配置, 同配置文件 ip_access
+type IPAccessLists struct {
+	TrustedProxies []string `json:"trusted_proxies"`
+	Allow          []string `json:"allow"`
+	Deny           []string `json:"deny"`
+	Api            IPLists  `json:"api"`
+	Admin          IPLists  `json:"admin"`
+}
+
+// IPAccess 解析后的 IP 访问控制, 只整体替换, 请求中只读
+type IPAccess struct {
+	Lists   IPAccessLists
+	Trusted ipfilter.List
+	Global  ipfilter.Rules
+	Api     ipfilter.Rules
+	Admin   ipfilter.Rules
+}
+
+var currentIPAccess atomic.Pointer[IPAccess]
+
+func parseIPRules(field string, lists IPLists) (ipfilter.Rules, error) {
+	allow, err := ipfilter.ParseList(lists.Allow)
+	if err != nil {
+		return ipfilter.Rules{}, fmt.Errorf("%sallow: %v", field, err)
+	}
+	deny, err := ipfilter.ParseList(lists.Deny)
+	if err != nil {
+		return ipfilter.Rules{}, fmt.Errorf("%sdeny: %v", field, err)
+	}
+	return ipfilter.Rules{Allow: allow, Deny: deny}, nil
+}
+
+// ParseIPAccess 解析全部列表, 错误带字段名
+func ParseIPAccess(lists IPAccessLists) (*IPAccess, error) {
+	trusted, err := ipfilter.ParseList(lists.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %v", err)
+	}
+	access := &IPAccess{Lists: lists, Trusted: trusted}
+	if access.Global, err = parseIPRules("", IPLists{Allow: lists.Allow, Deny: lists.Deny}); err != nil {
+		return nil, err
+	}
+	if access.Api, err = parseIPRules("api.", lists.Api); err != nil {
+		return nil, err
+	}
+	if access.Admin, err = parseIPRules("admin.", lists.Admin); err != nil {
+		return nil, err
+	}
+	return access, nil
+}
+
+// ApplyIPAccess 使用 TRUSTED_PROXIES 及各 IP 列表重建访问控制, 校验失败时保留原配置
+func ApplyIPAccess() error {
+	access, err := ParseIPAccess(IPAccessLists{
+		TrustedProxies: TrustedProxies,
+		Allow:          IpAllowList,
+		Deny:           IpDenyList,
+		Api:            IPLists{Allow: ApiIpAllowList, Deny: ApiIpDenyList},
+		Admin:          IPLists{Allow: AdminIpAllowList, Deny: AdminIpDenyList},
+	})
+	if err != nil {
+		return err
+	}
+	SetIPAccess(access)
+	return nil
+}
+
+// SetIPAccess 替换访问控制, 配置热加载或重启后恢复为配置的值
+func SetIPAccess(access *IPAccess) {
+	currentIPAccess.Store(access)
+}
+
+// GetIPAccess 当前的访问控制, 未设置时不做限制
+func GetIPAccess() *IPAccess {
+	if access := currentIPAccess.Load(); access != nil {
+		return access
+	}
+	return &IPAccess{}
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed models.yaml
+var defaultModelsYAML []byte
+
+// ModelInfo 模型元数据
+type ModelInfo struct {
+	ID              string    `yaml:"id"`
+	Upstream        string    `yaml:"upstream"`
+	OwnedBy         string    `yaml:"owned_by"`
+	Created         time.Time `yaml:"created"`
+	ContextWindow   int       `yaml:"context_window"`
+	MaxOutputTokens int       `yaml:"max_output_tokens"`
+	Vision          bool      `yaml:"vision"`
+	Tools           bool      `yaml:"tools"`
+	Aliases         []string  `yaml:"aliases"`
+	DeprecatedNames []string  `yaml:"deprecated_names"`
+	Disabled        bool      `yaml:"disabled"`
+}
+
+// UpstreamModel 返回发送给 Rovo 的模型名
+func (m ModelInfo) UpstreamModel() string {
+	if m.Upstream != "" {
+		return m.Upstream
+	}
+	// 从 前缀:模型 格式中提取出真实的模型ID
+	parts := strings.Split(m.ID, ":")
+	if len(parts) > 1 {
+		return strings.Join(parts[1:], ":")
+	}
+	return m.ID
+}
+
+type modelRegistry struct {
+	models    map[string]ModelInfo // id -> info
+	aliases   map[string]string    // alias -> id
+	redirs    map[string]string    // deprecated name -> id
+	fallbacks map[string][]string  // 模型名(id/别名) -> 备用模型链
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      modelRegistry
+	// DefaultModels 内置模型注册表
+	DefaultModels = loadDefaultModels()
+)
+
+func loadDefaultModels() []ModelInfo {
+	var models []ModelInfo
+	if err := yaml.Unmarshal(defaultModelsYAML, &models); err != nil {
+		panic(fmt.Sprintf("invalid embedded models.yaml: %v", err))
+	}
+	if err := SetModelRegistry(models, nil, nil); err != nil {
+		panic(fmt.Sprintf("invalid embedded models.yaml: %v", err))
+	}
+	return models
+}
+
+// MergeModels 以 id 为键用 overrides 覆盖 base, 未出现的新模型追加在后
+func MergeModels(base []ModelInfo, overrides []ModelInfo) []ModelInfo {
+	merged := make([]ModelInfo, 0, len(base)+len(overrides))
+	index := make(map[string]int)
+	for _, m := range base {
+		index[m.ID] = len(merged)
+		merged = append(merged, m)
+	}
+	for _, m := range overrides {
+		if i, ok := index[m.ID]; ok {
+			merged[i] = m
+			continue
+		}
+		index[m.ID] = len(merged)
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// ValidateModels 校验模型列表、别名及备用模型链, 返回带字段路径的错误列表
+func ValidateModels(models []ModelInfo, extraAliases map[string]string, fallbacks map[string][]string) []string {
+	var errs []string
+	names := make(map[string]string)
+	claim := func(field, name, owner string) {
+		if name == "" {
+			errs = append(errs, field+": must not be empty")
+			return
+		}
+		if prev, ok := names[name]; ok && prev != owner {
+			errs = append(errs, fmt.Sprintf("%s: %q is already used by %s", field, name, prev))
+			return
+		}
+		names[name] = owner
+	}
+	for _, m := range models {
+		field := fmt.Sprintf("models.registry[%s]", m.ID)
+		claim(field+".id", m.ID, m.ID)
+		// /v1/models 返回 created, 零值会输出为负数的时间戳
+		if m.Created.IsZero() {
+			errs = append(errs, field+".created: must be set, e.g. 2025-05-14")
+		}
+		if m.ContextWindow <= 0 {
+			errs = append(errs, fmt.Sprintf("%s.context_window: must be positive, got %d", field, m.ContextWindow))
+		}
+		if m.MaxOutputTokens <= 0 {
+			errs = append(errs, fmt.Sprintf("%s.max_output_tokens: must be positive, got %d", field, m.MaxOutputTokens))
+		} else if m.ContextWindow > 0 && m.MaxOutputTokens > m.ContextWindow {
+			errs = append(errs, fmt.Sprintf("%s.max_output_tokens: %d exceeds context_window %d", field, m.MaxOutputTokens, m.ContextWindow))
+		}
+		for j, alias := range m.Aliases {
+			claim(fmt.Sprintf("%s.aliases[%d]", field, j), alias, m.ID)
+		}
+		for j, name := range m.DeprecatedNames {
+			claim(fmt.Sprintf("%s.deprecated_names[%d]", field, j), name, m.ID)
+		}
+	}
+	aliases := make([]string, 0, len(extraAliases))
+	for alias := range extraAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		target := extraAliases[alias]
+		field := fmt.Sprintf("models.aliases[%s]", alias)
+		found := false
+		for _, m := range models {
+			if m.ID == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: unknown target model %q", field, target))
+			continue
+		}
+		claim(field, alias, target)
+	}
+
+	keys := make([]string, 0, len(fallbacks))
+	for name := range fallbacks {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		field := fmt.Sprintf("models.fallbacks[%s]", name)
+		if _, ok := names[name]; !ok {
+			errs = append(errs, fmt.Sprintf("%s: unknown model %q", field, name))
+		}
+		if len(fallbacks[name]) == 0 {
+			errs = append(errs, field+": must not be empty")
+		}
+		for j, target := range fallbacks[name] {
+			if _, ok := names[target]; !ok {
+				errs = append(errs, fmt.Sprintf("%s[%d]: unknown model %q", field, j, target))
+			}
+		}
+	}
+	return errs
+}
+
+// compileModelRegistry 校验并构建模型注册表, extraAliases 为额外的 别名->模型id 映射,
+// fallbacks 为 模型名->备用模型链
+func compileModelRegistry(models []ModelInfo, extraAliases map[string]string, fallbacks map[string][]string) (modelRegistry, error) {
+	if errs := ValidateModels(models, extraAliases, fallbacks); len(errs) > 0 {
+		return modelRegistry{}, fmt.Errorf("invalid model registry:\n  %s", strings.Join(errs, "\n  "))
+	}
+	next := modelRegistry{
+		models:    make(map[string]ModelInfo),
+		aliases:   make(map[string]string),
+		redirs:    make(map[string]string),
+		fallbacks: fallbacks,
+	}
+	for _, m := range models {
+		if m.Disabled {
+			continue
+		}
+		next.models[m.ID] = m
+		for _, alias := range m.Aliases {
+			next.aliases[alias] = m.ID
+		}
+		for _, name := range m.DeprecatedNames {
+			next.redirs[name] = m.ID
+		}
+	}
+	for alias, target := range extraAliases {
+		if _, ok := next.models[target]; ok {
+			next.aliases[alias] = target
+		}
+	}
+
+	return next, nil
+}
+
+func storeModelRegistry(next modelRegistry) {
+	registryMutex.Lock()
+	registry = next
+	registryMutex.Unlock()
+}
+
+// SetModelRegistry 校验并替换当前模型注册表, 校验失败时保留原注册表
+func SetModelRegistry(models []ModelInfo, extraAliases map[string]string, fallbacks map[string][]string) error {
+	next, err := compileModelRegistry(models, extraAliases, fallbacks)
+	if err != nil {
+		return err
+	}
+	storeModelRegistry(next)
+	return nil
+}
+
+// ApplyModelRegistry 使用 ModelRegistry、ModelAliases 与 ModelFallbacks 重建模型注册表
+func ApplyModelRegistry() error {
+	return SetModelRegistry(ModelRegistry, ModelAliases, ModelFallbacks)
+}
+
+func (r modelRegistry) lookup(modelName string) (ModelInfo, bool) {
+	if info, ok := r.models[modelName]; ok {
+		return info, true
+	}
+	if id, ok := r.aliases[modelName]; ok {
+		return r.models[id], true
+	}
+	if id, ok := r.redirs[modelName]; ok {
+		return r.models[id], true
+	}
+	return ModelInfo{}, false
+}
+
+// 获取模型信息, 支持别名及已废弃名称
+func GetModelInfo(modelName string) (ModelInfo, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return registry.lookup(modelName)
+}
+
+// FallbackModel 备用模型链中的一项, Name 为返回给客户端的模型名
+type FallbackModel struct {
+	Name string
+	Info ModelInfo
+}
+
+// GetFallbackChain 返回请求模型及其备用模型链, 第一项为请求模型本身.
+// 先按请求的模型名查找, 找不到时再按模型 id 查找; 已禁用或重复的模型会被跳过
+func GetFallbackChain(modelName string) []FallbackModel {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	info, ok := registry.lookup(modelName)
+	if !ok {
+		return nil
+	}
+	chain := []FallbackModel{{Name: modelName, Info: info}}
+	names, ok := registry.fallbacks[modelName]
+	if !ok {
+		names = registry.fallbacks[info.ID]
+	}
+	seen := map[string]bool{info.ID: true}
+	for _, name := range names {
+		fallbackInfo, ok := registry.lookup(name)
+		if !ok || seen[fallbackInfo.ID] {
+			continue
+		}
+		seen[fallbackInfo.ID] = true
+		chain = append(chain, FallbackModel{Name: name, Info: fallbackInfo})
+	}
+	return chain
+}
+
+// ModelListEntry /v1/models 中的一项, Root 为别名指向的模型 id
+type ModelListEntry struct {
+	Name string
+	Root string
+	Info ModelInfo
+}
+
+// 获取所有支持的模型列表(含别名), 按名称排序
+func GetModelEntries() []ModelListEntry {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	entries := make([]ModelListEntry, 0, len(registry.models)+len(registry.aliases))
+	for id, info := range registry.models {
+		entries = append(entries, ModelListEntry{Name: id, Root: id, Info: info})
+	}
+	for alias, id := range registry.aliases {
+		entries = append(entries, ModelListEntry{Name: alias, Root: id, Info: registry.models[id]})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// 获取所有支持的模型列表
+func GetModelList() []string {
+	entries := GetModelEntries()
+	models := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		models = append(models, entry.Name)
+	}
+	return models
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateModels(t *testing.T) {
+	valid := ModelInfo{
+		ID:              "anthropic:test@20250514",
+		Created:         time.Date(2025, 5, 14, 0, 0, 0, 0, time.UTC),
+		ContextWindow:   200000,
+		MaxOutputTokens: 64000,
+	}
+	tests := []struct {
+		name   string
+		modify func(m *ModelInfo)
+		want   string
+	}{
+		{"valid", func(m *ModelInfo) {}, ""},
+		{"missing created", func(m *ModelInfo) { m.Created = time.Time{} }, ".created: must be set"},
+		{"missing context window", func(m *ModelInfo) { m.ContextWindow = 0 }, ".context_window: must be positive"},
+		{"output exceeds context", func(m *ModelInfo) { m.MaxOutputTokens = 300000 }, "exceeds context_window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := valid
+			tt.modify(&m)
+			errs := ValidateModels([]ModelInfo{m}, nil, nil)
+			if tt.want == "" {
+				if len(errs) != 0 {
+					t.Fatalf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0], tt.want) {
+				t.Fatalf("errors = %v, want one containing %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+// 内置模型均需设置 created, /v1/models 返回的时间戳不能为零值
+func TestDefaultModelsCreated(t *testing.T) {
+	for _, m := range DefaultModels {
+		if m.Created.IsZero() || m.Created.Unix() <= 0 {
+			t.Errorf("%s: created = %v", m.ID, m.Created)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"rovo2api/common/env"
+	"rovo2api/common/moderation"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内容审核: 输入/输出的处理方式、本地规则(JSON 数组, 同配置文件 moderation.rules)及外部分类器
+var (
+	ModerationInputAction    = env.String("MODERATION_INPUT_ACTION", moderation.ActionOff)
+	ModerationOutputAction   = env.String("MODERATION_OUTPUT_ACTION", moderation.ActionOff)
+	ModerationRulesJSON      = env.String("MODERATION_RULES_JSON", "")
+	ModerationWebhookUrl     = env.String("MODERATION_WEBHOOK_URL", "")
+	ModerationWebhookSecret  = env.String("MODERATION_WEBHOOK_SECRET", "")
+	ModerationWebhookModel   = env.String("MODERATION_WEBHOOK_MODEL", "")
+	ModerationWebhookTimeout = env.Int("MODERATION_WEBHOOK_TIMEOUT", 5)
+	ModerationFailOpen       = env.Bool("MODERATION_FAIL_OPEN", true)
+	ModerationStreamBuffer   = env.Int("MODERATION_STREAM_BUFFER", moderation.DefaultStreamBuffer)
+)
+
+var (
+	moderationMutex  sync.RWMutex
+	moderationEngine = &moderation.Engine{}
+)
+
+// compileModeration 解析审核规则并创建审核引擎
+func compileModeration(rulesJSON string, webhook moderation.WebhookOptions) (*moderation.Engine, error) {
+	var rules []moderation.Rule
+	if strings.TrimSpace(rulesJSON) != "" {
+		if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+			return nil, err
+		}
+	}
+	engine, errs := moderation.New(moderation.Options{Rules: rules, Webhook: webhook})
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	return engine, nil
+}
+
+func moderationWebhookOptions() moderation.WebhookOptions {
+	return moderation.WebhookOptions{
+		URL:     ModerationWebhookUrl,
+		Secret:  ModerationWebhookSecret,
+		Model:   ModerationWebhookModel,
+		Timeout: time.Duration(ModerationWebhookTimeout) * time.Second,
+	}
+}
+
+func storeModeration(engine *moderation.Engine) {
+	moderationMutex.Lock()
+	defer moderationMutex.Unlock()
+	moderationEngine = engine
+}
+
+// ApplyModeration 使用当前配置重建审核引擎, 校验失败时保留原引擎
+func ApplyModeration() error {
+	engine, err := compileModeration(ModerationRulesJSON, moderationWebhookOptions())
+	if err != nil {
+		return err
+	}
+	storeModeration(engine)
+	return nil
+}
+
+// GetModerationEngine 当前的审核引擎
+func GetModerationEngine() *moderation.Engine {
+	moderationMutex.RLock()
+	defer moderationMutex.RUnlock()
+	return moderationEngine
+}
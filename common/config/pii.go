@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"rovo2api/common/env"
+	"rovo2api/common/pii"
+	"rovo2api/common/prompt"
+	"strings"
+	"sync"
+)
+
+// PII_KEY_POLICIES 中表示不脱敏、只使用自定义规则的取值
+const (
+	PIIPolicyOff  = "off"
+	PIIPolicyNone = "none"
+)
+
+// 发送到上游前的可逆脱敏: 内置规则、自定义规则(JSON 数组, 同配置文件 pii.custom_rules)及按 API-KEY 的策略(key=规则1|规则2, off 表示不脱敏)
+var (
+	PIIRedactEnabled   = env.Bool("PII_REDACT_ENABLED", false)
+	PIIRedactRules     = splitList(env.String("PII_REDACT_RULES", strings.Join(pii.DefaultRules, ",")))
+	PIICustomRulesJSON = env.String("PII_CUSTOM_RULES_JSON", "")
+	PIIKeyPolicies     = parseFallbackList(env.String("PII_KEY_POLICIES", ""))
+	PIIRestore         = env.Bool("PII_RESTORE", true)
+)
+
+var (
+	piiMutex          sync.RWMutex
+	piiDefault        *pii.Redactor
+	piiKeyRedactors   = map[string]*pii.Redactor{}
+	piiDefaultEnabled bool
+)
+
+// NewPIIRedactor 按策略创建脱敏规则; off 返回 nil, none 只使用自定义规则
+func NewPIIRedactor(policy []string, custom []pii.Rule) (*pii.Redactor, error) {
+	if len(policy) == 1 {
+		switch policy[0] {
+		case PIIPolicyOff:
+			return nil, nil
+		case PIIPolicyNone:
+			policy = nil
+		}
+	}
+	return pii.New(policy, custom)
+}
+
+// piiRedaction 编译后的脱敏规则
+type piiRedaction struct {
+	defaultRedactor *pii.Redactor
+	keyRedactors    map[string]*pii.Redactor
+	enabled         bool
+}
+
+// compilePIIRedaction 解析自定义规则并创建默认及各 API-KEY 的脱敏规则
+func compilePIIRedaction(enabled bool, rules []string, customJSON string, keyPolicies map[string][]string) (piiRedaction, error) {
+	var custom []pii.Rule
+	if strings.TrimSpace(customJSON) != "" {
+		if err := json.Unmarshal([]byte(customJSON), &custom); err != nil {
+			return piiRedaction{}, err
+		}
+	}
+	redactor, err := NewPIIRedactor(rules, custom)
+	if err != nil {
+		return piiRedaction{}, err
+	}
+	keyRedactors := make(map[string]*pii.Redactor, len(keyPolicies))
+	for key, policy := range keyPolicies {
+		keyRedactor, err := NewPIIRedactor(policy, custom)
+		if err != nil {
+			return piiRedaction{}, fmt.Errorf("policy of %s: %v", prompt.KeyID(key), err)
+		}
+		keyRedactors[prompt.KeyID(key)] = keyRedactor
+	}
+	return piiRedaction{defaultRedactor: redactor, keyRedactors: keyRedactors, enabled: enabled}, nil
+}
+
+func storePIIRedaction(redaction piiRedaction) {
+	piiMutex.Lock()
+	defer piiMutex.Unlock()
+	piiDefault, piiKeyRedactors, piiDefaultEnabled = redaction.defaultRedactor, redaction.keyRedactors, redaction.enabled
+}
+
+// ApplyPIIRedaction 使用当前配置重建脱敏规则, 校验失败时保留原规则
+func ApplyPIIRedaction() error {
+	redaction, err := compilePIIRedaction(PIIRedactEnabled, PIIRedactRules, PIICustomRulesJSON, PIIKeyPolicies)
+	if err != nil {
+		return err
+	}
+	storePIIRedaction(redaction)
+	return nil
+}
+
+// GetPIIRedactor 指定 API-KEY 标识使用的脱敏规则, 不脱敏时返回 nil; 配置了策略的 API-KEY 不受 PII_REDACT_ENABLED 影响
+func GetPIIRedactor(keyID string) *pii.Redactor {
+	piiMutex.RLock()
+	defer piiMutex.RUnlock()
+	if redactor, ok := piiKeyRedactors[keyID]; ok && keyID != "" {
+		return redactor
+	}
+	if !piiDefaultEnabled {
+		return nil
+	}
+	return piiDefault
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"rovo2api/common/env"
+	"rovo2api/common/prompt"
+	"strings"
+	"sync"
+)
+
+// 提示词策略(JSON 数组, 同配置文件 prompts.policies)及 API-KEY 的名称(key=名称,多个以,分隔), 可通过管理接口修改
+var (
+	PromptPoliciesJSON = env.String("PROMPT_POLICIES_JSON", "")
+	PromptKeyNames     = parseKeyValueList(env.String("PROMPT_KEY_NAMES", ""))
+)
+
+var (
+	promptMutex    sync.RWMutex
+	promptPolicies []prompt.Policy
+	promptKeyNames map[string]string
+	promptSet      = &prompt.Set{}
+)
+
+// promptConfig 编译后的提示词策略
+type promptConfig struct {
+	policies []prompt.Policy
+	keyNames map[string]string
+	set      *prompt.Set
+}
+
+// compilePromptPolicies 解析并编译提示词策略
+func compilePromptPolicies(raw string, keyNames map[string]string) (promptConfig, error) {
+	var policies []prompt.Policy
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+			return promptConfig{}, err
+		}
+	}
+	set, errs := prompt.Compile(policies, keyNames)
+	if len(errs) > 0 {
+		return promptConfig{}, errors.New(strings.Join(errs, "; "))
+	}
+	return promptConfig{policies: policies, keyNames: keyNames, set: set}, nil
+}
+
+func storePromptPolicies(compiled promptConfig) {
+	promptMutex.Lock()
+	defer promptMutex.Unlock()
+	promptPolicies, promptKeyNames, promptSet = compiled.policies, compiled.keyNames, compiled.set
+}
+
+// ApplyPromptPolicies 使用 PromptPoliciesJSON 与 PromptKeyNames 重建提示词策略
+func ApplyPromptPolicies() error {
+	compiled, err := compilePromptPolicies(PromptPoliciesJSON, PromptKeyNames)
+	if err != nil {
+		return err
+	}
+	storePromptPolicies(compiled)
+	return nil
+}
+
+// SetPromptPolicies 校验并替换提示词策略, 校验失败时保留当前策略
+func SetPromptPolicies(policies []prompt.Policy, keyNames map[string]string) []string {
+	set, errs := prompt.Compile(policies, keyNames)
+	if len(errs) > 0 {
+		return errs
+	}
+	storePromptPolicies(promptConfig{policies: policies, keyNames: keyNames, set: set})
+	return nil
+}
+
+// GetPromptPolicies 当前的提示词策略及 API-KEY 的名称
+func GetPromptPolicies() ([]prompt.Policy, map[string]string) {
+	promptMutex.RLock()
+	defer promptMutex.RUnlock()
+	return promptPolicies, promptKeyNames
+}
+
+// GetPromptSet 当前编译后的提示词策略
+func GetPromptSet() *prompt.Set {
+	promptMutex.RLock()
+	defer promptMutex.RUnlock()
+	return promptSet
+}
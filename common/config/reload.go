@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"rovo2api/common/events"
+	"rovo2api/common/moderation"
+	"time"
+)
+
+// reloadInputs 需要编译校验的配置, 热加载时全部校验通过后才写入全局配置
+type reloadInputs struct {
+	ipAccess IPAccessLists
+
+	models         []ModelInfo
+	modelAliases   map[string]string
+	modelFallbacks map[string][]string
+
+	promptPoliciesJSON string
+	promptKeyNames     map[string]string
+
+	moderationRulesJSON      string
+	moderationWebhookUrl     string
+	moderationWebhookSecret  string
+	moderationWebhookModel   string
+	moderationWebhookTimeout int
+
+	piiRedactEnabled   bool
+	piiRedactRules     []string
+	piiCustomRulesJSON string
+	piiKeyPolicies     map[string][]string
+
+	hooksJSON         string
+	eventWebhooksJSON string
+}
+
+// assign 写入全局配置
+func (in reloadInputs) assign() {
+	TrustedProxies = in.ipAccess.TrustedProxies
+	IpAllowList, IpDenyList = in.ipAccess.Allow, in.ipAccess.Deny
+	ApiIpAllowList, ApiIpDenyList = in.ipAccess.Api.Allow, in.ipAccess.Api.Deny
+	AdminIpAllowList, AdminIpDenyList = in.ipAccess.Admin.Allow, in.ipAccess.Admin.Deny
+
+	ModelRegistry, ModelAliases, ModelFallbacks = in.models, in.modelAliases, in.modelFallbacks
+	PromptPoliciesJSON, PromptKeyNames = in.promptPoliciesJSON, in.promptKeyNames
+
+	ModerationRulesJSON = in.moderationRulesJSON
+	ModerationWebhookUrl = in.moderationWebhookUrl
+	ModerationWebhookSecret = in.moderationWebhookSecret
+	ModerationWebhookModel = in.moderationWebhookModel
+	ModerationWebhookTimeout = in.moderationWebhookTimeout
+
+	PIIRedactEnabled = in.piiRedactEnabled
+	PIIRedactRules = in.piiRedactRules
+	PIICustomRulesJSON = in.piiCustomRulesJSON
+	PIIKeyPolicies = in.piiKeyPolicies
+
+	HooksJSON = in.hooksJSON
+	EventWebhooksJSON = in.eventWebhooksJSON
+}
+
+// reloadedConfig 编译后的配置, 由 store 一并替换
+type reloadedConfig struct {
+	ipAccess      *IPAccess
+	registry      modelRegistry
+	prompts       promptConfig
+	moderation    *moderation.Engine
+	pii           piiRedaction
+	hooks         []HookBinding
+	eventWebhooks []EventWebhook
+	eventBus      *events.Bus
+}
+
+// compile 编译全部配置, 不修改当前配置; 错误带配置项名
+func (in reloadInputs) compile() (*reloadedConfig, error) {
+	var next reloadedConfig
+	var err error
+	if next.ipAccess, err = ParseIPAccess(in.ipAccess); err != nil {
+		return nil, fmt.Errorf("ip_access.%v", err)
+	}
+	if next.registry, err = compileModelRegistry(in.models, in.modelAliases, in.modelFallbacks); err != nil {
+		return nil, err
+	}
+	if next.prompts, err = compilePromptPolicies(in.promptPoliciesJSON, in.promptKeyNames); err != nil {
+		return nil, fmt.Errorf("prompts: %v", err)
+	}
+	next.moderation, err = compileModeration(in.moderationRulesJSON, moderation.WebhookOptions{
+		URL:     in.moderationWebhookUrl,
+		Secret:  in.moderationWebhookSecret,
+		Model:   in.moderationWebhookModel,
+		Timeout: time.Duration(in.moderationWebhookTimeout) * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("moderation: %v", err)
+	}
+	if next.pii, err = compilePIIRedaction(in.piiRedactEnabled, in.piiRedactRules, in.piiCustomRulesJSON, in.piiKeyPolicies); err != nil {
+		return nil, fmt.Errorf("pii: %v", err)
+	}
+	if next.hooks, err = compileHooks(in.hooksJSON); err != nil {
+		return nil, fmt.Errorf("hooks: %v", err)
+	}
+	// 事件总线会启动投递协程, 放在最后创建
+	if next.eventWebhooks, next.eventBus, err = compileEvents(in.eventWebhooksJSON); err != nil {
+		return nil, fmt.Errorf("events: %v", err)
+	}
+	return &next, nil
+}
+
+// store 替换当前配置
+func (next *reloadedConfig) store() {
+	SetIPAccess(next.ipAccess)
+	storeModelRegistry(next.registry)
+	storePromptPolicies(next.prompts)
+	storeModeration(next.moderation)
+	storePIIRedaction(next.pii)
+	storeHooks(next.hooks)
+	storeEvents(next.eventWebhooks, next.eventBus)
+}
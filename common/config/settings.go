@@ -0,0 +1,151 @@
+package config
+
+import (
+	"rovo2api/common/audit"
+	"sync/atomic"
+)
+
+// Settings 请求中读取、热加载时整体替换的配置, 只读.
+// 请求中不直接读取同名的全局变量, 热加载会在请求进行中写入全局变量
+type Settings struct {
+	DebugEnabled          bool
+	ApiSecret             string
+	ApiSecrets            []string
+	BackendSecret         string
+	RovoApiBaseUrl        string
+	ProxyUrl              string
+	TLSProfile            string
+	UserAgent             string
+	CredentialTLSProfiles map[string]string
+	ProxyTLSProfiles      map[string]string
+	UpstreamTimeout       int
+
+	PreMessagesJSON string
+	ReasoningHide   int
+
+	RequestRateLimitNum         int
+	TokenRateLimitNum           int
+	RateLimitCookieLockDuration int
+	CredentialMaxConcurrency    int
+	CredentialQueueTimeout      int
+
+	ContextStrategy     string
+	ContextSummaryModel string
+	ContextSafetyMargin float64
+
+	ModerationInputAction  string
+	ModerationOutputAction string
+	ModerationFailOpen     bool
+	ModerationStreamBuffer int
+	PIIRestore             bool
+
+	EventPoolMinHealthy   int
+	EventErrorSpikeCount  int
+	EventErrorSpikeWindow int
+	EventQuotaDailyTokens int
+	EventQuotaThreshold   float64
+
+	ResponseCacheEnabled bool
+	ResponseCacheTTL     int
+	AuditLogEnabled      bool
+	AuditRedactRules     []string
+	AuditCustomRules     []audit.RedactRule
+
+	SchedulerMaxConcurrency int
+	SchedulerMaxQueue       int
+	SchedulerMaxQueuePerKey int
+	SchedulerQueueTimeout   int
+	SchedulerKeyWeights     map[string]string
+	SchedulerKeyPriorities  map[string]string
+
+	ReadyMinCredentials int
+	ReadyCheckUpstream  bool
+}
+
+var currentSettings atomic.Pointer[Settings]
+
+func settingsFromGlobals() *Settings {
+	return &Settings{
+		DebugEnabled:          DebugEnabled,
+		ApiSecret:             ApiSecret,
+		ApiSecrets:            ApiSecrets,
+		BackendSecret:         BackendSecret,
+		RovoApiBaseUrl:        RovoApiBaseUrl,
+		ProxyUrl:              ProxyUrl,
+		TLSProfile:            TLSProfile,
+		UserAgent:             UserAgent,
+		CredentialTLSProfiles: CredentialTLSProfiles,
+		ProxyTLSProfiles:      ProxyTLSProfiles,
+		UpstreamTimeout:       UpstreamTimeout,
+
+		PreMessagesJSON: PRE_MESSAGES_JSON,
+		ReasoningHide:   ReasoningHide,
+
+		RequestRateLimitNum:         RequestRateLimitNum,
+		TokenRateLimitNum:           TokenRateLimitNum,
+		RateLimitCookieLockDuration: RateLimitCookieLockDuration,
+		CredentialMaxConcurrency:    CredentialMaxConcurrency,
+		CredentialQueueTimeout:      CredentialQueueTimeout,
+
+		ContextStrategy:     ContextStrategy,
+		ContextSummaryModel: ContextSummaryModel,
+		ContextSafetyMargin: ContextSafetyMargin,
+
+		ModerationInputAction:  ModerationInputAction,
+		ModerationOutputAction: ModerationOutputAction,
+		ModerationFailOpen:     ModerationFailOpen,
+		ModerationStreamBuffer: ModerationStreamBuffer,
+		PIIRestore:             PIIRestore,
+
+		EventPoolMinHealthy:   EventPoolMinHealthy,
+		EventErrorSpikeCount:  EventErrorSpikeCount,
+		EventErrorSpikeWindow: EventErrorSpikeWindow,
+		EventQuotaDailyTokens: EventQuotaDailyTokens,
+		EventQuotaThreshold:   EventQuotaThreshold,
+
+		ResponseCacheEnabled: ResponseCacheEnabled,
+		ResponseCacheTTL:     ResponseCacheTTL,
+		AuditLogEnabled:      AuditLogEnabled,
+		AuditRedactRules:     AuditRedactRules,
+		AuditCustomRules:     AuditCustomRules,
+
+		SchedulerMaxConcurrency: SchedulerMaxConcurrency,
+		SchedulerMaxQueue:       SchedulerMaxQueue,
+		SchedulerMaxQueuePerKey: SchedulerMaxQueuePerKey,
+		SchedulerQueueTimeout:   SchedulerQueueTimeout,
+		SchedulerKeyWeights:     SchedulerKeyWeights,
+		SchedulerKeyPriorities:  SchedulerKeyPriorities,
+
+		ReadyMinCredentials: ReadyMinCredentials,
+		ReadyCheckUpstream:  ReadyCheckUpstream,
+	}
+}
+
+// ApplySettings 使用当前的全局配置生成快照
+func ApplySettings() {
+	SetSettings(settingsFromGlobals())
+}
+
+// SetSettings 替换当前的配置快照
+func SetSettings(settings *Settings) {
+	currentSettings.Store(settings)
+}
+
+// GetSettings 当前的配置快照, 同一请求中应只读取一次; 未生成时使用启动时的全局配置
+func GetSettings() *Settings {
+	if settings := currentSettings.Load(); settings != nil {
+		return settings
+	}
+	return settingsFromGlobals()
+}
+
+// ResolveTLSProfile 按 凭证 > 代理 > 全局 的优先级选择指纹配置
+func (s *Settings) ResolveTLSProfile(cookie string) string {
+	if profile, ok := s.CredentialTLSProfiles[CredentialName(cookie)]; ok && profile != "" {
+		return profile
+	}
+	if profile, ok := s.ProxyTLSProfiles[s.ProxyUrl]; ok && profile != "" {
+		return profile
+	}
+	return s.TLSProfile
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"rovo2api/common/state"
+	"strings"
+	"time"
+)
+
+const (
+	stateTimeout  = 2 * time.Second
+	usageDateFmt  = "20060102"
+	usageRetained = 8 * 24 * time.Hour // 用量计数保留天数
+)
+
+// State 运行状态后端, 启动时由 InitStateBackend 按配置创建
+var State state.Backend = state.NewMemory()
+
+// StateErrorHandler 状态后端出错时调用, 出错的操作按不限制处理
+var StateErrorHandler = func(err error) {}
+
+// InitStateBackend 按配置创建状态后端
+func InitStateBackend() error {
+	backend, err := state.New(state.Options{
+		Backend:   StateBackend,
+		RedisUrl:  RedisUrl,
+		KeyPrefix: StateKeyPrefix,
+		File:      StateFile,
+	})
+	if err != nil {
+		return err
+	}
+	previous := State
+	State = backend
+	return previous.Close()
+}
+
+// CloseStateBackend 关闭状态后端, memory 后端同时保存状态到 STATE_FILE
+func CloseStateBackend() error {
+	return State.Close()
+}
+
+func stateContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), stateTimeout)
+}
+
+func reportStateError(err error) {
+	if err != nil {
+		StateErrorHandler(err)
+	}
+}
+
+// CredentialKey 返回凭证的稳定标识, 状态后端中不保存凭证本身
+func CredentialKey(cookie string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(cookie)))
+	return "cred-" + hex.EncodeToString(sum[:])[:16]
+}
+
+func usageKey(kind, cookie string, day time.Time) string {
+	return kind + ":" + CredentialKey(cookie) + ":" + day.UTC().Format(usageDateFmt)
+}
+
+// RecordCredentialUsage 累加凭证当天(UTC)的请求数及 token 数
+func RecordCredentialUsage(cookie string, tokens int) {
+	ctx, cancel := stateContext()
+	defer cancel()
+	now := time.Now()
+	_, err := State.IncrUsage(ctx, usageKey("requests", cookie, now), 1, usageRetained)
+	reportStateError(err)
+	total, err := State.IncrUsage(ctx, usageKey("tokens", cookie, now), int64(tokens), usageRetained)
+	if err != nil {
+		reportStateError(err)
+		return
+	}
+	publishQuotaLow(cookie, total-int64(tokens), total)
+}
+
+// TakeRateLimit 从每分钟补充 limit 个令牌的令牌桶中取 cost 个令牌, 参数 force 见 state.Backend.Take;
+// 状态后端不可用时返回 false, 此时不做限制
+func TakeRateLimit(key string, limit int, cost int64, force bool) (state.BucketResult, bool) {
+	ctx, cancel := stateContext()
+	defer cancel()
+	bucket := state.Bucket{Capacity: int64(limit), Rate: float64(limit) / 60}
+	result, err := State.Take(ctx, key, bucket, cost, force)
+	if err != nil {
+		reportStateError(err)
+		return result, false
+	}
+	return result, true
+}
+
+// CredentialStatus 凭证状态
+type CredentialStatus struct {
+	Name          string               `json:"name"`
+	Key           string               `json:"key"`
+	Invalid       string               `json:"invalid,omitempty"`   // 失效原因
+	Cooldowns     map[string]time.Time `json:"cooldowns,omitempty"` // 模型 -> 冷却到期时间
+	RequestsToday int64                `json:"requests_today"`
+	TokensToday   int64                `json:"tokens_today"`
+	Inflight      int                  `json:"inflight"`          // 当前实例中进行中的请求数
+	Runtime       bool                 `json:"runtime,omitempty"` // 通过管理接口添加, 未写入配置
+}
+
+// GetCredentialStatuses 从状态后端汇总所有凭证的状态
+func GetCredentialStatuses() ([]CredentialStatus, error) {
+	ctx, cancel := stateContext()
+	defer cancel()
+	invalid, err := State.InvalidCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var models []string
+	for _, entry := range GetModelEntries() {
+		if entry.Name == entry.Info.ID {
+			models = append(models, entry.Info.ID)
+		}
+	}
+
+	now := time.Now()
+	var statuses []CredentialStatus
+	for _, cookie := range GetRVCookies() {
+		if cookie = strings.TrimSpace(cookie); cookie == "" {
+			continue
+		}
+		status := CredentialStatus{
+			Name:     CredentialName(cookie),
+			Key:      CredentialKey(cookie),
+			Invalid:  invalid[CredentialKey(cookie)],
+			Inflight: CredentialInflight(cookie),
+			Runtime:  isRuntimeCookie(cookie),
+		}
+		keys := make([]string, len(models))
+		for i, modelId := range models {
+			keys[i] = rateLimitCookieKey(cookie, modelId)
+		}
+		cooldowns, err := State.Cooldowns(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		for i, modelId := range models {
+			if until, ok := cooldowns[keys[i]]; ok {
+				if status.Cooldowns == nil {
+					status.Cooldowns = make(map[string]time.Time)
+				}
+				status.Cooldowns[modelId] = until
+			}
+		}
+		if status.RequestsToday, err = State.Usage(ctx, usageKey("requests", cookie, now)); err != nil {
+			return nil, err
+		}
+		if status.TokensToday, err = State.Usage(ctx, usageKey("tokens", cookie, now)); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// CredentialDisabled 手动停用凭证时记录的失效原因, 仅能通过 EnableCredential 恢复
+const CredentialDisabled = "disabled"
+
+// ClearInvalidCredentials 清除所有凭证的失效标记, 手动停用的凭证除外
+func ClearInvalidCredentials() error {
+	ctx, cancel := stateContext()
+	defer cancel()
+	invalid, err := State.InvalidCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	var credentials []string
+	for credential, reason := range invalid {
+		if reason != CredentialDisabled {
+			credentials = append(credentials, credential)
+		}
+	}
+	if len(credentials) == 0 {
+		return nil
+	}
+	return State.ClearInvalid(ctx, credentials...)
+}
+
+// CredentialInvalidReason 返回凭证的失效原因, 未失效时为空
+func CredentialInvalidReason(cookie string) (string, error) {
+	ctx, cancel := stateContext()
+	defer cancel()
+	invalid, err := State.InvalidCredentials(ctx)
+	if err != nil {
+		return "", err
+	}
+	return invalid[CredentialKey(cookie)], nil
+}
+
+// DisableCredential 手动停用凭证, 所有实例均不再使用
+func DisableCredential(cookie string) error {
+	ctx, cancel := stateContext()
+	defer cancel()
+	return State.MarkInvalid(ctx, CredentialKey(cookie), CredentialDisabled)
+}
+
+// EnableCredential 清除凭证的失效标记及所有模型的冷却, 用于手动启用或重新校验通过
+func EnableCredential(cookie string) error {
+	ctx, cancel := stateContext()
+	defer cancel()
+	if err := State.ClearInvalid(ctx, CredentialKey(cookie)); err != nil {
+		return err
+	}
+	for _, entry := range GetModelEntries() {
+		if entry.Name != entry.Info.ID {
+			continue
+		}
+		if err := State.SetCooldown(ctx, rateLimitCookieKey(cookie, entry.Info.ID), time.Time{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
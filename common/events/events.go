@@ -0,0 +1,188 @@
+// Package events 运行事件的通知: 事件发布到总线后, 由各 webhook 异步投递
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	CredentialInvalidated    = "credential.invalidated"     // 凭证失效(未登录、被禁止访问)
+	CredentialQuotaExhausted = "credential.quota_exhausted" // 凭证用量超出上游限制
+	CredentialQuotaLow       = "credential.quota_low"       // 凭证当天用量达到阈值
+	PoolUnhealthy            = "pool.unhealthy"             // 可用凭证数低于阈值
+	UpstreamErrorSpike       = "upstream.error_spike"       // 上游错误数在时间窗口内达到阈值
+	KeyBudgetExceeded        = "key.budget_exceeded"        // API-KEY 超出 token 额度
+	Test                     = "test"                       // 通过管理接口发送的测试事件
+)
+
+// Types 所有事件类型
+var Types = []string{CredentialInvalidated, CredentialQuotaExhausted, CredentialQuotaLow, PoolUnhealthy, UpstreamErrorSpike, KeyBudgetExceeded, Test}
+
+// 严重程度
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severities = map[string]string{
+	CredentialInvalidated:    SeverityWarning,
+	CredentialQuotaExhausted: SeverityWarning,
+	CredentialQuotaLow:       SeverityInfo,
+	PoolUnhealthy:            SeverityCritical,
+	UpstreamErrorSpike:       SeverityCritical,
+	KeyBudgetExceeded:        SeverityInfo,
+	Test:                     SeverityInfo,
+}
+
+// IsType 是否为已知的事件类型
+func IsType(eventType string) bool {
+	_, ok := severities[eventType]
+	return ok
+}
+
+// Event 通用 JSON 格式的事件
+type Event struct {
+	ID       string         `json:"id"`
+	Type     string         `json:"type"`
+	Severity string         `json:"severity"`
+	Message  string         `json:"message"`
+	Source   string         `json:"source,omitempty"` // 发出事件的实例
+	Time     time.Time      `json:"time"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+// New 创建事件, 按类型设置严重程度
+func New(eventType, message string, data map[string]any) Event {
+	severity := severities[eventType]
+	if severity == "" {
+		severity = SeverityInfo
+	}
+	now := time.Now()
+	return Event{
+		ID:       "evt-" + strconv.FormatInt(now.UnixNano(), 36) + strconv.FormatInt(rand.Int63n(1<<20), 36),
+		Type:     eventType,
+		Severity: severity,
+		Message:  message,
+		Time:     now,
+		Data:     data,
+	}
+}
+
+// Options 事件总线配置
+type Options struct {
+	Webhooks  []WebhookOptions
+	Source    string          // 写入事件的 source, 如主机名
+	QueueSize int             // 每个 webhook 的待投递事件数, 超出时丢弃新事件
+	OnError   func(err error) // 投递最终失败或事件被丢弃时调用
+}
+
+// DefaultQueueSize 每个 webhook 默认的待投递事件数
+const DefaultQueueSize = 100
+
+// Bus 事件总线, nil 表示不发送通知
+type Bus struct {
+	source  string
+	sinks   []*sink
+	onError func(err error)
+	wg      sync.WaitGroup
+}
+
+type sink struct {
+	webhook *Webhook
+	types   map[string]bool // 为空时接收所有事件
+	queue   chan Event
+}
+
+// NewBus 创建事件总线并启动投递, 没有 webhook 时返回 nil
+func NewBus(options Options) (*Bus, error) {
+	if len(options.Webhooks) == 0 {
+		return nil, nil
+	}
+	queueSize := options.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	bus := &Bus{source: options.Source, onError: options.OnError}
+	for i, webhookOptions := range options.Webhooks {
+		webhook, err := NewWebhook(webhookOptions)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks[%d]: %v", i, err)
+		}
+		s := &sink{webhook: webhook, queue: make(chan Event, queueSize)}
+		if len(webhookOptions.Events) > 0 {
+			s.types = make(map[string]bool, len(webhookOptions.Events))
+			for _, eventType := range webhookOptions.Events {
+				s.types[eventType] = true
+			}
+		}
+		bus.sinks = append(bus.sinks, s)
+	}
+	for _, s := range bus.sinks {
+		bus.wg.Add(1)
+		go bus.deliver(s)
+	}
+	return bus, nil
+}
+
+// Publish 发布事件, 不等待投递
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Source == "" {
+		event.Source = b.source
+	}
+	for _, s := range b.sinks {
+		if s.types != nil && !s.types[event.Type] && event.Type != Test {
+			continue
+		}
+		select {
+		case s.queue <- event:
+		default:
+			b.reportError(fmt.Errorf("webhook %s: queue full, dropped event %s", s.webhook.Name(), event.Type))
+		}
+	}
+}
+
+func (b *Bus) deliver(s *sink) {
+	defer b.wg.Done()
+	for event := range s.queue {
+		if err := s.webhook.Send(context.Background(), event); err != nil {
+			b.reportError(fmt.Errorf("webhook %s: event %s: %v", s.webhook.Name(), event.Type, err))
+		}
+	}
+}
+
+func (b *Bus) reportError(err error) {
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
+
+// Close 停止接收事件并等待已发布的事件投递完成, ctx 结束时不再等待
+func (b *Bus) Close(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	for _, s := range b.sinks {
+		close(s.queue)
+	}
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,193 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 负载格式
+const (
+	FormatJSON     = "json"     // 通用 JSON 格式, 即 Event
+	FormatSlack    = "slack"    // Slack 兼容的 {"text": ...}
+	FormatTelegram = "telegram" // Telegram Bot API sendMessage 的 {"chat_id": ..., "text": ...}
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-Rovo2api-Event"
+	HeaderTimestamp = "X-Rovo2api-Timestamp"
+	HeaderSignature = "X-Rovo2api-Signature"
+)
+
+// 默认值
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxRetries = 3
+	retryBackoff      = time.Second
+	maxRetryBackoff   = 30 * time.Second
+)
+
+// DefaultTemplate slack 及 telegram 格式默认的消息文本
+const DefaultTemplate = `[{{.Severity}}] {{.Type}}{{if .Source}} ({{.Source}}){{end}}: {{.Message}}`
+
+// WebhookOptions webhook 配置
+type WebhookOptions struct {
+	Name   string
+	URL    string
+	Secret string   // 不为空时对请求体签名
+	Format string   // json、slack 或 telegram, 默认 json
+	ChatID string   // telegram 格式的 chat_id
+	Events []string // 接收的事件类型, 为空时接收所有事件
+	// slack 及 telegram 格式的消息文本, text/template 格式, 数据为 Event
+	Template   string
+	Timeout    time.Duration
+	MaxRetries int // 失败后的重试次数, 小于 0 时不重试
+}
+
+// Webhook 将事件以 HTTP POST 发送到指定地址
+type Webhook struct {
+	options  WebhookOptions
+	template *template.Template
+	client   *http.Client
+}
+
+// NewWebhook 校验配置并创建 webhook
+func NewWebhook(options WebhookOptions) (*Webhook, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url: must be an http(s) URL")
+	}
+	if options.Name == "" {
+		options.Name = u.Host
+	}
+	switch options.Format {
+	case "":
+		options.Format = FormatJSON
+	case FormatJSON, FormatSlack:
+	case FormatTelegram:
+		if options.ChatID == "" {
+			return nil, fmt.Errorf("chat_id: required for telegram format")
+		}
+	default:
+		return nil, fmt.Errorf("format: must be one of json, slack, telegram")
+	}
+	for _, eventType := range options.Events {
+		if !IsType(eventType) {
+			return nil, fmt.Errorf("events: unknown event %q", eventType)
+		}
+	}
+	text := options.Template
+	if text == "" {
+		text = DefaultTemplate
+	} else if options.Format == FormatJSON {
+		return nil, fmt.Errorf("template: not supported for json format")
+	}
+	// text/template 的错误以 "template: " 开头
+	tmpl, err := template.New(options.Name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = DefaultMaxRetries
+	}
+	return &Webhook{
+		options:  options,
+		template: tmpl,
+		client:   &http.Client{Timeout: options.Timeout},
+	}, nil
+}
+
+// Name webhook 的名称, 未配置时为地址的主机名
+func (w *Webhook) Name() string {
+	return w.options.Name
+}
+
+// Payload 按格式生成请求体
+func (w *Webhook) Payload(event Event) ([]byte, error) {
+	if w.options.Format == FormatJSON {
+		return json.Marshal(event)
+	}
+	var text strings.Builder
+	if err := w.template.Execute(&text, event); err != nil {
+		return nil, err
+	}
+	if w.options.Format == FormatTelegram {
+		return json.Marshal(map[string]string{"chat_id": w.options.ChatID, "text": text.String()})
+	}
+	return json.Marshal(map[string]string{"text": text.String()})
+}
+
+// Sign 计算签名: HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send 发送事件, 网络错误、429 及 5xx 时按指数退避重试
+func (w *Webhook) Send(ctx context.Context, event Event) error {
+	body, err := w.Payload(event)
+	if err != nil {
+		return err
+	}
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, event, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.options.MaxRetries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// 发送一次, 返回失败时是否可以重试
+func (w *Webhook) post(ctx context.Context, event Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if w.options.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.options.Secret, timestamp, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
@@ -1,5 +1,7 @@
 package helper
 
 const (
-	RequestIdKey = "X-Request-Id"
+	RequestIdKey   = "X-Request-Id"
+	RateLimitKey   = "rovo2api_rate_limit_key" // 限流标识, 由限流中间件写入
+	HookRequestKey = "rovo2api_hook_request"   // 插件的请求上下文, 由插件中间件写入
 )
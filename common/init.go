@@ -13,6 +13,7 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "", "specify the log directory")
+	ConfigFile   = flag.String("config", "", "specify the config file (yaml)")
 )
 
 // UploadPath Maybe override by ENV_VAR
@@ -22,10 +23,11 @@ func printHelp() {
 	fmt.Println("rovo2api" + Version + "")
 	fmt.Println("Copyright (C) 2025 Dean. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/deanxv/rovo2api ")
-	fmt.Println("Usage: rovo2api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: rovo2api [--port <port>] [--log-dir <log directory>] [--config <config file>] [--version] [--help]")
 }
 
-func init() {
+// Init 解析命令行参数, 需在 main 中最先调用(不在包初始化时解析, 以免影响 go test)
+func Init() {
 	flag.Parse()
 
 	if *PrintVersion {
@@ -0,0 +1,113 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// List IP 及 CIDR 列表
+type List []netip.Prefix
+
+// ParseList 解析 IP(如 10.0.0.1、::1)或 CIDR(如 10.0.0.0/8、fd00::/8), 忽略空项
+func ParseList(entries []string) (List, error) {
+	var list List
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a valid CIDR", entry)
+			}
+			if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+				prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+			}
+			list = append(list, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid IP address", entry)
+		}
+		addr = addr.Unmap()
+		list = append(list, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return list, nil
+}
+
+// Contains 判断 ip 是否在列表中, IPv4 映射的 IPv6 地址按 IPv4 处理
+func (l List) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range l {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules 访问规则: 拒绝列表优先, 允许列表非空时只允许列表中的地址
+type Rules struct {
+	Allow List
+	Deny  List
+}
+
+func (r Rules) Allowed(ip netip.Addr) bool {
+	if r.Deny.Contains(ip) {
+		return false
+	}
+	return len(r.Allow) == 0 || r.Allow.Contains(ip)
+}
+
+// ParseAddr 解析 IP, 失败时返回无效地址(不在任何列表中)
+func ParseAddr(ip string) netip.Addr {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// ClientIP 解析客户端 IP: 直连地址是受信任的代理时, 从 X-Forwarded-For 的右侧向左跳过受信任的代理,
+// 第一个不受信任的地址即为客户端; 没有 X-Forwarded-For 时使用 X-Real-IP. 不信任任何代理时总是返回直连地址
+func ClientIP(remoteAddr string, header http.Header, trusted List) string {
+	remote := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remote = host
+	}
+	addr := ParseAddr(remote)
+	if !addr.IsValid() || !trusted.Contains(addr) {
+		return remote
+	}
+
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if len(hops) == 0 {
+		if realIP := ParseAddr(header.Get("X-Real-IP")); realIP.IsValid() {
+			return realIP.String()
+		}
+		return remote
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := ParseAddr(hops[i])
+		if !hop.IsValid() {
+			// 无法解析的地址可能是伪造的, 以其右侧的地址为客户端
+			break
+		}
+		client = hop.String()
+		if !trusted.Contains(hop) {
+			break
+		}
+	}
+	return client
+}
@@ -0,0 +1,60 @@
+package ipfilter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseList([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		remote  string
+		xff     []string
+		realIP  string
+		trusted List
+		want    string
+	}{
+		{name: "direct", remote: "198.51.100.20:5000", want: "198.51.100.20"},
+		{name: "remote without port", remote: "198.51.100.20", want: "198.51.100.20"},
+		{name: "untrusted remote ignores X-Forwarded-For", remote: "203.0.113.9:5000", xff: []string{"198.51.100.20"}, want: "203.0.113.9"},
+		{name: "untrusted remote ignores X-Real-IP", remote: "203.0.113.9:5000", realIP: "198.51.100.20", want: "203.0.113.9"},
+		{name: "no trusted proxies", remote: "10.0.0.1:5000", xff: []string{"198.51.100.20"}, trusted: List{}, want: "10.0.0.1"},
+		{name: "trusted proxy", remote: "10.0.0.1:5000", xff: []string{"198.51.100.20"}, want: "198.51.100.20"},
+		{name: "spoofed leftmost hop", remote: "10.0.0.1:5000", xff: []string{"6.6.6.6, 198.51.100.20"}, want: "198.51.100.20"},
+		{name: "proxy chain", remote: "10.0.0.1:5000", xff: []string{"6.6.6.6, 198.51.100.20, 192.168.1.1"}, want: "198.51.100.20"},
+		{name: "repeated header", remote: "10.0.0.1:5000", xff: []string{"6.6.6.6", "198.51.100.20, 10.0.0.2"}, want: "198.51.100.20"},
+		{name: "all trusted", remote: "10.0.0.1:5000", xff: []string{"10.0.0.3, 192.168.1.1"}, want: "10.0.0.3"},
+		{name: "unparsable hop left of the client", remote: "10.0.0.1:5000", xff: []string{"garbage, 198.51.100.20"}, want: "198.51.100.20"},
+		{name: "unparsable hop after trusted proxies", remote: "10.0.0.1:5000", xff: []string{"198.51.100.20, garbage, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "unparsable rightmost hop", remote: "10.0.0.1:5000", xff: []string{"198.51.100.20, unknown"}, want: "10.0.0.1"},
+		{name: "X-Real-IP fallback", remote: "10.0.0.1:5000", realIP: "198.51.100.30", want: "198.51.100.30"},
+		{name: "X-Forwarded-For preferred over X-Real-IP", remote: "10.0.0.1:5000", xff: []string{"198.51.100.20"}, realIP: "198.51.100.30", want: "198.51.100.20"},
+		{name: "invalid X-Real-IP", remote: "10.0.0.1:5000", realIP: "unknown", want: "10.0.0.1"},
+		{name: "IPv4-mapped remote", remote: "[::ffff:10.0.0.1]:5000", xff: []string{"198.51.100.20"}, want: "198.51.100.20"},
+		{name: "IPv4-mapped hops", remote: "10.0.0.1:5000", xff: []string{"::ffff:198.51.100.20, ::ffff:10.0.0.2"}, want: "198.51.100.20"},
+		{name: "IPv6 proxy", remote: "[fd00::1]:5000", xff: []string{"2001:db8::7"}, want: "2001:db8::7"},
+		{name: "untrusted IPv6 remote", remote: "[2001:db8::1]:5000", xff: []string{"198.51.100.20"}, want: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, value := range tt.xff {
+				header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				header.Set("X-Real-IP", tt.realIP)
+			}
+			list := trusted
+			if tt.trusted != nil {
+				list = tt.trusted
+			}
+			if got := ClientIP(tt.remote, header, list); got != tt.want {
+				t.Errorf("ClientIP(%s, %v) = %s, want %s", tt.remote, header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"context"
+	"sync"
+)
+
+// 日志上下文字段
+const (
+	FieldAPIKey     = "api_key"
+	FieldCredential = "credential"
+	FieldModel      = "model"
+	FieldTraceID    = "trace_id"
+)
+
+type Field struct {
+	Key   string
+	Value string
+}
+
+// fieldSet 请求级别的日志字段, 处理请求过程中逐步补充
+type fieldSet struct {
+	mutex  sync.Mutex
+	fields []Field
+}
+
+type fieldsKey struct{}
+
+// WithFields 为请求上下文挂载日志字段, 由 RequestId 中间件调用
+func WithFields(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(fieldsKey{}).(*fieldSet); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, fieldsKey{}, &fieldSet{})
+}
+
+// SetField 设置当前请求的日志字段, 之后该请求的每条日志都会带上此字段
+func SetField(ctx context.Context, key, value string) {
+	set, ok := ctx.Value(fieldsKey{}).(*fieldSet)
+	if !ok || value == "" {
+		return
+	}
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	for i := range set.fields {
+		if set.fields[i].Key == key {
+			set.fields[i].Value = value
+			return
+		}
+	}
+	set.fields = append(set.fields, Field{Key: key, Value: value})
+}
+
+// ContextFields 返回当前请求日志字段的副本
+func ContextFields(ctx context.Context) []Field {
+	set, ok := ctx.Value(fieldsKey{}).(*fieldSet)
+	if !ok {
+		return nil
+	}
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return append([]Field(nil), set.fields...)
+}
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"encoding/json"
+	"rovo2api/common/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日志格式
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// Format 返回当前日志格式, 未知的格式按 text 处理
+func Format() string {
+	switch strings.ToLower(config.LogFormat) {
+	case FormatJSON:
+		return FormatJSON
+	case FormatLogfmt:
+		return FormatLogfmt
+	default:
+		return FormatText
+	}
+}
+
+// Entry 一条日志
+type Entry struct {
+	Time      time.Time
+	Tag       string // text 格式的前缀, 如 INFO、SYS、GIN
+	Level     string // 结构化格式中的级别
+	RequestID string
+	Msg       string
+	Fields    []Field
+}
+
+func (e Entry) format(format string) string {
+	switch format {
+	case FormatJSON:
+		return e.json()
+	case FormatLogfmt:
+		return e.logfmt()
+	default:
+		return e.text()
+	}
+}
+
+func (e Entry) text() string {
+	var b strings.Builder
+	b.WriteString("[" + e.Tag + "] " + e.Time.Format("2006/01/02 - 15:04:05") + " | ")
+	if e.RequestID != "" {
+		b.WriteString(e.RequestID + " | ")
+	}
+	b.WriteString(e.Msg)
+	if len(e.Fields) > 0 {
+		b.WriteString(" |")
+		for _, field := range e.Fields {
+			b.WriteString(" " + field.Key + "=" + logfmtValue(field.Value))
+		}
+	}
+	b.WriteString(" \n")
+	return b.String()
+}
+
+func (e Entry) json() string {
+	var b strings.Builder
+	b.WriteString(`{"time":` + jsonString(e.Time.Format(time.RFC3339Nano)))
+	b.WriteString(`,"level":` + jsonString(e.Level))
+	if e.RequestID != "" {
+		b.WriteString(`,"request_id":` + jsonString(e.RequestID))
+	}
+	b.WriteString(`,"msg":` + jsonString(e.Msg))
+	for _, field := range e.Fields {
+		b.WriteString("," + jsonString(field.Key) + ":" + jsonString(field.Value))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (e Entry) logfmt() string {
+	var b strings.Builder
+	b.WriteString("time=" + e.Time.Format(time.RFC3339Nano))
+	b.WriteString(" level=" + e.Level)
+	if e.RequestID != "" {
+		b.WriteString(" request_id=" + logfmtValue(e.RequestID))
+	}
+	b.WriteString(" msg=" + logfmtValue(e.Msg))
+	for _, field := range e.Fields {
+		b.WriteString(" " + field.Key + "=" + logfmtValue(field.Value))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
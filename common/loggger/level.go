@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"fmt"
+	"rovo2api/common/config"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	levelDebug Level = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < levelDebug || l > levelError {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+var currentLevel atomic.Int32
+
+func init() {
+	currentLevel.Store(int32(levelInfo))
+}
+
+// ParseLevel 解析日志级别, 为空时开启 DEBUG 则为 debug, 否则为 info
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		if config.GetSettings().DebugEnabled {
+			return levelDebug, nil
+		}
+		return levelInfo, nil
+	}
+	if name == "warning" {
+		name = "warn"
+	}
+	for i, levelName := range levelNames {
+		if levelName == name {
+			return Level(i), nil
+		}
+	}
+	return levelInfo, fmt.Errorf("unknown log level %q (available: %s)", name, strings.Join(levelNames, ","))
+}
+
+// SetLevel 运行时修改日志级别
+func SetLevel(name string) error {
+	level, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	currentLevel.Store(int32(level))
+	return nil
+}
+
+// GetLevel 返回当前日志级别
+func GetLevel() string {
+	return Level(currentLevel.Load()).String()
+}
+
+// Enabled 当前级别是否输出该级别的日志
+func Enabled(level Level) bool {
+	return level >= Level(currentLevel.Load())
+}
@@ -6,9 +6,9 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"rovo2api/common/config"
 	"rovo2api/common/helper"
+	"rovo2api/common/rotate"
 	"sync"
 	"time"
 
@@ -20,84 +20,135 @@ const (
 	loggerINFO  = "INFO"
 	loggerWarn  = "WARN"
 	loggerError = "ERR"
+	loggerSys   = "SYS"
+	loggerFatal = "FATAL"
 )
 
-var setupLogOnce sync.Once
+var (
+	setupLogOnce sync.Once
+	logWriter    *rotate.Writer
+)
 
+// SetupLogger 配置了日志目录(--log-dir 或 LOG_DIR)时同时写入 rovo2api.log, 文件按天及大小轮转
 func SetupLogger() {
 	setupLogOnce.Do(func() {
-		if LogDir != "" {
-			logPath := filepath.Join(LogDir, fmt.Sprintf("rovo2api-%s.log", time.Now().Format("20060102")))
-			fd, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		_ = SetLevel(config.LogLevel)
+		dir := LogDir
+		if dir == "" {
+			dir = config.LogDir
+		}
+		if dir != "" {
+			writer, err := rotate.New(rotate.Options{
+				Dir:      dir,
+				Name:     "rovo2api.log",
+				MaxBytes: int64(config.LogMaxSize) << 20,
+				Daily:    true,
+				MaxAge:   time.Duration(config.LogMaxAge) * 24 * time.Hour,
+				MaxFiles: config.LogMaxFiles,
+				Compress: config.LogCompress,
+			})
 			if err != nil {
 				log.Fatal("failed to open log file")
 			}
-			gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
-			gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
+			logWriter = writer
+			gin.DefaultWriter = io.MultiWriter(os.Stdout, writer)
+			gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, writer)
 		}
 	})
 }
 
+// Close 退出前关闭日志文件, 之后的日志只输出到控制台
+func Close() error {
+	if logWriter == nil {
+		return nil
+	}
+	gin.DefaultWriter = os.Stdout
+	gin.DefaultErrorWriter = os.Stderr
+	return logWriter.Close()
+}
+
 func SysLog(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	write(gin.DefaultWriter, Entry{Time: time.Now(), Tag: loggerSys, Level: "info", Msg: s})
 }
 
 func SysError(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	write(gin.DefaultErrorWriter, Entry{Time: time.Now(), Tag: loggerSys, Level: "error", Msg: s})
 }
 
 func Debug(ctx context.Context, msg string) {
-	if config.DebugEnabled {
-		logHelper(ctx, loggerDEBUG, msg)
-	}
+	logHelper(ctx, levelDebug, loggerDEBUG, msg)
 }
 
 func Info(ctx context.Context, msg string) {
-	logHelper(ctx, loggerINFO, msg)
+	logHelper(ctx, levelInfo, loggerINFO, msg)
 }
 
 func Warn(ctx context.Context, msg string) {
-	logHelper(ctx, loggerWarn, msg)
+	logHelper(ctx, levelWarn, loggerWarn, msg)
 }
 
 func Error(ctx context.Context, msg string) {
-	logHelper(ctx, loggerError, msg)
+	logHelper(ctx, levelError, loggerError, msg)
 }
 
 func Debugf(ctx context.Context, format string, a ...any) {
-	Debug(ctx, fmt.Sprintf(format, a...))
+	if Enabled(levelDebug) {
+		Debug(ctx, fmt.Sprintf(format, a...))
+	}
 }
 
 func Infof(ctx context.Context, format string, a ...any) {
-	Info(ctx, fmt.Sprintf(format, a...))
+	if Enabled(levelInfo) {
+		Info(ctx, fmt.Sprintf(format, a...))
+	}
 }
 
 func Warnf(ctx context.Context, format string, a ...any) {
-	Warn(ctx, fmt.Sprintf(format, a...))
+	if Enabled(levelWarn) {
+		Warn(ctx, fmt.Sprintf(format, a...))
+	}
 }
 
 func Errorf(ctx context.Context, format string, a ...any) {
 	Error(ctx, fmt.Sprintf(format, a...))
 }
 
-func logHelper(ctx context.Context, level string, msg string) {
+func logHelper(ctx context.Context, level Level, tag string, msg string) {
+	if !Enabled(level) {
+		return
+	}
 	writer := gin.DefaultErrorWriter
-	if level == loggerINFO {
+	if level == levelInfo {
 		writer = gin.DefaultWriter
 	}
 	id := ctx.Value(helper.RequestIdKey)
 	if id == nil {
 		id = helper.GenRequestID()
 	}
-	now := time.Now()
-	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
-	SetupLogger()
+	write(writer, Entry{
+		Time:      time.Now(),
+		Tag:       tag,
+		Level:     level.String(),
+		RequestID: fmt.Sprint(id),
+		Msg:       msg,
+		Fields:    ContextFields(ctx),
+	})
 }
 
 func FatalLog(v ...any) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[FATAL] %v | %v \n", t.Format("2006/01/02 - 15:04:05"), v)
+	write(gin.DefaultErrorWriter, Entry{Time: time.Now(), Tag: loggerFatal, Level: "fatal", Msg: fmt.Sprint(v...)})
 	os.Exit(1)
 }
+
+// FormatEntry 脱敏后按当前格式生成一行日志
+func FormatEntry(e Entry) string {
+	e.Msg = MaskSecrets(e.Msg)
+	for i := range e.Fields {
+		e.Fields[i].Value = MaskSecrets(e.Fields[i].Value)
+	}
+	return e.format(Format())
+}
+
+func write(writer io.Writer, e Entry) {
+	_, _ = io.WriteString(writer, FormatEntry(e))
+}
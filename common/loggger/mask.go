@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"regexp"
+	"rovo2api/common/config"
+	"strings"
+	"sync"
+)
+
+const (
+	maskText         = "****"
+	minMaskSecretLen = 6 // 过短的密钥不做替换, 以免误伤正常文本
+)
+
+// 常见的凭证格式, 未配置在本服务中的凭证同样会被遮盖
+var maskPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`([\w.+-]+@[\w-]+(?:\.[\w-]+)+):[A-Za-z0-9_=\-]{8,}`), "${1}:" + maskText},
+	{regexp.MustCompile(`ATATT[A-Za-z0-9_=\-]{8,}`), "ATATT" + maskText},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=\-]{6,}`), "${1}" + maskText},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{8,}`), "sk-" + maskText},
+}
+
+var (
+	maskMutex    sync.Mutex
+	maskKey      string
+	maskReplacer *strings.Replacer
+)
+
+// 已配置的凭证令牌及接口密钥, 配置变化时重新生成
+func secretReplacer() *strings.Replacer {
+	cookies := config.GetRVCookies()
+	settings := config.GetSettings()
+	key := strings.Join(cookies, ",") + "\x00" + settings.ApiSecret + "\x00" + settings.BackendSecret
+
+	maskMutex.Lock()
+	defer maskMutex.Unlock()
+	if maskReplacer != nil && key == maskKey {
+		return maskReplacer
+	}
+	var secrets []string
+	for _, cookie := range cookies {
+		token := strings.TrimSpace(cookie)
+		if idx := strings.Index(token, ":"); idx > 0 {
+			token = token[idx+1:]
+		}
+		secrets = append(secrets, token)
+	}
+	secrets = append(secrets, settings.ApiSecrets...)
+	secrets = append(secrets, settings.BackendSecret)
+
+	var oldnew []string
+	for _, secret := range secrets {
+		if len(secret) >= minMaskSecretLen {
+			oldnew = append(oldnew, secret, maskText)
+		}
+	}
+	maskKey = key
+	maskReplacer = strings.NewReplacer(oldnew...)
+	return maskReplacer
+}
+
+// MaskSecrets 遮盖日志中的凭证令牌、接口密钥等敏感信息
+func MaskSecrets(s string) string {
+	s = secretReplacer().Replace(s)
+	for _, pattern := range maskPatterns {
+		s = pattern.re.ReplaceAllString(s, pattern.replacement)
+	}
+	return s
+}
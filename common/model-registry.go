@@ -0,0 +1,16 @@
+package common
+
+import "rovo2api/common/config"
+
+// ModelInfo 模型元数据, 注册表由 config 维护(内置 models.yaml + 配置文件)
+type ModelInfo = config.ModelInfo
+
+// 获取模型信息, 支持别名及已废弃名称
+func GetModelInfo(modelName string) (ModelInfo, bool) {
+	return config.GetModelInfo(modelName)
+}
+
+// 获取所有支持的模型列表
+func GetModelList() []string {
+	return config.GetModelList()
+}
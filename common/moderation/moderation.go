@@ -0,0 +1,297 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 审核命中后的处理方式
+const (
+	ActionOff    = "off"    // 不审核
+	ActionBlock  = "block"  // 拒绝请求或终止输出
+	ActionRedact = "redact" // 替换命中的内容
+	ActionFlag   = "flag"   // 放行, 仅记录
+)
+
+// IsAction 是否为有效的处理方式
+func IsAction(action string) bool {
+	switch action {
+	case ActionOff, ActionBlock, ActionRedact, ActionFlag:
+		return true
+	}
+	return false
+}
+
+// Rule 本地规则, 命中任一关键词或正则即判定为该类别
+type Rule struct {
+	Category string   `yaml:"category" json:"category"`
+	Keywords []string `yaml:"keywords" json:"keywords,omitempty"` // 不区分大小写的子串
+	Patterns []string `yaml:"patterns" json:"patterns,omitempty"` // 正则表达式(RE2)
+}
+
+// Span 规则命中的位置(字节偏移)
+type Span struct {
+	Start    int
+	End      int
+	Category string
+}
+
+// Result 一段文本的审核结果, 与 OpenAI moderation 的 results 对应
+type Result struct {
+	Flagged        bool
+	Categories     map[string]bool
+	CategoryScores map[string]float64
+	Spans          []Span // 本地规则命中的位置, 外部分类器判定的结果不含位置
+}
+
+// FlaggedCategories 命中的类别, 按名称排序
+func (r Result) FlaggedCategories() []string {
+	var categories []string
+	for category, flagged := range r.Categories {
+		if flagged {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// Classifier 分类器, 按 inputs 的顺序返回结果
+type Classifier interface {
+	Classify(ctx context.Context, inputs []string) ([]Result, error)
+}
+
+// Options 审核配置
+type Options struct {
+	Rules   []Rule
+	Webhook WebhookOptions // URL 为空时不调用外部分类器
+}
+
+// Engine 依次调用本地规则及外部分类器并合并结果, 零值不审核任何内容
+type Engine struct {
+	rules   *Rules
+	webhook *Webhook
+}
+
+// New 校验配置并创建审核引擎, 返回带字段路径的错误列表
+func New(options Options) (*Engine, []string) {
+	rules, errs := CompileRules(options.Rules)
+	if options.Webhook.URL != "" && !strings.HasPrefix(options.Webhook.URL, "http://") && !strings.HasPrefix(options.Webhook.URL, "https://") {
+		errs = append(errs, fmt.Sprintf("webhook.url: unsupported URL %q, expected http(s)://", options.Webhook.URL))
+	}
+	if options.Webhook.Timeout < 0 {
+		errs = append(errs, "webhook.timeout: must not be negative")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	engine := &Engine{rules: rules}
+	if options.Webhook.URL != "" {
+		engine.webhook = NewWebhook(options.Webhook)
+	}
+	return engine, nil
+}
+
+// Enabled 是否配置了规则或外部分类器
+func (e *Engine) Enabled() bool {
+	return e != nil && ((e.rules != nil && len(e.rules.rules) > 0) || e.webhook != nil)
+}
+
+// Categories 本地规则的类别
+func (e *Engine) Categories() []string {
+	if e == nil || e.rules == nil {
+		return []string{}
+	}
+	return append([]string{}, e.rules.categories...)
+}
+
+// Classify 审核 inputs; 外部分类器失败时仍返回本地规则的结果及错误, 由调用方决定是否放行
+func (e *Engine) Classify(ctx context.Context, inputs []string) ([]Result, error) {
+	results := make([]Result, len(inputs))
+	if e == nil {
+		for i := range results {
+			results[i] = Result{Categories: map[string]bool{}, CategoryScores: map[string]float64{}}
+		}
+		return results, nil
+	}
+	ruleResults, _ := e.rules.Classify(ctx, inputs)
+	copy(results, ruleResults)
+	if e.webhook == nil || len(inputs) == 0 {
+		return results, nil
+	}
+	webhookResults, err := e.webhook.Classify(ctx, inputs)
+	if err != nil {
+		return results, err
+	}
+	for i := range results {
+		merge(&results[i], webhookResults[i])
+	}
+	return results, nil
+}
+
+// 合并外部分类器的结果; 外部分类器判定命中时无法定位, 去掉本地规则的位置以便整段处理
+func merge(dst *Result, src Result) {
+	dst.Flagged = dst.Flagged || src.Flagged
+	if src.Flagged {
+		dst.Spans = nil
+	}
+	for category, flagged := range src.Categories {
+		dst.Categories[category] = dst.Categories[category] || flagged
+	}
+	for category, score := range src.CategoryScores {
+		if score > dst.CategoryScores[category] {
+			dst.CategoryScores[category] = score
+		}
+	}
+}
+
+type compiledRule struct {
+	category string
+	pattern  *regexp.Regexp
+}
+
+// Rules 本地规则引擎
+type Rules struct {
+	rules      []compiledRule
+	categories []string
+	maxKeyword int // 最长关键词的字符数
+}
+
+// CompileRules 校验并编译规则, 关键词与正则按规则合并为一个表达式
+func CompileRules(rules []Rule) (*Rules, []string) {
+	var errs []string
+	addErr := func(field string, format string, a ...any) {
+		errs = append(errs, field+": "+fmt.Sprintf(format, a...))
+	}
+
+	compiled := &Rules{}
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		category := strings.TrimSpace(rule.Category)
+		if category == "" {
+			addErr(field+".category", "is required")
+		}
+		var alternatives []string
+		for j, keyword := range rule.Keywords {
+			if strings.TrimSpace(keyword) == "" {
+				addErr(fmt.Sprintf("%s.keywords[%d]", field, j), "must not be empty")
+				continue
+			}
+			alternatives = append(alternatives, "(?i:"+regexp.QuoteMeta(keyword)+")")
+			compiled.maxKeyword = max(compiled.maxKeyword, utf8.RuneCountInString(keyword))
+		}
+		for j, pattern := range rule.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				addErr(fmt.Sprintf("%s.patterns[%d]", field, j), "%v", err)
+				continue
+			}
+			alternatives = append(alternatives, "(?:"+pattern+")")
+		}
+		if len(rule.Keywords) == 0 && len(rule.Patterns) == 0 {
+			addErr(field, "keywords or patterns is required")
+		}
+		if len(alternatives) == 0 || category == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(strings.Join(alternatives, "|"))
+		if err != nil {
+			addErr(field, "%v", err)
+			continue
+		}
+		compiled.rules = append(compiled.rules, compiledRule{category: category, pattern: pattern})
+		if !seen[category] {
+			seen[category] = true
+			compiled.categories = append(compiled.categories, category)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return compiled, nil
+}
+
+// Match 审核一段文本
+func (r *Rules) Match(text string) Result {
+	result := Result{Categories: make(map[string]bool), CategoryScores: make(map[string]float64)}
+	if r == nil {
+		return result
+	}
+	for _, category := range r.categories {
+		result.Categories[category] = false
+		result.CategoryScores[category] = 0
+	}
+	for _, rule := range r.rules {
+		for _, loc := range rule.pattern.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			result.Flagged = true
+			result.Categories[rule.category] = true
+			result.CategoryScores[rule.category] = 1
+			result.Spans = append(result.Spans, Span{Start: loc[0], End: loc[1], Category: rule.category})
+		}
+	}
+	result.Spans = mergeSpans(result.Spans)
+	return result
+}
+
+// Classify 实现 Classifier
+func (r *Rules) Classify(_ context.Context, inputs []string) ([]Result, error) {
+	results := make([]Result, len(inputs))
+	for i, input := range inputs {
+		results[i] = r.Match(input)
+	}
+	return results, nil
+}
+
+// 按起始位置排序并合并重叠的命中
+func mergeSpans(spans []Span) []Span {
+	if len(spans) < 2 {
+		return spans
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+	merged := spans[:1]
+	for _, span := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if span.Start < last.End {
+			if span.End > last.End {
+				last.End = span.End
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// Redact 替换命中的内容; 结果不含位置(外部分类器判定)时替换整段文本
+func Redact(text string, result Result) string {
+	if !result.Flagged {
+		return text
+	}
+	if len(result.Spans) == 0 {
+		return "[REDACTED]"
+	}
+	var sb strings.Builder
+	last := 0
+	for _, span := range result.Spans {
+		if span.Start < last || span.End > len(text) {
+			continue
+		}
+		sb.WriteString(text[last:span.Start])
+		sb.WriteString("[REDACTED:" + span.Category + "]")
+		last = span.End
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
@@ -0,0 +1,89 @@
+package moderation
+
+import (
+	"context"
+	"unicode/utf8"
+)
+
+// DefaultStreamBuffer 流式输出每段审核的默认字符数
+const DefaultStreamBuffer = 200
+
+// Stream 对流式输出分段审核: 累积到 buffer 个字符后审核, 末尾 buffer/2 个字符(不少于最长关键词的字符数)
+// 留到下一段一起审核, 避免关键词被拆分到两段; 正则匹配长于保留部分时可能被拆分
+type Stream struct {
+	engine   *Engine
+	buffer   int
+	holdback int
+	pending  string
+}
+
+// Segment 审核后可以发送的一段输出, Result 中的位置相对于 Text
+type Segment struct {
+	Text   string
+	Result Result
+}
+
+// NewStream 创建流式审核, buffer 不大于 0 时使用 DefaultStreamBuffer
+func (e *Engine) NewStream(buffer int) *Stream {
+	if buffer <= 0 {
+		buffer = DefaultStreamBuffer
+	}
+	holdback := buffer / 2
+	if e != nil && e.rules != nil {
+		holdback = max(holdback, e.rules.maxKeyword)
+	}
+	return &Stream{engine: e, buffer: buffer, holdback: holdback}
+}
+
+// Write 追加一段输出, 未达到 buffer 时返回空的 Segment; 审核失败时仍返回 Segment 及错误
+func (s *Stream) Write(ctx context.Context, delta string) (Segment, error) {
+	s.pending += delta
+	if utf8.RuneCountInString(s.pending) < s.buffer {
+		return Segment{}, nil
+	}
+	return s.emit(ctx, false)
+}
+
+// Flush 审核并返回剩余的输出
+func (s *Stream) Flush(ctx context.Context) (Segment, error) {
+	if s.pending == "" {
+		return Segment{}, nil
+	}
+	return s.emit(ctx, true)
+}
+
+func (s *Stream) emit(ctx context.Context, final bool) (Segment, error) {
+	results, err := s.engine.Classify(ctx, []string{s.pending})
+	result := results[0]
+
+	cut := len(s.pending)
+	if !final && !(result.Flagged && len(result.Spans) == 0) {
+		// 保留末尾 holdback 个字符
+		for i := 0; i < s.holdback && cut > 0; i++ {
+			_, size := utf8.DecodeLastRuneInString(s.pending[:cut])
+			cut -= size
+		}
+		// 不拆分跨越分段位置的命中
+		for _, span := range result.Spans {
+			if span.Start < cut && span.End > cut {
+				cut = span.Start
+			}
+		}
+	}
+
+	segment := Segment{Text: s.pending[:cut], Result: result}
+	if len(result.Spans) > 0 {
+		// 只计入本段内的命中, 保留部分的命中留到下一段
+		segment.Result = s.engine.rules.Match("")
+		for _, span := range result.Spans {
+			if span.End <= cut {
+				segment.Result.Flagged = true
+				segment.Result.Categories[span.Category] = true
+				segment.Result.CategoryScores[span.Category] = 1
+				segment.Result.Spans = append(segment.Result.Spans, span)
+			}
+		}
+	}
+	s.pending = s.pending[cut:]
+	return segment, err
+}
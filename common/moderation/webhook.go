@@ -0,0 +1,97 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultWebhookTimeout 外部分类器的默认超时
+const DefaultWebhookTimeout = 5 * time.Second
+
+// WebhookOptions 外部分类器配置
+type WebhookOptions struct {
+	URL     string
+	Secret  string // 非空时以 Authorization: Bearer 发送
+	Model   string // 请求体中的 model 字段, 为空时不发送
+	Timeout time.Duration
+}
+
+// Webhook 兼容 OpenAI /v1/moderations 协议的外部分类器:
+// 请求体为 {"input":[...],"model":"..."}, 响应体需包含与 input 一一对应的 results
+type Webhook struct {
+	options WebhookOptions
+	client  *http.Client
+}
+
+func NewWebhook(options WebhookOptions) *Webhook {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultWebhookTimeout
+	}
+	return &Webhook{options: options, client: &http.Client{Timeout: options.Timeout}}
+}
+
+type webhookRequest struct {
+	Input []string `json:"input"`
+	Model string   `json:"model,omitempty"`
+}
+
+type webhookResponse struct {
+	Results []struct {
+		Flagged        bool               `json:"flagged"`
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+}
+
+// Classify 实现 Classifier
+func (w *Webhook) Classify(ctx context.Context, inputs []string) ([]Result, error) {
+	body, err := json.Marshal(webhookRequest{Input: inputs, Model: w.options.Model})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.options.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+w.options.Secret)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("moderation webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("moderation webhook: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation webhook: status %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+	}
+	var parsed webhookResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("moderation webhook: invalid response: %v", err)
+	}
+	if len(parsed.Results) != len(inputs) {
+		return nil, fmt.Errorf("moderation webhook: got %d results for %d inputs", len(parsed.Results), len(inputs))
+	}
+
+	results := make([]Result, len(inputs))
+	for i, item := range parsed.Results {
+		result := Result{Flagged: item.Flagged, Categories: make(map[string]bool), CategoryScores: make(map[string]float64)}
+		for category, flagged := range item.Categories {
+			result.Categories[category] = flagged
+		}
+		for category, score := range item.CategoryScores {
+			result.CategoryScores[category] = score
+		}
+		results[i] = result
+	}
+	return results, nil
+}
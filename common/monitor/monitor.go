@@ -0,0 +1,221 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Request 一次对话请求的概要, 不含消息内容
+type Request struct {
+	ID               string    `json:"id"`
+	Time             time.Time `json:"time"`
+	Key              string    `json:"key"` // 调用方标识(API-KEY 哈希或 IP), 不含密钥本身
+	Model            string    `json:"model"`
+	UsedModel        string    `json:"used_model,omitempty"`
+	Credential       string    `json:"credential,omitempty"`
+	Stream           bool      `json:"stream"`
+	Status           int       `json:"status,omitempty"`
+	Cache            string    `json:"cache,omitempty"`
+	Error            bool      `json:"error,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	LatencyMs        int64     `json:"latency_ms"` // 进行中的请求为已耗时
+}
+
+// Usage 一个时间段内的用量
+type Usage struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	Tokens   int64 `json:"tokens"`
+}
+
+func (u *Usage) add(other Usage) {
+	u.Requests += other.Requests
+	u.Errors += other.Errors
+	u.Tokens += other.Tokens
+}
+
+// Series 按调用方及模型分组的用量时间序列, 各序列长度相同, 第 i 个点对应 Start+i*Step
+type Series struct {
+	Start   time.Time          `json:"start"`
+	Step    int64              `json:"step"` // 秒
+	Total   []Usage            `json:"total"`
+	ByKey   map[string][]Usage `json:"by_key"`
+	ByModel map[string][]Usage `json:"by_model"`
+}
+
+// Options 监控配置
+type Options struct {
+	Recent    int           // 保留的最近请求数
+	Retention time.Duration // 用量统计的保留时长
+}
+
+type minute struct {
+	byKey   map[string]*Usage
+	byModel map[string]*Usage
+}
+
+// Monitor 记录当前实例进行中及最近完成的请求, 以及按分钟汇总的用量
+type Monitor struct {
+	options Options
+	mutex   sync.Mutex
+	live    map[*Request]struct{}
+	recent  []Request // 环形缓冲
+	next    int
+	minutes map[int64]*minute // unix 分钟 -> 用量
+}
+
+// New 创建监控
+func New(options Options) *Monitor {
+	if options.Recent <= 0 {
+		options.Recent = 200
+	}
+	if options.Retention <= 0 {
+		options.Retention = 24 * time.Hour
+	}
+	return &Monitor{
+		options: options,
+		live:    make(map[*Request]struct{}),
+		minutes: make(map[int64]*minute),
+	}
+}
+
+// Start 开始记录请求, 之后只能通过 Update 修改 r
+func (m *Monitor) Start(r *Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.live[r] = struct{}{}
+}
+
+// Update 在锁内修改进行中的请求
+func (m *Monitor) Update(r *Request, update func(r *Request)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	update(r)
+}
+
+// Finish 结束请求, 计入最近请求及用量统计
+func (m *Monitor) Finish(r *Request, update func(r *Request)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	update(r)
+	r.LatencyMs = time.Since(r.Time).Milliseconds()
+	delete(m.live, r)
+
+	if len(m.recent) < m.options.Recent {
+		m.recent = append(m.recent, *r)
+	} else {
+		m.recent[m.next] = *r
+	}
+	m.next = (m.next + 1) % m.options.Recent
+
+	now := time.Now()
+	index := now.Unix() / 60
+	bucket, ok := m.minutes[index]
+	if !ok {
+		bucket = &minute{byKey: make(map[string]*Usage), byModel: make(map[string]*Usage)}
+		m.minutes[index] = bucket
+		m.prune(now)
+	}
+	usage := Usage{Requests: 1, Tokens: int64(r.PromptTokens + r.CompletionTokens)}
+	if r.Error {
+		usage.Errors = 1
+	}
+	model := r.UsedModel
+	if model == "" {
+		model = r.Model
+	}
+	addUsage(bucket.byKey, r.Key, usage)
+	addUsage(bucket.byModel, model, usage)
+}
+
+func addUsage(usages map[string]*Usage, name string, usage Usage) {
+	if usages[name] == nil {
+		usages[name] = &Usage{}
+	}
+	usages[name].add(usage)
+}
+
+func (m *Monitor) prune(now time.Time) {
+	oldest := now.Add(-m.options.Retention).Unix() / 60
+	for index := range m.minutes {
+		if index < oldest {
+			delete(m.minutes, index)
+		}
+	}
+}
+
+// Live 返回进行中的请求, 按开始时间排序
+func (m *Monitor) Live() []Request {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	result := make([]Request, 0, len(m.live))
+	for r := range m.live {
+		request := *r
+		request.LatencyMs = time.Since(r.Time).Milliseconds()
+		result = append(result, request)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result
+}
+
+// Recent 返回最近完成的至多 limit 个请求, 最新的在前
+func (m *Monitor) Recent(limit int) []Request {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	size := len(m.recent)
+	if limit <= 0 || limit > size {
+		limit = size
+	}
+	result := make([]Request, 0, limit)
+	for i := 1; i <= limit; i++ {
+		result = append(result, m.recent[(m.next-i+size)%size])
+	}
+	return result
+}
+
+// Usage 返回最近 window 时长内的用量, 每 step 汇总为一个点
+func (m *Monitor) Usage(window, step time.Duration) Series {
+	if step < time.Minute {
+		step = time.Minute
+	}
+	window = min(window, m.options.Retention)
+	stepMinutes := int64(step / time.Minute)
+	points := max(int((window+step-1)/step), 1)
+
+	// 按 step 对齐, 最后一个点包含当前分钟
+	end := time.Now().Unix()/60/stepMinutes*stepMinutes + stepMinutes
+	start := end - int64(points)*stepMinutes
+	series := Series{
+		Start:   time.Unix(start*60, 0),
+		Step:    int64(step / time.Second),
+		Total:   make([]Usage, points),
+		ByKey:   make(map[string][]Usage),
+		ByModel: make(map[string][]Usage),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for index, bucket := range m.minutes {
+		if index < start || index >= end {
+			continue
+		}
+		point := int((index - start) / stepMinutes)
+		addPoint(series.ByKey, bucket.byKey, point, points)
+		addPoint(series.ByModel, bucket.byModel, point, points)
+		for _, usage := range bucket.byModel {
+			series.Total[point].add(*usage)
+		}
+	}
+	return series
+}
+
+func addPoint(series map[string][]Usage, usages map[string]*Usage, point, points int) {
+	for name, usage := range usages {
+		if series[name] == nil {
+			series[name] = make([]Usage, points)
+		}
+		series[name][point].add(*usage)
+	}
+}
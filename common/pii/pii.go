@@ -0,0 +1,286 @@
+package pii
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"rovo2api/common/audit"
+	"sort"
+	"strings"
+)
+
+// Rule 自定义检测规则
+type Rule struct {
+	Name    string `yaml:"name" json:"name"`
+	Pattern string `yaml:"pattern" json:"pattern"`
+}
+
+type builtinRule struct {
+	name    string
+	pattern string
+	valid   func(string) bool // 为 nil 时不额外校验
+}
+
+// 内置规则, 按顺序应用; 与审计日志共用的规则取自 audit.BuiltinRules
+var builtinRules = func() []builtinRule {
+	rules := []builtinRule{
+		{name: "private_key", pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+		{name: "jwt", pattern: `\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`},
+	}
+	for _, rule := range audit.BuiltinRules {
+		builtin := builtinRule{name: rule.Name, pattern: rule.Pattern}
+		if rule.Name == "card" {
+			builtin.valid = luhn
+		}
+		rules = append(rules, builtin)
+	}
+	return append(rules,
+		builtinRule{name: "ipv6", pattern: `(?i)(?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}`, valid: isIPv6},
+		builtinRule{name: "ipv4", pattern: `\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`},
+	)
+}()
+
+// DefaultRules 默认启用的内置规则, phone 容易误判时间戳等数字, 默认不启用
+var DefaultRules = []string{"private_key", "jwt", "credential", "atlassian_token", "bearer", "api_key", "email", "card", "ipv6", "ipv4"}
+
+// BuiltinRuleNames 返回所有内置规则名
+func BuiltinRuleNames() []string {
+	names := make([]string, 0, len(builtinRules))
+	for _, rule := range builtinRules {
+		names = append(names, rule.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func luhn(s string) bool {
+	sum, digits := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() == nil
+}
+
+type detector struct {
+	name        string
+	placeholder string // 占位符前缀, 如 EMAIL
+	re          *regexp.Regexp
+	valid       func(string) bool
+}
+
+// Redactor 编译后的检测规则, nil 表示不脱敏
+type Redactor struct {
+	detectors []detector
+}
+
+var placeholderName = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// New 按名称选择内置规则(保持内置顺序, all 表示全部)并追加自定义规则, 没有任何规则时返回 nil
+func New(builtin []string, custom []Rule) (*Redactor, error) {
+	enabled := make(map[string]bool)
+	for _, name := range builtin {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "all":
+			for _, rule := range builtinRules {
+				enabled[rule.name] = true
+			}
+		case isBuiltinRule(name):
+			enabled[name] = true
+		default:
+			return nil, fmt.Errorf("unknown rule %q (available: all,%s)", name, strings.Join(BuiltinRuleNames(), ","))
+		}
+	}
+
+	redactor := &Redactor{}
+	add := func(name, pattern string, valid func(string) bool) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("rule %s: %v", name, err)
+		}
+		placeholder := strings.Trim(placeholderName.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+		if placeholder == "" {
+			placeholder = "REDACTED"
+		}
+		redactor.detectors = append(redactor.detectors, detector{name: name, placeholder: placeholder, re: re, valid: valid})
+		return nil
+	}
+	for _, rule := range builtinRules {
+		if enabled[rule.name] {
+			if err := add(rule.name, rule.pattern, rule.valid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, rule := range custom {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("custom_rules[%d]: name is required", i)
+		}
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("custom_rules[%d]: pattern is required", i)
+		}
+		if err := add(rule.Name, rule.Pattern, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(redactor.detectors) == 0 {
+		return nil, nil
+	}
+	return redactor, nil
+}
+
+func isBuiltinRule(name string) bool {
+	for _, rule := range builtinRules {
+		if rule.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 占位符, 如 [EMAIL_1]
+var placeholderPattern = regexp.MustCompile(`\[[A-Z0-9_]+_[0-9]+\]`)
+
+// Session 一次请求内的占位符映射, 同一原文始终使用同一占位符, 以便多次重试及还原
+type Session struct {
+	redactor  *Redactor
+	values    map[string]string // 原文 -> 占位符
+	originals map[string]string // 占位符 -> 原文
+	counts    map[string]int    // 规则 -> 脱敏的不同原文数
+	next      map[string]int
+	maxLen    int
+}
+
+// NewSession 创建一次请求的脱敏会话, r 为 nil 时返回 nil
+func (r *Redactor) NewSession() *Session {
+	if r == nil {
+		return nil
+	}
+	return &Session{
+		redactor:  r,
+		values:    make(map[string]string),
+		originals: make(map[string]string),
+		counts:    make(map[string]int),
+		next:      make(map[string]int),
+	}
+}
+
+// Redact 将文本中检测到的内容替换为占位符
+func (s *Session) Redact(text string) string {
+	if s == nil {
+		return text
+	}
+	for _, d := range s.redactor.detectors {
+		text = d.re.ReplaceAllStringFunc(text, func(match string) string {
+			if _, ok := s.originals[match]; ok {
+				return match
+			}
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			if placeholder, ok := s.values[match]; ok {
+				return placeholder
+			}
+			s.next[d.placeholder]++
+			placeholder := fmt.Sprintf("[%s_%d]", d.placeholder, s.next[d.placeholder])
+			s.values[match] = placeholder
+			s.originals[placeholder] = match
+			s.counts[d.name]++
+			s.maxLen = max(s.maxLen, len(placeholder))
+			return placeholder
+		})
+	}
+	return text
+}
+
+// Restore 将文本中本次请求的占位符还原为原文
+func (s *Session) Restore(text string) string {
+	if s == nil || len(s.originals) == 0 {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if original, ok := s.originals[placeholder]; ok {
+			return original
+		}
+		return placeholder
+	})
+}
+
+// Counts 各规则脱敏的不同原文数
+func (s *Session) Counts() map[string]int {
+	if s == nil || len(s.counts) == 0 {
+		return nil
+	}
+	counts := make(map[string]int, len(s.counts))
+	for name, count := range s.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// Restorer 还原流式输出中的占位符, 可能被拆分到两段的占位符留到下一段
+type Restorer struct {
+	session *Session
+	pending string
+}
+
+// NewRestorer 创建流式还原, s 为 nil 时返回 nil
+func (s *Session) NewRestorer() *Restorer {
+	if s == nil {
+		return nil
+	}
+	return &Restorer{session: s}
+}
+
+// Write 追加一段输出, 返回可以发送的内容
+func (r *Restorer) Write(delta string) string {
+	if r == nil {
+		return delta
+	}
+	text := r.session.Restore(r.pending + delta)
+	r.pending = ""
+	// 末尾未闭合且可能是占位符开头的部分留到下一段
+	if i := strings.LastIndexByte(text, '['); i >= 0 && len(text)-i < r.session.maxLen && isPlaceholderPrefix(text[i:]) {
+		r.pending = text[i:]
+		text = text[:i]
+	}
+	return text
+}
+
+// Flush 返回剩余的内容
+func (r *Restorer) Flush() string {
+	if r == nil {
+		return ""
+	}
+	text := r.session.Restore(r.pending)
+	r.pending = ""
+	return text
+}
+
+func isPlaceholderPrefix(s string) bool {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
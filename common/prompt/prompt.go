@@ -0,0 +1,230 @@
+package prompt
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"rovo2api/common/audit"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 策略消息的插入方式
+const (
+	ModePrepend = "prepend" // 插入到消息列表开头
+	ModeAppend  = "append"  // 追加到消息列表末尾
+	ModeReplace = "replace" // 移除客户端的 system 消息, 再插入到消息列表开头
+)
+
+// Message 策略消息, content 为 text/template 模板
+type Message struct {
+	Role    string `yaml:"role" json:"role"`
+	Content string `yaml:"content" json:"content"`
+}
+
+// Policy 提示词策略; keys/models/routes 为空时不限制, 多个条件需同时满足
+type Policy struct {
+	Name     string    `yaml:"name" json:"name"`
+	Keys     []string  `yaml:"keys" json:"keys,omitempty"`     // API-KEY 或其标识(key-xxxx)
+	Models   []string  `yaml:"models" json:"models,omitempty"` // 请求的模型名或模型 id, 支持 * 通配
+	Routes   []string  `yaml:"routes" json:"routes,omitempty"` // 接口路径(不含 ROUTE_PREFIX), 支持 * 通配
+	Mode     string    `yaml:"mode" json:"mode,omitempty"`     // 默认为 prepend
+	Messages []Message `yaml:"messages" json:"messages"`
+}
+
+// Vars 模板变量, 如 {{.Date}}、{{.KeyName}}
+type Vars struct {
+	Date    string // 当天日期, 如 2025-06-01
+	Time    string // 当前时间(RFC3339)
+	Weekday string
+	KeyName string // key_names 中配置的名称, 未配置时为 KeyID
+	KeyID   string
+	Model   string // 请求的模型名
+	ModelID string
+	User    string // 请求中的 user 字段
+	Route   string
+}
+
+// Request 匹配及渲染策略所需的请求信息
+type Request struct {
+	Key     string // API-KEY 或其标识
+	KeyID   string // API-KEY 的标识, 为空时由 Key 计算
+	Model   string
+	ModelID string
+	Route   string
+	User    string
+	Now     time.Time
+}
+
+// Result 一条匹配的策略渲染后的消息
+type Result struct {
+	Policy   string    `json:"policy"`
+	Mode     string    `json:"mode"`
+	Messages []Message `json:"messages"`
+}
+
+type compiledPolicy struct {
+	Policy
+	keyIDs    map[string]bool
+	templates []*template.Template
+}
+
+var keyIDPattern = regexp.MustCompile(`^key-[0-9a-f]{12}$`)
+
+// KeyID 返回 API-KEY 的标识, 已经是标识时原样返回
+func KeyID(key string) string {
+	key = strings.TrimSpace(key)
+	if keyIDPattern.MatchString(key) {
+		return key
+	}
+	return audit.KeyID(key)
+}
+
+// Set 编译后的策略, 零值不包含任何策略
+type Set struct {
+	policies []compiledPolicy
+	keyNames map[string]string
+}
+
+// Compile 校验并编译策略, 返回带字段路径的错误列表; keys 及 keyNames 可使用 API-KEY 或其标识
+func Compile(policies []Policy, keyNames map[string]string) (*Set, []string) {
+	var errs []string
+	addErr := func(field string, format string, a ...any) {
+		errs = append(errs, field+": "+fmt.Sprintf(format, a...))
+	}
+
+	set := &Set{keyNames: make(map[string]string, len(keyNames))}
+	for key, name := range keyNames {
+		set.keyNames[KeyID(key)] = strings.TrimSpace(name)
+	}
+	names := make(map[string]int)
+	for i, policy := range policies {
+		field := fmt.Sprintf("policies[%d]", i)
+		if policy.Name == "" {
+			policy.Name = field
+		}
+		if j, ok := names[policy.Name]; ok {
+			addErr(field+".name", "%q is already used by policies[%d]", policy.Name, j)
+		}
+		names[policy.Name] = i
+		switch policy.Mode {
+		case "":
+			policy.Mode = ModePrepend
+		case ModePrepend, ModeAppend, ModeReplace:
+		default:
+			addErr(field+".mode", "unknown mode %q (expected prepend, append or replace)", policy.Mode)
+		}
+		for j, pattern := range policy.Models {
+			if _, err := path.Match(pattern, ""); err != nil {
+				addErr(fmt.Sprintf("%s.models[%d]", field, j), "invalid pattern %q", pattern)
+			}
+		}
+		for j, pattern := range policy.Routes {
+			if _, err := path.Match(pattern, ""); err != nil {
+				addErr(fmt.Sprintf("%s.routes[%d]", field, j), "invalid pattern %q", pattern)
+			}
+		}
+		if len(policy.Messages) == 0 && policy.Mode != ModeReplace {
+			addErr(field+".messages", "must not be empty")
+		}
+
+		compiled := compiledPolicy{Policy: policy, keyIDs: make(map[string]bool, len(policy.Keys))}
+		for j, key := range policy.Keys {
+			if strings.TrimSpace(key) == "" {
+				addErr(fmt.Sprintf("%s.keys[%d]", field, j), "must not be empty")
+			}
+			compiled.keyIDs[KeyID(key)] = true
+		}
+		for j, message := range policy.Messages {
+			messageField := fmt.Sprintf("%s.messages[%d]", field, j)
+			switch message.Role {
+			case "system", "user", "assistant":
+			default:
+				addErr(messageField+".role", "unknown role %q (expected system, user or assistant)", message.Role)
+			}
+			tmpl, err := template.New(messageField).Option("missingkey=error").Parse(message.Content)
+			if err == nil {
+				// 用空变量试渲染, 提前发现不存在的变量
+				err = tmpl.Execute(&strings.Builder{}, Vars{})
+			}
+			if err != nil {
+				addErr(messageField+".content", "%v", err)
+				continue
+			}
+			compiled.templates = append(compiled.templates, tmpl)
+		}
+		set.policies = append(set.policies, compiled)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return set, nil
+}
+
+func matchAny(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if ok, _ := path.Match(pattern, value); ok && value != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p compiledPolicy) matches(req Request, keyID string) bool {
+	if len(p.keyIDs) > 0 && (keyID == "" || !p.keyIDs[keyID]) {
+		return false
+	}
+	return matchAny(p.Models, req.Model, req.ModelID) && matchAny(p.Routes, req.Route)
+}
+
+// Render 按配置顺序渲染所有匹配的策略
+func (s *Set) Render(req Request) ([]Result, error) {
+	if s == nil || len(s.policies) == 0 {
+		return nil, nil
+	}
+	if req.Now.IsZero() {
+		req.Now = time.Now()
+	}
+	keyID := req.KeyID
+	if keyID == "" && req.Key != "" {
+		keyID = KeyID(req.Key)
+	}
+	keyName := s.keyNames[keyID]
+	if keyName == "" {
+		keyName = keyID
+	}
+	vars := Vars{
+		Date:    req.Now.Format(time.DateOnly),
+		Time:    req.Now.Format(time.RFC3339),
+		Weekday: req.Now.Weekday().String(),
+		KeyName: keyName,
+		KeyID:   keyID,
+		Model:   req.Model,
+		ModelID: req.ModelID,
+		User:    req.User,
+		Route:   req.Route,
+	}
+
+	var results []Result
+	for _, policy := range s.policies {
+		if !policy.matches(req, keyID) {
+			continue
+		}
+		result := Result{Policy: policy.Name, Mode: policy.Mode}
+		for i, tmpl := range policy.templates {
+			var content strings.Builder
+			if err := tmpl.Execute(&content, vars); err != nil {
+				return nil, fmt.Errorf("policy %s: %v", policy.Name, err)
+			}
+			result.Messages = append(result.Messages, Message{Role: policy.Messages[i].Role, Content: content.String()})
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
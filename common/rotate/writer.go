@@ -0,0 +1,213 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405"
+
+// Options 日志轮转配置, 0 表示不限制
+type Options struct {
+	Dir      string
+	Name     string        // 当前文件名, 如 audit.jsonl
+	MaxBytes int64         // 单个文件最大字节数
+	Daily    bool          // 跨天时轮转
+	MaxAge   time.Duration // 轮转后的文件保留时长
+	MaxFiles int           // 轮转后的文件最多保留个数
+	Compress bool          // 轮转后使用 gzip 压缩
+}
+
+// Writer 按大小/日期轮转的文件写入器, 轮转后的文件命名为 <name>-<时间><ext>
+type Writer struct {
+	mu      sync.Mutex
+	options Options
+	file    *os.File
+	size    int64
+	day     string
+	pending sync.WaitGroup // 进行中的压缩
+}
+
+// New 创建轮转写入器, 目录不存在时自动创建
+func New(options Options) (*Writer, error) {
+	if err := os.MkdirAll(options.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	w := &Writer{options: options}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.cleanup()
+	return w, nil
+}
+
+func (w *Writer) path() string {
+	return filepath.Join(w.options.Dir, w.options.Name)
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.file = file
+	w.size = stat.Size()
+	w.day = stat.ModTime().Format("20060102")
+	if w.size == 0 {
+		w.day = time.Now().Format("20060102")
+	}
+	return nil
+}
+
+// Write 写入一条记录, 写入前按需轮转
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	today := time.Now().Format("20060102")
+	if w.size > 0 && ((w.options.MaxBytes > 0 && w.size+int64(len(p)) > w.options.MaxBytes) ||
+		(w.options.Daily && w.day != today)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	w.day = today
+	return n, err
+}
+
+// Rotate 立即轮转当前文件
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	ext := filepath.Ext(w.options.Name)
+	base := strings.TrimSuffix(w.options.Name, ext)
+	backup := filepath.Join(w.options.Dir, fmt.Sprintf("%s-%s%s", base, time.Now().Format(backupTimeFormat), ext))
+	for i := 1; fileExists(backup); i++ {
+		backup = filepath.Join(w.options.Dir, fmt.Sprintf("%s-%s.%d%s", base, time.Now().Format(backupTimeFormat), i, ext))
+	}
+	if err := os.Rename(w.path(), backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	if w.options.Compress {
+		// 压缩完成后再清理, 避免与压缩中的文件冲突
+		w.pending.Add(1)
+		go func() {
+			defer w.pending.Done()
+			if err := compressFile(backup); err == nil {
+				w.mu.Lock()
+				w.cleanup()
+				w.mu.Unlock()
+			}
+		}()
+		return nil
+	}
+	w.cleanup()
+	return nil
+}
+
+// compressFile 将文件压缩为 <path>.gz 并删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz.tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path + ".gz.tmp")
+		return err
+	}
+	if err := os.Rename(path+".gz.tmp", path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Backups 返回轮转后的文件, 最新的在前
+func (w *Writer) Backups() []string {
+	ext := filepath.Ext(w.options.Name)
+	base := strings.TrimSuffix(w.options.Name, ext)
+	matches, _ := filepath.Glob(filepath.Join(w.options.Dir, base+"-*"))
+	backups := matches[:0]
+	for _, match := range matches {
+		if !strings.HasSuffix(match, ".tmp") {
+			backups = append(backups, match)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups
+}
+
+// cleanup 按保留时长及个数删除旧文件
+func (w *Writer) cleanup() {
+	now := time.Now()
+	for i, backup := range w.Backups() {
+		if w.options.MaxFiles > 0 && i >= w.options.MaxFiles {
+			_ = os.Remove(backup)
+			continue
+		}
+		if w.options.MaxAge > 0 {
+			if stat, err := os.Stat(backup); err == nil && now.Sub(stat.ModTime()) > w.options.MaxAge {
+				_ = os.Remove(backup)
+			}
+		}
+	}
+}
+
+// Close 等待进行中的压缩完成后关闭当前文件
+func (w *Writer) Close() error {
+	w.pending.Wait()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,275 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority 优先级, 有高优先级的请求排队时低优先级的请求不会被派发
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // 交互式请求, 默认
+	PriorityBatch                       // 批量任务
+	priorityCount
+)
+
+var priorityNames = [priorityCount]string{"interactive", "batch"}
+
+func (p Priority) String() string {
+	if p < 0 || p >= priorityCount {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority 解析优先级名称(interactive、batch)
+func ParsePriority(name string) (Priority, bool) {
+	for i, priorityName := range priorityNames {
+		if strings.EqualFold(strings.TrimSpace(name), priorityName) {
+			return Priority(i), true
+		}
+	}
+	return PriorityInteractive, false
+}
+
+// ErrQueueFull 队列已满, 请求被直接拒绝
+var ErrQueueFull = errors.New("scheduler queue is full")
+
+// Options 调度器配置
+type Options struct {
+	MaxConcurrent  int // 同时派发的请求数
+	MaxQueue       int // 排队的请求总数上限, 0 为不限制
+	MaxQueuePerKey int // 单个 key 排队的请求数上限, 0 为不限制
+}
+
+// Ticket 待派发的请求
+type Ticket struct {
+	Key      string  // 公平调度的单位, 如 API-KEY
+	Weight   float64 // 权重, 同一优先级内按权重分配派发机会, 小于等于 0 时为 1
+	Priority Priority
+}
+
+type waiter struct {
+	ready    chan struct{}
+	finish   float64 // 虚拟完成时间, 越小越先派发
+	enqueued time.Time
+	granted  bool
+}
+
+type keyQueue struct {
+	waiters    []*waiter
+	lastFinish float64
+}
+
+// Scheduler 加权公平队列: 并发已满时请求按优先级及 key 排队,
+// 同一优先级内按各 key 的虚拟完成时间派发, 发送请求多的 key 不会挤占其他 key
+type Scheduler struct {
+	mutex   sync.Mutex
+	options Options
+	running int
+	queued  int
+	queues  [priorityCount]map[string]*keyQueue
+	virtual [priorityCount]float64
+	stats   counters
+}
+
+type counters struct {
+	dispatched int64
+	rejected   int64
+	cancelled  int64
+	queuedOnce int64 // 经过排队的请求数
+	totalWait  time.Duration
+	maxWait    time.Duration
+}
+
+func New(options Options) *Scheduler {
+	s := &Scheduler{options: options}
+	for i := range s.queues {
+		s.queues[i] = make(map[string]*keyQueue)
+	}
+	return s
+}
+
+// Update 更新配置, 并发数增加时立即派发排队的请求
+func (s *Scheduler) Update(options Options) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.options == options {
+		return
+	}
+	s.options = options
+	s.dispatch()
+}
+
+// Acquire 获取一个派发名额, 并发已满时排队等待直到派发或 ctx 结束; 队列已满时返回 ErrQueueFull.
+// 成功时返回释放名额的函数及排队时间
+func (s *Scheduler) Acquire(ctx context.Context, ticket Ticket) (func(), time.Duration, error) {
+	s.mutex.Lock()
+	if s.running < s.options.MaxConcurrent && s.queued == 0 {
+		s.running++
+		s.stats.dispatched++
+		s.mutex.Unlock()
+		return s.releaseFunc(), 0, nil
+	}
+
+	if ticket.Priority < 0 || ticket.Priority >= priorityCount {
+		ticket.Priority = PriorityInteractive
+	}
+	if ticket.Weight <= 0 {
+		ticket.Weight = 1
+	}
+	queues := s.queues[ticket.Priority]
+	queue := queues[ticket.Key]
+	if (s.options.MaxQueue > 0 && s.queued >= s.options.MaxQueue) ||
+		(s.options.MaxQueuePerKey > 0 && queue != nil && len(queue.waiters) >= s.options.MaxQueuePerKey) {
+		s.stats.rejected++
+		s.mutex.Unlock()
+		return nil, 0, ErrQueueFull
+	}
+	if queue == nil {
+		queue = &keyQueue{}
+		queues[ticket.Key] = queue
+	}
+	w := &waiter{
+		ready:    make(chan struct{}),
+		finish:   max(s.virtual[ticket.Priority], queue.lastFinish) + 1/ticket.Weight,
+		enqueued: time.Now(),
+	}
+	queue.lastFinish = w.finish
+	queue.waiters = append(queue.waiters, w)
+	s.queued++
+	s.mutex.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaseFunc(), time.Since(w.enqueued), nil
+	case <-ctx.Done():
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if w.granted {
+		// 取消的同时已被派发, 归还名额
+		s.running--
+		s.dispatch()
+	} else {
+		s.remove(ticket, w)
+	}
+	s.stats.cancelled++
+	return nil, time.Since(w.enqueued), ctx.Err()
+}
+
+func (s *Scheduler) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			s.running--
+			s.dispatch()
+		})
+	}
+}
+
+func (s *Scheduler) remove(ticket Ticket, w *waiter) {
+	queues := s.queues[ticket.Priority]
+	queue := queues[ticket.Key]
+	if queue == nil {
+		return
+	}
+	for i, item := range queue.waiters {
+		if item == w {
+			queue.waiters = append(queue.waiters[:i], queue.waiters[i+1:]...)
+			s.queued--
+			break
+		}
+	}
+	if len(queue.waiters) == 0 {
+		delete(queues, ticket.Key)
+	}
+}
+
+// 在并发数允许时按优先级及虚拟完成时间派发排队的请求, 需持有锁
+func (s *Scheduler) dispatch() {
+	for s.running < s.options.MaxConcurrent && s.queued > 0 {
+		for priority := range s.queues {
+			queues := s.queues[priority]
+			var nextKey string
+			var next *keyQueue
+			for key, queue := range queues {
+				if next == nil || queue.waiters[0].finish < next.waiters[0].finish {
+					nextKey, next = key, queue
+				}
+			}
+			if next == nil {
+				continue
+			}
+			w := next.waiters[0]
+			next.waiters = next.waiters[1:]
+			if len(next.waiters) == 0 {
+				delete(queues, nextKey)
+			}
+			s.virtual[priority] = w.finish
+			w.granted = true
+			close(w.ready)
+			s.queued--
+			s.running++
+
+			wait := time.Since(w.enqueued)
+			s.stats.dispatched++
+			s.stats.queuedOnce++
+			s.stats.totalWait += wait
+			s.stats.maxWait = max(s.stats.maxWait, wait)
+			break
+		}
+	}
+}
+
+// Stats 调度器状态
+type Stats struct {
+	MaxConcurrent int                       `json:"max_concurrent"`
+	Running       int                       `json:"running"`
+	Queued        int                       `json:"queued"`
+	QueuedByKey   map[string]map[string]int `json:"queued_by_key"` // 优先级 -> key -> 排队数
+	OldestWaitMs  int64                     `json:"oldest_wait_ms"`
+	Dispatched    int64                     `json:"dispatched"`
+	Rejected      int64                     `json:"rejected"`
+	Cancelled     int64                     `json:"cancelled"`   // 排队超时或客户端断开
+	AvgWaitMs     int64                     `json:"avg_wait_ms"` // 经过排队的请求的平均等待时间
+	MaxWaitMs     int64                     `json:"max_wait_ms"`
+}
+
+func (s *Scheduler) Stats() Stats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := Stats{
+		MaxConcurrent: s.options.MaxConcurrent,
+		Running:       s.running,
+		Queued:        s.queued,
+		QueuedByKey:   make(map[string]map[string]int),
+		Dispatched:    s.stats.dispatched,
+		Rejected:      s.stats.rejected,
+		Cancelled:     s.stats.cancelled,
+		MaxWaitMs:     s.stats.maxWait.Milliseconds(),
+	}
+	if s.stats.queuedOnce > 0 {
+		stats.AvgWaitMs = (s.stats.totalWait / time.Duration(s.stats.queuedOnce)).Milliseconds()
+	}
+	now := time.Now()
+	for priority, queues := range s.queues {
+		if len(queues) == 0 {
+			continue
+		}
+		byKey := make(map[string]int, len(queues))
+		for key, queue := range queues {
+			byKey[key] = len(queue.waiters)
+			stats.OldestWaitMs = max(stats.OldestWaitMs, now.Sub(queue.waiters[0].enqueued).Milliseconds())
+		}
+		stats.QueuedByKey[Priority(priority).String()] = byKey
+	}
+	return stats
+}
@@ -0,0 +1,238 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type grant struct {
+	key     string
+	release func()
+	err     error
+}
+
+// enqueue 在新的 goroutine 中排队, 派发或失败后把结果发送到 grants
+func enqueue(ctx context.Context, s *Scheduler, ticket Ticket, grants chan<- grant) {
+	go func() {
+		release, _, err := s.Acquire(ctx, ticket)
+		grants <- grant{key: ticket.Key, release: release, err: err}
+	}()
+}
+
+// receive 等待下一个派发或失败的请求
+func receive(t *testing.T, grants <-chan grant) grant {
+	t.Helper()
+	select {
+	case g := <-grants:
+		return g
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request finished queueing")
+		return grant{}
+	}
+}
+
+// waitQueued 等待排队的请求数达到 n
+func waitQueued(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Stats().Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", s.Stats().Queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// acquireNow 获取名额, 名额未被占满时不会排队
+func acquireNow(t *testing.T, s *Scheduler, key string) func() {
+	t.Helper()
+	release, wait, err := s.Acquire(context.Background(), Ticket{Key: key})
+	if err != nil || wait != 0 {
+		t.Fatalf("Acquire = %v after %s, want an immediate grant", err, wait)
+	}
+	return release
+}
+
+// drain 依次释放名额, 返回各请求的派发顺序
+func drain(t *testing.T, release func(), grants <-chan grant, n int) []string {
+	t.Helper()
+	var order []string
+	for i := 0; i < n; i++ {
+		release()
+		g := receive(t, grants)
+		if g.err != nil {
+			t.Fatalf("%s: %v", g.key, g.err)
+		}
+		order = append(order, g.key)
+		release = g.release
+	}
+	release()
+	return order
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 同一优先级内按权重分配派发机会, 与排队的先后无关
+func TestWeightedFairOrder(t *testing.T) {
+	s := New(Options{MaxConcurrent: 1})
+	release := acquireNow(t, s, "holder")
+	grants := make(chan grant, 6)
+	for i := 0; i < 2; i++ {
+		enqueue(context.Background(), s, Ticket{Key: "light", Weight: 1}, grants)
+	}
+	waitQueued(t, s, 2)
+	for i := 0; i < 4; i++ {
+		enqueue(context.Background(), s, Ticket{Key: "heavy", Weight: 2.5}, grants)
+	}
+	waitQueued(t, s, 6)
+
+	// heavy 的虚拟完成时间为 0.4、0.8、1.2、1.6, light 为 1、2
+	want := []string{"heavy", "heavy", "light", "heavy", "heavy", "light"}
+	if got := drain(t, release, grants, 6); !equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	if stats := s.Stats(); stats.Running != 0 || stats.Queued != 0 || stats.Dispatched != 7 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+// 有 interactive 请求排队时不派发 batch 请求
+func TestPriorityPreemption(t *testing.T) {
+	s := New(Options{MaxConcurrent: 1})
+	release := acquireNow(t, s, "holder")
+	grants := make(chan grant, 3)
+	enqueue(context.Background(), s, Ticket{Key: "batch", Priority: PriorityBatch, Weight: 100}, grants)
+	waitQueued(t, s, 1)
+	enqueue(context.Background(), s, Ticket{Key: "interactive-1"}, grants)
+	enqueue(context.Background(), s, Ticket{Key: "interactive-2"}, grants)
+	waitQueued(t, s, 3)
+
+	if stats := s.Stats(); stats.QueuedByKey["batch"]["batch"] != 1 || len(stats.QueuedByKey["interactive"]) != 2 {
+		t.Fatalf("queued by key = %v", stats.QueuedByKey)
+	}
+	if got := drain(t, release, grants, 3); got[2] != "batch" {
+		t.Fatalf("order = %v, want batch last", got)
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	s := New(Options{MaxConcurrent: 1, MaxQueue: 3, MaxQueuePerKey: 2})
+	release := acquireNow(t, s, "holder")
+	ctx, cancel := context.WithCancel(context.Background())
+	grants := make(chan grant, 3)
+	enqueue(ctx, s, Ticket{Key: "a"}, grants)
+	enqueue(ctx, s, Ticket{Key: "a"}, grants)
+	waitQueued(t, s, 2)
+
+	if _, _, err := s.Acquire(ctx, Ticket{Key: "a"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("third request of a: %v, want ErrQueueFull", err)
+	}
+	// 不同优先级分别计算单个 key 的排队数
+	enqueue(ctx, s, Ticket{Key: "a", Priority: PriorityBatch}, grants)
+	waitQueued(t, s, 3)
+	if _, _, err := s.Acquire(ctx, Ticket{Key: "b"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("request of b: %v, want ErrQueueFull", err)
+	}
+	if stats := s.Stats(); stats.Rejected != 2 {
+		t.Fatalf("rejected = %d, want 2", stats.Rejected)
+	}
+
+	cancel()
+	for i := 0; i < 3; i++ {
+		if g := receive(t, grants); !errors.Is(g.err, context.Canceled) {
+			t.Fatalf("cancelled request: %v", g.err)
+		}
+	}
+	release()
+	if stats := s.Stats(); stats.Queued != 0 || stats.Running != 0 || stats.Cancelled != 3 || len(stats.QueuedByKey) != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	acquireNow(t, s, "b")()
+}
+
+// 排队超时后离开队列, 不占用名额
+func TestCancelWhileQueued(t *testing.T) {
+	s := New(Options{MaxConcurrent: 1})
+	release := acquireNow(t, s, "holder")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, wait, err := s.Acquire(ctx, Ticket{Key: "a"})
+	if !errors.Is(err, context.DeadlineExceeded) || wait < 20*time.Millisecond {
+		t.Fatalf("Acquire = %v after %s, want a timeout", err, wait)
+	}
+	if stats := s.Stats(); stats.Queued != 0 || stats.Running != 1 || stats.Cancelled != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	release()
+	acquireNow(t, s, "b")()
+}
+
+// 取消的同时被派发时归还名额, 由下一个排队的请求使用
+func TestCancelWhileGranted(t *testing.T) {
+	s := New(Options{MaxConcurrent: 1})
+	// holder 的名额在下面持有锁时直接归还
+	acquireNow(t, s, "holder")
+	ctx, cancel := context.WithCancel(context.Background())
+	grants := make(chan grant, 2)
+	enqueue(ctx, s, Ticket{Key: "cancelled"}, grants)
+	waitQueued(t, s, 1)
+	enqueue(context.Background(), s, Ticket{Key: "next"}, grants)
+	waitQueued(t, s, 2)
+
+	s.mutex.Lock()
+	cancel()
+	// 等待 Acquire 收到取消并阻塞在锁上, 再在持有锁时派发
+	time.Sleep(20 * time.Millisecond)
+	s.running--
+	s.dispatch()
+	s.mutex.Unlock()
+
+	results := make(map[string]grant)
+	for i := 0; i < 2; i++ {
+		g := receive(t, grants)
+		results[g.key] = g
+	}
+	if err := results["cancelled"].err; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled request: %v", err)
+	}
+	next := results["next"]
+	if next.err != nil {
+		t.Fatalf("next request: %v", next.err)
+	}
+	if stats := s.Stats(); stats.Running != 1 || stats.Queued != 0 || stats.Cancelled != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	next.release()
+	if stats := s.Stats(); stats.Running != 0 {
+		t.Fatalf("running = %d after release", stats.Running)
+	}
+}
+
+// 增加并发数后立即派发排队的请求
+func TestUpdateDispatchesQueued(t *testing.T) {
+	s := New(Options{MaxConcurrent: 1})
+	release := acquireNow(t, s, "holder")
+	defer release()
+	grants := make(chan grant, 1)
+	enqueue(context.Background(), s, Ticket{Key: "a"}, grants)
+	waitQueued(t, s, 1)
+
+	s.Update(Options{MaxConcurrent: 2})
+	g := receive(t, grants)
+	if g.err != nil {
+		t.Fatal(g.err)
+	}
+	g.release()
+}
@@ -0,0 +1,67 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAborted 关闭时进行中的请求超过等待时间后被取消的原因, 可通过 context.Cause 判断
+var ErrAborted = errors.New("server is shutting down")
+
+var (
+	draining atomic.Bool
+	inflight atomic.Int64
+
+	abortCtx, abort = context.WithCancelCause(context.Background())
+)
+
+// Begin 开始关闭, 之后 Draining 返回 true
+func Begin() {
+	draining.Store(true)
+}
+
+// Draining 是否正在关闭
+func Draining() bool {
+	return draining.Load()
+}
+
+// Track 派生在 Abort 时取消的请求上下文并计入进行中的请求, 请求结束时调用返回的函数
+func Track(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	stop := context.AfterFunc(abortCtx, func() { cancel(ErrAborted) })
+	inflight.Add(1)
+	return ctx, func() {
+		stop()
+		cancel(context.Canceled)
+		inflight.Add(-1)
+	}
+}
+
+// Inflight 进行中的请求数
+func Inflight() int64 {
+	return inflight.Load()
+}
+
+// Abort 取消所有进行中的请求
+func Abort() {
+	abort(ErrAborted)
+}
+
+// Aborted 请求是否因 Abort 被取消
+func Aborted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrAborted)
+}
+
+// Wait 等待进行中的请求结束, 超时返回 false
+func Wait(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for inflight.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
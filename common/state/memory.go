@@ -0,0 +1,193 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memoryCleanupInterval = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	bucket  Bucket
+}
+
+// 按经过的时间补充令牌
+func (b *tokenBucket) refill(now time.Time, bucket Bucket) {
+	b.bucket = bucket
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(float64(bucket.Capacity), b.tokens+elapsed.Seconds()*bucket.Rate)
+		b.updated = now
+	}
+}
+
+type usageCounter struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// Memory 单实例的内存后端
+type Memory struct {
+	mutex     sync.Mutex
+	cooldowns map[string]time.Time
+	invalid   map[string]string
+	usage     map[string]*usageCounter
+	buckets   map[string]*tokenBucket
+	file      string // 非空时 Close 时保存状态到该文件
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewMemory() *Memory {
+	m := &Memory{
+		cooldowns: make(map[string]time.Time),
+		invalid:   make(map[string]string),
+		usage:     make(map[string]*usageCounter),
+		buckets:   make(map[string]*tokenBucket),
+		done:      make(chan struct{}),
+	}
+	go m.cleanup()
+	return m
+}
+
+func (m *Memory) Name() string {
+	return BackendMemory
+}
+
+func (m *Memory) SetCooldown(_ context.Context, key string, until time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cooldowns[key] = until
+	return nil
+}
+
+func (m *Memory) Cooldowns(_ context.Context, keys []string) (map[string]time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	result := make(map[string]time.Time)
+	for _, key := range keys {
+		until, ok := m.cooldowns[key]
+		if !ok {
+			continue
+		}
+		if until.After(now) {
+			result[key] = until
+		} else {
+			delete(m.cooldowns, key)
+		}
+	}
+	return result, nil
+}
+
+func (m *Memory) MarkInvalid(_ context.Context, credential string, reason string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.invalid[credential] = reason
+	return nil
+}
+
+func (m *Memory) InvalidCredentials(_ context.Context) (map[string]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	result := make(map[string]string, len(m.invalid))
+	for credential, reason := range m.invalid {
+		result[credential] = reason
+	}
+	return result, nil
+}
+
+func (m *Memory) ClearInvalid(_ context.Context, credentials ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(credentials) == 0 {
+		m.invalid = make(map[string]string)
+	}
+	for _, credential := range credentials {
+		delete(m.invalid, credential)
+	}
+	return nil
+}
+
+func (m *Memory) IncrUsage(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	counter, ok := m.usage[key]
+	if !ok || !counter.expiresAt.After(now) {
+		counter = &usageCounter{expiresAt: now.Add(ttl)}
+		m.usage[key] = counter
+	}
+	counter.value += delta
+	return counter.value, nil
+}
+
+func (m *Memory) Usage(_ context.Context, key string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counter, ok := m.usage[key]
+	if !ok || !counter.expiresAt.After(time.Now()) {
+		return 0, nil
+	}
+	return counter.value, nil
+}
+
+func (m *Memory) Take(_ context.Context, key string, bucket Bucket, cost int64, force bool) (BucketResult, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(bucket.Capacity), updated: now}
+		m.buckets[key] = b
+	}
+	b.refill(now, bucket)
+	var result BucketResult
+	b.tokens, result = bucket.take(b.tokens, cost, force)
+	return result, nil
+}
+
+func (m *Memory) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		if m.file != "" {
+			err = m.save()
+		}
+	})
+	return err
+}
+
+// 定期清理过期的数据
+func (m *Memory) cleanup() {
+	ticker := time.NewTicker(memoryCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		m.mutex.Lock()
+		now := time.Now()
+		for key, until := range m.cooldowns {
+			if !until.After(now) {
+				delete(m.cooldowns, key)
+			}
+		}
+		for key, counter := range m.usage {
+			if !counter.expiresAt.After(now) {
+				delete(m.usage, key)
+			}
+		}
+		for key, b := range m.buckets {
+			// 已补满的令牌桶与新建的相同
+			if b.refill(now, b.bucket); b.tokens >= float64(b.bucket.Capacity) {
+				delete(m.buckets, key)
+			}
+		}
+		m.mutex.Unlock()
+	}
+}
@@ -0,0 +1,173 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 令牌桶, 与 Bucket.take 的逻辑一致; 令牌数以字符串返回以保留小数.
+// 使用 Redis 服务器的时间, 各实例的时钟偏差不影响共享的令牌桶;
+// Redis 5 之前需开启命令复制才能在 TIME 之后写入
+var takeScript = redis.NewScript(`
+redis.replicate_commands()
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2]) / 1000
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local cost = tonumber(ARGV[3])
+local force = ARGV[4] == '1'
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+	ts = now
+end
+local allowed = 0
+if force or tokens >= math.min(cost, capacity) then
+	allowed = 1
+	tokens = math.min(capacity, tokens - cost)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+if rate > 0 then
+	redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+end
+return {allowed, tostring(tokens)}
+`)
+
+// 累加计数, 仅在首次计数时设置过期时间
+var incrScript = redis.NewScript(`
+local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// Redis 多实例共享的 Redis 后端
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedis(rawUrl string, prefix string) (*Redis, error) {
+	options, err := redis.ParseURL(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(options)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &Redis{client: client, prefix: prefix}, nil
+}
+
+func (r *Redis) Name() string {
+	return BackendRedis
+}
+
+func (r *Redis) key(kind, key string) string {
+	return r.prefix + kind + ":" + key
+}
+
+func (r *Redis) SetCooldown(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return r.client.Del(ctx, r.key("cooldown", key)).Err()
+	}
+	return r.client.Set(ctx, r.key("cooldown", key), until.UnixMilli(), ttl).Err()
+}
+
+func (r *Redis) Cooldowns(ctx context.Context, keys []string) (map[string]time.Time, error) {
+	result := make(map[string]time.Time)
+	if len(keys) == 0 {
+		return result, nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = r.key("cooldown", key)
+	}
+	values, err := r.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		millis, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			continue
+		}
+		if until := time.UnixMilli(millis); until.After(now) {
+			result[keys[i]] = until
+		}
+	}
+	return result, nil
+}
+
+func (r *Redis) MarkInvalid(ctx context.Context, credential string, reason string) error {
+	return r.client.HSet(ctx, r.prefix+"invalid", credential, reason).Err()
+}
+
+func (r *Redis) InvalidCredentials(ctx context.Context) (map[string]string, error) {
+	return r.client.HGetAll(ctx, r.prefix+"invalid").Result()
+}
+
+func (r *Redis) ClearInvalid(ctx context.Context, credentials ...string) error {
+	if len(credentials) == 0 {
+		return r.client.Del(ctx, r.prefix+"invalid").Err()
+	}
+	return r.client.HDel(ctx, r.prefix+"invalid", credentials...).Err()
+}
+
+func (r *Redis) IncrUsage(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, r.client, []string{r.key("usage", key)}, delta, ttl.Milliseconds()).Int64()
+}
+
+func (r *Redis) Usage(ctx context.Context, key string) (int64, error) {
+	value, err := r.client.Get(ctx, r.key("usage", key)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return value, err
+}
+
+func (r *Redis) Take(ctx context.Context, key string, bucket Bucket, cost int64, force bool) (BucketResult, error) {
+	forceArg := 0
+	if force {
+		forceArg = 1
+	}
+	values, err := takeScript.Run(ctx, r.client, []string{r.key("bucket", key)},
+		bucket.Capacity, bucket.Rate, cost, forceArg).Slice()
+	if err != nil {
+		return BucketResult{}, err
+	}
+	if len(values) != 2 {
+		return BucketResult{}, fmt.Errorf("unexpected token bucket reply: %v", values)
+	}
+	allowed, _ := values[0].(int64)
+	text, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return BucketResult{}, fmt.Errorf("unexpected token bucket reply: %v", values)
+	}
+	return bucket.result(tokens, cost, allowed == 1), nil
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
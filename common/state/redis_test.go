@@ -0,0 +1,160 @@
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	r, err := NewRedis("redis://"+server.Addr(), "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r, server
+}
+
+// 两种后端的行为一致
+func testBackends(t *testing.T) map[string]Backend {
+	memory := NewMemory()
+	t.Cleanup(func() { _ = memory.Close() })
+	r, _ := newTestRedis(t)
+	return map[string]Backend{BackendMemory: memory, BackendRedis: r}
+}
+
+func TestBackendCooldowns(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			until := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+			if err := backend.SetCooldown(ctx, "a", until); err != nil {
+				t.Fatal(err)
+			}
+			if err := backend.SetCooldown(ctx, "b", time.Now().Add(-time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			cooldowns, err := backend.Cooldowns(ctx, []string{"a", "b", "c"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cooldowns) != 1 || !cooldowns["a"].Equal(until) {
+				t.Fatalf("cooldowns = %v, want only a until %v", cooldowns, until)
+			}
+		})
+	}
+}
+
+func TestBackendInvalidCredentials(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			for credential, reason := range map[string]string{"a": "not login", "b": "disabled"} {
+				if err := backend.MarkInvalid(ctx, credential, reason); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := backend.ClearInvalid(ctx, "a"); err != nil {
+				t.Fatal(err)
+			}
+			invalid, err := backend.InvalidCredentials(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(invalid) != 1 || invalid["b"] != "disabled" {
+				t.Fatalf("invalid = %v, want only b", invalid)
+			}
+			if err := backend.ClearInvalid(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if invalid, _ := backend.InvalidCredentials(ctx); len(invalid) != 0 {
+				t.Fatalf("invalid = %v after clearing all", invalid)
+			}
+		})
+	}
+}
+
+func TestBackendUsage(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			if value, err := backend.Usage(ctx, "u"); err != nil || value != 0 {
+				t.Fatalf("usage = %d, %v, want 0", value, err)
+			}
+			for _, delta := range []int64{3, 4} {
+				if _, err := backend.IncrUsage(ctx, "u", delta, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if value, err := backend.Usage(ctx, "u"); err != nil || value != 7 {
+				t.Fatalf("usage = %d, %v, want 7", value, err)
+			}
+		})
+	}
+}
+
+// 计数只在首次累加时设置过期时间
+func TestRedisUsageExpiry(t *testing.T) {
+	ctx := context.Background()
+	r, server := newTestRedis(t)
+	if _, err := r.IncrUsage(ctx, "u", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	server.FastForward(30 * time.Second)
+	if _, err := r.IncrUsage(ctx, "u", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL("test:usage:u"); ttl != 30*time.Second {
+		t.Fatalf("ttl = %v, want 30s", ttl)
+	}
+	server.FastForward(30 * time.Second)
+	if value, _ := r.Usage(ctx, "u"); value != 0 {
+		t.Fatalf("usage = %d after expiry, want 0", value)
+	}
+}
+
+// 令牌按 Redis 服务器的时间补充, 与调用方的时钟无关
+func TestRedisTakeUsesServerTime(t *testing.T) {
+	ctx := context.Background()
+	r, server := newTestRedis(t)
+	now := time.Date(2025, 5, 14, 0, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+	bucket := Bucket{Capacity: 2, Rate: 1}
+
+	take := func(cost int64, force bool) BucketResult {
+		t.Helper()
+		result, err := r.Take(ctx, "k", bucket, cost, force)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	if result := take(2, false); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("first take = %+v", result)
+	}
+	if result := take(1, false); result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("take from an empty bucket = %+v, want rejected with retry after 1s", result)
+	}
+
+	// 服务器时间前进 500ms, 调用方的时钟不影响补充的令牌数
+	server.SetTime(now.Add(500 * time.Millisecond))
+	if result := take(1, false); result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("take after 500ms = %+v, want rejected with retry after 500ms", result)
+	}
+	server.SetTime(now.Add(time.Second))
+	if result := take(1, false); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("take after 1s = %+v", result)
+	}
+
+	// 结算时可扣为负数, 归还后恢复
+	if result := take(3, true); !result.Allowed || result.Remaining != -3 {
+		t.Fatalf("forced take = %+v, want remaining -3", result)
+	}
+	if result := take(-3, true); result.Remaining != 0 {
+		t.Fatalf("refund = %+v, want remaining 0", result)
+	}
+}
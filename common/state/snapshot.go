@@ -0,0 +1,113 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// memorySnapshot 内存后端的持久化格式
+type memorySnapshot struct {
+	SavedAt   time.Time                 `json:"saved_at"`
+	Cooldowns map[string]time.Time      `json:"cooldowns"`
+	Invalid   map[string]string         `json:"invalid"`
+	Usage     map[string]snapshotUsage  `json:"usage"`
+	Buckets   map[string]snapshotBucket `json:"buckets"`
+}
+
+type snapshotUsage struct {
+	Value     int64     `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type snapshotBucket struct {
+	Tokens   float64   `json:"tokens"`
+	Updated  time.Time `json:"updated"`
+	Capacity int64     `json:"capacity"`
+	Rate     float64   `json:"rate"`
+}
+
+// NewMemoryFromFile 创建内存后端并恢复 path 中保存的状态(文件不存在时为空), Close 时保存到 path
+func NewMemoryFromFile(path string) (*Memory, error) {
+	m := NewMemory()
+	m.file = path
+	if err := m.load(); err != nil {
+		m.closeOnce.Do(func() { close(m.done) })
+		return nil, err
+	}
+	return m, nil
+}
+
+// 恢复时丢弃已过期的数据
+func (m *Memory) load() error {
+	data, err := os.ReadFile(m.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snapshot memorySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	for key, until := range snapshot.Cooldowns {
+		if until.After(now) {
+			m.cooldowns[key] = until
+		}
+	}
+	for credential, reason := range snapshot.Invalid {
+		m.invalid[credential] = reason
+	}
+	for key, usage := range snapshot.Usage {
+		if usage.ExpiresAt.After(now) {
+			m.usage[key] = &usageCounter{value: usage.Value, expiresAt: usage.ExpiresAt}
+		}
+	}
+	for key, b := range snapshot.Buckets {
+		m.buckets[key] = &tokenBucket{
+			tokens:  b.Tokens,
+			updated: b.Updated,
+			bucket:  Bucket{Capacity: b.Capacity, Rate: b.Rate},
+		}
+	}
+	return nil
+}
+
+// 先写入临时文件再替换, 避免中途退出时留下不完整的文件
+func (m *Memory) save() error {
+	m.mutex.Lock()
+	snapshot := memorySnapshot{
+		SavedAt:   time.Now(),
+		Cooldowns: m.cooldowns,
+		Invalid:   m.invalid,
+		Usage:     make(map[string]snapshotUsage, len(m.usage)),
+		Buckets:   make(map[string]snapshotBucket, len(m.buckets)),
+	}
+	for key, counter := range m.usage {
+		snapshot.Usage[key] = snapshotUsage{Value: counter.value, ExpiresAt: counter.expiresAt}
+	}
+	for key, b := range m.buckets {
+		snapshot.Buckets[key] = snapshotBucket{Tokens: b.tokens, Updated: b.updated, Capacity: b.bucket.Capacity, Rate: b.bucket.Rate}
+	}
+	data, err := json.Marshal(snapshot)
+	m.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.file), 0o755); err != nil {
+		return err
+	}
+	tmp := m.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.file)
+}
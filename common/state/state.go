@@ -0,0 +1,115 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Backend 运行状态存储, 多实例部署时使用 Redis 共享凭证冷却、失效标记、用量计数及限流窗口
+type Backend interface {
+	// Name 后端名称
+	Name() string
+
+	// SetCooldown 在 until 之前停用 key(凭证+模型)
+	SetCooldown(ctx context.Context, key string, until time.Time) error
+	// Cooldowns 返回 keys 中仍在冷却的 key 及其到期时间
+	Cooldowns(ctx context.Context, keys []string) (map[string]time.Time, error)
+
+	// MarkInvalid 标记失效的凭证(未登录、被禁止访问), 清除前不再使用
+	MarkInvalid(ctx context.Context, credential string, reason string) error
+	// InvalidCredentials 返回所有失效的凭证及原因
+	InvalidCredentials(ctx context.Context) (map[string]string, error)
+	// ClearInvalid 清除指定凭证的失效标记, 未指定时清除所有
+	ClearInvalid(ctx context.Context, credentials ...string) error
+
+	// IncrUsage 累加计数, 计数在 ttl 后过期, 返回累加后的值
+	IncrUsage(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Usage 返回计数, 不存在时为 0
+	Usage(ctx context.Context, key string) (int64, error)
+
+	// Take 从令牌桶中取出 cost 个令牌, 令牌不足时不扣减并返回未放行;
+	// force 时总是扣减(可扣为负数, cost 为负时归还), 用于按实际用量结算
+	Take(ctx context.Context, key string, bucket Bucket, cost int64, force bool) (BucketResult, error)
+
+	Close() error
+}
+
+// Bucket 令牌桶参数
+type Bucket struct {
+	Capacity int64   // 桶容量, 即允许的突发量
+	Rate     float64 // 每秒补充的令牌数
+}
+
+// BucketResult 取令牌的结果
+type BucketResult struct {
+	Allowed    bool
+	Remaining  int64         // 剩余令牌数, 结算超出预留时可为负数
+	RetryAfter time.Duration // 未放行时, 令牌足够所需的等待时间
+	Reset      time.Duration // 令牌补满所需的时间
+}
+
+// 按补充后的令牌数取令牌, 返回取后的令牌数; cost 超过容量时桶满即可放行
+func (b Bucket) take(tokens float64, cost int64, force bool) (float64, BucketResult) {
+	allowed := force || tokens >= float64(min(cost, b.Capacity))
+	if allowed {
+		tokens = min(float64(b.Capacity), tokens-float64(cost))
+	}
+	return tokens, b.result(tokens, cost, allowed)
+}
+
+// 按取后的令牌数计算结果
+func (b Bucket) result(tokens float64, cost int64, allowed bool) BucketResult {
+	result := BucketResult{
+		Allowed:   allowed,
+		Remaining: int64(math.Floor(tokens)),
+		Reset:     b.duration(float64(b.Capacity) - tokens),
+	}
+	if !allowed {
+		result.RetryAfter = b.duration(float64(min(cost, b.Capacity)) - tokens)
+	}
+	return result
+}
+
+// 补充 tokens 个令牌所需的时间
+func (b Bucket) duration(tokens float64) time.Duration {
+	if tokens <= 0 || b.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(tokens / b.Rate * float64(time.Second)))
+}
+
+// 可选的后端
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Options 状态后端配置
+type Options struct {
+	Backend   string
+	RedisUrl  string // 如 redis://:password@localhost:6379/0
+	KeyPrefix string
+	File      string // memory 后端的持久化文件, 为空时不保存
+}
+
+// New 按配置创建状态后端
+func New(options Options) (Backend, error) {
+	switch strings.ToLower(options.Backend) {
+	case "", BackendMemory:
+		if options.File != "" {
+			m, err := NewMemoryFromFile(options.File)
+			if err != nil {
+				return nil, fmt.Errorf("load state file %s: %v", options.File, err)
+			}
+			return m, nil
+		}
+		return NewMemory(), nil
+	case BackendRedis:
+		return NewRedis(options.RedisUrl, options.KeyPrefix)
+	default:
+		return nil, fmt.Errorf("unknown state backend %q (available: %s,%s)", options.Backend, BackendMemory, BackendRedis)
+	}
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "rovo2api"
+
+// Options 链路追踪配置
+type Options struct {
+	Enabled     bool
+	Endpoint    string // OTLP/HTTP 地址, 如 http://localhost:4318, 为空时使用 OTEL_EXPORTER_OTLP_* 环境变量
+	ServiceName string
+	Version     string
+	SampleRatio float64
+}
+
+var (
+	providerMutex sync.Mutex
+	provider      *sdktrace.TracerProvider
+)
+
+// Setup 初始化链路追踪, 未开启时仍会解析并透传请求中的 traceparent
+func Setup(ctx context.Context, options Options) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !options.Enabled {
+		return nil
+	}
+
+	var exporterOptions []otlptracehttp.Option
+	if options.Endpoint != "" {
+		endpoint, err := url.Parse(options.Endpoint)
+		if err != nil {
+			return err
+		}
+		if strings.Trim(endpoint.Path, "/") == "" {
+			endpoint.Path = "/v1/traces"
+		}
+		exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(endpoint.String()))
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOptions...)
+	if err != nil {
+		return err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName(options.ServiceName),
+			semconv.ServiceVersion(options.Version),
+		),
+		// OTEL_SERVICE_NAME、OTEL_RESOURCE_ATTRIBUTES 优先
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	providerMutex.Lock()
+	provider = tp
+	providerMutex.Unlock()
+	return nil
+}
+
+// Shutdown 导出剩余的 span 并关闭
+func Shutdown(ctx context.Context) error {
+	providerMutex.Lock()
+	tp := provider
+	provider = nil
+	providerMutex.Unlock()
+	if tp == nil {
+		return nil
+	}
+	return tp.Shutdown(ctx)
+}
+
+// Start 创建子 span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Fail 将 span 标记为失败
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceID 返回当前请求的 trace id, 无有效链路时为空
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"fmt"
+	"rovo2api/common/audit"
+	"rovo2api/common/config"
+	"rovo2api/common/helper"
+	logger "rovo2api/common/loggger"
+	"rovo2api/common/monitor"
+	"rovo2api/model"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditRecordKey   = "rovo2api_audit_record"
+	auditMaxErrorLen = 2048
+)
+
+var (
+	auditLogger     *audit.Logger
+	auditLoggerOnce sync.Once
+	auditRulesMutex sync.Mutex
+	auditRulesKey   string
+)
+
+// 首次使用时按当前配置创建审计日志, 目录及轮转配置的修改需重启后生效
+func getAuditLogger() *audit.Logger {
+	auditLoggerOnce.Do(func() {
+		settings := config.GetSettings()
+		rules, err := audit.ResolveRules(settings.AuditRedactRules, settings.AuditCustomRules)
+		if err != nil {
+			logger.SysError("audit log disabled: " + err.Error())
+			return
+		}
+		l, err := audit.NewLogger(audit.Options{
+			Dir:      config.AuditLogDir,
+			MaxBytes: int64(config.AuditLogMaxSize) << 20,
+			MaxAge:   time.Duration(config.AuditLogMaxAge) * 24 * time.Hour,
+			MaxFiles: config.AuditLogMaxFiles,
+			Rules:    rules,
+		})
+		if err != nil {
+			logger.SysError(fmt.Sprintf("audit log disabled, failed to open %s: %s", config.AuditLogDir, err.Error()))
+			return
+		}
+		auditRulesKey = fmt.Sprint(settings.AuditRedactRules, settings.AuditCustomRules)
+		auditLogger = l
+	})
+	return auditLogger
+}
+
+// CloseAuditLog 退出前关闭审计日志, 需在所有请求结束后调用
+func CloseAuditLog() error {
+	auditLoggerOnce.Do(func() {})
+	if auditLogger == nil {
+		return nil
+	}
+	return auditLogger.Close()
+}
+
+// 配置热加载后更新脱敏规则
+func refreshAuditRules(l *audit.Logger) {
+	auditRulesMutex.Lock()
+	defer auditRulesMutex.Unlock()
+	settings := config.GetSettings()
+	key := fmt.Sprint(settings.AuditRedactRules, settings.AuditCustomRules)
+	if key == auditRulesKey {
+		return
+	}
+	rules, err := audit.ResolveRules(settings.AuditRedactRules, settings.AuditCustomRules)
+	if err == nil {
+		err = l.SetRules(rules)
+	}
+	if err != nil {
+		logger.SysError("keeping previous audit redact rules: " + err.Error())
+	}
+	auditRulesKey = key
+}
+
+// auditWriter 记录错误响应的内容
+type auditWriter struct {
+	gin.ResponseWriter
+	body strings.Builder
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if w.Status() >= 400 && w.body.Len() < auditMaxErrorLen {
+		w.body.Write(data[:min(len(data), auditMaxErrorLen-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// startAudit 开启审计时为当前请求创建审计记录, 返回的函数在请求结束时写入记录
+func startAudit(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) func() {
+	if !config.GetSettings().AuditLogEnabled || getAuditLogger() == nil {
+		return func() {}
+	}
+	start := time.Now()
+	record := &audit.Record{
+		Time:      start,
+		RequestID: c.GetString(helper.RequestIdKey),
+		APIKey:    audit.KeyID(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")),
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Model:     openAIReq.Model,
+		Request: audit.Request{
+			Stream:      openAIReq.Stream,
+			Temperature: openAIReq.Temperature,
+			TopP:        openAIReq.TopP,
+			MaxTokens:   openAIReq.MaxTokens,
+			Messages:    auditMessages(openAIReq.Messages),
+		},
+	}
+	c.Set(auditRecordKey, record)
+	writer := &auditWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	return func() {
+		record.LatencyMs = time.Since(start).Milliseconds()
+		record.Status = writer.Status()
+		record.Cache = writer.Header().Get(cacheHeader)
+		record.UsedModel = writer.Header().Get("X-Rovo2api-Fallback")
+		if record.Error == "" && record.Status >= 400 {
+			record.Error = writer.body.String()
+		}
+		l := getAuditLogger()
+		refreshAuditRules(l)
+		if err := l.Write(*record); err != nil {
+			logger.Errorf(c.Request.Context(), "write audit log err: %v", err)
+		}
+	}
+}
+
+func auditRecord(c *gin.Context) *audit.Record {
+	if value, ok := c.Get(auditRecordKey); ok {
+		return value.(*audit.Record)
+	}
+	return nil
+}
+
+// 记录本次请求使用的凭证标识, 同时写入日志字段及请求监控
+func auditCredential(c *gin.Context, cookie string) {
+	logger.SetField(c.Request.Context(), logger.FieldCredential, config.CredentialName(cookie))
+	if record := auditRecord(c); record != nil {
+		record.Credential = config.CredentialName(cookie)
+	}
+	monitorUpdate(c, func(r *monitor.Request) {
+		r.Credential = config.CredentialName(cookie)
+	})
+}
+
+// 记录最终的回答及用量
+func auditResult(c *gin.Context, content string, promptTokens, completionTokens int) {
+	if record := auditRecord(c); record != nil {
+		record.Response = content
+		record.Usage = audit.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
+	}
+	monitorUpdate(c, func(r *monitor.Request) {
+		r.PromptTokens = promptTokens
+		r.CompletionTokens = completionTokens
+	})
+}
+
+// 记录错误信息, 流式响应开始后状态码不再变化, 需显式记录
+func auditError(c *gin.Context, err string) {
+	if record := auditRecord(c); record != nil {
+		record.Error = err
+	}
+	monitorUpdate(c, func(r *monitor.Request) {
+		r.Error = true
+	})
+}
+
+func auditMessages(messages []model.OpenAIChatMessage) []audit.Message {
+	result := make([]audit.Message, 0, len(messages))
+	for _, msg := range messages {
+		var content string
+		switch value := msg.Content.(type) {
+		case string:
+			content = value
+		case []interface{}:
+			var parts []string
+			for _, item := range value {
+				itemMap, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				switch itemMap["type"] {
+				case "text":
+					text, _ := itemMap["text"].(string)
+					parts = append(parts, text)
+				case "image_url":
+					parts = append(parts, "[image]")
+				}
+			}
+			content = strings.Join(parts, "\n")
+		default:
+			content = fmt.Sprintf("%v", msg.Content)
+		}
+		result = append(result, audit.Message{Role: msg.Role, Content: content})
+	}
+	return result
+}
@@ -0,0 +1,330 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"rovo2api/common/batch"
+	"rovo2api/common/config"
+	"rovo2api/common/helper"
+	logger "rovo2api/common/loggger"
+	"rovo2api/common/scheduler"
+	"rovo2api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量任务支持的接口
+var batchEndpoints = []string{"/v1/chat/completions"}
+
+var (
+	batchManager *batch.Manager
+	// 在进程内执行批量任务中的请求, 与 /v1/chat/completions 使用相同的处理流程
+	batchEngine *gin.Engine
+)
+
+type batchOwnerKey struct{}
+
+// InitBatches 读取保存的批量任务并开始在后台处理, BATCH_ENABLED 为 false 时不启用
+func InitBatches() error {
+	if !config.BatchEnabled {
+		return nil
+	}
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	engine.Use(func(c *gin.Context) {
+		id := helper.GenRequestID()
+		owner, _ := c.Request.Context().Value(batchOwnerKey{}).(string)
+		c.Set(helper.RequestIdKey, id)
+		c.Set(helper.RateLimitKey, owner)
+		ctx := context.WithValue(c.Request.Context(), helper.RequestIdKey, id)
+		c.Request = c.Request.WithContext(logger.WithFields(ctx))
+		if owner != "" {
+			logger.SetField(c.Request.Context(), logger.FieldAPIKey, owner)
+		}
+		c.Header(helper.RequestIdKey, id)
+		c.Next()
+	})
+	engine.POST("/v1/chat/completions", ChatForOpenAI)
+	batchEngine = engine
+
+	manager, err := batch.Open(batch.Options{
+		Dir:          config.BatchDir,
+		Concurrency:  config.BatchConcurrency,
+		MaxFileBytes: int64(config.BatchMaxFileSize),
+		MaxRequests:  config.BatchMaxRequests,
+		Endpoints:    batchEndpoints,
+		Execute:      executeBatchRequest,
+		Idle:         batchIdle,
+		OnError: func(err error) {
+			logger.SysError("batch error: " + err.Error())
+		},
+	})
+	if err != nil {
+		return err
+	}
+	batchManager = manager
+	return nil
+}
+
+// CloseBatches 停止处理批量任务, 进行中的请求在重启后重新执行
+func CloseBatches(ctx context.Context) error {
+	if batchManager == nil {
+		return nil
+	}
+	return batchManager.Close(ctx)
+}
+
+// executeBatchRequest 以 batch 优先级执行一个请求, 不使用流式响应
+func executeBatchRequest(ctx context.Context, owner string, req batch.Request) (batch.Response, error) {
+	var body map[string]any
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		return batch.Response{}, err
+	}
+	body["stream"] = false
+	data, err := json.Marshal(body)
+	if err != nil {
+		return batch.Response{}, err
+	}
+	ctx = context.WithValue(ctx, batchOwnerKey{}, owner)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(data))
+	if err != nil {
+		return batch.Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(priorityHeader, scheduler.PriorityBatch.String())
+
+	recorder := httptest.NewRecorder()
+	batchEngine.ServeHTTP(recorder, httpReq)
+	if err := ctx.Err(); err != nil {
+		return batch.Response{}, err
+	}
+	resp := batch.Response{
+		StatusCode: recorder.Code,
+		RequestID:  recorder.Header().Get(helper.RequestIdKey),
+		Body:       recorder.Body.Bytes(),
+	}
+	if !json.Valid(resp.Body) {
+		resp.Body, _ = json.Marshal(recorder.Body.String())
+	}
+	return resp, nil
+}
+
+// batchIdle 调度器没有排队的请求且有空闲的凭证时派发批量任务的请求, 优先处理交互请求
+func batchIdle() bool {
+	if maxConcurrency := config.GetSettings().SchedulerMaxConcurrency; maxConcurrency > 0 {
+		stats := requestScheduler.Stats()
+		if stats.Queued > 0 || stats.Running >= maxConcurrency {
+			return false
+		}
+	}
+	return config.CredentialIdle()
+}
+
+// 批量任务使用服务端的凭证, CUSTOM_HEADER_KEY_ENABLED 时不可用
+func batchAvailable(c *gin.Context) bool {
+	if batchManager != nil && !config.CustomHeaderKeyEnabled {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: "Batch API is not available when CUSTOM_HEADER_KEY_ENABLED is set",
+			Type:    "invalid_request_error",
+			Code:    "batch_unavailable",
+		},
+	})
+	return false
+}
+
+func batchError(c *gin.Context, err error) {
+	var invalid *batch.InvalidError
+	switch {
+	case errors.Is(err, batch.ErrNotFound):
+		c.JSON(http.StatusNotFound, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: "No such object",
+				Type:    "invalid_request_error",
+				Code:    "not_found",
+			},
+		})
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: invalid.Message,
+				Type:    "invalid_request_error",
+				Param:   invalid.Param,
+				Code:    "invalid_request",
+			},
+		})
+	default:
+		logger.Errorf(c.Request.Context(), "batch: %v", err)
+		c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: "Internal error",
+				Type:    "server_error",
+				Code:    "500",
+			},
+		})
+	}
+}
+
+// UploadFile @Summary OpenAI文件上传接口
+// @Description 上传批量任务的 JSONL 输入文件, purpose 需为 batch
+// @Tags OpenAI
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "JSONL 文件"
+// @Param purpose formData string true "文件用途, batch"
+// @Param Authorization header string true "Authorization API-KEY"
+// @Router /v1/files [post]
+func UploadFile(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	// 预留 multipart 其他字段的空间, 文件本身的大小由 BATCH_MAX_FILE_SIZE 限制
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(config.BatchMaxFileSize)+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		batchError(c, &batch.InvalidError{Param: "file", Message: err.Error()})
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	defer f.Close()
+	file, err := batchManager.CreateFile(requestKeyID(c), header.Filename, c.PostForm("purpose"), f)
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// ListFiles 列出文件, 可按 purpose 过滤
+func ListFiles(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	files := batchManager.ListFiles(requestKeyID(c), c.Query("purpose"))
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": files, "has_more": false})
+}
+
+func GetFile(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	file, err := batchManager.GetFile(requestKeyID(c), c.Param("file_id"))
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// GetFileContent 下载文件内容, 如批量任务的输出文件及错误文件
+func GetFileContent(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	f, file, err := batchManager.OpenFile(requestKeyID(c), c.Param("file_id"))
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	defer f.Close()
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", f, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", file.Filename),
+	})
+}
+
+func DeleteFile(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	id := c.Param("file_id")
+	if err := batchManager.DeleteFile(requestKeyID(c), id); err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "object": "file", "deleted": true})
+}
+
+// CreateBatch @Summary OpenAI批量任务接口
+// @Description 使用上传的 JSONL 文件创建批量任务, 在凭证空闲时于后台处理
+// @Tags OpenAI
+// @Accept json
+// @Produce json
+// @Param req body model.OpenAICreateBatchRequest true "批量任务请求"
+// @Param Authorization header string true "Authorization API-KEY"
+// @Router /v1/batches [post]
+func CreateBatch(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	var req model.OpenAICreateBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		batchError(c, &batch.InvalidError{Param: "body", Message: err.Error()})
+		return
+	}
+	created, err := batchManager.CreateBatch(requestKeyID(c), req.InputFileID, req.Endpoint, req.CompletionWindow, req.Metadata)
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, created)
+}
+
+func GetBatch(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	found, err := batchManager.GetBatch(requestKeyID(c), c.Param("batch_id"))
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, found)
+}
+
+// ListBatches 按创建时间倒序分页列出批量任务, 参数 after 及 limit
+func ListBatches(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	limit := batch.DefaultListLimit
+	if raw := c.Query("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 || value > batch.MaxListLimit {
+			batchError(c, &batch.InvalidError{Param: "limit", Message: fmt.Sprintf("must be between 1 and %d", batch.MaxListLimit)})
+			return
+		}
+		limit = value
+	}
+	batches, hasMore := batchManager.ListBatches(requestKeyID(c), c.Query("after"), limit)
+	response := gin.H{"object": "list", "data": batches, "first_id": nil, "last_id": nil, "has_more": hasMore}
+	if len(batches) > 0 {
+		response["first_id"] = batches[0].ID
+		response["last_id"] = batches[len(batches)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelBatch 取消批量任务, 已完成的请求的结果仍写入输出文件
+func CancelBatch(c *gin.Context) {
+	if !batchAvailable(c) {
+		return
+	}
+	cancelled, err := batchManager.CancelBatch(requestKeyID(c), c.Param("batch_id"))
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cancelled)
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,18 +10,22 @@ import (
 	"rovo2api/common"
 	"rovo2api/common/config"
 	logger "rovo2api/common/loggger"
+	"rovo2api/common/tracing"
 	"rovo2api/cycletls"
+	"rovo2api/hook"
 	"rovo2api/model"
-	rovoapi "rovo2api/rovo-api"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
 	errServerErrMsg  = "Service Unavailable"
 	responseIDFormat = "chatcmpl-%s"
+	// 上游流结束但未发送结束事件时的结束原因, 告知客户端回答可能不完整
+	incompleteFinishReason = "length"
 )
 
 // ChatForOpenAI @Summary OpenAI对话接口
@@ -49,6 +54,9 @@ func ChatForOpenAI(c *gin.Context) {
 	}
 
 	openAIReq.RemoveEmptyContentMessages()
+	logger.SetField(c.Request.Context(), logger.FieldModel, openAIReq.Model)
+	defer startAudit(c, openAIReq)()
+	defer startMonitor(c, openAIReq)()
 
 	modelInfo, b := common.GetModelInfo(openAIReq.Model)
 	if !b {
@@ -61,10 +69,10 @@ func ChatForOpenAI(c *gin.Context) {
 		})
 		return
 	}
-	if openAIReq.MaxTokens > modelInfo.MaxTokens {
+	if openAIReq.MaxTokens > modelInfo.MaxOutputTokens {
 		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
 			OpenAIError: model.OpenAIError{
-				Message: fmt.Sprintf("Max tokens %d exceeds limit %d", openAIReq.MaxTokens, modelInfo.MaxTokens),
+				Message: fmt.Sprintf("Max tokens %d exceeds limit %d", openAIReq.MaxTokens, modelInfo.MaxOutputTokens),
 				Type:    "invalid_request_error",
 				Code:    "invalid_max_tokens",
 			},
@@ -72,23 +80,51 @@ func ChatForOpenAI(c *gin.Context) {
 		return
 	}
 
+	if !moderateInput(c, &openAIReq) {
+		return
+	}
+
+	if !runRequestHooks(c, &openAIReq, modelInfo) {
+		return
+	}
+
+	cacheState := newResponseCacheState(c, openAIReq, modelInfo)
+	if cacheState.serve(c, openAIReq) {
+		return
+	}
+
+	if !manageContext(c, client, &openAIReq, modelInfo) {
+		return
+	}
+
+	reservation, ok := reserveTokens(c, openAIReq)
+	if !ok {
+		return
+	}
+	defer reservation.settle()
+
+	release, ok := scheduleRequest(c)
+	if !ok {
+		return
+	}
+	defer release()
+
 	if openAIReq.Stream {
-		handleStreamRequest(c, client, openAIReq, modelInfo)
+		handleStreamRequest(c, client, openAIReq, modelInfo, cacheState)
 	} else {
-		handleNonStreamRequest(c, client, openAIReq, modelInfo)
+		handleNonStreamRequest(c, client, openAIReq, modelInfo, cacheState)
 	}
 }
 
-func handleNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) {
-	ctx := c.Request.Context()
-	cookieManager := config.NewCookieManager()
+// 获取当前请求可用的凭证
+func newCookieManager(c *gin.Context, modelId string) (*config.CookieManager, error) {
+	cookieManager := config.NewCookieManager(modelId)
 
 	if config.CustomHeaderKeyEnabled {
 		// 从请求头中获取自定义键
 		cookie := c.Request.Header.Get("Authorization")
 		if cookie == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization header is required"})
-			return
+			return nil, fmt.Errorf("Authorization header is required")
 		}
 		cookie = strings.Replace(cookie, "Bearer ", "", 1)
 		customKeysList := strings.Split(cookie, ",")
@@ -99,135 +135,110 @@ func handleNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq
 			cookieManager.Cookies = []string{selectedKey}
 		}
 	}
+	return cookieManager, nil
+}
 
-	maxRetries := len(cookieManager.Cookies)
-	cookie, err := cookieManager.GetRandomCookie()
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+// 切换到备用模型, 并通过响应头告知客户端实际使用的模型; 流式请求仅在发送内容前切换, 响应头此时尚未发送
+func useFallbackModel(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest, from string, fallback config.FallbackModel) {
+	logger.Warnf(c.Request.Context(), "Model %s unavailable, falling back to %s", from, fallback.Name)
+	c.Header("X-Rovo2api-Fallback", fallback.Name)
+	openAIReq.Model = fallback.Name
+	logger.SetField(c.Request.Context(), logger.FieldModel, fallback.Name)
+	if openAIReq.MaxTokens > fallback.Info.MaxOutputTokens {
+		openAIReq.MaxTokens = fallback.Info.MaxOutputTokens
 	}
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		requestBody, err := createRequestBody(c, &openAIReq, modelInfo)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
+}
 
-		jsonData, err := json.Marshal(requestBody)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to marshal request body"})
-			return
-		}
-		sseChan, err := rovoapi.MakeStreamChatRequest(c, client, jsonData, cookie, modelInfo)
-		if err != nil {
-			logger.Errorf(ctx, "MakeStreamChatRequest err on attempt %d: %v", attempt+1, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+// nonStreamOutput 汇总非流式请求的回答
+type nonStreamOutput struct {
+	c                            *gin.Context
+	attempt                      *upstreamAttempt
+	content                      strings.Builder
+	thinkStartType, thinkEndType *bool
+}
 
-		isRateLimit := false
-		var delta string
-		var assistantMsgContent string
-		var shouldContinue bool
-		thinkStartType := new(bool)
-		thinkEndType := new(bool)
-	SSELoop:
-		for response := range sseChan {
-			data := response.Data
-			if data == "" {
-				continue
-			}
-			if response.Done {
-				switch {
-				case common.IsUsageLimitExceeded(data):
-					isRateLimit = true
-					logger.Warnf(ctx, "Cookie Usage limit exceeded, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-					config.RemoveCookie(cookie)
-					break SSELoop
-				case common.IsServerError(data):
-					logger.Errorf(ctx, errServerErrMsg)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": errServerErrMsg})
-					return
-				case common.IsNotLogin(data):
-					isRateLimit = true
-					logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-					break SSELoop
-				case common.IsRateLimit(data):
-					isRateLimit = true
-					logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-					config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
-					break SSELoop
-				}
-				logger.Warnf(ctx, response.Data)
-				return
-			}
+func (o *nonStreamOutput) start(attempt *upstreamAttempt) {
+	o.attempt = attempt
+	o.content.Reset()
+}
 
-			logger.Debug(ctx, strings.TrimSpace(data))
-
-			streamDelta, streamShouldContinue := processNoStreamData(c, data, modelInfo, thinkStartType, thinkEndType)
-			delta = streamDelta
-			shouldContinue = streamShouldContinue
-			// 处理事件流数据
-			if !shouldContinue {
-				promptTokens := model.CountTokenText(string(jsonData), openAIReq.Model)
-				completionTokens := model.CountTokenText(assistantMsgContent, openAIReq.Model)
-				finishReason := "stop"
-
-				c.JSON(http.StatusOK, model.OpenAIChatCompletionResponse{
-					ID:      fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405")),
-					Object:  "chat.completion",
-					Created: time.Now().Unix(),
-					Model:   openAIReq.Model,
-					Choices: []model.OpenAIChoice{{
-						Message: model.OpenAIMessage{
-							Role:    "assistant",
-							Content: assistantMsgContent,
-						},
-						FinishReason: &finishReason,
-					}},
-					Usage: model.OpenAIUsage{
-						PromptTokens:     promptTokens,
-						CompletionTokens: completionTokens,
-						TotalTokens:      promptTokens + completionTokens,
-					},
-				})
-
-				return
-			} else {
-				assistantMsgContent = assistantMsgContent + delta
-			}
-		}
-		if !isRateLimit {
-			return
-		}
+func (o *nonStreamOutput) consume(data string) bool {
+	delta, shouldContinue := processNoStreamData(o.c, data, o.attempt.modelInfo, o.thinkStartType, o.thinkEndType)
+	if shouldContinue {
+		o.content.WriteString(delta)
+	}
+	return shouldContinue
+}
 
-		// 获取下一个可用的cookie继续尝试
-		cookie, err = cookieManager.GetNextCookie()
-		if err != nil {
-			logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+// respond 以收到的内容结束回答, unfinished 表示上游未发送结束事件
+func (o *nonStreamOutput) respond(openAIReq model.OpenAIChatCompletionRequest, cacheState *responseCacheState, unfinished bool) {
+	c := o.c
+	assistantMsgContent := o.content.String()
+	promptTokens := model.CountTokenText(string(o.attempt.jsonData), openAIReq.Model)
+	completionTokens := model.CountTokenText(assistantMsgContent, openAIReq.Model)
+	content, finishReason := completeOutput(c, assistantMsgContent)
+	if unfinished && finishReason != moderationFinishReason {
+		finishReason = incompleteFinishReason
+	}
+
+	c.JSON(http.StatusOK, model.OpenAIChatCompletionResponse{
+		ID:      fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405")),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   openAIReq.Model,
+		Choices: []model.OpenAIChoice{{
+			Message: model.OpenAIMessage{
+				Role:    "assistant",
+				Content: content,
+			},
+			FinishReason: &finishReason,
+		}},
+		Usage: model.OpenAIUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	})
+	auditResult(c, assistantMsgContent, promptTokens, completionTokens)
+	config.RecordCredentialUsage(o.attempt.cookie, promptTokens+completionTokens)
+	recordTokenUsage(c, promptTokens+completionTokens)
+	// 切换到备用模型后的结果、被审核拦截及不完整的结果不缓存
+	if !o.attempt.fallback && finishReason == "stop" {
+		cacheState.store(openAIReq, content, promptTokens, completionTokens)
+	}
+	runPostCompletionHooks(c, hook.Completion{
+		Model:            openAIReq.Model,
+		Content:          content,
+		FinishReason:     finishReason,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+	})
+}
 
+func handleNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo, cacheState *responseCacheState) {
+	driver := &upstreamDriver{c: c, client: client}
+	defer driver.end()
+
+	output := &nonStreamOutput{c: c, thinkStartType: new(bool), thinkEndType: new(bool)}
+	outcome := driver.run(&openAIReq, modelInfo, output)
+	switch outcome.result {
+	case upstreamFinished, upstreamUnfinished:
+		output.respond(openAIReq, cacheState, outcome.result == upstreamUnfinished)
+	case upstreamFailed:
+		c.JSON(outcome.status, gin.H{"error": outcome.message})
 	}
-	logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "All cookies are temporarily unavailable."})
-	return
 }
 
-func createRequestBody(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) (map[string]interface{}, error) {
+// createRequestBody 使用请求的副本构造上游请求, 重试及切换备用模型时不会修改原请求
+func createRequestBody(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) (map[string]interface{}, error) {
+	_, span := tracing.Start(c.Request.Context(), "createRequestBody", attribute.Int("rovo2api.messages", len(openAIReq.Messages)))
+	defer span.End()
+
 	// 创建请求体
 	logger.Debug(c.Request.Context(), fmt.Sprintf("RequestBody: %v", openAIReq))
 
-	if config.PRE_MESSAGES_JSON != "" {
-		err := openAIReq.PrependMessagesFromJSON(config.PRE_MESSAGES_JSON)
-		if err != nil {
-			return nil, fmt.Errorf("PrependMessagesFromJSON err: %v JSON:%s", err, config.PRE_MESSAGES_JSON)
-		}
-	}
-
 	if openAIReq.MaxTokens <= 1 {
-		openAIReq.MaxTokens = 8192
+		openAIReq.MaxTokens = min(8192, modelInfo.MaxOutputTokens)
 	}
 
 	// 将消息格式化为Atlassian API接受的格式
@@ -245,22 +256,16 @@ func createRequestBody(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequ
 			"top_p":             openAIReq.TopP,
 		},
 		"platform_attributes": map[string]interface{}{
-			"model": transformModelId(openAIReq.Model),
+			"model": modelInfo.UpstreamModel(),
 		},
 	}
+	if err := runPayloadHooks(c, upstreamRequest); err != nil {
+		return nil, err
+	}
 
 	return upstreamRequest, nil
 }
 
-// 转换模型ID，从前缀:模型格式提取出真实的模型ID
-func transformModelId(modelId string) string {
-	parts := strings.Split(modelId, ":")
-	if len(parts) > 1 {
-		return strings.Join(parts[1:], ":")
-	}
-	return modelId
-}
-
 // 将OpenAI消息格式转换为Atlassian API接受的格式
 func transformMessages(messages []model.OpenAIChatMessage) []map[string]interface{} {
 	var result []map[string]interface{}
@@ -370,8 +375,7 @@ func handleDelta(c *gin.Context, delta string, responseId, modelName string, jso
 }
 
 // handleMessageResult 处理消息结果
-func handleMessageResult(c *gin.Context, responseId, modelName string, jsonData []byte) bool {
-	finishReason := "stop"
+func handleMessageResult(c *gin.Context, responseId, modelName string, jsonData []byte, finishReason string) bool {
 	var delta string
 
 	promptTokens := 0
@@ -404,147 +408,113 @@ func sendSSEvent(c *gin.Context, response model.OpenAIChatCompletionResponse) er
 	return nil
 }
 
-func handleStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) {
-
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-
-	responseId := fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405"))
-	ctx := c.Request.Context()
+// streamConsumer 将上游的回答转换为流式响应发送
+type streamConsumer struct {
+	c                            *gin.Context
+	responseId                   string
+	openAIReq                    *model.OpenAIChatCompletionRequest
+	attempt                      *upstreamAttempt
+	content                      strings.Builder
+	completed                    bool
+	unfinished                   bool // 上游未发送结束事件
+	output                       *streamOutput
+	thinkStartType, thinkEndType *bool
+}
 
-	cookieManager := config.NewCookieManager()
+func (s *streamConsumer) start(attempt *upstreamAttempt) {
+	s.attempt = attempt
+	s.content.Reset()
+	s.completed = false
+	s.unfinished = false
+	s.output = newStreamOutput(s.c)
+}
 
-	if config.CustomHeaderKeyEnabled {
-		// 从请求头中获取自定义键
-		cookie := c.Request.Header.Get("Authorization")
-		if cookie == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization header is required"})
-			return
-		}
-		cookie = strings.Replace(cookie, "Bearer ", "", 1)
-		customKeysList := strings.Split(cookie, ",")
-		if len(customKeysList) > 0 {
-			// 随机选择一个键
-			randomIndex := rand.Intn(len(customKeysList))
-			selectedKey := strings.TrimSpace(customKeysList[randomIndex])
-			cookieManager.Cookies = []string{selectedKey}
-		}
-	}
+func (s *streamConsumer) consume(data string) bool {
+	delta, shouldContinue := processStreamData(s.c, data, s.responseId, s.openAIReq.Model, s.attempt.modelInfo, s.attempt.jsonData, s.thinkStartType, s.thinkEndType, &s.completed, s.output)
+	s.content.WriteString(delta)
+	return shouldContinue
+}
 
-	maxRetries := len(cookieManager.Cookies)
-	cookie, err := cookieManager.GetRandomCookie()
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+// finishReason 回答的结束原因
+func (s *streamConsumer) finishReason() string {
+	if s.unfinished && !s.output.isBlocked() {
+		return incompleteFinishReason
 	}
+	return s.output.finishReason()
+}
 
-	thinkStartType := new(bool)
-	thinkEndType := new(bool)
-
-	c.Stream(func(w io.Writer) bool {
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			requestBody, err := createRequestBody(c, &openAIReq, modelInfo)
-			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return false
-			}
-
-			jsonData, err := json.Marshal(requestBody)
-			if err != nil {
-				c.JSON(500, gin.H{"error": "Failed to marshal request body"})
-				return false
-			}
-			sseChan, err := rovoapi.MakeStreamChatRequest(c, client, jsonData, cookie, modelInfo)
-			if err != nil {
-				logger.Errorf(ctx, "MakeStreamChatRequest err on attempt %d: %v", attempt+1, err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return false
-			}
-
-			isRateLimit := false
-		SSELoop:
-			for response := range sseChan {
-
-				if response.Status == 403 {
-					c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
-					config.RemoveCookie(cookie)
-					isRateLimit = true
-					break SSELoop
-				}
-				if response.Status == 401 {
-					//c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
-					config.RemoveCookie(cookie)
-					isRateLimit = true
-					break SSELoop
-				}
-
-				data := response.Data
-				if data == "" {
-					continue
-				}
-
-				if response.Done {
-					switch {
-					case common.IsUsageLimitExceeded(data):
-						isRateLimit = true
-						logger.Warnf(ctx, "Cookie Usage limit exceeded, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-						config.RemoveCookie(cookie)
-						break SSELoop
-					case common.IsServerError(data):
-						logger.Errorf(ctx, errServerErrMsg)
-						c.JSON(http.StatusInternalServerError, gin.H{"error": errServerErrMsg})
-						return false
-					case common.IsNotLogin(data):
-						isRateLimit = true
-						logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-						break SSELoop // 使用 label 跳出 SSE 循环
-					case common.IsRateLimit(data):
-						isRateLimit = true
-						logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-						config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
-						break SSELoop
-					}
-					logger.Warnf(ctx, response.Data)
-					return false
-				}
+// complete 回答结束后记录用量并缓存
+func (s *streamConsumer) complete(cacheState *responseCacheState) {
+	c := s.c
+	content := s.content.String()
+	promptTokens := model.CountTokenText(string(s.attempt.jsonData), s.openAIReq.Model)
+	completionTokens := model.CountTokenText(content, s.openAIReq.Model)
+	auditResult(c, content, promptTokens, completionTokens)
+	config.RecordCredentialUsage(s.attempt.cookie, promptTokens+completionTokens)
+	recordTokenUsage(c, promptTokens+completionTokens)
+	// 切换到备用模型后的结果、被审核拦截及不完整的结果不缓存
+	if !s.attempt.fallback && s.finishReason() == "stop" {
+		cacheState.store(*s.openAIReq, s.output.content(content), promptTokens, completionTokens)
+	}
+	runPostCompletionHooks(c, hook.Completion{
+		Model:            s.openAIReq.Model,
+		Stream:           true,
+		Content:          s.output.content(content),
+		FinishReason:     s.finishReason(),
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+	})
+}
 
-				logger.Debug(ctx, strings.TrimSpace(data))
+func handleStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo, cacheState *responseCacheState) {
 
-				_, shouldContinue := processStreamData(c, data, responseId, openAIReq.Model, modelInfo, jsonData, thinkStartType, thinkEndType)
-				// 处理事件流数据
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
 
-				if !shouldContinue {
-					return false
-				}
-			}
+	driver := &upstreamDriver{c: c, client: client}
+	defer driver.end()
 
-			if !isRateLimit {
-				return true
-			}
+	consumer := &streamConsumer{
+		c:              c,
+		responseId:     fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405")),
+		openAIReq:      &openAIReq,
+		thinkStartType: new(bool),
+		thinkEndType:   new(bool),
+	}
 
-			// 获取下一个可用的cookie继续尝试
-			cookie, err = cookieManager.GetNextCookie()
-			if err != nil {
-				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return false
+	// 上游流结束后返回 false, 返回 true 会使 c.Stream 重新发起整个请求
+	c.Stream(func(w io.Writer) bool {
+		outcome := driver.run(&openAIReq, modelInfo, consumer)
+		switch outcome.result {
+		case upstreamFinished:
+			if consumer.completed {
+				consumer.complete(cacheState)
 			}
+		case upstreamUnfinished:
+			// 以已发送的内容结束回答
+			consumer.completed = true
+			consumer.unfinished = true
+			finishStream(c, consumer.responseId, openAIReq.Model, outcome.attempt.jsonData, consumer.output, incompleteFinishReason)
+			consumer.complete(cacheState)
+		case upstreamInterrupted:
+			auditError(c, outcome.message)
+		case upstreamFailed:
+			c.JSON(outcome.status, gin.H{"error": outcome.message})
 		}
-
-		logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "All cookies are temporarily unavailable."})
 		return false
 	})
 }
 
 // 处理流式数据的辅助函数，返回bool表示是否继续处理
-func processStreamData(c *gin.Context, data, responseId, model string, modelInfo common.ModelInfo, jsonData []byte, thinkStartType, thinkEndType *bool) (string, bool) {
+func processStreamData(c *gin.Context, data, responseId, model string, modelInfo common.ModelInfo, jsonData []byte, thinkStartType, thinkEndType, completed *bool, output *streamOutput) (string, bool) {
 	data = strings.TrimSpace(data)
 	data = strings.TrimPrefix(data, "data: ")
 
-	// 处理[DONE]标记
+	// 处理[DONE]标记, 上游未发送 end_turn 即结束时同样结束回答
 	if data == "[DONE]" {
+		*completed = true
+		finishStream(c, responseId, model, jsonData, output, "stop")
 		return "", false
 	}
 
@@ -580,7 +550,8 @@ func processStreamData(c *gin.Context, data, responseId, model string, modelInfo
 	finishReason, hasFinishReason := choice["finish_reason"]
 	if hasFinishReason && finishReason != nil && finishReason.(string) == "end_turn" {
 		// 处理完成的消息
-		handleMessageResult(c, responseId, model, jsonData)
+		*completed = true
+		finishStream(c, responseId, model, jsonData, output, "stop")
 		return "", false // 标记为结束
 	}
 
@@ -622,8 +593,27 @@ func processStreamData(c *gin.Context, data, responseId, model string, modelInfo
 			continue
 		}
 
+		delta := text
+		if output != nil {
+			var reason string
+			if delta, reason = output.write(text); reason != "" {
+				// 插件结束回答或被审核拦截时结束输出
+				if delta != "" {
+					if err := handleDelta(c, delta, responseId, model, jsonData); err != nil {
+						logger.Errorf(c.Request.Context(), "handleDelta err: %v", err)
+					}
+				}
+				*completed = true
+				handleMessageResult(c, responseId, model, jsonData, reason)
+				return text, false
+			}
+			if delta == "" {
+				return text, true
+			}
+		}
+
 		// 处理文本内容
-		if err := handleDelta(c, text, responseId, model, jsonData); err != nil {
+		if err := handleDelta(c, delta, responseId, model, jsonData); err != nil {
 			logger.Errorf(c.Request.Context(), "handleDelta err: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return "", false
@@ -635,67 +625,91 @@ func processStreamData(c *gin.Context, data, responseId, model string, modelInfo
 	return "", true
 }
 
+// finishStream 发送插件及审核保留的内容及结束事件, 被审核拦截时以 content_filter 代替 reason 结束
+func finishStream(c *gin.Context, responseId, model string, jsonData []byte, output *streamOutput, reason string) {
+	if output != nil {
+		text, finish := output.flush()
+		if text != "" {
+			if err := handleDelta(c, text, responseId, model, jsonData); err != nil {
+				logger.Errorf(c.Request.Context(), "handleDelta err: %v", err)
+			}
+		}
+		if finish == moderationFinishReason {
+			reason = finish
+		}
+	}
+	handleMessageResult(c, responseId, model, jsonData, reason)
+}
+
 func processNoStreamData(c *gin.Context, data string, modelInfo common.ModelInfo, thinkStartType *bool, thinkEndType *bool) (string, bool) {
+	text, shouldContinue, err := parseNoStreamEvent(c.Request.Context(), data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return text, shouldContinue
+}
+
+// parseNoStreamEvent 提取事件中的文本, 返回 false 表示回答结束; 事件无法解析时返回错误
+func parseNoStreamEvent(ctx context.Context, data string) (string, bool, error) {
 	data = strings.TrimSpace(data)
 	data = strings.TrimPrefix(data, "data: ")
 
 	// 处理[DONE]标记
 	if data == "[DONE]" {
-		return "", false
+		return "", false, nil
 	}
 
 	var event map[string]interface{}
 	if err := json.Unmarshal([]byte(data), &event); err != nil {
-		logger.Errorf(c.Request.Context(), "Failed to unmarshal event: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return "", false
+		logger.Errorf(ctx, "Failed to unmarshal event: %v", err)
+		return "", false, err
 	}
 
 	// 获取response_payload
 	responsePayload, ok := event["response_payload"].(map[string]interface{})
 	if !ok {
-		logger.Errorf(c.Request.Context(), "Invalid response format: response_payload not found")
-		return "", false
+		logger.Errorf(ctx, "Invalid response format: response_payload not found")
+		return "", false, nil
 	}
 
 	// 检查是否有choices数组
 	choices, ok := responsePayload["choices"].([]interface{})
 	if !ok || len(choices) == 0 {
-		logger.Errorf(c.Request.Context(), "Invalid response format: choices not found or empty")
-		return "", false
+		logger.Errorf(ctx, "Invalid response format: choices not found or empty")
+		return "", false, nil
 	}
 
 	// 获取第一个choice
 	choice, ok := choices[0].(map[string]interface{})
 	if !ok {
-		logger.Errorf(c.Request.Context(), "Invalid choice format in response")
-		return "", false
+		logger.Errorf(ctx, "Invalid choice format in response")
+		return "", false, nil
 	}
 
 	// 检查是否完成
 	finishReason, hasFinishReason := choice["finish_reason"]
 	if hasFinishReason && finishReason != nil && finishReason.(string) == "end_turn" {
 		// 处理完成的消息
-		return "", false // 标记为结束
+		return "", false, nil // 标记为结束
 	}
 
 	// 获取message内容
 	message, ok := choice["message"].(map[string]interface{})
 	if !ok {
-		logger.Errorf(c.Request.Context(), "Message not found in response")
-		return "", true
+		logger.Errorf(ctx, "Message not found in response")
+		return "", true, nil
 	}
 
 	// 获取content数组
 	contentArray, ok := message["content"].([]interface{})
 	if !ok {
 		// 可能是空数组或其他格式，继续处理
-		return "", true
+		return "", true, nil
 	}
 
 	// 如果content数组为空，继续处理
 	if len(contentArray) == 0 {
-		return "", true
+		return "", true, nil
 	}
 
 	// 收集所有文本内容
@@ -721,7 +735,7 @@ func processNoStreamData(c *gin.Context, data string, modelInfo common.ModelInfo
 		contentText += text
 	}
 
-	return contentText, true
+	return contentText, true, nil
 }
 
 // OpenaiModels @Summary OpenAI模型列表接口
@@ -733,19 +747,29 @@ func processNoStreamData(c *gin.Context, data string, modelInfo common.ModelInfo
 // @Success 200 {object} common.ResponseResult{data=model.OpenaiModelListResponse} "成功"
 // @Router /v1/models [get]
 func OpenaiModels(c *gin.Context) {
-	var modelsResp []string
-
-	modelsResp = common.GetModelList()
-
 	var openaiModelListResponse model.OpenaiModelListResponse
-	var openaiModelResponse []model.OpenaiModelResponse
+	openaiModelResponse := make([]model.OpenaiModelResponse, 0)
 	openaiModelListResponse.Object = "list"
 
-	for _, modelResp := range modelsResp {
-		openaiModelResponse = append(openaiModelResponse, model.OpenaiModelResponse{
-			ID:     modelResp,
-			Object: "model",
-		})
+	for _, entry := range config.GetModelEntries() {
+		modelResp := model.OpenaiModelResponse{
+			ID:              entry.Name,
+			Object:          "model",
+			Created:         entry.Info.Created.Unix(),
+			OwnedBy:         entry.Info.OwnedBy,
+			Root:            entry.Root,
+			ContextWindow:   entry.Info.ContextWindow,
+			MaxOutputTokens: entry.Info.MaxOutputTokens,
+			Capabilities: model.OpenaiModelCapabilities{
+				Vision: entry.Info.Vision,
+				Tools:  entry.Info.Tools,
+			},
+		}
+		// 别名指向的模型
+		if entry.Name != entry.Root {
+			modelResp.Parent = entry.Root
+		}
+		openaiModelResponse = append(openaiModelResponse, modelResp)
 	}
 	openaiModelListResponse.Data = openaiModelResponse
 	c.JSON(http.StatusOK, openaiModelListResponse)
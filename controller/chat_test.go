@@ -0,0 +1,295 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"rovo2api/common/config"
+	"rovo2api/model"
+	"rovo2api/rovo-api/mock"
+)
+
+const testMessages = `"model":"anthropic:claude-sonnet-4@20250514","messages":[{"role":"user","content":"hi"}]`
+
+func chatBody(stream bool) string {
+	return fmt.Sprintf(`{"stream":%t,%s}`, stream, testMessages)
+}
+
+// replyContent 返回流式或非流式响应中的回答
+func replyContent(t *testing.T, stream bool, result chatResult) string {
+	t.Helper()
+	if result.status != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", result.status, result.body)
+	}
+	if stream {
+		content, done := streamContent(t, result.body)
+		if !done {
+			t.Fatalf("stream did not end with [DONE]: %s", result.body)
+		}
+		return content
+	}
+	var resp model.OpenAIChatCompletionResponse
+	if err := json.Unmarshal([]byte(result.body), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", result.body, err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].FinishReason == nil {
+		t.Fatalf("unexpected response: %s", result.body)
+	}
+	return resp.Choices[0].Message.Content
+}
+
+func TestChatReply(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%t", stream), func(t *testing.T) {
+			credential := fmt.Sprintf("reply-%t@example.com:token", stream)
+			upstream := newUpstream(t, credential)
+			upstream.Script(credential, mock.Reply("Hello", " from", " mock"))
+
+			if got := replyContent(t, stream, postChat(t, chatBody(stream))); got != "Hello from mock" {
+				t.Fatalf("content = %q", got)
+			}
+			if requests := upstream.Requests(); len(requests) != 1 {
+				t.Fatalf("upstream requests = %d, want 1", len(requests))
+			}
+		})
+	}
+}
+
+// replyFinishReason 返回流式或非流式响应的结束原因
+func replyFinishReason(t *testing.T, stream bool, result chatResult) string {
+	t.Helper()
+	if !stream {
+		var resp model.OpenAIChatCompletionResponse
+		if err := json.Unmarshal([]byte(result.body), &resp); err != nil || len(resp.Choices) != 1 || resp.Choices[0].FinishReason == nil {
+			t.Fatalf("unexpected response: %s", result.body)
+		}
+		return *resp.Choices[0].FinishReason
+	}
+	reason := ""
+	for _, line := range strings.Split(result.body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk model.OpenAIChatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				reason = *choice.FinishReason
+			}
+		}
+	}
+	return reason
+}
+
+// 上游正常结束但没有结束事件时, 以已收到的内容结束回答且不重发请求; 回答可能不完整, 以 length 结束且不缓存
+func TestChatUnfinishedStream(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%t", stream), func(t *testing.T) {
+			responseCache := withResponseCache(t)
+			credential := fmt.Sprintf("unfinished-%t@example.com:token", stream)
+			upstream := newUpstream(t, credential)
+			upstream.Script(credential, mock.Unfinished("partial", " answer"), mock.Reply("full answer"))
+
+			result := postChat(t, chatBody(stream))
+			if got := replyContent(t, stream, result); got != "partial answer" {
+				t.Fatalf("content = %q", got)
+			}
+			if got := replyFinishReason(t, stream, result); got != "length" {
+				t.Fatalf("finish reason = %q, want length", got)
+			}
+			if requests := upstream.Requests(); len(requests) != 1 {
+				t.Fatalf("upstream requests = %d, want 1", len(requests))
+			}
+			if stats := responseCache.Stats(); stats.Stores != 0 {
+				t.Fatalf("cache stores = %d, want 0", stats.Stores)
+			}
+
+			// 相同的请求不会命中不完整的回答
+			result = postChat(t, chatBody(stream))
+			if got := replyContent(t, stream, result); got != "full answer" {
+				t.Fatalf("content = %q", got)
+			}
+			if got := result.header.Get("X-Rovo2api-Cache"); got != "MISS" {
+				t.Fatalf("X-Rovo2api-Cache = %q, want MISS", got)
+			}
+			if requests := upstream.Requests(); len(requests) != 2 {
+				t.Fatalf("upstream requests = %d, want 2", len(requests))
+			}
+		})
+	}
+}
+
+// 第一次请求失败后切换到另一个凭证; 无论先选中哪个凭证, 失败的都是第一次请求
+func TestChatCredentialFailover(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior mock.Behavior
+		invalid  string // 失败的凭证被标记为失效的原因, 为空时只进入冷却
+	}{
+		{"rate_limit", mock.RateLimit(), ""},
+		{"usage_exceeded", mock.UsageExceeded(), "usage limit exceeded"},
+		{"invalid_token", mock.InvalidToken(), "unauthorized"},
+	}
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%t", tt.name, stream), func(t *testing.T) {
+				credentials := []string{
+					fmt.Sprintf("a-%s-%t@example.com:token", tt.name, stream),
+					fmt.Sprintf("b-%s-%t@example.com:token", tt.name, stream),
+				}
+				upstream := newUpstream(t, credentials...)
+				upstream.Sequence(tt.behavior, mock.Reply("from", " healthy"))
+
+				if got := replyContent(t, stream, postChat(t, chatBody(stream))); got != "from healthy" {
+					t.Fatalf("content = %q", got)
+				}
+				requests := upstream.Requests()
+				if len(requests) != 2 || requests[0].Credential == requests[1].Credential {
+					t.Fatalf("upstream requests = %v, want one attempt with each credential", requests)
+				}
+				failing := requests[0].Credential
+
+				invalid, err := config.State.InvalidCredentials(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if reason := invalid[config.CredentialKey(failing)]; reason != tt.invalid {
+					t.Fatalf("invalid reason = %q, want %q", reason, tt.invalid)
+				}
+				if _, ok := invalid[config.CredentialKey(requests[1].Credential)]; ok {
+					t.Fatal("the healthy credential was invalidated")
+				}
+			})
+		}
+	}
+}
+
+// 用量超出上游限制的凭证被标记为失效, 不仅在当前模型上停用
+func TestChatUsageExceededInvalidatesCredential(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%t", stream), func(t *testing.T) {
+			credential := fmt.Sprintf("exhausted-%t@example.com:token", stream)
+			upstream := newUpstream(t, credential)
+			upstream.Script(credential, mock.UsageExceeded(), mock.Reply("unreachable"))
+
+			postChat(t, chatBody(stream))
+			invalid, err := config.State.InvalidCredentials(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reason := invalid[config.CredentialKey(credential)]; reason != "usage limit exceeded" {
+				t.Fatalf("invalid reason = %q, want usage limit exceeded", reason)
+			}
+			// 其他模型同样不再使用该凭证
+			body := strings.Replace(chatBody(stream), testModel, testFallbackModel, 1)
+			postChat(t, body)
+			if requests := upstream.Requests(); len(requests) != 1 {
+				t.Fatalf("upstream requests = %d, want 1", len(requests))
+			}
+		})
+	}
+}
+
+const (
+	testModel         = "anthropic:claude-sonnet-4@20250514"
+	testFallbackModel = "bedrock:anthropic.claude-sonnet-4-20250514-v1:0"
+)
+
+// withFallback 为 testModel 配置备用模型, 测试结束后恢复内置的注册表
+func withFallback(t *testing.T) {
+	t.Helper()
+	if err := config.SetModelRegistry(config.DefaultModels, nil, map[string][]string{testModel: {testFallbackModel}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := config.SetModelRegistry(config.DefaultModels, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func upstreamMessages(request mock.Request) []interface{} {
+	payload, _ := request.Body["request_payload"].(map[string]interface{})
+	messages, _ := payload["messages"].([]interface{})
+	return messages
+}
+
+func upstreamModel(request mock.Request) string {
+	attributes, _ := request.Body["platform_attributes"].(map[string]interface{})
+	name, _ := attributes["model"].(string)
+	return name
+}
+
+// 上游不可用时切换到备用模型, PRE_MESSAGES_JSON 只追加一次
+func TestChatModelFallback(t *testing.T) {
+	withSettings(t, func(settings *config.Settings) { settings.PreMessagesJSON = `[{"role":"user","content":"pre"}]` })
+	withFallback(t)
+
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%t", stream), func(t *testing.T) {
+			credential := fmt.Sprintf("fallback-%t@example.com:token", stream)
+			upstream := newUpstream(t, credential)
+			upstream.Script(credential, mock.ServiceUnavailable(), mock.Reply("from", " fallback"))
+
+			result := postChat(t, chatBody(stream))
+			if got := replyContent(t, stream, result); got != "from fallback" {
+				t.Fatalf("content = %q", got)
+			}
+			if got := result.header.Get("X-Rovo2api-Fallback"); got != testFallbackModel {
+				t.Fatalf("X-Rovo2api-Fallback = %q, want %q", got, testFallbackModel)
+			}
+			requests := upstream.Requests()
+			if len(requests) != 2 {
+				t.Fatalf("upstream requests = %d, want 2", len(requests))
+			}
+			if upstreamModel(requests[1]) == upstreamModel(requests[0]) {
+				t.Fatalf("fallback request used the same upstream model %q", upstreamModel(requests[1]))
+			}
+			for i, request := range requests {
+				if messages := upstreamMessages(request); len(messages) != 2 {
+					t.Fatalf("request %d messages = %v, want the pre message and the user message", i, messages)
+				}
+			}
+		})
+	}
+}
+
+// 已发送内容后上游出错或断开时不切换凭证或备用模型, 避免在同一响应中开始第二个回答
+func TestChatStreamNoFallbackAfterOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior mock.Behavior
+	}{
+		{"error_event", mock.FailMidStream(mock.ServiceUnavailableBody, "partial")},
+		{"dropped", mock.DropMidStream("partial")},
+	}
+	withFallback(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newUpstream(t, "started-a@example.com:token", "started-b@example.com:token")
+			upstream.Sequence(tt.behavior)
+			upstream.SetDefault(mock.Reply("second", " answer"))
+
+			result := postChat(t, chatBody(true))
+			if result.status != http.StatusOK {
+				t.Fatalf("status = %d, body: %s", result.status, result.body)
+			}
+			if got := result.header.Get("X-Rovo2api-Fallback"); got != "" {
+				t.Fatalf("X-Rovo2api-Fallback = %q, want none", got)
+			}
+			if content, _ := streamContent(t, result.body); content != "partial" {
+				t.Fatalf("content = %q, want %q", content, "partial")
+			}
+			if requests := upstream.Requests(); len(requests) != 1 {
+				t.Fatalf("upstream requests = %d, want 1", len(requests))
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	logger "rovo2api/common/loggger"
+	"rovo2api/cycletls"
+	"rovo2api/model"
+	rovoapi "rovo2api/rovo-api"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 响应头, 说明为适应上下文窗口对消息做了哪些处理
+	contextHeader = "X-Rovo2api-Context"
+
+	contextSummaryMaxTokens = 2048
+	contextSummaryTimeout   = 2 * time.Minute
+	contextSummaryPrompt    = "Summarize the earlier part of a conversation below so that the summary can replace those messages. " +
+		"Keep facts, decisions, names, numbers, code identifiers, file paths and open questions. " +
+		"Write in the language of the conversation and output only the summary."
+	contextSummaryPrefix = "Summary of the earlier part of this conversation (the original messages were removed to fit the context window):\n\n"
+
+	// CountTokenMessages 为每次回答额外计入的 token 数
+	replyPrimingTokens = 3
+)
+
+// 上下文窗口管理的结果
+type contextResult struct {
+	strategy   string
+	before     int // 处理前的提示词 token 数
+	after      int
+	dropped    int // 丢弃的消息数
+	summarized int // 被总结的消息数
+}
+
+func (r contextResult) header() string {
+	return fmt.Sprintf("strategy=%s; dropped=%d; summarized=%d; tokens=%d->%d", r.strategy, r.dropped, r.summarized, r.before, r.after)
+}
+
+func countMessageTokens(message model.OpenAIChatMessage, modelName string) int {
+	return model.CountTokenMessages([]model.OpenAIChatMessage{message}, modelName) - replyPrimingTokens
+}
+
+// 可用于提示词的 token 数: 上下文窗口扣除安全余量及 max_tokens; PRE_MESSAGES_JSON 的消息已由 prompt 插件插入
+func contextBudget(openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) (int, int) {
+	maxTokens := openAIReq.MaxTokens
+	if maxTokens <= 1 {
+		maxTokens = min(8192, modelInfo.MaxOutputTokens)
+	}
+	budget := int(float64(modelInfo.ContextWindow)*(1-config.GetSettings().ContextSafetyMargin)) - maxTokens
+	return budget, maxTokens
+}
+
+// 按备用模型链中可用 token 数最少的模型计算, 切换到备用模型后提示词同样不超过其上下文窗口; 返回可用 token 数、该模型的 max_tokens 及模型
+func chainContextBudget(openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) (int, int, common.ModelInfo) {
+	budget, maxTokens := contextBudget(openAIReq, modelInfo)
+	limit := modelInfo
+	for _, fallback := range config.GetFallbackChain(openAIReq.Model) {
+		// 与 useFallbackModel 一致, max_tokens 不超过备用模型的最大输出
+		req := *openAIReq
+		req.MaxTokens = min(req.MaxTokens, fallback.Info.MaxOutputTokens)
+		if fallbackBudget, fallbackMaxTokens := contextBudget(&req, fallback.Info); fallbackBudget < budget {
+			budget, maxTokens, limit = fallbackBudget, fallbackMaxTokens, fallback.Info
+		}
+	}
+	return budget, maxTokens, limit
+}
+
+// 对话轮次的起始位置: 每条 user 消息开始新的一轮, 开头的非 user 消息单独成为一轮; system 消息不属于任何轮次
+func contextTurnStarts(messages []model.OpenAIChatMessage) []int {
+	var starts []int
+	for i, message := range messages {
+		if message.Role == "system" {
+			continue
+		}
+		if len(starts) == 0 || message.Role == "user" {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// 丢弃最早的对话轮次直到不超过 target, 至少保留最后一轮; 返回保留的第一条非 system 消息的位置及剩余 token 数
+func truncateTurns(messages []model.OpenAIChatMessage, tokens []int, total int, target int) (int, int) {
+	starts := contextTurnStarts(messages)
+	cut := 0
+	for turn := 0; turn < len(starts)-1 && total > target; turn++ {
+		for i := starts[turn]; i < starts[turn+1]; i++ {
+			if messages[i].Role != "system" {
+				total -= tokens[i]
+			}
+		}
+		cut = starts[turn+1]
+	}
+	return cut, total
+}
+
+// manageContext 提示词超过模型(配置了备用模型时为其中最小的)上下文窗口时按 CONTEXT_STRATEGY 处理, 无法处理时返回 400; 返回是否继续请求
+func manageContext(c *gin.Context, client cycletls.CycleTLS, openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) bool {
+	strategy := config.GetSettings().ContextStrategy
+	if strategy == config.ContextStrategyOff {
+		return true
+	}
+	ctx := c.Request.Context()
+	budget, maxTokens, limit := chainContextBudget(openAIReq, modelInfo)
+
+	messages := openAIReq.Messages
+	tokens := make([]int, len(messages))
+	total := replyPrimingTokens
+	for i, message := range messages {
+		tokens[i] = countMessageTokens(message, openAIReq.Model)
+		total += tokens[i]
+	}
+	if total <= budget {
+		return true
+	}
+	if strategy == config.ContextStrategyReject {
+		logger.Warnf(ctx, "Prompt of %d tokens exceeds context budget %d, rejected", total, budget)
+		respondContextExceeded(c, limit, total, maxTokens)
+		return false
+	}
+
+	result := contextResult{strategy: config.ContextStrategyTruncate, before: total}
+	summaryMessage := model.OpenAIChatMessage{Role: "system", Content: contextSummaryPrefix}
+	// 总结最多占用 1/4 的可用 token
+	summaryTokens := min(contextSummaryMaxTokens, budget/4)
+	target := budget
+	if strategy == config.ContextStrategySummarize {
+		target -= summaryTokens + countMessageTokens(summaryMessage, openAIReq.Model)
+	}
+	cut, remaining := truncateTurns(messages, tokens, total, target)
+	if remaining > budget {
+		logger.Warnf(ctx, "Prompt of %d tokens exceeds context budget %d even after dropping older turns", total, budget)
+		respondContextExceeded(c, limit, remaining, maxTokens)
+		return false
+	}
+
+	// 总结的内容放在保留的对话之前, 即之前的 system 消息之后
+	var kept, dropped []model.OpenAIChatMessage
+	summaryAt := 0
+	for i, message := range messages {
+		if i == cut {
+			summaryAt = len(kept)
+		}
+		if message.Role == "system" || i >= cut {
+			kept = append(kept, message)
+		} else {
+			dropped = append(dropped, message)
+		}
+	}
+	result.dropped = len(dropped)
+	result.after = remaining
+
+	if strategy == config.ContextStrategySummarize && remaining <= target {
+		summary, summarized, err := summarizeMessages(c, client, dropped, summaryTokens)
+		if err != nil {
+			logger.Warnf(ctx, "Failed to summarize %d older messages, truncating instead: %v", len(dropped), err)
+		} else {
+			summaryMessage.Content = contextSummaryPrefix + summary
+			kept = append(kept[:summaryAt], append([]model.OpenAIChatMessage{summaryMessage}, kept[summaryAt:]...)...)
+			result.strategy = config.ContextStrategySummarize
+			result.summarized = summarized
+			result.dropped -= summarized
+			result.after += countMessageTokens(summaryMessage, openAIReq.Model)
+		}
+	}
+
+	logger.Infof(ctx, "Prompt of %d tokens exceeds context budget %d, %s", total, budget, result.header())
+	openAIReq.Messages = kept
+	c.Header(contextHeader, result.header())
+	return true
+}
+
+func respondContextExceeded(c *gin.Context, modelInfo common.ModelInfo, promptTokens int, maxTokens int) {
+	c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: fmt.Sprintf("This model's maximum context length is %d tokens. However, your messages resulted in about %d tokens (%d more are reserved for max_tokens). Please reduce the length of the messages.",
+				modelInfo.ContextWindow, promptTokens, maxTokens),
+			Type: "invalid_request_error",
+			Code: "context_length_exceeded",
+		},
+	})
+}
+
+// 将消息转为文本记录, 图片以 [image] 代替
+func contextTranscript(message model.OpenAIChatMessage) string {
+	var text strings.Builder
+	switch content := message.Content.(type) {
+	case string:
+		text.WriteString(content)
+	case []interface{}:
+		for _, item := range content {
+			part, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch part["type"] {
+			case "text":
+				value, _ := part["text"].(string)
+				text.WriteString(value)
+			case "image_url":
+				text.WriteString("[image]")
+			}
+		}
+	default:
+		text.WriteString(fmt.Sprintf("%v", content))
+	}
+	return message.Role + ": " + text.String()
+}
+
+// 用 CONTEXT_SUMMARY_MODEL 总结被丢弃的消息, 超过总结模型窗口时只总结较新的部分; 返回总结及被总结的消息数
+func summarizeMessages(c *gin.Context, client cycletls.CycleTLS, messages []model.OpenAIChatMessage, maxTokens int) (string, int, error) {
+	summaryModel := config.GetSettings().ContextSummaryModel
+	summaryInfo, ok := common.GetModelInfo(summaryModel)
+	if !ok {
+		return "", 0, fmt.Errorf("summary model %s not supported", summaryModel)
+	}
+	req := model.OpenAIChatCompletionRequest{
+		Model:     summaryInfo.ID,
+		MaxTokens: min(maxTokens, summaryInfo.MaxOutputTokens),
+	}
+	budget, _ := contextBudget(&req, summaryInfo)
+	budget -= model.CountTokenText(contextSummaryPrompt, summaryInfo.ID) + 2*replyPrimingTokens
+
+	var parts []string
+	for i := len(messages) - 1; i >= 0; i-- {
+		part := contextTranscript(messages[i])
+		tokens := model.CountTokenText(part, summaryInfo.ID)
+		if tokens > budget {
+			break
+		}
+		budget -= tokens
+		parts = append([]string{part}, parts...)
+	}
+	if len(parts) == 0 {
+		return "", 0, errors.New("messages too long to summarize")
+	}
+	req.Messages = []model.OpenAIChatMessage{
+		{Role: "system", Content: contextSummaryPrompt},
+		{Role: "user", Content: strings.Join(parts, "\n\n")},
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextSummaryTimeout)
+	defer cancel()
+	requestBody, err := createRequestBody(c, req, summaryInfo)
+	if err != nil {
+		return "", 0, err
+	}
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", 0, err
+	}
+	cookieManager, err := newCookieManager(c, summaryInfo.ID)
+	if err != nil {
+		return "", 0, err
+	}
+	var lease credentialLease
+	defer lease.end()
+	for attempt := 0; attempt < len(cookieManager.Cookies); attempt++ {
+		cookie, err := lease.acquire(ctx, cookieManager)
+		if err != nil {
+			return "", 0, err
+		}
+		summary, retry, err := requestSummary(ctx, client, jsonData, cookie, summaryInfo)
+		if err == nil {
+			config.RecordCredentialUsage(cookie, model.CountTokenText(string(jsonData), summaryInfo.ID)+model.CountTokenText(summary, summaryInfo.ID))
+			return summary, len(parts), nil
+		}
+		if !retry {
+			return "", 0, err
+		}
+		logger.Warnf(c.Request.Context(), "Summary request failed, switching to next cookie, credential:%s: %v", config.CredentialName(cookie), err)
+	}
+	return "", 0, errors.New("no cookies available")
+}
+
+// 发送总结请求并收集回答; 凭证不可用时返回 retry 为 true
+func requestSummary(ctx context.Context, client cycletls.CycleTLS, jsonData []byte, cookie string, summaryInfo common.ModelInfo) (string, bool, error) {
+	sseChan, err := rovoapi.MakeStreamChatRequest(ctx, client, jsonData, cookie, summaryInfo)
+	if err != nil {
+		return "", false, err
+	}
+	var summary strings.Builder
+	for response := range sseChan {
+		switch response.Status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "", true, fmt.Errorf("upstream returned %d", response.Status)
+		}
+		data := response.Data
+		if data == "" {
+			continue
+		}
+		if response.Done {
+			switch {
+			case common.IsUsageLimitExceeded(data):
+				exhaustCredential(cookie, summaryInfo.ID)
+				return "", true, errors.New("usage limit exceeded")
+			case common.IsRateLimit(data):
+				config.AddRateLimitCookie(cookie, summaryInfo.ID, time.Now().Add(time.Duration(config.GetSettings().RateLimitCookieLockDuration)*time.Second))
+				return "", true, errors.New("rate limited")
+			case common.IsNotLogin(data):
+				return "", true, errors.New("not login")
+			}
+			return "", false, errors.New(data)
+		}
+		text, more, err := parseNoStreamEvent(ctx, data)
+		if err != nil {
+			return "", false, err
+		}
+		if !more {
+			if summary.Len() == 0 {
+				return "", false, errors.New("empty summary")
+			}
+			return summary.String(), false, nil
+		}
+		summary.WriteString(text)
+	}
+	if ctx.Err() != nil {
+		return "", false, ctx.Err()
+	}
+	return "", false, errors.New("empty response")
+}
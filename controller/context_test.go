@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rovo2api/common/config"
+	"rovo2api/cycletls"
+	"rovo2api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testSmallModel = "test:small-window"
+
+// withSmallFallback 为 testModel 配置上下文窗口较小的备用模型
+func withSmallFallback(t *testing.T) {
+	t.Helper()
+	small := config.ModelInfo{
+		ID:              testSmallModel,
+		Created:         time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		ContextWindow:   4000,
+		MaxOutputTokens: 1000,
+	}
+	models := append(append([]config.ModelInfo(nil), config.DefaultModels...), small)
+	if err := config.SetModelRegistry(models, nil, map[string][]string{testModel: {testSmallModel}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := config.SetModelRegistry(config.DefaultModels, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestChainContextBudget(t *testing.T) {
+	withSmallFallback(t)
+	primary, ok := config.GetModelInfo(testModel)
+	if !ok {
+		t.Fatalf("model %s not found", testModel)
+	}
+	small, _ := config.GetModelInfo(testSmallModel)
+
+	tests := []struct {
+		name      string
+		model     string
+		maxTokens int
+		wantModel string
+		wantMax   int
+	}{
+		{"smallest window in the chain", testModel, 0, testSmallModel, 1000},
+		{"max_tokens clamped for the fallback", testModel, 8000, testSmallModel, 1000},
+		{"no fallback", testSmallModel, 0, testSmallModel, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := primary
+			if tt.model == testSmallModel {
+				info = small
+			}
+			req := model.OpenAIChatCompletionRequest{Model: tt.model, MaxTokens: tt.maxTokens}
+			budget, maxTokens, limit := chainContextBudget(&req, info)
+			if limit.ID != tt.wantModel || maxTokens != tt.wantMax {
+				t.Fatalf("limit = %s, max_tokens = %d, want %s, %d", limit.ID, maxTokens, tt.wantModel, tt.wantMax)
+			}
+			if want, _ := contextBudget(&model.OpenAIChatCompletionRequest{MaxTokens: tt.wantMax}, small); budget != want {
+				t.Fatalf("budget = %d, want %d", budget, want)
+			}
+		})
+	}
+}
+
+// 提示词不超过主模型的窗口但超过备用模型的窗口时同样按 CONTEXT_STRATEGY 处理
+func TestManageContextFallbackWindow(t *testing.T) {
+	withSmallFallback(t)
+	withSettings(t, func(settings *config.Settings) { settings.ContextStrategy = config.ContextStrategyReject })
+
+	primary, _ := config.GetModelInfo(testModel)
+	req := model.OpenAIChatCompletionRequest{
+		Model:    testModel,
+		Messages: []model.OpenAIChatMessage{{Role: "user", Content: strings.Repeat("hello world ", 4000)}},
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	if manageContext(c, cycletls.CycleTLS{}, &req, primary) {
+		t.Fatal("prompt exceeding the fallback model's window was accepted")
+	}
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "maximum context length is 4000 tokens") {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+}
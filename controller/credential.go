@@ -0,0 +1,236 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	logger "rovo2api/common/loggger"
+	"rovo2api/cycletls"
+	"rovo2api/model"
+	rovoapi "rovo2api/rovo-api"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const credentialProbeTimeout = 30 * time.Second
+
+// CredentialStatuses 凭证状态(失效标记、各模型冷却及当天用量), 多实例部署时为所有实例的汇总
+func CredentialStatuses(c *gin.Context) {
+	statuses, err := config.GetCredentialStatuses()
+	if err != nil {
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"backend":     config.State.Name(),
+		"credentials": statuses,
+	})
+}
+
+// ClearInvalidCredentials 清除凭证的失效标记
+func ClearInvalidCredentials(c *gin.Context) {
+	if err := config.ClearInvalidCredentials(); err != nil {
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", nil)
+}
+
+// 按 :key(CredentialKey) 查找凭证, 不存在时返回 404
+func credentialByKey(c *gin.Context) (string, bool) {
+	cookie, ok := config.FindCredential(c.Param("key"))
+	if !ok {
+		common.SendResponse(c, http.StatusNotFound, 1, "credential not found", nil)
+	}
+	return cookie, ok
+}
+
+// AddCredential 在运行时添加凭证, 仅保存在当前实例内存中, 需写入 RV_COOKIE 或配置文件才能持久保留
+func AddCredential(c *gin.Context) {
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, "invalid request body", nil)
+		return
+	}
+	if err := config.AddCredential(req.Value); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+	logger.SysLog("credential added via admin api: " + config.CredentialName(req.Value))
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"name": config.CredentialName(req.Value),
+		"key":  config.CredentialKey(req.Value),
+	})
+}
+
+// DisableCredential 手动停用凭证
+func DisableCredential(c *gin.Context) {
+	cookie, ok := credentialByKey(c)
+	if !ok {
+		return
+	}
+	if err := config.DisableCredential(cookie); err != nil {
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	logger.SysLog("credential disabled via admin api: " + config.CredentialName(cookie))
+	common.SendResponse(c, http.StatusOK, 0, "success", nil)
+}
+
+// EnableCredential 清除凭证的失效标记及冷却
+func EnableCredential(c *gin.Context) {
+	cookie, ok := credentialByKey(c)
+	if !ok {
+		return
+	}
+	if err := config.EnableCredential(cookie); err != nil {
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	logger.SysLog("credential enabled via admin api: " + config.CredentialName(cookie))
+	common.SendResponse(c, http.StatusOK, 0, "success", nil)
+}
+
+// ValidateCredential 向上游发送一个最小请求校验凭证:
+// 校验通过时清除失效标记及冷却(手动停用的除外), 未登录或被禁止访问时标记为失效
+func ValidateCredential(c *gin.Context) {
+	cookie, ok := credentialByKey(c)
+	if !ok {
+		return
+	}
+	modelName := c.Query("model")
+	if modelName == "" {
+		for _, entry := range config.GetModelEntries() {
+			if entry.Name == entry.Info.ID {
+				modelName = entry.Name
+				break
+			}
+		}
+	}
+	modelInfo, ok := common.GetModelInfo(modelName)
+	if !ok {
+		common.SendResponse(c, http.StatusBadRequest, 1, fmt.Sprintf("model %s not supported", modelName), nil)
+		return
+	}
+
+	result, detail := probeCredential(c, cookie, modelInfo)
+	switch result {
+	case "valid":
+		reason, err := config.CredentialInvalidReason(cookie)
+		if err == nil && reason != config.CredentialDisabled {
+			err = config.EnableCredential(cookie)
+		}
+		if err != nil {
+			common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), nil)
+			return
+		}
+	case "unauthorized", "forbidden", "not login":
+		removeCredential(cookie, result)
+	}
+	logger.SysLog(fmt.Sprintf("credential %s validated via admin api: %s", config.CredentialName(cookie), result))
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"model":  modelInfo.ID,
+		"result": result,
+		"detail": detail,
+	})
+}
+
+// 发送最小请求并返回结果: valid、unauthorized、forbidden、not login、rate limited、usage limit exceeded 或 error
+func probeCredential(c *gin.Context, cookie string, modelInfo common.ModelInfo) (string, string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), credentialProbeTimeout)
+	defer cancel()
+	client := cycletls.Init()
+	defer safeClose(client)
+
+	req := model.OpenAIChatCompletionRequest{
+		Model:     modelInfo.ID,
+		MaxTokens: 16,
+		Messages:  []model.OpenAIChatMessage{{Role: "user", Content: "hi"}},
+	}
+	requestBody, err := createRequestBody(c, req, modelInfo)
+	if err != nil {
+		return "error", err.Error()
+	}
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "error", err.Error()
+	}
+	sseChan, err := rovoapi.MakeStreamChatRequest(ctx, client, jsonData, cookie, modelInfo)
+	if err != nil {
+		return "error", err.Error()
+	}
+	for response := range sseChan {
+		switch response.Status {
+		case http.StatusUnauthorized:
+			return "unauthorized", ""
+		case http.StatusForbidden:
+			return "forbidden", ""
+		}
+		data := response.Data
+		if data == "" {
+			continue
+		}
+		if !response.Done {
+			// 收到正常的事件即说明凭证可用, 不必等待回答结束
+			return "valid", ""
+		}
+		switch {
+		case common.IsNotLogin(data):
+			return "not login", data
+		case common.IsUsageLimitExceeded(data):
+			return "usage limit exceeded", data
+		case common.IsRateLimit(data):
+			return "rate limited", data
+		}
+		return "error", data
+	}
+	if ctx.Err() != nil {
+		return "error", ctx.Err().Error()
+	}
+	return "error", "empty response"
+}
+
+// credentialLease 当前请求占用的凭证并发名额, 切换凭证或请求结束时释放
+type credentialLease struct {
+	release func()
+}
+
+// 释放当前占用的名额, 并从 cookieManager 中选择下一个凭证
+func (l *credentialLease) acquire(ctx context.Context, cookieManager *config.CookieManager) (string, error) {
+	l.end()
+	cookie, release, err := cookieManager.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	l.release = release
+	return cookie, nil
+}
+
+func (l *credentialLease) end() {
+	if l.release != nil {
+		l.release()
+		l.release = nil
+	}
+}
+
+// 凭证均繁忙时返回 503, 客户端已断开时不再响应(关闭超时被取消时返回 503); 返回是否已处理
+func credentialsBusy(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, config.ErrCredentialsBusy):
+		logger.Warnf(c.Request.Context(), "All credentials busy after waiting %ds", config.GetSettings().CredentialQueueTimeout)
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return true
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		respondShutdown(c)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	"rovo2api/common/events"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 凭证池的定时检查间隔, 凭证失效或冷却时另外立即检查
+const poolCheckInterval = 30 * time.Second
+
+// 同一 API-KEY 超出额度的通知间隔
+const keyBudgetNotifyInterval = time.Minute
+
+var poolCheck = make(chan struct{}, 1)
+
+// MonitorCredentialPool 检查可用凭证数, 由不少于 EVENT_POOL_MIN_HEALTHY 变为少于时通知
+func MonitorCredentialPool() {
+	ticker := time.NewTicker(poolCheckInterval)
+	defer ticker.Stop()
+	unhealthy := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-poolCheck:
+		}
+		unhealthy = checkCredentialPool(unhealthy)
+	}
+}
+
+// 凭证状态变化后请求检查凭证池, 不等待检查完成
+func notifyPoolChange() {
+	select {
+	case poolCheck <- struct{}{}:
+	default:
+	}
+}
+
+// checkCredentialPool 返回凭证池当前是否低于阈值, 由不低于变为低于时通知
+func checkCredentialPool(wasUnhealthy bool) bool {
+	required := config.GetSettings().EventPoolMinHealthy
+	if required <= 0 || config.CustomHeaderKeyEnabled || !config.EventsEnabled() {
+		return false
+	}
+	health, _, err := credentialPoolHealth()
+	if err != nil {
+		// 状态后端不可用时保持原状态
+		return wasUnhealthy
+	}
+	healthy := 0
+	for _, h := range health {
+		if h.usable() {
+			healthy++
+		}
+	}
+	unhealthy := healthy < required
+	if unhealthy && !wasUnhealthy {
+		config.PublishEvent(events.PoolUnhealthy,
+			fmt.Sprintf("only %d of %d credentials are usable (required %d)", healthy, len(health), required),
+			map[string]any{"healthy": healthy, "total": len(health), "required": required})
+	}
+	return unhealthy
+}
+
+// removeCredential 将凭证标记为失效并检查凭证池
+func removeCredential(cookie, reason string) {
+	config.RemoveCookie(cookie, reason)
+	notifyPoolChange()
+}
+
+// exhaustCredential 凭证用量超出上游限制, 与未登录一样标记为失效
+func exhaustCredential(cookie, modelId string) {
+	if !config.CustomHeaderKeyEnabled {
+		config.PublishEvent(events.CredentialQuotaExhausted,
+			fmt.Sprintf("credential %s exceeded the usage limit of %s", config.CredentialName(cookie), modelId),
+			map[string]any{
+				"credential": config.CredentialName(cookie),
+				"key":        config.CredentialKey(cookie),
+				"model":      modelId,
+			})
+	}
+	removeCredential(cookie, "usage limit exceeded")
+}
+
+type upstreamError struct {
+	time   time.Time
+	reason string
+}
+
+// 上游错误的滑动窗口, 达到 EVENT_ERROR_SPIKE_COUNT 时通知, 一个窗口内最多通知一次
+var upstreamErrors struct {
+	sync.Mutex
+	recent   []upstreamError
+	notified time.Time
+}
+
+// recordUpstreamError 记录一次上游错误(服务端错误、请求失败等, 不含凭证限流)
+func recordUpstreamError(reason string) {
+	settings := config.GetSettings()
+	threshold := settings.EventErrorSpikeCount
+	if threshold <= 0 || !config.EventsEnabled() {
+		return
+	}
+	window := time.Duration(settings.EventErrorSpikeWindow) * time.Second
+	now := time.Now()
+
+	upstreamErrors.Lock()
+	defer upstreamErrors.Unlock()
+	start := 0
+	for start < len(upstreamErrors.recent) && now.Sub(upstreamErrors.recent[start].time) > window {
+		start++
+	}
+	upstreamErrors.recent = append(upstreamErrors.recent[start:], upstreamError{time: now, reason: reason})
+	if len(upstreamErrors.recent) < threshold || now.Sub(upstreamErrors.notified) < window {
+		return
+	}
+	upstreamErrors.notified = now
+	reasons := make(map[string]int)
+	for _, e := range upstreamErrors.recent {
+		reasons[e.reason]++
+	}
+	config.PublishEvent(events.UpstreamErrorSpike,
+		fmt.Sprintf("%d upstream errors in the last %s", len(upstreamErrors.recent), window),
+		map[string]any{"errors": len(upstreamErrors.recent), "window_seconds": settings.EventErrorSpikeWindow, "reasons": reasons})
+}
+
+var keyBudgetNotified sync.Map // API-KEY 标识 -> 上次通知时间
+
+// publishKeyBudgetExceeded API-KEY 超出每分钟 token 额度, 同一 API-KEY 每分钟最多通知一次
+func publishKeyBudgetExceeded(key string, limit int, requested int64) {
+	if !strings.HasPrefix(key, "key-") || !config.EventsEnabled() {
+		return
+	}
+	now := time.Now()
+	if last, ok := keyBudgetNotified.Load(key); ok && now.Sub(last.(time.Time)) < keyBudgetNotifyInterval {
+		return
+	}
+	keyBudgetNotified.Store(key, now)
+	config.PublishEvent(events.KeyBudgetExceeded,
+		fmt.Sprintf("API key %s exceeded its token budget: limit %d per minute, requested %d", key, limit, requested),
+		map[string]any{"key": key, "tokens_per_minute": limit, "requested": requested})
+}
+
+// TestEvent 向所有 webhook 发送测试事件, 不受 webhook 的 events 过滤
+func TestEvent(c *gin.Context) {
+	if !config.EventsEnabled() {
+		common.SendResponse(c, http.StatusBadRequest, 1, "no event webhook configured", nil)
+		return
+	}
+	config.PublishEvent(events.Test, "test event from rovo2api", nil)
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{"webhooks": config.GetEventWebhooks()})
+}
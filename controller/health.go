@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	"rovo2api/common/shutdown"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	upstreamProbeInterval = 10 * time.Second // 上游连通性检查结果的缓存时间
+	upstreamProbeTimeout  = 3 * time.Second
+)
+
+// 凭证健康状态
+const (
+	credentialHealthy   = "healthy"   // 所有模型可用
+	credentialDegraded  = "degraded"  // 部分模型冷却中
+	credentialExhausted = "exhausted" // 所有模型冷却中
+	credentialInvalid   = "invalid"   // 未登录或被禁止访问
+	credentialDisabled  = "disabled"  // 手动停用
+)
+
+type credentialHealth struct {
+	Name          string     `json:"name"`
+	Key           string     `json:"key"`
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason,omitempty"`       // 失效原因
+	CoolingModels int        `json:"cooling_models"`         // 冷却中的模型数
+	AvailableAt   *time.Time `json:"available_at,omitempty"` // 所有模型均冷却时, 最早恢复的时间
+	Inflight      int        `json:"inflight"`
+	RequestsToday int64      `json:"requests_today"`
+	TokensToday   int64      `json:"tokens_today"`
+}
+
+// usable 至少可用于一个模型
+func (h credentialHealth) usable() bool {
+	return h.Status == credentialHealthy || h.Status == credentialDegraded
+}
+
+type modelAvailability struct {
+	Model     string `json:"model"`
+	Available int    `json:"available"` // 未失效且该模型未冷却的凭证数
+	Total     int    `json:"total"`
+}
+
+type upstreamCheck struct {
+	OK        bool      `json:"ok"`
+	Target    string    `json:"target"` // 配置了代理时为代理地址
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type readiness struct {
+	Ready       bool `json:"ready"`
+	Draining    bool `json:"draining"`
+	Credentials struct {
+		OK       bool   `json:"ok"`
+		Healthy  int    `json:"healthy"`
+		Required int    `json:"required"`
+		Error    string `json:"error,omitempty"`
+	} `json:"credentials"`
+	Upstream *upstreamCheck `json:"upstream,omitempty"`
+}
+
+var upstreamProbe struct {
+	sync.Mutex
+	result upstreamCheck
+}
+
+// 建立到上游(配置了代理时为代理)的 TCP 连接, 结果缓存 upstreamProbeInterval
+func probeUpstream() upstreamCheck {
+	upstreamProbe.Lock()
+	defer upstreamProbe.Unlock()
+	if time.Since(upstreamProbe.result.CheckedAt) < upstreamProbeInterval {
+		return upstreamProbe.result
+	}
+
+	settings := config.GetSettings()
+	raw := settings.RovoApiBaseUrl
+	if settings.ProxyUrl != "" {
+		raw = settings.ProxyUrl
+	}
+	result := upstreamCheck{CheckedAt: time.Now()}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		result.Error = "invalid url"
+		upstreamProbe.result = result
+		return result
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[u.Scheme]
+	}
+	result.Target = net.JoinHostPort(u.Hostname(), port)
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", result.Target, upstreamProbeTimeout)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		_ = conn.Close()
+		result.OK = true
+	}
+	upstreamProbe.result = result
+	return result
+}
+
+// 未启用别名的模型列表, 与凭证冷却记录的模型一致
+func credentialModels() []string {
+	var models []string
+	for _, entry := range config.GetModelEntries() {
+		if entry.Name == entry.Info.ID {
+			models = append(models, entry.Info.ID)
+		}
+	}
+	return models
+}
+
+// 汇总各凭证的健康状态及各模型可用的凭证数
+func credentialPoolHealth() ([]credentialHealth, []modelAvailability, error) {
+	statuses, err := config.GetCredentialStatuses()
+	if err != nil {
+		return nil, nil, err
+	}
+	models := credentialModels()
+	availability := make([]modelAvailability, len(models))
+	for i, modelId := range models {
+		availability[i] = modelAvailability{Model: modelId, Total: len(statuses)}
+	}
+
+	now := time.Now()
+	health := make([]credentialHealth, 0, len(statuses))
+	for _, status := range statuses {
+		h := credentialHealth{
+			Name:          status.Name,
+			Key:           status.Key,
+			Inflight:      status.Inflight,
+			RequestsToday: status.RequestsToday,
+			TokensToday:   status.TokensToday,
+		}
+		for i, modelId := range models {
+			until, cooling := status.Cooldowns[modelId]
+			if cooling && until.After(now) {
+				h.CoolingModels++
+				if h.AvailableAt == nil || until.Before(*h.AvailableAt) {
+					h.AvailableAt = &until
+				}
+			} else if status.Invalid == "" {
+				availability[i].Available++
+			}
+		}
+		switch {
+		case status.Invalid == config.CredentialDisabled:
+			h.Status = credentialDisabled
+		case status.Invalid != "":
+			h.Status, h.Reason = credentialInvalid, status.Invalid
+		case h.CoolingModels == 0:
+			h.Status = credentialHealthy
+		case h.CoolingModels < len(models):
+			h.Status = credentialDegraded
+		default:
+			h.Status = credentialExhausted
+		}
+		if h.Status != credentialExhausted {
+			h.AvailableAt = nil
+		}
+		health = append(health, h)
+	}
+	return health, availability, nil
+}
+
+// 就绪条件: 未在关闭中、可用凭证数不少于 READY_MIN_CREDENTIALS(凭证由请求头传入时不检查)、可连接上游
+func checkReadiness(health []credentialHealth, healthErr error) readiness {
+	var r readiness
+	r.Draining = shutdown.Draining()
+
+	settings := config.GetSettings()
+	r.Credentials.Required = settings.ReadyMinCredentials
+	if config.CustomHeaderKeyEnabled {
+		r.Credentials.Required = 0
+	}
+	for _, h := range health {
+		if h.usable() {
+			r.Credentials.Healthy++
+		}
+	}
+	if healthErr != nil {
+		r.Credentials.Error = healthErr.Error()
+	}
+	r.Credentials.OK = healthErr == nil && r.Credentials.Healthy >= r.Credentials.Required
+
+	r.Ready = !r.Draining && r.Credentials.OK
+	if settings.ReadyCheckUpstream {
+		upstream := probeUpstream()
+		r.Upstream = &upstream
+		r.Ready = r.Ready && upstream.OK
+	}
+	return r
+}
+
+// Healthz 存活检查, 进程能处理请求即返回 200
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz 就绪检查, 凭证池耗尽、上游不可达或正在关闭时返回 503, 供负载均衡摘除实例
+func Readyz(c *gin.Context) {
+	health, _, err := credentialPoolHealth()
+	r := checkReadiness(health, err)
+	status := http.StatusOK
+	if !r.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, r)
+}
+
+// Status 运行状态: 版本、运行时长、就绪检查、各模型可用的凭证数及各凭证的健康状态
+func Status(c *gin.Context) {
+	health, availability, err := credentialPoolHealth()
+	if err != nil {
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	scheduler := requestScheduler.Stats()
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"version":       common.Version,
+		"started_at":    time.Unix(common.StartTime, 0),
+		"uptime":        time.Now().Unix() - common.StartTime,
+		"state_backend": config.State.Name(),
+		"readiness":     checkReadiness(health, nil),
+		"inflight":      shutdown.Inflight(),
+		"running":       scheduler.Running,
+		"queued":        scheduler.Queued,
+		"models":        availability,
+		"credentials":   health,
+	})
+}
@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"rovo2api/common"
+	"rovo2api/common/config"
+	"rovo2api/common/helper"
+	logger "rovo2api/common/loggger"
+	"rovo2api/hook"
+	"rovo2api/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 内置插件
+func init() {
+	hook.Register(promptHook{})
+	hook.Register(piiHook{})
+	hook.Register(stopHook{})
+	config.HookRegistered = func(name string) bool {
+		return hook.Lookup(name) != nil
+	}
+}
+
+const hookChainKey = "hook_chain"
+
+// 保存在插件上下文中的 gin.Context, 供内置插件写入审计记录等
+type ginContextKey struct{}
+
+// 内置插件使用的 gin.Context
+func hookGinContext(req *hook.Request) *gin.Context {
+	c, _ := req.Value(ginContextKey{}).(*gin.Context)
+	return c
+}
+
+// 本次请求的插件上下文及启用的插件; 在 pre_upstream 阶段之前为空
+func requestHooks(c *gin.Context) (*hook.Request, hook.Chain) {
+	value, ok := c.Get(helper.HookRequestKey)
+	if !ok {
+		return nil, nil
+	}
+	chain, _ := c.Get(hookChainKey)
+	hooks, _ := chain.(hook.Chain)
+	return value.(*hook.Request), hooks
+}
+
+// runRequestHooks 按校验后的 API-KEY 选择插件并执行 pre_upstream 阶段修改请求, 返回是否继续请求
+func runRequestHooks(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) bool {
+	keyID := requestKeyID(c)
+	var req *hook.Request
+	if value, ok := c.Get(helper.HookRequestKey); ok {
+		req = value.(*hook.Request)
+		req.HTTP, req.KeyID = c.Request, keyID
+	} else {
+		req = hook.NewRequest(c.Request, c.Writer.Header(), requestRoute(c), keyID)
+		c.Set(helper.HookRequestKey, req)
+	}
+	req.ModelID = modelInfo.ID
+	req.SetValue(ginContextKey{}, c)
+
+	chain := hook.Select(config.HookNames(req.Route, keyID))
+	c.Set(hookChainKey, chain)
+	if len(chain) == 0 {
+		return true
+	}
+	logger.Debugf(c.Request.Context(), "Hooks: %s", strings.Join(hookNames(chain), ","))
+	if err := chain.PreUpstream(req, openAIReq); err != nil {
+		logger.Errorf(c.Request.Context(), "Hook failed: %v", err)
+		c.JSON(hook.ErrorResponse(err))
+		return false
+	}
+	return true
+}
+
+// runPayloadHooks 执行 pre_upstream 阶段修改发送到上游的请求体
+func runPayloadHooks(c *gin.Context, payload map[string]interface{}) error {
+	req, chain := requestHooks(c)
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain.PreUpstreamPayload(req, payload)
+}
+
+// newHookStream 创建 stream_chunk 阶段的输出处理, 没有插件处理输出时返回 nil
+func newHookStream(c *gin.Context) hook.Stream {
+	req, chain := requestHooks(c)
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain.NewStream(req)
+}
+
+// runPostCompletionHooks 执行 post_completion 阶段
+func runPostCompletionHooks(c *gin.Context, completion hook.Completion) {
+	req, chain := requestHooks(c)
+	if len(chain) == 0 {
+		return
+	}
+	chain.PostCompletion(req, completion)
+}
+
+func hookNames(chain hook.Chain) []string {
+	names := make([]string, 0, len(chain))
+	for _, h := range chain {
+		names = append(names, h.Name())
+	}
+	return names
+}
+
+// completeOutput 处理非流式请求的完整回答: 先经过 stream_chunk 阶段的插件再审核, 返回发送给客户端的内容及结束原因
+func completeOutput(c *gin.Context, content string) (string, string) {
+	if stream := newHookStream(c); stream != nil {
+		var stop bool
+		if content, stop = stream.Write(content); !stop {
+			content += stream.Flush()
+		}
+	}
+	content, blocked := moderateOutput(c, content)
+	if blocked {
+		return content, moderationFinishReason
+	}
+	return content, "stop"
+}
+
+// streamOutput 流式输出的处理: 先经过 stream_chunk 阶段的插件再审核, 为 nil 时原样输出
+type streamOutput struct {
+	hooks     hook.Stream
+	moderator *outputModerator
+	emitted   strings.Builder
+	finish    string
+}
+
+func newStreamOutput(c *gin.Context) *streamOutput {
+	hooks := newHookStream(c)
+	moderator := newOutputModerator(c)
+	if hooks == nil && moderator == nil {
+		return nil
+	}
+	return &streamOutput{hooks: hooks, moderator: moderator}
+}
+
+// write 追加上游的输出, 返回可以发送的内容及结束原因, 结束原因为空时继续输出
+func (o *streamOutput) write(delta string) (string, string) {
+	text, stop := delta, false
+	if o.hooks != nil {
+		text, stop = o.hooks.Write(delta)
+	}
+	return o.moderate(text, stop)
+}
+
+// flush 输出结束时返回剩余的内容及结束原因
+func (o *streamOutput) flush() (string, string) {
+	var text string
+	if o.hooks != nil {
+		text = o.hooks.Flush()
+	}
+	return o.moderate(text, true)
+}
+
+// 审核插件处理后的内容, final 为 true 时同时发送审核保留的内容
+func (o *streamOutput) moderate(text string, final bool) (string, string) {
+	if o.moderator != nil {
+		blocked := false
+		if text, blocked = o.moderator.write(text); !blocked && final {
+			var rest string
+			rest, blocked = o.moderator.flush()
+			text += rest
+		}
+		if blocked {
+			o.finish = moderationFinishReason
+			return "", o.finish
+		}
+	}
+	o.emitted.WriteString(text)
+	if final {
+		o.finish = "stop"
+	}
+	return text, o.finish
+}
+
+// content 已发送给客户端的内容, o 为 nil 时返回上游的原始内容
+func (o *streamOutput) content(raw string) string {
+	if o == nil {
+		return raw
+	}
+	return o.emitted.String()
+}
+
+func (o *streamOutput) isBlocked() bool {
+	return o != nil && o.finish == moderationFinishReason
+}
+
+// finishReason 回答的结束原因
+func (o *streamOutput) finishReason() string {
+	if o == nil || o.finish == "" {
+		return "stop"
+	}
+	return o.finish
+}
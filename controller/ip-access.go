@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	"rovo2api/common/ipfilter"
+	logger "rovo2api/common/loggger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetIPAccess 当前的 IP 访问控制配置, client_ip 为按受信任的代理解析出的调用方 IP
+func GetIPAccess(c *gin.Context) {
+	lists := config.GetIPAccess().Lists
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"trusted_proxies": lists.TrustedProxies,
+		"allow":           lists.Allow,
+		"deny":            lists.Deny,
+		"api":             lists.Api,
+		"admin":           lists.Admin,
+		"client_ip":       c.ClientIP(),
+	})
+}
+
+// SetIPAccess 运行时替换 IP 访问控制配置(未传的列表清空), 配置热加载或重启后恢复为配置的值.
+// 修改后调用方自身无法访问管理接口时拒绝修改
+func SetIPAccess(c *gin.Context) {
+	var req config.IPAccessLists
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+	access, err := config.ParseIPAccess(req)
+	if err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+
+	clientIP := ipfilter.ClientIP(c.Request.RemoteAddr, c.Request.Header, access.Trusted)
+	addr := ipfilter.ParseAddr(clientIP)
+	if !access.Global.Allowed(addr) || !access.Admin.Allowed(addr) {
+		common.SendResponse(c, http.StatusBadRequest, 1, fmt.Sprintf("rejected: %s would no longer be able to access the admin api", clientIP), nil)
+		return
+	}
+
+	config.SetIPAccess(access)
+	logger.SysLog(fmt.Sprintf("ip access updated by %s", clientIP))
+	GetIPAccess(c)
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"net/http"
+	"rovo2api/common"
+	logger "rovo2api/common/loggger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// GetLogLevel 当前日志级别
+func GetLogLevel(c *gin.Context) {
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"level":  logger.GetLevel(),
+		"format": logger.Format(),
+	})
+}
+
+// SetLogLevel 运行时修改日志级别, 配置热加载或重启后恢复为配置的级别
+func SetLogLevel(c *gin.Context) {
+	var req logLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Level == "" {
+		common.SendResponse(c, http.StatusBadRequest, 1, "level is required", nil)
+		return
+	}
+	if err := logger.SetLevel(req.Level); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+	logger.SysLog("log level changed to " + logger.GetLevel())
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{"level": logger.GetLevel()})
+}
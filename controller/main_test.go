@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"rovo2api/common/config"
+	"rovo2api/common/state"
+	"rovo2api/middleware"
+	"rovo2api/model"
+	"rovo2api/rovo-api/mock"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// 测试中不下载 BPE 词表
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	model.InitTokenEncoders()
+	// 启用默认的内置插件
+	if err := config.ApplyHooks(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// withSettings 修改当前的配置快照, 测试结束后恢复
+func withSettings(t *testing.T, update func(settings *config.Settings)) {
+	t.Helper()
+	previous := config.GetSettings()
+	settings := *previous
+	update(&settings)
+	config.SetSettings(&settings)
+	t.Cleanup(func() { config.SetSettings(previous) })
+}
+
+// newUpstream 启动 mock 上游并使用给定的凭证及新的状态后端, 测试结束后恢复配置
+func newUpstream(t *testing.T, cookies ...string) *mock.Server {
+	t.Helper()
+	upstream := mock.NewServer()
+	withSettings(t, func(settings *config.Settings) { settings.RovoApiBaseUrl = upstream.URL })
+	config.RVCookies = cookies
+	// 凭证的冷却及失效状态只在本测试中有效
+	previousState := config.State
+	config.State = state.NewMemory()
+	t.Cleanup(func() {
+		upstream.Close()
+		config.RVCookies = nil
+		_ = config.State.Close()
+		config.State = previousState
+	})
+	return upstream
+}
+
+type chatResult struct {
+	status int
+	header http.Header
+	body   string
+}
+
+// postChat 通过 HTTP 服务调用 ChatForOpenAI, 流式响应需要真实的连接
+func postChat(t *testing.T, body string, headers ...string) chatResult {
+	t.Helper()
+	router := gin.New()
+	router.Use(middleware.Tracing(), middleware.PreAuthHooks())
+	router.POST("/v1/chat/completions", ChatForOpenAI)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chatResult{status: resp.StatusCode, header: resp.Header, body: string(data)}
+}
+
+// streamContent 拼接流式响应中的文本, 并返回是否以 [DONE] 结束
+func streamContent(t *testing.T, body string) (string, bool) {
+	t.Helper()
+	var content strings.Builder
+	done := false
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if done {
+			t.Fatalf("data after [DONE]: %s", data)
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk model.OpenAIChatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+	}
+	return content.String(), done
+}
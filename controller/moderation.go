@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"rovo2api/common/config"
+	logger "rovo2api/common/loggger"
+	"rovo2api/common/moderation"
+	"rovo2api/model"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 响应头, 内容审核命中时说明阶段、处理方式及类别, 如 stage=input; action=flag; categories=violence
+const moderationHeader = "X-Rovo2api-Moderation"
+
+const moderationFinishReason = "content_filter"
+
+// 消息中一段文本的位置, part 为 -1 时 content 为字符串
+type messageTextRef struct {
+	message int
+	part    int
+}
+
+// 提取消息中的文本
+func messageTexts(messages []model.OpenAIChatMessage) ([]string, []messageTextRef) {
+	var texts []string
+	var refs []messageTextRef
+	for i, msg := range messages {
+		switch content := msg.Content.(type) {
+		case string:
+			texts = append(texts, content)
+			refs = append(refs, messageTextRef{message: i, part: -1})
+		case []interface{}:
+			for j, item := range content {
+				itemMap, ok := item.(map[string]interface{})
+				if !ok || itemMap["type"] != "text" {
+					continue
+				}
+				text, _ := itemMap["text"].(string)
+				texts = append(texts, text)
+				refs = append(refs, messageTextRef{message: i, part: j})
+			}
+		}
+	}
+	return texts, refs
+}
+
+func setMessageText(messages []model.OpenAIChatMessage, ref messageTextRef, text string) {
+	if ref.part < 0 {
+		messages[ref.message].Content = text
+		return
+	}
+	if content, ok := messages[ref.message].Content.([]interface{}); ok {
+		if itemMap, ok := content[ref.part].(map[string]interface{}); ok {
+			itemMap["text"] = text
+		}
+	}
+}
+
+// 记录命中: 写入日志、审计记录, 响应尚未开始时写入响应头
+func recordModeration(c *gin.Context, stage, action string, categories []string) {
+	summary := fmt.Sprintf("stage=%s; action=%s; categories=%s", stage, action, strings.Join(categories, ","))
+	logger.Warnf(c.Request.Context(), "Moderation flagged: %s", summary)
+	if !c.Writer.Written() {
+		c.Writer.Header().Add(moderationHeader, summary)
+	}
+	if record := auditRecord(c); record != nil {
+		record.Moderation = append(record.Moderation, summary)
+	}
+}
+
+func flaggedCategories(results []moderation.Result) []string {
+	set := make(map[string]bool)
+	for _, result := range results {
+		for _, category := range result.FlaggedCategories() {
+			set[category] = true
+		}
+	}
+	categories := make([]string, 0, len(set))
+	for category := range set {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// moderateInput 审核客户端发送的消息, 返回是否继续请求
+func moderateInput(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest) bool {
+	settings := config.GetSettings()
+	action := settings.ModerationInputAction
+	engine := config.GetModerationEngine()
+	if action == moderation.ActionOff || !engine.Enabled() {
+		return true
+	}
+	texts, refs := messageTexts(openAIReq.Messages)
+	if len(texts) == 0 {
+		return true
+	}
+	results, err := engine.Classify(c.Request.Context(), texts)
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "Input moderation failed: %v", err)
+		if !settings.ModerationFailOpen {
+			c.JSON(http.StatusServiceUnavailable, model.OpenAIErrorResponse{
+				OpenAIError: model.OpenAIError{
+					Message: "Moderation service unavailable",
+					Type:    "server_error",
+					Code:    "moderation_unavailable",
+				},
+			})
+			return false
+		}
+	}
+	categories := flaggedCategories(results)
+	if len(categories) == 0 {
+		return true
+	}
+	recordModeration(c, "input", action, categories)
+
+	switch action {
+	case moderation.ActionBlock:
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: fmt.Sprintf("Input was flagged by moderation: %s", strings.Join(categories, ", ")),
+				Type:    "invalid_request_error",
+				Code:    "content_policy_violation",
+			},
+		})
+		return false
+	case moderation.ActionRedact:
+		for i, result := range results {
+			if result.Flagged {
+				setMessageText(openAIReq.Messages, refs[i], moderation.Redact(texts[i], result))
+			}
+		}
+	}
+	return true
+}
+
+// moderateOutput 审核完整的回答, 返回发送给客户端的内容及是否被拦截
+func moderateOutput(c *gin.Context, content string) (string, bool) {
+	settings := config.GetSettings()
+	action := settings.ModerationOutputAction
+	engine := config.GetModerationEngine()
+	if action == moderation.ActionOff || !engine.Enabled() || content == "" {
+		return content, false
+	}
+	results, err := engine.Classify(c.Request.Context(), []string{content})
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "Output moderation failed: %v", err)
+		if !settings.ModerationFailOpen {
+			recordModeration(c, "output", moderation.ActionBlock, []string{"moderation_unavailable"})
+			return "", true
+		}
+	}
+	result := results[0]
+	if !result.Flagged {
+		return content, false
+	}
+	recordModeration(c, "output", action, result.FlaggedCategories())
+	switch action {
+	case moderation.ActionBlock:
+		return "", true
+	case moderation.ActionRedact:
+		return moderation.Redact(content, result), false
+	}
+	return content, false
+}
+
+// outputModerator 流式输出的审核, 为 nil 时原样输出
+type outputModerator struct {
+	c          *gin.Context
+	action     string
+	failOpen   bool
+	stream     *moderation.Stream
+	categories map[string]bool
+	blocked    bool
+}
+
+func newOutputModerator(c *gin.Context) *outputModerator {
+	settings := config.GetSettings()
+	action := settings.ModerationOutputAction
+	engine := config.GetModerationEngine()
+	if action == moderation.ActionOff || !engine.Enabled() {
+		return nil
+	}
+	return &outputModerator{
+		c:          c,
+		action:     action,
+		failOpen:   settings.ModerationFailOpen,
+		stream:     engine.NewStream(settings.ModerationStreamBuffer),
+		categories: make(map[string]bool),
+	}
+}
+
+// write 追加上游的输出, 返回可以发送的内容及是否被拦截
+func (m *outputModerator) write(delta string) (string, bool) {
+	segment, err := m.stream.Write(m.c.Request.Context(), delta)
+	return m.apply(segment, err)
+}
+
+// flush 输出结束时返回剩余的内容
+func (m *outputModerator) flush() (string, bool) {
+	segment, err := m.stream.Flush(m.c.Request.Context())
+	return m.apply(segment, err)
+}
+
+func (m *outputModerator) apply(segment moderation.Segment, err error) (string, bool) {
+	if err != nil {
+		logger.Warnf(m.c.Request.Context(), "Output moderation failed: %v", err)
+		if !m.failOpen {
+			recordModeration(m.c, "output", moderation.ActionBlock, []string{"moderation_unavailable"})
+			m.blocked = true
+			return "", true
+		}
+	}
+	text := segment.Text
+	if segment.Result.Flagged {
+		// 同一响应中只在出现新的类别时记录
+		var added []string
+		for _, category := range segment.Result.FlaggedCategories() {
+			if !m.categories[category] {
+				m.categories[category] = true
+				added = append(added, category)
+			}
+		}
+		if len(added) > 0 {
+			recordModeration(m.c, "output", m.action, added)
+		}
+		switch m.action {
+		case moderation.ActionBlock:
+			m.blocked = true
+			return "", true
+		case moderation.ActionRedact:
+			text = moderation.Redact(text, segment.Result)
+		}
+	}
+	return text, false
+}
+
+// Moderations @Summary OpenAI内容审核接口
+// @Description 使用与对话接口相同的审核规则及外部分类器判定文本
+// @Tags OpenAI
+// @Accept json
+// @Produce json
+// @Param req body model.OpenAIModerationRequest true "OpenAI内容审核请求"
+// @Param Authorization header string true "Authorization API-KEY"
+// @Success 200 {object} model.OpenAIModerationResponse "成功"
+// @Router /v1/moderations [post]
+func Moderations(c *gin.Context) {
+	var req model.OpenAIModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: "Invalid request parameters",
+				Type:    "invalid_request_error",
+				Code:    "invalid_request",
+			},
+		})
+		return
+	}
+	texts, err := req.Texts()
+	if err != nil || len(texts) == 0 {
+		message := "input is required"
+		if err != nil {
+			message = err.Error()
+		}
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: message,
+				Type:    "invalid_request_error",
+				Code:    "invalid_input",
+			},
+		})
+		return
+	}
+
+	results, err := config.GetModerationEngine().Classify(c.Request.Context(), texts)
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "Moderation failed: %v", err)
+		if !config.GetSettings().ModerationFailOpen {
+			c.JSON(http.StatusBadGateway, model.OpenAIErrorResponse{
+				OpenAIError: model.OpenAIError{
+					Message: "Moderation service unavailable",
+					Type:    "server_error",
+					Code:    "moderation_unavailable",
+				},
+			})
+			return
+		}
+	}
+
+	modelName := req.Model
+	if modelName == "" {
+		modelName = "rovo2api-moderation"
+	}
+	response := model.OpenAIModerationResponse{
+		ID:      fmt.Sprintf("modr-%s", time.Now().Format("20060102150405")),
+		Model:   modelName,
+		Results: make([]model.OpenAIModerationResult, 0, len(results)),
+	}
+	for _, result := range results {
+		response.Results = append(response.Results, model.OpenAIModerationResult{
+			Flagged:        result.Flagged,
+			Categories:     result.Categories,
+			CategoryScores: result.CategoryScores,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
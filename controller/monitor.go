@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	"rovo2api/common/helper"
+	"rovo2api/common/monitor"
+	"rovo2api/model"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const monitorRequestKey = "rovo2api_monitor_request"
+
+// 当前实例的请求监控, 供管理面板展示
+var requestMonitor = monitor.New(monitor.Options{Recent: 200, Retention: 24 * time.Hour})
+
+// usageWindows 用量图表支持的时间范围及对应的汇总粒度
+var usageWindows = map[string]time.Duration{
+	"1h":  time.Minute,
+	"6h":  5 * time.Minute,
+	"24h": 15 * time.Minute,
+}
+
+// startMonitor 记录进行中的请求, 返回的函数在请求结束时计入最近请求及用量统计
+func startMonitor(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) func() {
+	r := &monitor.Request{
+		ID:     c.GetString(helper.RequestIdKey),
+		Time:   time.Now(),
+		Key:    c.GetString(helper.RateLimitKey),
+		Model:  openAIReq.Model,
+		Stream: openAIReq.Stream,
+	}
+	requestMonitor.Start(r)
+	c.Set(monitorRequestKey, r)
+
+	return func() {
+		requestMonitor.Finish(r, func(r *monitor.Request) {
+			r.Status = c.Writer.Status()
+			r.Cache = c.Writer.Header().Get(cacheHeader)
+			r.UsedModel = c.Writer.Header().Get("X-Rovo2api-Fallback")
+			r.Error = r.Error || r.Status >= 400
+		})
+	}
+}
+
+func monitorUpdate(c *gin.Context, update func(r *monitor.Request)) {
+	if value, ok := c.Get(monitorRequestKey); ok {
+		requestMonitor.Update(value.(*monitor.Request), update)
+	}
+}
+
+// MonitorRequests 当前实例进行中及最近完成的请求
+func MonitorRequests(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"live":   requestMonitor.Live(),
+		"recent": requestMonitor.Recent(limit),
+	})
+}
+
+// MonitorUsage 当前实例按调用方及模型统计的用量, window 为 1h、6h 或 24h
+func MonitorUsage(c *gin.Context) {
+	window := c.DefaultQuery("window", "1h")
+	step, ok := usageWindows[window]
+	if !ok {
+		common.SendResponse(c, http.StatusBadRequest, 1, "window must be one of 1h, 6h, 24h", nil)
+		return
+	}
+	duration, _ := time.ParseDuration(window)
+	common.SendResponse(c, http.StatusOK, 0, "success", requestMonitor.Usage(duration, step))
+}
+
+// DashboardConfig 当前生效的配置, 密钥及凭证不返回原值
+func DashboardConfig(c *gin.Context) {
+	common.SendResponse(c, http.StatusOK, 0, "success", config.EffectiveConfig())
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"fmt"
+	"rovo2api/common/config"
+	logger "rovo2api/common/loggger"
+	"rovo2api/common/pii"
+	"rovo2api/hook"
+	"rovo2api/model"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 响应头, 发送到上游前脱敏的规则及数量, 如 card=1, email=2
+const redactionsHeader = "X-Rovo2api-Redactions"
+
+// piiHook 内置插件, 发送到上游前将敏感信息替换为占位符, 并在回答中还原
+type piiHook struct{}
+
+type piiSessionKey struct{}
+
+func (piiHook) Name() string {
+	return "pii"
+}
+
+// PreUpstream 按调用方的策略创建本次请求的脱敏会话, 重试及上下文摘要共用同一会话
+func (piiHook) PreUpstream(req *hook.Request, _ *model.OpenAIChatCompletionRequest) error {
+	if session := config.GetPIIRedactor(req.KeyID).NewSession(); session != nil {
+		req.SetValue(piiSessionKey{}, session)
+	}
+	return nil
+}
+
+// 本次请求的脱敏会话, 不脱敏时为 nil
+func piiSession(req *hook.Request) *pii.Session {
+	session, _ := req.Value(piiSessionKey{}).(*pii.Session)
+	return session
+}
+
+// PreUpstreamPayload 脱敏请求体中消息的文本内容
+func (piiHook) PreUpstreamPayload(req *hook.Request, payload map[string]interface{}) error {
+	session := piiSession(req)
+	if session == nil {
+		return nil
+	}
+	requestPayload, _ := payload["request_payload"].(map[string]interface{})
+	messages, _ := requestPayload["messages"].([]map[string]interface{})
+	for _, message := range messages {
+		items, _ := message["content"].([]map[string]interface{})
+		for _, item := range items {
+			if text, ok := item["text"].(string); ok && item["type"] == "text" {
+				item["text"] = session.Redact(text)
+			}
+		}
+	}
+	if c := hookGinContext(req); c != nil {
+		recordRedactions(c, session)
+	}
+	return nil
+}
+
+// NewStream PII_RESTORE 开启时将回答中的占位符还原为原文
+func (piiHook) NewStream(req *hook.Request) hook.Stream {
+	session := piiSession(req)
+	if !config.GetSettings().PIIRestore || session == nil {
+		return nil
+	}
+	return piiRestoreStream{session.NewRestorer()}
+}
+
+type piiRestoreStream struct {
+	restorer *pii.Restorer
+}
+
+func (s piiRestoreStream) Write(delta string) (string, bool) {
+	return s.restorer.Write(delta), false
+}
+
+func (s piiRestoreStream) Flush() string {
+	return s.restorer.Flush()
+}
+
+// 记录脱敏数量: 写入日志、审计记录, 响应尚未开始时写入响应头
+func recordRedactions(c *gin.Context, session *pii.Session) {
+	counts := session.Counts()
+	if len(counts) == 0 {
+		return
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, counts[name]))
+	}
+	summary := strings.Join(parts, ", ")
+	logger.Debugf(c.Request.Context(), "PII redacted: %s", summary)
+	if !c.Writer.Written() {
+		c.Writer.Header().Set(redactionsHeader, summary)
+	}
+	if record := auditRecord(c); record != nil {
+		record.Redactions = counts
+	}
+}
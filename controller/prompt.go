@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	"rovo2api/common/helper"
+	logger "rovo2api/common/loggger"
+	"rovo2api/common/prompt"
+	"rovo2api/hook"
+	"rovo2api/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 响应头, 本次请求应用的提示词策略, 多个以,分隔
+const promptPoliciesHeader = "X-Rovo2api-Prompt-Policies"
+
+type promptPoliciesRequest struct {
+	KeyNames map[string]string `json:"key_names"`
+	Policies []prompt.Policy   `json:"policies"`
+}
+
+type promptPreviewRequest struct {
+	Model    string                    `json:"model"`
+	Messages []model.OpenAIChatMessage `json:"messages"`
+	User     string                    `json:"user"`
+	Key      string                    `json:"key"`   // API-KEY 或其标识
+	Route    string                    `json:"route"` // 默认为 /v1/chat/completions
+	// 传入时预览这些策略而不是当前生效的策略
+	Policies *[]prompt.Policy  `json:"policies"`
+	KeyNames map[string]string `json:"key_names"`
+}
+
+// 接口路径, 去掉 ROUTE_PREFIX
+func requestRoute(c *gin.Context) string {
+	return config.TrimRoutePrefix(c.Request.URL.Path)
+}
+
+// 调用方 API-KEY 的标识, 未携带有效的 API-KEY 时为空
+func requestKeyID(c *gin.Context) string {
+	if keyID := c.GetString(helper.RateLimitKey); strings.HasPrefix(keyID, "key-") {
+		return keyID
+	}
+	return ""
+}
+
+// 按顺序合并策略消息: prepend/replace 的消息依次放在开头, append 的消息依次追加到末尾;
+// 存在 replace 策略时去掉客户端的 system 消息
+func mergePromptResults(messages []model.OpenAIChatMessage, results []prompt.Result) []model.OpenAIChatMessage {
+	var head, tail []model.OpenAIChatMessage
+	replace := false
+	for _, result := range results {
+		var rendered []model.OpenAIChatMessage
+		for _, message := range result.Messages {
+			rendered = append(rendered, model.OpenAIChatMessage{Role: message.Role, Content: message.Content})
+		}
+		switch result.Mode {
+		case prompt.ModeAppend:
+			tail = append(tail, rendered...)
+		case prompt.ModeReplace:
+			replace = true
+			head = append(head, rendered...)
+		default:
+			head = append(head, rendered...)
+		}
+	}
+	merged := head
+	for _, message := range messages {
+		if replace && message.Role == "system" {
+			continue
+		}
+		merged = append(merged, message)
+	}
+	return append(merged, tail...)
+}
+
+func promptPolicyNames(results []prompt.Result) []string {
+	names := make([]string, 0, len(results))
+	for _, result := range results {
+		names = append(names, result.Policy)
+	}
+	return names
+}
+
+// promptHook 内置插件, 应用匹配的提示词策略及 PRE_MESSAGES_JSON
+type promptHook struct{}
+
+func (promptHook) Name() string {
+	return "prompt"
+}
+
+// applyPromptMessages 应用策略的消息后插入 PRE_MESSAGES_JSON 的消息
+func applyPromptMessages(openAIReq *model.OpenAIChatCompletionRequest, results []prompt.Result) error {
+	openAIReq.Messages = mergePromptResults(openAIReq.Messages, results)
+	if preMessages := config.GetSettings().PreMessagesJSON; preMessages != "" {
+		if err := openAIReq.PrependMessagesFromJSON(preMessages); err != nil {
+			return fmt.Errorf("PRE_MESSAGES_JSON: %v", err)
+		}
+	}
+	return nil
+}
+
+// PreUpstream 每个请求执行一次, 重试及切换备用模型时不会重复插入消息
+func (promptHook) PreUpstream(req *hook.Request, openAIReq *model.OpenAIChatCompletionRequest) error {
+	results, err := config.GetPromptSet().Render(prompt.Request{
+		KeyID:   req.KeyID,
+		Model:   openAIReq.Model,
+		ModelID: req.ModelID,
+		Route:   req.Route,
+		User:    openAIReq.User,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render prompt policies: %v", err)
+	}
+	if err := applyPromptMessages(openAIReq, results); err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	names := strings.Join(promptPolicyNames(results), ",")
+	logger.Debugf(req.Context(), "Applied prompt policies: %s", names)
+	req.Header.Set(promptPoliciesHeader, names)
+	return nil
+}
+
+// 以标识代替 API-KEY, 避免通过管理接口泄露
+func redactPromptKeys(policies []prompt.Policy, keyNames map[string]string) promptPoliciesRequest {
+	redact := prompt.KeyID
+	result := promptPoliciesRequest{KeyNames: make(map[string]string, len(keyNames)), Policies: make([]prompt.Policy, 0, len(policies))}
+	for key, name := range keyNames {
+		result.KeyNames[redact(key)] = name
+	}
+	for _, policy := range policies {
+		keys := make([]string, 0, len(policy.Keys))
+		for _, key := range policy.Keys {
+			keys = append(keys, redact(key))
+		}
+		if len(keys) > 0 {
+			policy.Keys = keys
+		}
+		result.Policies = append(result.Policies, policy)
+	}
+	return result
+}
+
+// GetPromptPolicies 当前的提示词策略, API-KEY 以标识代替
+func GetPromptPolicies(c *gin.Context) {
+	common.SendResponse(c, http.StatusOK, 0, "success", redactPromptKeys(config.GetPromptPolicies()))
+}
+
+// SetPromptPolicies 运行时替换提示词策略, 配置热加载或重启后恢复为配置的值
+func SetPromptPolicies(c *gin.Context) {
+	var req promptPoliciesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+	if errs := config.SetPromptPolicies(req.Policies, req.KeyNames); len(errs) > 0 {
+		common.SendResponse(c, http.StatusBadRequest, 1, strings.Join(errs, "; "), errs)
+		return
+	}
+	logger.SysLog(fmt.Sprintf("prompt policies updated by %s", c.ClientIP()))
+	GetPromptPolicies(c)
+}
+
+// PreviewPrompt 预览应用提示词策略及 PRE_MESSAGES_JSON 后发送给上游的消息列表
+func PreviewPrompt(c *gin.Context) {
+	var req promptPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+	modelInfo, ok := common.GetModelInfo(req.Model)
+	if !ok {
+		common.SendResponse(c, http.StatusBadRequest, 1, fmt.Sprintf("model %s not supported", req.Model), nil)
+		return
+	}
+	set := config.GetPromptSet()
+	if req.Policies != nil {
+		var errs []string
+		if set, errs = prompt.Compile(*req.Policies, req.KeyNames); len(errs) > 0 {
+			common.SendResponse(c, http.StatusBadRequest, 1, strings.Join(errs, "; "), errs)
+			return
+		}
+	}
+	if req.Route == "" {
+		req.Route = "/v1/chat/completions"
+	}
+	results, err := set.Render(prompt.Request{Key: req.Key, Model: req.Model, ModelID: modelInfo.ID, Route: req.Route, User: req.User})
+	if err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+
+	openAIReq := model.OpenAIChatCompletionRequest{Model: req.Model, Messages: req.Messages}
+	if err := applyPromptMessages(&openAIReq, results); err != nil {
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"policies": promptPolicyNames(results),
+		"messages": openAIReq.Messages,
+		"tokens":   model.CountTokenMessages(openAIReq.Messages, req.Model),
+	})
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"rovo2api/common/config"
+	"rovo2api/hook"
+	"rovo2api/model"
+)
+
+func TestPromptHookPreMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		preMessages string
+		messages    []model.OpenAIChatMessage
+		want        []model.OpenAIChatMessage
+		wantErr     bool
+	}{
+		{
+			name:     "not set",
+			messages: []model.OpenAIChatMessage{{Role: "user", Content: "hi"}},
+			want:     []model.OpenAIChatMessage{{Role: "user", Content: "hi"}},
+		},
+		{
+			name:        "inserted after the last system message",
+			preMessages: `[{"role":"user","content":"pre"}]`,
+			messages:    []model.OpenAIChatMessage{{Role: "system", Content: "sys"}, {Role: "user", Content: "hi"}},
+			want:        []model.OpenAIChatMessage{{Role: "system", Content: "sys"}, {Role: "user", Content: "pre"}, {Role: "user", Content: "hi"}},
+		},
+		{
+			name:        "invalid JSON",
+			preMessages: `[{`,
+			messages:    []model.OpenAIChatMessage{{Role: "user", Content: "hi"}},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSettings(t, func(settings *config.Settings) { settings.PreMessagesJSON = tt.preMessages })
+			httpReq := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			req := hook.NewRequest(httpReq, http.Header{}, "/v1/chat/completions", "")
+			original := append([]model.OpenAIChatMessage(nil), tt.messages...)
+			openAIReq := model.OpenAIChatCompletionRequest{Model: testModel, Messages: tt.messages}
+
+			err := promptHook{}.PreUpstream(req, &openAIReq)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(openAIReq.Messages, tt.want) {
+				t.Fatalf("messages = %v, want %v", openAIReq.Messages, tt.want)
+			}
+			if !reflect.DeepEqual(tt.messages, original) {
+				t.Fatalf("client messages were modified: %v", tt.messages)
+			}
+		})
+	}
+}
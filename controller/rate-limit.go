@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	"rovo2api/common/helper"
+	"rovo2api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tokenReservationKey = "rovo2api_token_reservation"
+
+// tokenReservation 按估算的提示词 token 数预留的每分钟 token 额度, 请求结束时按实际用量结算
+type tokenReservation struct {
+	key      string
+	limit    int
+	reserved int64
+	used     int64
+}
+
+// 预留 token 额度, 额度不足时返回 429 及 false
+func reserveTokens(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) (*tokenReservation, bool) {
+	limit := config.GetSettings().TokenRateLimitNum
+	if limit <= 0 {
+		return nil, true
+	}
+	key := c.GetString(helper.RateLimitKey)
+	if key == "" {
+		key = "ip-" + c.ClientIP()
+	}
+	reservation := &tokenReservation{
+		key:      "tpm:" + key,
+		limit:    limit,
+		reserved: int64(model.CountTokenMessages(openAIReq.Messages, openAIReq.Model)),
+	}
+	result, ok := config.TakeRateLimit(reservation.key, limit, reservation.reserved, false)
+	if !ok {
+		return nil, true
+	}
+	common.SetRateLimitHeaders(c, "tokens", limit, result)
+	if !result.Allowed {
+		publishKeyBudgetExceeded(key, limit, reservation.reserved)
+		c.JSON(http.StatusTooManyRequests, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: fmt.Sprintf("每分钟token数超出限制: 限制 %d, 本次请求约 %d", limit, reservation.reserved),
+				Type:    "tokens",
+				Code:    "rate_limit_exceeded",
+			},
+		})
+		return nil, false
+	}
+	c.Set(tokenReservationKey, reservation)
+	return reservation, true
+}
+
+// 记录本次请求实际的 token 用量
+func recordTokenUsage(c *gin.Context, tokens int) {
+	if value, ok := c.Get(tokenReservationKey); ok {
+		value.(*tokenReservation).used = int64(tokens)
+	}
+}
+
+// settle 按实际用量结算, 超出预留的部分继续扣减; 请求失败未产生用量时归还预留的额度
+func (r *tokenReservation) settle() {
+	if r == nil {
+		return
+	}
+	if delta := r.used - r.reserved; delta != 0 {
+		config.TakeRateLimit(r.key, r.limit, delta, true)
+	}
+}
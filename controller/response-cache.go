@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/cache"
+	"rovo2api/common/config"
+	logger "rovo2api/common/loggger"
+	"rovo2api/model"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	cacheHeader     = "X-Rovo2api-Cache"
+	cacheHit        = "HIT"
+	cacheMiss       = "MISS"
+	cacheBypass     = "BYPASS"
+	cacheRefresh    = "REFRESH"
+	replayChunkSize = 16 // 缓存回放时每个SSE事件的字符数
+)
+
+var (
+	responseCache     *cache.Cache
+	responseCacheOnce sync.Once
+)
+
+// 首次使用时按当前配置创建缓存, 大小及目录的修改需重启后生效
+func getResponseCache() *cache.Cache {
+	responseCacheOnce.Do(func() {
+		c, err := cache.New(cache.Options{
+			MaxEntries:   config.ResponseCacheMaxEntries,
+			MaxBytes:     int64(config.ResponseCacheMaxBytes),
+			Dir:          config.ResponseCacheDir,
+			DiskMaxBytes: int64(config.ResponseCacheDiskMaxBytes),
+		})
+		if err != nil {
+			logger.SysError(fmt.Sprintf("response cache disabled, failed to open %s: %s", config.ResponseCacheDir, err.Error()))
+			return
+		}
+		responseCache = c
+	})
+	return responseCache
+}
+
+// cachedCompletion 缓存的对话结果
+type cachedCompletion struct {
+	Model            string `json:"model"`
+	Content          string `json:"content"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
+
+// responseCacheState 单个请求的缓存状态
+type responseCacheState struct {
+	key   string
+	read  bool
+	write bool
+}
+
+// 根据配置及请求头决定是否使用缓存:
+// Cache-Control: no-store 或 X-Rovo2api-Cache: bypass 跳过缓存;
+// Cache-Control: no-cache 或 X-Rovo2api-Cache: refresh 忽略已有缓存并写入新结果
+func newResponseCacheState(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) *responseCacheState {
+	settings := config.GetSettings()
+	if !settings.ResponseCacheEnabled || getResponseCache() == nil {
+		return nil
+	}
+	// 只缓存确定性的请求
+	if openAIReq.Temperature != 0 {
+		c.Header(cacheHeader, cacheBypass)
+		return nil
+	}
+
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	directive := strings.ToLower(strings.TrimSpace(c.GetHeader(cacheHeader)))
+	state := &responseCacheState{read: true, write: true}
+	if strings.Contains(cacheControl, "no-store") || directive == "bypass" {
+		c.Header(cacheHeader, cacheBypass)
+		return nil
+	}
+	if strings.Contains(cacheControl, "no-cache") || directive == "refresh" {
+		state.read = false
+	}
+
+	maxTokens := openAIReq.MaxTokens
+	if maxTokens <= 1 {
+		maxTokens = min(8192, modelInfo.MaxOutputTokens)
+	}
+	key, err := cache.Key(map[string]interface{}{
+		"model":             modelInfo.ID,
+		"messages":          openAIReq.Messages,
+		"temperature":       openAIReq.Temperature,
+		"top_p":             openAIReq.TopP,
+		"max_tokens":        maxTokens,
+		"frequency_penalty": openAIReq.FrequencyPenalty,
+		"presence_penalty":  openAIReq.PresencePenalty,
+		"stop":              openAIReq.StopSequences(),
+		"reasoning_hide":    settings.ReasoningHide,
+	})
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "response cache key err: %v", err)
+		return nil
+	}
+	state.key = key
+	if state.read {
+		c.Header(cacheHeader, cacheMiss)
+	} else {
+		c.Header(cacheHeader, cacheRefresh)
+	}
+	return state
+}
+
+// 命中缓存时直接返回结果, 返回 true 表示请求已处理
+func (s *responseCacheState) serve(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) bool {
+	if s == nil || !s.read {
+		return false
+	}
+	entry, source, ok := getResponseCache().Get(s.key)
+	if !ok {
+		return false
+	}
+	var completion cachedCompletion
+	if err := json.Unmarshal(entry.Value, &completion); err != nil {
+		getResponseCache().Delete(s.key)
+		return false
+	}
+	logger.Debugf(c.Request.Context(), "response cache hit (%s): %s", source, s.key)
+
+	auditResult(c, completion.Content, completion.PromptTokens, completion.CompletionTokens)
+	c.Header(cacheHeader, cacheHit)
+	c.Header("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+	responseId := fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405"))
+
+	if !openAIReq.Stream {
+		finishReason := "stop"
+		c.JSON(http.StatusOK, model.OpenAIChatCompletionResponse{
+			ID:      responseId,
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   openAIReq.Model,
+			Choices: []model.OpenAIChoice{{
+				Message: model.OpenAIMessage{
+					Role:    "assistant",
+					Content: completion.Content,
+				},
+				FinishReason: &finishReason,
+			}},
+			Usage: model.OpenAIUsage{
+				PromptTokens:     completion.PromptTokens,
+				CompletionTokens: completion.CompletionTokens,
+				TotalTokens:      completion.PromptTokens + completion.CompletionTokens,
+			},
+		})
+		return true
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	jsonData, _ := json.Marshal(openAIReq)
+	runes := []rune(completion.Content)
+	for start := 0; start < len(runes); start += replayChunkSize {
+		end := min(start+replayChunkSize, len(runes))
+		if err := handleDelta(c, string(runes[start:end]), responseId, openAIReq.Model, jsonData); err != nil {
+			return true
+		}
+	}
+	handleMessageResult(c, responseId, openAIReq.Model, jsonData, "stop")
+	return true
+}
+
+// 保存上游返回的完整结果
+func (s *responseCacheState) store(openAIReq model.OpenAIChatCompletionRequest, content string, promptTokens, completionTokens int) {
+	if s == nil || !s.write || content == "" {
+		return
+	}
+	value, err := json.Marshal(cachedCompletion{
+		Model:            openAIReq.Model,
+		Content:          content,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+	})
+	if err != nil {
+		return
+	}
+	getResponseCache().Set(s.key, value, time.Duration(config.GetSettings().ResponseCacheTTL)*time.Second)
+}
+
+// ResponseCacheStats 响应缓存统计
+func ResponseCacheStats(c *gin.Context) {
+	enabled := config.GetSettings().ResponseCacheEnabled
+	stats := cache.Stats{}
+	if enabled && getResponseCache() != nil {
+		stats = getResponseCache().Stats()
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", gin.H{
+		"enabled": enabled,
+		"stats":   stats,
+	})
+}
+
+// PurgeResponseCache 清空响应缓存
+func PurgeResponseCache(c *gin.Context) {
+	if getResponseCache() != nil {
+		getResponseCache().Purge()
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", nil)
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"rovo2api/common/cache"
+	"rovo2api/common/config"
+	"rovo2api/rovo-api/mock"
+)
+
+// withResponseCache 开启响应缓存并使用新的内存缓存, 测试结束后恢复
+func withResponseCache(t *testing.T) *cache.Cache {
+	t.Helper()
+	getResponseCache()
+	previous := responseCache
+	c, err := cache.New(cache.Options{MaxEntries: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseCache = c
+	t.Cleanup(func() { responseCache = previous })
+	withSettings(t, func(settings *config.Settings) { settings.ResponseCacheEnabled = true })
+	return c
+}
+
+// 第二次相同的请求直接由缓存返回, 不再请求上游
+func TestResponseCacheHit(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%t", stream), func(t *testing.T) {
+			responses := withResponseCache(t)
+			credential := fmt.Sprintf("cache-hit-%t@example.com:token", stream)
+			upstream := newUpstream(t, credential)
+			upstream.Script(credential, mock.Reply("cached", " answer"), mock.Reply("fresh answer"))
+
+			first := postChat(t, chatBody(stream))
+			if got := first.header.Get(cacheHeader); got != cacheMiss {
+				t.Fatalf("first %s = %q, want %s", cacheHeader, got, cacheMiss)
+			}
+			if got := replyContent(t, stream, first); got != "cached answer" {
+				t.Fatalf("first content = %q", got)
+			}
+
+			second := postChat(t, chatBody(stream))
+			if got := second.header.Get(cacheHeader); got != cacheHit {
+				t.Fatalf("second %s = %q, want %s", cacheHeader, got, cacheHit)
+			}
+			if second.header.Get("Age") == "" {
+				t.Fatal("cache hit without Age header")
+			}
+			if got := replyContent(t, stream, second); got != "cached answer" {
+				t.Fatalf("second content = %q", got)
+			}
+			if got := replyFinishReason(t, stream, second); got != "stop" {
+				t.Fatalf("second finish reason = %q", got)
+			}
+			if requests := upstream.Requests(); len(requests) != 1 {
+				t.Fatalf("upstream requests = %d, want 1", len(requests))
+			}
+			if stats := responses.Stats(); stats.Stores != 1 || stats.Hits != 1 {
+				t.Fatalf("cache stats = %+v, want 1 store and 1 hit", stats)
+			}
+		})
+	}
+}
+
+// 请求头中的缓存指令: bypass 不读也不写缓存, refresh 忽略已有缓存并写入新结果
+func TestResponseCacheDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		status  string
+		// 之后的普通请求命中的内容
+		cached string
+	}{
+		{"Cache-Control no-store", []string{"Cache-Control", "no-store"}, cacheBypass, "first"},
+		{"bypass", []string{cacheHeader, "bypass"}, cacheBypass, "first"},
+		{"Cache-Control no-cache", []string{"Cache-Control", "no-cache"}, cacheRefresh, "second"},
+		{"refresh", []string{cacheHeader, " Refresh "}, cacheRefresh, "second"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withResponseCache(t)
+			credential := "cache-directive@example.com:token"
+			upstream := newUpstream(t, credential)
+			upstream.Script(credential, mock.Reply("first"), mock.Reply("second"))
+
+			if got := replyContent(t, false, postChat(t, chatBody(false))); got != "first" {
+				t.Fatalf("first content = %q", got)
+			}
+
+			result := postChat(t, chatBody(false), tt.headers...)
+			if got := result.header.Get(cacheHeader); got != tt.status {
+				t.Fatalf("%s = %q, want %s", cacheHeader, got, tt.status)
+			}
+			if got := replyContent(t, false, result); got != "second" {
+				t.Fatalf("content = %q, want the upstream answer", got)
+			}
+
+			result = postChat(t, chatBody(false))
+			if got := result.header.Get(cacheHeader); got != cacheHit {
+				t.Fatalf("next %s = %q, want %s", cacheHeader, got, cacheHit)
+			}
+			if got := replyContent(t, false, result); got != tt.cached {
+				t.Fatalf("cached content = %q, want %q", got, tt.cached)
+			}
+			if requests := upstream.Requests(); len(requests) != 2 {
+				t.Fatalf("upstream requests = %d, want 2", len(requests))
+			}
+		})
+	}
+}
+
+// 非零 temperature 的请求不使用缓存
+func TestResponseCacheSkipsNonDeterministicRequests(t *testing.T) {
+	responses := withResponseCache(t)
+	credential := "cache-temperature@example.com:token"
+	upstream := newUpstream(t, credential)
+	upstream.Script(credential, mock.Reply("random"))
+
+	body := fmt.Sprintf(`{"temperature":0.7,%s}`, testMessages)
+	for i := 0; i < 2; i++ {
+		result := postChat(t, body)
+		if got := result.header.Get(cacheHeader); got != cacheBypass {
+			t.Fatalf("%s = %q, want %s", cacheHeader, got, cacheBypass)
+		}
+		replyContent(t, false, result)
+	}
+	if requests := upstream.Requests(); len(requests) != 2 {
+		t.Fatalf("upstream requests = %d, want 2", len(requests))
+	}
+	if stats := responses.Stats(); stats.Stores != 0 {
+		t.Fatalf("cache stores = %d, want 0", stats.Stores)
+	}
+}
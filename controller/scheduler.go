@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	"rovo2api/common/helper"
+	logger "rovo2api/common/loggger"
+	"rovo2api/common/prompt"
+	"rovo2api/common/scheduler"
+	"rovo2api/common/tracing"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	priorityHeader  = "X-Rovo2api-Priority"
+	queueTimeHeader = "X-Rovo2api-Queue-Time" // 排队时间(毫秒)
+)
+
+// 并发数等配置在每次请求时更新, 以便配置热加载后立即生效
+var requestScheduler = scheduler.New(scheduler.Options{})
+
+// 请求的优先级: 配置为 batch 的 API-KEY 总是 batch, 其他请求可通过请求头降为 batch
+func requestPriority(c *gin.Context, settings *config.Settings, secret string) scheduler.Priority {
+	priority := scheduler.PriorityInteractive
+	if configured, ok := scheduler.ParsePriority(settings.SchedulerKeyPriorities[prompt.KeyID(secret)]); ok {
+		priority = configured
+	}
+	if requested, ok := scheduler.ParsePriority(c.GetHeader(priorityHeader)); ok {
+		priority = max(priority, requested)
+	}
+	return priority
+}
+
+func requestWeight(settings *config.Settings, secret string) float64 {
+	weight, err := strconv.ParseFloat(settings.SchedulerKeyWeights[prompt.KeyID(secret)], 64)
+	if err != nil || weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+// scheduleRequest 开启调度时排队等待派发, 返回释放名额的函数;
+// 队列已满或排队超时返回 503 及 false, 客户端断开时直接返回 false
+func scheduleRequest(c *gin.Context) (func(), bool) {
+	settings := config.GetSettings()
+	if settings.SchedulerMaxConcurrency <= 0 {
+		return func() {}, true
+	}
+	requestScheduler.Update(scheduler.Options{
+		MaxConcurrent:  settings.SchedulerMaxConcurrency,
+		MaxQueue:       settings.SchedulerMaxQueue,
+		MaxQueuePerKey: settings.SchedulerMaxQueuePerKey,
+	})
+
+	secret := strings.Replace(c.Request.Header.Get("Authorization"), "Bearer ", "", 1)
+	key := c.GetString(helper.RateLimitKey)
+	if key == "" {
+		key = "ip-" + c.ClientIP()
+	}
+	ticket := scheduler.Ticket{
+		Key:      key,
+		Weight:   requestWeight(settings, secret),
+		Priority: requestPriority(c, settings, secret),
+	}
+
+	ctx, span := tracing.Start(c.Request.Context(), "scheduler.wait", attribute.String("rovo2api.priority", ticket.Priority.String()))
+	defer span.End()
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(settings.SchedulerQueueTimeout)*time.Second)
+	defer cancel()
+	release, wait, err := requestScheduler.Acquire(waitCtx, ticket)
+	span.SetAttributes(attribute.Int64("rovo2api.queue_time_ms", wait.Milliseconds()))
+	if err == nil {
+		c.Header(queueTimeHeader, strconv.FormatInt(wait.Milliseconds(), 10))
+		if wait > 0 {
+			logger.Debugf(ctx, "Dispatched after queueing %dms, priority:%s", wait.Milliseconds(), ticket.Priority)
+		}
+		return release, true
+	}
+	if ctx.Err() != nil {
+		respondShutdown(c)
+		return nil, false
+	}
+
+	tracing.Fail(span, err)
+	message := "server is busy, please try again later"
+	if errors.Is(err, scheduler.ErrQueueFull) {
+		logger.Warnf(ctx, "Request shed, scheduler queue is full, priority:%s", ticket.Priority)
+	} else {
+		logger.Warnf(ctx, "Request shed after queueing %dms, priority:%s", wait.Milliseconds(), ticket.Priority)
+	}
+	// 按平均排队时间估算重试间隔
+	retryAfter := max(1, int(math.Ceil(float64(requestScheduler.Stats().AvgWaitMs)/1000)))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": message})
+	return nil, false
+}
+
+// SchedulerStats 调度器状态: 进行中及排队的请求数、排队时间
+func SchedulerStats(c *gin.Context) {
+	common.SendResponse(c, http.StatusOK, 0, "success", requestScheduler.Stats())
+}
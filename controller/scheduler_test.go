@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rovo2api/common/config"
+	"rovo2api/common/prompt"
+	"rovo2api/common/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 按 API-KEY 的标识查找配置的权重及优先级, 请求头只能降低优先级
+func TestRequestWeightAndPriority(t *testing.T) {
+	settings := &config.Settings{
+		SchedulerKeyWeights:    map[string]string{prompt.KeyID("sk-heavy"): "3"},
+		SchedulerKeyPriorities: map[string]string{prompt.KeyID("sk-batch"): "batch"},
+	}
+
+	tests := []struct {
+		secret   string
+		header   string
+		weight   float64
+		priority scheduler.Priority
+	}{
+		{"sk-heavy", "", 3, scheduler.PriorityInteractive},
+		{"sk-batch", "", 1, scheduler.PriorityBatch},
+		{"sk-batch", "interactive", 1, scheduler.PriorityBatch},
+		{"sk-other", "batch", 1, scheduler.PriorityBatch},
+		{"", "", 1, scheduler.PriorityInteractive},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if tt.header != "" {
+			c.Request.Header.Set(priorityHeader, tt.header)
+		}
+		if got := requestWeight(settings, tt.secret); got != tt.weight {
+			t.Errorf("requestWeight(%q) = %v, want %v", tt.secret, got, tt.weight)
+		}
+		if got := requestPriority(c, settings, tt.secret); got != tt.priority {
+			t.Errorf("requestPriority(%q, %q) = %s, want %s", tt.secret, tt.header, got, tt.priority)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"rovo2api/common/shutdown"
+	"rovo2api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondShutdown 请求因关闭超时被取消时结束响应: 流式响应已开始时发送错误事件, 否则返回 503; 返回是否已处理
+func respondShutdown(c *gin.Context) bool {
+	if !shutdown.Aborted(c.Request.Context()) {
+		return false
+	}
+	auditError(c, shutdown.ErrAborted.Error())
+	errResp := model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: "server is shutting down, please retry",
+			Type:    "server_error",
+			Code:    "server_shutdown",
+		},
+	}
+	if c.Writer.Written() {
+		data, _ := json.Marshal(errResp)
+		c.SSEvent("", " "+string(data))
+		c.Writer.Flush()
+		return true
+	}
+	c.Header("Retry-After", "1")
+	c.JSON(http.StatusServiceUnavailable, errResp)
+	return true
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"rovo2api/hook"
+	"rovo2api/model"
+	"strings"
+	"unicode/utf8"
+)
+
+// stopHook 内置插件, 支持请求中的 stop: 回答中出现任一停止序列时截断并结束回答
+type stopHook struct{}
+
+type stopSequencesKey struct{}
+
+func (stopHook) Name() string {
+	return "stop"
+}
+
+func (stopHook) PreUpstream(req *hook.Request, openAIReq *model.OpenAIChatCompletionRequest) error {
+	if sequences := openAIReq.StopSequences(); len(sequences) > 0 {
+		req.SetValue(stopSequencesKey{}, sequences)
+	}
+	return nil
+}
+
+func (stopHook) NewStream(req *hook.Request) hook.Stream {
+	sequences, _ := req.Value(stopSequencesKey{}).([]string)
+	if len(sequences) == 0 {
+		return nil
+	}
+	holdback := 0
+	for _, sequence := range sequences {
+		holdback = max(holdback, len(sequence)-1)
+	}
+	return &stopStream{sequences: sequences, holdback: holdback}
+}
+
+// stopStream 末尾可能是停止序列开头的部分留到下一段
+type stopStream struct {
+	sequences []string
+	holdback  int
+	pending   string
+}
+
+func (s *stopStream) Write(delta string) (string, bool) {
+	s.pending += delta
+	cut := -1
+	for _, sequence := range s.sequences {
+		if i := strings.Index(s.pending, sequence); i >= 0 && (cut < 0 || i < cut) {
+			cut = i
+		}
+	}
+	if cut >= 0 {
+		text := s.pending[:cut]
+		s.pending = ""
+		return text, true
+	}
+
+	cut = max(len(s.pending)-s.holdback, 0)
+	for cut > 0 && cut < len(s.pending) && !utf8.RuneStart(s.pending[cut]) {
+		cut--
+	}
+	text := s.pending[:cut]
+	s.pending = s.pending[cut:]
+	return text, false
+}
+
+func (s *stopStream) Flush() string {
+	text := s.pending
+	s.pending = ""
+	return text
+}
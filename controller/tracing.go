@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"context"
+	"rovo2api/common/config"
+	"rovo2api/common/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// attemptSpan 记录每次上游请求尝试(含凭证切换及备用模型), 下一次尝试开始或请求结束时结束
+type attemptSpan struct {
+	span     trace.Span
+	received bool
+}
+
+func (a *attemptSpan) start(ctx context.Context, attempt int, modelId string, cookie string) context.Context {
+	a.end()
+	ctx, a.span = tracing.Start(ctx, "upstream.attempt",
+		attribute.Int("rovo2api.attempt", attempt),
+		attribute.String("rovo2api.model", modelId),
+		attribute.String("rovo2api.credential", config.CredentialName(cookie)),
+	)
+	a.received = false
+	return ctx
+}
+
+// 收到第一个上游事件
+func (a *attemptSpan) firstEvent() {
+	if a.span != nil && !a.received {
+		a.received = true
+		a.span.AddEvent("first_token")
+	}
+}
+
+func (a *attemptSpan) fail(reason string) {
+	if a.span != nil {
+		a.span.SetStatus(codes.Error, reason)
+	}
+}
+
+func (a *attemptSpan) end() {
+	if a.span != nil {
+		a.span.End()
+		a.span = nil
+	}
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"rovo2api/common/config"
+	"rovo2api/common/tracing"
+	"rovo2api/rovo-api/mock"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector 进程内的 OTLP/HTTP 接收端, 保存收到的 span
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (col *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	col.mu.Lock()
+	for _, resourceSpans := range req.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			col.spans = append(col.spans, scopeSpans.Spans...)
+		}
+	}
+	col.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+// trace 指定链路中的 span
+func (col *collector) trace(traceID string) []*tracepb.Span {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	var spans []*tracepb.Span
+	for _, span := range col.spans {
+		if hex.EncodeToString(span.TraceId) == traceID {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func spanAttribute(span *tracepb.Span, key string) string {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			switch value := attr.Value.Value.(type) {
+			case *commonpb.AnyValue_StringValue:
+				return value.StringValue
+			case *commonpb.AnyValue_IntValue:
+				return fmt.Sprint(value.IntValue)
+			}
+		}
+	}
+	return ""
+}
+
+func hasSpanEvent(span *tracepb.Span, name string) bool {
+	for _, event := range span.Events {
+		if event.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 凭证切换时每次上游请求尝试为一个 span, 均属于请求头 traceparent 指定的链路
+func TestTracingUpstreamAttempts(t *testing.T) {
+	col := &collector{}
+	server := httptest.NewServer(col)
+	defer server.Close()
+	if err := tracing.Setup(context.Background(), tracing.Options{
+		Enabled:     true,
+		Endpoint:    server.URL,
+		ServiceName: "rovo2api-test",
+		SampleRatio: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	shutdown := func() {
+		if err := tracing.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer shutdown()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	upstream := newUpstream(t, "trace-a@example.com:token", "trace-b@example.com:token")
+	// 无论先选中哪个凭证, 第一次请求被限流
+	upstream.Sequence(mock.RateLimit(), mock.Reply("traced"))
+
+	result := postChat(t, chatBody(true), "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	if got := replyContent(t, true, result); got != "traced" {
+		t.Fatalf("content = %q", got)
+	}
+	requests := upstream.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("upstream requests = %d, want 2", len(requests))
+	}
+	// 导出剩余的 span
+	shutdown()
+
+	spans := col.trace(traceID)
+	byName := make(map[string][]*tracepb.Span)
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	roots := byName["POST /v1/chat/completions"]
+	if len(roots) != 1 {
+		t.Fatalf("server spans = %d, want 1 (spans: %v)", len(roots), byName)
+	}
+	if parent := hex.EncodeToString(roots[0].ParentSpanId); parent != "00f067aa0ba902b7" {
+		t.Fatalf("server span parent = %s, want the traceparent span", parent)
+	}
+	if len(byName["createRequestBody"]) == 0 {
+		t.Fatal("missing createRequestBody span")
+	}
+
+	attempts := byName["upstream.attempt"]
+	if len(attempts) != 2 {
+		t.Fatalf("upstream attempts = %d, want 2", len(attempts))
+	}
+	if attempts[0].StartTimeUnixNano > attempts[1].StartTimeUnixNano {
+		attempts[0], attempts[1] = attempts[1], attempts[0]
+	}
+	failed, succeeded := attempts[0], attempts[1]
+	if spanAttribute(failed, "rovo2api.attempt") != "1" || spanAttribute(succeeded, "rovo2api.attempt") != "2" {
+		t.Fatalf("attempt numbers = %s, %s", spanAttribute(failed, "rovo2api.attempt"), spanAttribute(succeeded, "rovo2api.attempt"))
+	}
+	if spanAttribute(failed, "rovo2api.credential") != config.CredentialName(requests[0].Credential) ||
+		spanAttribute(succeeded, "rovo2api.credential") != config.CredentialName(requests[1].Credential) {
+		t.Fatalf("credentials = %s, %s", spanAttribute(failed, "rovo2api.credential"), spanAttribute(succeeded, "rovo2api.credential"))
+	}
+	if failed.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || failed.Status.GetMessage() != "rate limited" {
+		t.Fatalf("failed attempt status = %v", failed.Status)
+	}
+	if succeeded.Status.GetCode() == tracepb.Status_STATUS_CODE_ERROR || !hasSpanEvent(succeeded, "first_token") {
+		t.Fatalf("successful attempt status = %v, events = %v", succeeded.Status, succeeded.Events)
+	}
+	for _, attempt := range attempts {
+		if string(attempt.ParentSpanId) != string(roots[0].SpanId) {
+			t.Fatal("upstream attempt is not a child of the server span")
+		}
+		if spanAttribute(attempt, "rovo2api.model") != testModel {
+			t.Fatalf("model = %s", spanAttribute(attempt, "rovo2api.model"))
+		}
+	}
+
+	// 每次尝试的上游 SSE 流是该次尝试的子 span
+	streams := byName["cycletls.sse"]
+	if len(streams) != 2 {
+		t.Fatalf("sse spans = %d, want 2", len(streams))
+	}
+	for _, stream := range streams {
+		if string(stream.ParentSpanId) != string(failed.SpanId) && string(stream.ParentSpanId) != string(succeeded.SpanId) {
+			t.Fatal("sse span is not a child of an upstream attempt")
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"rovo2api/common"
+	"rovo2api/common/config"
+	logger "rovo2api/common/loggger"
+	"rovo2api/cycletls"
+	"rovo2api/model"
+	rovoapi "rovo2api/rovo-api"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamResult 上游请求的最终结果
+type upstreamResult int
+
+const (
+	upstreamFinished    upstreamResult = iota // 回答已结束
+	upstreamUnfinished                        // 上游流结束但未发送结束事件
+	upstreamInterrupted                       // 已向客户端发送内容后上游出错, 不再切换凭证或备用模型
+	upstreamFailed                            // 请求失败, 尚未向客户端发送内容
+	upstreamHandled                           // 已向客户端返回响应(关闭、凭证均繁忙)
+)
+
+// upstreamAttempt 一次上游请求尝试
+type upstreamAttempt struct {
+	fallback  bool // 是否已切换到备用模型
+	modelInfo common.ModelInfo
+	cookie    string
+	jsonData  []byte
+}
+
+// upstreamOutcome 上游请求的结果; upstreamFailed 时 status 及 message 为返回客户端的错误
+type upstreamOutcome struct {
+	result  upstreamResult
+	status  int
+	message string
+	attempt *upstreamAttempt
+}
+
+// upstreamConsumer 处理上游的回答, 流式及非流式请求分别实现
+type upstreamConsumer interface {
+	// start 开始一次请求尝试, 丢弃上一次尝试未发送的内容
+	start(attempt *upstreamAttempt)
+	// consume 处理一个上游事件, 返回 false 表示回答已结束
+	consume(data string) bool
+}
+
+// upstreamDriver 依次使用备用模型及凭证请求上游, 按上游错误决定切换凭证、切换备用模型或结束请求
+type upstreamDriver struct {
+	c      *gin.Context
+	client cycletls.CycleTLS
+	span   attemptSpan
+	lease  credentialLease
+}
+
+// end 结束最后一次尝试的 span 并释放凭证, 在输出回答之后调用
+func (d *upstreamDriver) end() {
+	d.span.end()
+	d.lease.end()
+}
+
+func failedOutcome(status int, message string) upstreamOutcome {
+	return upstreamOutcome{result: upstreamFailed, status: status, message: message}
+}
+
+// run 请求上游直到回答结束或无法继续; 切换到备用模型时修改 openAIReq
+func (d *upstreamDriver) run(openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo, consumer upstreamConsumer) upstreamOutcome {
+	c := d.c
+	ctx := c.Request.Context()
+
+	chain := config.GetFallbackChain(openAIReq.Model)
+	if len(chain) == 0 {
+		chain = []config.FallbackModel{{Name: openAIReq.Model, Info: modelInfo}}
+	}
+
+	errMsg := "All cookies are temporarily unavailable."
+ModelLoop:
+	for i, candidate := range chain {
+		if i > 0 {
+			useFallbackModel(c, openAIReq, chain[i-1].Name, candidate)
+		}
+		modelInfo = candidate.Info
+		hasFallback := i < len(chain)-1
+
+		cookieManager, err := newCookieManager(c, modelInfo.ID)
+		if err != nil {
+			return failedOutcome(http.StatusBadRequest, err.Error())
+		}
+
+		maxRetries := len(cookieManager.Cookies)
+		cookie, err := d.lease.acquire(ctx, cookieManager)
+		if err != nil {
+			if credentialsBusy(c, err) {
+				return upstreamOutcome{result: upstreamHandled}
+			}
+			errMsg = err.Error()
+			continue
+		}
+		for attempt := 0; attempt < maxRetries; attempt++ {
+			requestBody, err := createRequestBody(c, *openAIReq, modelInfo)
+			if err != nil {
+				return failedOutcome(http.StatusInternalServerError, err.Error())
+			}
+			jsonData, err := json.Marshal(requestBody)
+			if err != nil {
+				return failedOutcome(http.StatusInternalServerError, "Failed to marshal request body")
+			}
+
+			current := &upstreamAttempt{fallback: i > 0, modelInfo: modelInfo, cookie: cookie, jsonData: jsonData}
+			auditCredential(c, cookie)
+			attemptCtx := d.span.start(ctx, attempt+1, modelInfo.ID, cookie)
+			sseChan, err := rovoapi.MakeStreamChatRequest(attemptCtx, d.client, jsonData, cookie, modelInfo)
+			if err != nil {
+				logger.Errorf(ctx, "MakeStreamChatRequest err on attempt %d: %v", attempt+1, err)
+				recordUpstreamError("request failed")
+				return failedOutcome(http.StatusInternalServerError, err.Error())
+			}
+			consumer.start(current)
+
+			switchCredential := false
+		SSELoop:
+			for response := range sseChan {
+				switch response.Status {
+				case http.StatusForbidden:
+					d.span.fail("forbidden")
+					removeCredential(cookie, "forbidden")
+					switchCredential = true
+					break SSELoop
+				case http.StatusUnauthorized:
+					d.span.fail("unauthorized")
+					removeCredential(cookie, "unauthorized")
+					switchCredential = true
+					break SSELoop
+				}
+
+				data := response.Data
+				if data == "" {
+					continue
+				}
+
+				if response.Done {
+					if respondShutdown(c) {
+						return upstreamOutcome{result: upstreamHandled}
+					}
+					// 已发送内容后不再切换凭证或备用模型, 否则会在同一响应中开始第二个回答
+					if c.Writer.Written() {
+						d.span.fail("interrupted")
+						recordUpstreamError("interrupted")
+						logger.Errorf(ctx, "upstream failed after the stream started, credential:%s, error:%s", config.CredentialName(cookie), data)
+						return upstreamOutcome{result: upstreamInterrupted, message: data, attempt: current}
+					}
+					switch {
+					case common.IsUsageLimitExceeded(data):
+						d.span.fail("usage limit exceeded")
+						logger.Warnf(ctx, "Cookie Usage limit exceeded, switching to next cookie, attempt %d/%d, credential:%s", attempt+1, maxRetries, config.CredentialName(cookie))
+						exhaustCredential(cookie, modelInfo.ID)
+						switchCredential = true
+						break SSELoop
+					case common.IsServerError(data):
+						d.span.fail(errServerErrMsg)
+						recordUpstreamError("server error")
+						logger.Errorf(ctx, errServerErrMsg)
+						if hasFallback {
+							continue ModelLoop
+						}
+						return failedOutcome(http.StatusInternalServerError, errServerErrMsg)
+					case common.IsNotLogin(data):
+						d.span.fail("not login")
+						logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, credential:%s", attempt+1, maxRetries, config.CredentialName(cookie))
+						switchCredential = true
+						break SSELoop
+					case common.IsRateLimit(data):
+						d.span.fail("rate limited")
+						logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, credential:%s", attempt+1, maxRetries, config.CredentialName(cookie))
+						config.AddRateLimitCookie(cookie, modelInfo.ID, time.Now().Add(time.Duration(config.GetSettings().RateLimitCookieLockDuration)*time.Second))
+						switchCredential = true
+						break SSELoop
+					}
+					d.span.fail("upstream error")
+					recordUpstreamError("upstream error")
+					logger.Warnf(ctx, data)
+					return failedOutcome(http.StatusInternalServerError, data)
+				}
+
+				logger.Debug(ctx, strings.TrimSpace(data))
+				d.span.firstEvent()
+				if !consumer.consume(data) {
+					return upstreamOutcome{result: upstreamFinished, attempt: current}
+				}
+			}
+			if respondShutdown(c) {
+				return upstreamOutcome{result: upstreamHandled}
+			}
+			if !switchCredential {
+				logger.Warnf(ctx, "upstream stream ended without a finish event, credential:%s", config.CredentialName(cookie))
+				return upstreamOutcome{result: upstreamUnfinished, attempt: current}
+			}
+
+			// 获取下一个可用的cookie继续尝试
+			cookie, err = d.lease.acquire(ctx, cookieManager)
+			if err != nil {
+				if credentialsBusy(c, err) {
+					return upstreamOutcome{result: upstreamHandled}
+				}
+				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
+				errMsg = err.Error()
+				continue ModelLoop
+			}
+		}
+		logger.Errorf(ctx, "All cookies exhausted for model %s after %d attempts", modelInfo.ID, maxRetries)
+		errMsg = "All cookies are temporarily unavailable."
+	}
+	return failedOutcome(http.StatusInternalServerError, errMsg)
+}
@@ -2,6 +2,7 @@ package cycletls
 
 import (
 	http "github.com/Danny-Dasilva/fhttp"
+	http2 "github.com/Danny-Dasilva/fhttp/http2"
 
 	"time"
 
@@ -15,6 +16,7 @@ type Browser struct {
 	Cookies            []Cookie
 	InsecureSkipVerify bool
 	forceHTTP1         bool
+	HTTP2Settings      *http2.HTTP2Settings
 }
 
 var disabledRedirect = func(req *http.Request, via []*http.Request) error {
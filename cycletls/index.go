@@ -1,11 +1,12 @@
 package cycletls
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	http "github.com/Danny-Dasilva/fhttp"
+	http2 "github.com/Danny-Dasilva/fhttp/http2"
 	"github.com/gorilla/websocket"
 	"io"
 	"log"
@@ -14,25 +15,39 @@ import (
 	"os"
 	"runtime"
 	"strings"
-	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer returns the tracer of the current global provider, so a provider set
+// (or replaced) after package initialization is used
+func tracer() trace.Tracer {
+	return otel.Tracer("rovo2api/cycletls")
+}
+
 // Options sets CycleTLS client options
 type Options struct {
-	URL                string            `json:"url"`
-	Method             string            `json:"method"`
-	Headers            map[string]string `json:"headers"`
-	Body               string            `json:"body"`
-	Ja3                string            `json:"ja3"`
-	UserAgent          string            `json:"userAgent"`
-	Proxy              string            `json:"proxy"`
-	Cookies            []Cookie          `json:"cookies"`
-	Timeout            int               `json:"timeout"`
-	DisableRedirect    bool              `json:"disableRedirect"`
-	HeaderOrder        []string          `json:"headerOrder"`
-	OrderAsProvided    bool              `json:"orderAsProvided"` //TODO
-	InsecureSkipVerify bool              `json:"insecureSkipVerify"`
-	ForceHTTP1         bool              `json:"forceHTTP1"`
+	URL                string               `json:"url"`
+	Method             string               `json:"method"`
+	Headers            map[string]string    `json:"headers"`
+	Body               string               `json:"body"`
+	Ja3                string               `json:"ja3"`
+	UserAgent          string               `json:"userAgent"`
+	Proxy              string               `json:"proxy"`
+	Cookies            []Cookie             `json:"cookies"`
+	Timeout            int                  `json:"timeout"`
+	DisableRedirect    bool                 `json:"disableRedirect"`
+	HeaderOrder        []string             `json:"headerOrder"`
+	OrderAsProvided    bool                 `json:"orderAsProvided"` //TODO
+	InsecureSkipVerify bool                 `json:"insecureSkipVerify"`
+	ForceHTTP1         bool                 `json:"forceHTTP1"`
+	Profile            string               `json:"profile"`
+	PHeaderOrder       []string             `json:"pHeaderOrder"`
+	HTTP2Settings      *http2.HTTP2Settings `json:"-"`
+	Context            context.Context      `json:"-"` // 请求取消时中断上游请求, 同时作为链路追踪的父 span
 }
 
 type cycleTLSRequest struct {
@@ -81,6 +96,7 @@ func processRequest(request cycleTLSRequest) (result fullRequest) {
 		Cookies:            request.Options.Cookies,
 		InsecureSkipVerify: request.Options.InsecureSkipVerify,
 		forceHTTP1:         request.Options.ForceHTTP1,
+		HTTP2Settings:      request.Options.HTTP2Settings,
 	}
 
 	client, err := newClient(
@@ -94,7 +110,11 @@ func processRequest(request cycleTLSRequest) (result fullRequest) {
 		log.Fatal(err)
 	}
 
-	req, err := http.NewRequest(strings.ToUpper(request.Options.Method), request.Options.URL, strings.NewReader(request.Options.Body))
+	ctx := request.Options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(request.Options.Method), request.Options.URL, strings.NewReader(request.Options.Body))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -152,6 +172,9 @@ func processRequest(request cycleTLSRequest) (result fullRequest) {
 
 	}
 	headerOrder := parseUserAgent(request.Options.UserAgent).HeaderOrder
+	if len(request.Options.PHeaderOrder) > 0 {
+		headerOrder = request.Options.PHeaderOrder
+	}
 
 	//ordering the pseudo headers and our normal headers
 	req.Header = http.Header{
@@ -244,13 +267,7 @@ func (client CycleTLS) Do(URL string, options Options, Method string) (response
 	options.URL = URL
 	options.Method = Method
 	// Set default values if not provided
-	if options.Ja3 == "" {
-		options.Ja3 = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,18-35-65281-45-17513-27-65037-16-10-11-5-13-0-43-23-51,29-23-24,0"
-	}
-	if options.UserAgent == "" {
-		// Mac OS Chrome 121
-		options.UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
-	}
+	applyProfile(&options)
 	opt := cycleTLSRequest{"cycleTLSRequest", options}
 
 	res := processRequest(opt)
@@ -413,6 +430,8 @@ type SSEResponse struct {
 	RequestID string
 	Status    int
 	Data      string
+	Event     string // SSE 事件类型, 未指定时为 message
+	ID        string // SSE 事件 id
 	Done      bool
 	FinalUrl  string // 添加 FinalUrl 字段
 }
@@ -421,20 +440,39 @@ func dispatcherSSE(res fullRequest, sseChan chan<- SSEResponse) {
 	defer res.client.CloseIdleConnections()
 
 	finalUrl := res.options.Options.URL
+	ctx, span := tracer().Start(res.req.Context(), "cycletls.sse", trace.WithAttributes(
+		attribute.String("http.request.method", res.req.Method),
+		attribute.String("url.full", finalUrl),
+	))
+	defer span.End()
+
+	// 调用方不再读取(请求已结束)时停止发送, 避免 goroutine 阻塞
+	send := func(response SSEResponse) bool {
+		select {
+		case sseChan <- response:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
 
-	resp, err := res.client.Do(res.req)
+	resp, err := res.client.Do(res.req.WithContext(ctx))
 	if err != nil {
 		parsedError := parseError(err)
-		sseChan <- SSEResponse{
+		span.RecordError(err)
+		span.SetStatus(codes.Error, parsedError.ErrorMsg)
+		send(SSEResponse{
 			RequestID: res.options.RequestID,
 			Status:    parsedError.StatusCode,
 			Data:      fmt.Sprintf("%s-> \n%s", parsedError.ErrorMsg, err.Error()),
 			Done:      true,
 			FinalUrl:  finalUrl,
-		}
+		})
 		return
 	}
 	defer resp.Body.Close()
+	span.AddEvent("response_headers")
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	// 检查HTTP状态码，非2xx状态码可能表示错误
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
@@ -443,14 +481,15 @@ func dispatcherSSE(res fullRequest, sseChan chan<- SSEResponse) {
 		if errorMsg == "" {
 			errorMsg = fmt.Sprintf("HTTP error status: %d", resp.StatusCode)
 		}
+		span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", resp.StatusCode))
 
-		sseChan <- SSEResponse{
+		send(SSEResponse{
 			RequestID: res.options.RequestID,
 			Status:    resp.StatusCode,
 			Data:      errorMsg,
 			Done:      true,
 			FinalUrl:  finalUrl,
-		}
+		})
 		return
 	}
 
@@ -459,73 +498,82 @@ func dispatcherSSE(res fullRequest, sseChan chan<- SSEResponse) {
 		finalUrl = resp.Request.URL.String()
 	}
 
-	reader := bufio.NewReader(resp.Body)
-	const maxRetries = 3
-	retries := 0
+	parser := NewSSEParser(resp.Body)
+	events := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("sse.events", events))
+	}()
 
 	for {
-		// 读取直到换行符
-		line, err := reader.ReadString('\n')
+		event, err := parser.Next()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
 
-			if retries < maxRetries {
-				retries++
-				time.Sleep(time.Second * time.Duration(retries))
-				continue
-			}
-
-			sseChan <- SSEResponse{
+			// 连接已损坏, 不在同一个 body 上重试
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "error reading stream")
+			send(SSEResponse{
 				RequestID: res.options.RequestID,
 				Status:    resp.StatusCode,
 				Data:      "Error reading stream: " + err.Error(),
 				Done:      true,
 				FinalUrl:  finalUrl,
-			}
+			})
 			return
 		}
 
-		// 重置重试计数
-		retries = 0
-
-		// 去除行尾的空白字符
-		line = strings.TrimSpace(line)
+		// 上游通过 error 事件返回的错误, 交由调用方按错误处理
+		if event.Event == "error" {
+			span.SetStatus(codes.Error, "upstream error event")
+			send(SSEResponse{
+				RequestID: res.options.RequestID,
+				Status:    resp.StatusCode,
+				Data:      event.Data,
+				Event:     event.Event,
+				ID:        event.ID,
+				Done:      true,
+				FinalUrl:  finalUrl,
+			})
+			return
+		}
 
-		// 跳过空行
-		if line == "" {
+		if event.Data == "" {
 			continue
 		}
 
-		// 处理数据行
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimSpace(strings.TrimPrefix(line, "data: "))
-			if data != "" {
-				sseChan <- SSEResponse{
-					RequestID: res.options.RequestID,
-					Status:    resp.StatusCode,
-					Data:      data,
-					Done:      false,
-					FinalUrl:  finalUrl,
-				}
-			}
+		if events == 0 {
+			span.AddEvent("first_event")
+		}
+		events++
+		if !send(SSEResponse{
+			RequestID: res.options.RequestID,
+			Status:    resp.StatusCode,
+			Data:      event.Data,
+			Event:     event.Event,
+			ID:        event.ID,
+			Done:      false,
+			FinalUrl:  finalUrl,
+		}) {
+			span.SetStatus(codes.Error, "canceled by client")
+			return
 		}
 
-		// 检查是否有结束标记
-		if strings.HasSuffix(line, "[DONE]") {
+		// 结束标记转发给调用方后不再读取
+		if event.Data == "[DONE]" {
 			break
 		}
 	}
 
 	// 发送完成信号
-	sseChan <- SSEResponse{
+	send(SSEResponse{
 		RequestID: res.options.RequestID,
 		Status:    resp.StatusCode,
 		Data:      "",
 		Done:      true,
 		FinalUrl:  finalUrl,
-	}
+	})
 }
 
 // 修改 Do 方法以支持 SSE
@@ -534,12 +582,7 @@ func (client CycleTLS) DoSSE(URL string, options Options, Method string) (<-chan
 
 	options.URL = URL
 	options.Method = Method
-	if options.Ja3 == "" {
-		options.Ja3 = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,18-35-65281-45-17513-27-65037-16-10-11-5-13-0-43-23-51,29-23-24,0"
-	}
-	if options.UserAgent == "" {
-		options.UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
-	}
+	applyProfile(&options)
 
 	opt := cycleTLSRequest{"cycleTLSRequest", options}
 	res := processRequest(opt)
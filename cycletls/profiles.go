@@ -0,0 +1,236 @@
+package cycletls
+
+import (
+	"sort"
+	"strings"
+
+	http2 "github.com/Danny-Dasilva/fhttp/http2"
+)
+
+// Profile bundles everything that makes up a client fingerprint: the TLS
+// ClientHello (JA3), the User-Agent, the header order and the HTTP/2
+// connection preface.
+type Profile struct {
+	Name          string
+	JA3           string
+	UserAgent     string
+	HeaderOrder   []string
+	PHeaderOrder  []string
+	HTTP2Settings *http2.HTTP2Settings
+}
+
+// DefaultProfile is used when neither the request nor the configuration selects a profile.
+const DefaultProfile = "chrome_121"
+
+var chromeHeaderOrder = []string{
+	"host",
+	"connection",
+	"content-length",
+	"sec-ch-ua",
+	"sec-ch-ua-mobile",
+	"sec-ch-ua-platform",
+	"authorization",
+	"content-type",
+	"x-atlassian-encodedtoken",
+	"user-agent",
+	"accept",
+	"origin",
+	"sec-fetch-site",
+	"sec-fetch-mode",
+	"sec-fetch-dest",
+	"referer",
+	"accept-encoding",
+	"accept-language",
+	"cookie",
+}
+
+var firefoxHeaderOrder = []string{
+	"host",
+	"user-agent",
+	"accept",
+	"accept-language",
+	"accept-encoding",
+	"content-type",
+	"authorization",
+	"x-atlassian-encodedtoken",
+	"content-length",
+	"origin",
+	"connection",
+	"referer",
+	"cookie",
+	"sec-fetch-dest",
+	"sec-fetch-mode",
+	"sec-fetch-site",
+}
+
+var safariHeaderOrder = []string{
+	"host",
+	"content-type",
+	"accept",
+	"authorization",
+	"x-atlassian-encodedtoken",
+	"sec-fetch-site",
+	"accept-language",
+	"accept-encoding",
+	"sec-fetch-mode",
+	"origin",
+	"user-agent",
+	"referer",
+	"content-length",
+	"connection",
+	"sec-fetch-dest",
+	"cookie",
+}
+
+var goHeaderOrder = []string{
+	"host",
+	"user-agent",
+	"content-length",
+	"accept",
+	"authorization",
+	"content-type",
+	"x-atlassian-encodedtoken",
+	"accept-encoding",
+}
+
+var chromeHTTP2Settings = &http2.HTTP2Settings{
+	Settings: []http2.Setting{
+		{ID: http2.SettingHeaderTableSize, Val: 65536},
+		{ID: http2.SettingEnablePush, Val: 0},
+		{ID: http2.SettingInitialWindowSize, Val: 6291456},
+		{ID: http2.SettingMaxHeaderListSize, Val: 262144},
+	},
+	ConnectionFlow: 15663105,
+	HeaderPriority: &http2.PriorityParam{Weight: 255, Exclusive: true},
+}
+
+var firefoxHTTP2Settings = &http2.HTTP2Settings{
+	Settings: []http2.Setting{
+		{ID: http2.SettingHeaderTableSize, Val: 65536},
+		{ID: http2.SettingInitialWindowSize, Val: 131072},
+		{ID: http2.SettingMaxFrameSize, Val: 16384},
+	},
+	ConnectionFlow: 12517377,
+	HeaderPriority: &http2.PriorityParam{Weight: 41, StreamDep: 13},
+}
+
+var safariHTTP2Settings = &http2.HTTP2Settings{
+	Settings: []http2.Setting{
+		{ID: http2.SettingEnablePush, Val: 0},
+		{ID: http2.SettingMaxConcurrentStreams, Val: 100},
+		{ID: http2.SettingInitialWindowSize, Val: 2097152},
+	},
+	ConnectionFlow: 10485760,
+	HeaderPriority: &http2.PriorityParam{Weight: 254},
+}
+
+var goHTTP2Settings = &http2.HTTP2Settings{
+	Settings: []http2.Setting{
+		{ID: http2.SettingEnablePush, Val: 0},
+		{ID: http2.SettingInitialWindowSize, Val: 4194304},
+		{ID: http2.SettingMaxHeaderListSize, Val: 10485760},
+	},
+	ConnectionFlow: 1073741824,
+}
+
+var profiles = map[string]Profile{
+	"chrome_120": {
+		JA3:           "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-21,29-23-24,0",
+		UserAgent:     "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		HeaderOrder:   chromeHeaderOrder,
+		PHeaderOrder:  []string{":method", ":authority", ":scheme", ":path"},
+		HTTP2Settings: chromeHTTP2Settings,
+	},
+	"chrome_121": {
+		JA3:           "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,18-35-65281-45-17513-27-65037-16-10-11-5-13-0-43-23-51,29-23-24,0",
+		UserAgent:     "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36",
+		HeaderOrder:   chromeHeaderOrder,
+		PHeaderOrder:  []string{":method", ":authority", ":scheme", ":path"},
+		HTTP2Settings: chromeHTTP2Settings,
+	},
+	"chrome_131": {
+		JA3:           "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-5-10-11-13-16-18-23-27-35-43-45-51-17513-65037-65281,4588-29-23-24,0",
+		UserAgent:     "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+		HeaderOrder:   chromeHeaderOrder,
+		PHeaderOrder:  []string{":method", ":authority", ":scheme", ":path"},
+		HTTP2Settings: chromeHTTP2Settings,
+	},
+	"firefox_120": {
+		JA3:           "771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53,0-23-65281-10-11-16-5-34-51-43-13-45-28-65037,29-23-24-25-256-257,0",
+		UserAgent:     "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0",
+		HeaderOrder:   firefoxHeaderOrder,
+		PHeaderOrder:  []string{":method", ":path", ":authority", ":scheme"},
+		HTTP2Settings: firefoxHTTP2Settings,
+	},
+	"firefox_133": {
+		JA3:           "771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53,0-23-65281-10-11-16-5-34-51-43-13-28-27-65037,4588-29-23-24-25-256-257,0",
+		UserAgent:     "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:133.0) Gecko/20100101 Firefox/133.0",
+		HeaderOrder:   firefoxHeaderOrder,
+		PHeaderOrder:  []string{":method", ":path", ":authority", ":scheme"},
+		HTTP2Settings: firefoxHTTP2Settings,
+	},
+	"safari_17": {
+		JA3:           "771,4865-4866-4867-49196-49195-52393-49200-49199-52392-49162-49161-49172-49171-157-156-53-47-49160-49170-10,0-23-65281-10-11-16-5-13-18-51-45-43-27-21,29-23-24-25,0",
+		UserAgent:     "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+		HeaderOrder:   safariHeaderOrder,
+		PHeaderOrder:  []string{":method", ":scheme", ":path", ":authority"},
+		HTTP2Settings: safariHTTP2Settings,
+	},
+	"safari_18": {
+		JA3:           "771,4865-4866-4867-49196-49195-52393-49200-49199-52392-49162-49161-49172-49171-157-156-53-47-49160-49170-10,0-23-65281-10-11-16-5-13-18-51-45-43-27-21,4588-29-23-24-25,0",
+		UserAgent:     "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Safari/605.1.15",
+		HeaderOrder:   safariHeaderOrder,
+		PHeaderOrder:  []string{":method", ":scheme", ":authority", ":path"},
+		HTTP2Settings: safariHTTP2Settings,
+	},
+	"go": {
+		JA3:           "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49161-49171-49162-49172-156-157-47-53-49170-10,0-5-10-11-13-65281-16-18-43-51,29-23-24-25,0",
+		UserAgent:     "Go-http-client/2.0",
+		HeaderOrder:   goHeaderOrder,
+		PHeaderOrder:  []string{":authority", ":method", ":path", ":scheme"},
+		HTTP2Settings: goHTTP2Settings,
+	},
+}
+
+// GetProfile returns the profile registered under name (case-insensitive).
+func GetProfile(name string) (Profile, bool) {
+	profile, ok := profiles[strings.ToLower(strings.TrimSpace(name))]
+	if ok {
+		profile.Name = strings.ToLower(strings.TrimSpace(name))
+	}
+	return profile, ok
+}
+
+// ProfileNames returns the names of all registered profiles in sorted order.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile fills the fingerprint related options that were not set explicitly
+// from the selected profile, falling back to DefaultProfile.
+func applyProfile(options *Options) {
+	profile, ok := GetProfile(options.Profile)
+	if !ok {
+		profile, _ = GetProfile(DefaultProfile)
+	}
+	if options.Ja3 == "" {
+		options.Ja3 = profile.JA3
+	}
+	if options.UserAgent == "" {
+		options.UserAgent = profile.UserAgent
+	}
+	if len(options.HeaderOrder) == 0 {
+		options.HeaderOrder = profile.HeaderOrder
+	}
+	if len(options.PHeaderOrder) == 0 {
+		options.PHeaderOrder = profile.PHeaderOrder
+	}
+	if options.HTTP2Settings == nil {
+		options.HTTP2Settings = profile.HTTP2Settings
+	}
+}
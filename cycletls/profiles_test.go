@@ -0,0 +1,378 @@
+package cycletls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// 通过 CycleTLS 以各 profile 向本地的 TLS/HTTP2 服务发起真实请求, 校验服务端观察到的 JA3、SETTINGS 及伪头部顺序
+func TestProfileFingerprint(t *testing.T) {
+	tests := []struct {
+		profile string
+		hash    string
+	}{
+		{"chrome_120", "cd08e31494f9531f560d64c695473da9"},
+		{"chrome_121", "c193ca8bd475cbf00f6472a0d714190a"},
+		{"chrome_131", "dee19b855b658c6aa0f575eda2525e19"},
+		{"firefox_120", "c0a45cc83cb2005bbd2a860db187a357"},
+		{"firefox_133", "a767f8ae9115cc5752e5cff59612e74f"},
+		{"safari_17", "773906b0efdefa24a7f2b8eb6985bf37"},
+		{"safari_18", "f1a8f4857b1aff297f2fe6daf416f1aa"},
+		{"go", "00eb7f13e9538f3433cbd28238a69639"},
+	}
+	cert := testCertificate(t)
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			profile, ok := GetProfile(tt.profile)
+			if !ok {
+				t.Fatalf("profile %s not found", tt.profile)
+			}
+			if got := ja3Hash(profile.JA3); got != tt.hash {
+				t.Fatalf("profile JA3 hash = %s, want %s", got, tt.hash)
+			}
+
+			seen := captureFingerprint(t, cert, Options{Profile: tt.profile, InsecureSkipVerify: true, Timeout: 5})
+			if seen.ja3 != profile.JA3 {
+				t.Errorf("ClientHello JA3 mismatch\n got: %s\nwant: %s", seen.ja3, profile.JA3)
+			}
+			if got := ja3Hash(seen.ja3); got != tt.hash {
+				t.Errorf("ClientHello JA3 hash = %s, want %s", got, tt.hash)
+			}
+			if seen.protocol != "h2" {
+				t.Fatalf("negotiated protocol = %q, want h2", seen.protocol)
+			}
+
+			var want []http2.Setting
+			for _, setting := range profile.HTTP2Settings.Settings {
+				want = append(want, http2.Setting{ID: http2.SettingID(setting.ID), Val: setting.Val})
+			}
+			if !reflect.DeepEqual(seen.settings, want) {
+				t.Errorf("SETTINGS = %v, want %v", seen.settings, want)
+			}
+			if int(seen.windowUpdate) != profile.HTTP2Settings.ConnectionFlow {
+				t.Errorf("connection WINDOW_UPDATE = %d, want %d", seen.windowUpdate, profile.HTTP2Settings.ConnectionFlow)
+			}
+			if !reflect.DeepEqual(seen.pseudoHeaders, profile.PHeaderOrder) {
+				t.Errorf("pseudo-header order = %v, want %v", seen.pseudoHeaders, profile.PHeaderOrder)
+			}
+			if seen.userAgent != profile.UserAgent {
+				t.Errorf("user-agent = %q, want %q", seen.userAgent, profile.UserAgent)
+			}
+		})
+	}
+}
+
+func ja3Hash(ja3 string) string {
+	sum := md5.Sum([]byte(ja3))
+	return hex.EncodeToString(sum[:])
+}
+
+// testCertificate 为 localhost 生成自签名证书
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// fingerprint 服务端观察到的客户端指纹
+type fingerprint struct {
+	ja3           string
+	protocol      string          // ALPN 协商的协议
+	settings      []http2.Setting // 客户端 SETTINGS 帧中的设置, 按发送顺序
+	windowUpdate  uint32          // 连接级 WINDOW_UPDATE 的增量
+	pseudoHeaders []string        // HEADERS 帧中伪头部的顺序
+	userAgent     string
+}
+
+// recordingConn 记录握手期间读取的数据, 用于解析 ClientHello
+type recordingConn struct {
+	net.Conn
+	recording bool
+	data      bytes.Buffer
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.recording {
+		c.data.Write(b[:n])
+	}
+	return n, err
+}
+
+// captureFingerprint 启动本地 TLS/HTTP2 服务, 以 options 通过 CycleTLS 请求一次并返回服务端观察到的指纹
+func captureFingerprint(t *testing.T, cert tls.Certificate, options Options) fingerprint {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	result := make(chan fingerprint, 1)
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		seen, err := serveFingerprint(conn, cert)
+		if err != nil {
+			errs <- err
+			return
+		}
+		result <- seen
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	// 使用域名而非 IP, 使 ClientHello 带有 SNI 扩展
+	if _, err := Init().Do("https://localhost:"+port+"/fingerprint", options, http.MethodGet); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case seen := <-result:
+		return seen
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the request")
+	}
+	return fingerprint{}
+}
+
+// serveFingerprint 完成 TLS 握手, 读取 HTTP/2 连接前言及请求头并返回 200
+func serveFingerprint(conn net.Conn, cert tls.Certificate) (fingerprint, error) {
+	var seen fingerprint
+	recorder := &recordingConn{Conn: conn, recording: true}
+	tlsConn := tls.Server(recorder, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}})
+	if err := tlsConn.Handshake(); err != nil {
+		return seen, err
+	}
+	recorder.recording = false
+	hello, err := readClientHello(&recorder.data)
+	if err != nil {
+		return seen, err
+	}
+	if seen.ja3, err = parseJA3(hello); err != nil {
+		return seen, err
+	}
+	seen.protocol = tlsConn.ConnectionState().NegotiatedProtocol
+	if seen.protocol != "h2" {
+		return seen, nil
+	}
+
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(tlsConn, preface); err != nil {
+		return seen, err
+	}
+	if string(preface) != http2.ClientPreface {
+		return seen, fmt.Errorf("unexpected connection preface %q", preface)
+	}
+	framer := http2.NewFramer(tlsConn, tlsConn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(65536, nil)
+	if err := framer.WriteSettings(); err != nil {
+		return seen, err
+	}
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return seen, err
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			_ = f.ForeachSetting(func(setting http2.Setting) error {
+				seen.settings = append(seen.settings, setting)
+				return nil
+			})
+			if err := framer.WriteSettingsAck(); err != nil {
+				return seen, err
+			}
+		case *http2.WindowUpdateFrame:
+			if f.StreamID == 0 {
+				seen.windowUpdate = f.Increment
+			}
+		case *http2.MetaHeadersFrame:
+			for _, field := range f.Fields {
+				if field.IsPseudo() {
+					seen.pseudoHeaders = append(seen.pseudoHeaders, field.Name)
+				} else if field.Name == "user-agent" {
+					seen.userAgent = field.Value
+				}
+			}
+			var block bytes.Buffer
+			if err := hpack.NewEncoder(&block).WriteField(hpack.HeaderField{Name: ":status", Value: "200"}); err != nil {
+				return seen, err
+			}
+			err := framer.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      f.StreamID,
+				BlockFragment: block.Bytes(),
+				EndStream:     true,
+				EndHeaders:    true,
+			})
+			return seen, err
+		}
+	}
+}
+
+// readClientHello 读取握手消息, 可能跨多个 TLS 记录
+func readClientHello(r io.Reader) ([]byte, error) {
+	var handshake []byte
+	for {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		if header[0] != 22 {
+			return nil, fmt.Errorf("unexpected record type %d", header[0])
+		}
+		record := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, err
+		}
+		handshake = append(handshake, record...)
+		if len(handshake) >= 4 {
+			length := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+			if len(handshake) >= 4+length {
+				if handshake[0] != 1 {
+					return nil, fmt.Errorf("unexpected handshake type %d", handshake[0])
+				}
+				return handshake[4 : 4+length], nil
+			}
+		}
+	}
+}
+
+// GREASE 值 (RFC 8701) 不计入 JA3
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+type helloReader struct {
+	data []byte
+	err  error
+}
+
+func (r *helloReader) bytes(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = errors.New("truncated ClientHello")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *helloReader) u8() int {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+func (r *helloReader) u16() int {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func joinUint16(values []uint16) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			parts = append(parts, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func uint16List(data []byte) []uint16 {
+	values := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		values = append(values, binary.BigEndian.Uint16(data[i:]))
+	}
+	return values
+}
+
+// parseJA3 按 JA3 的格式: 版本,加密套件,扩展,椭圆曲线,点格式
+func parseJA3(hello []byte) (string, error) {
+	r := &helloReader{data: hello}
+	version := r.u16()
+	r.bytes(32)     // random
+	r.bytes(r.u8()) // session id
+	ciphers := uint16List(r.bytes(r.u16()))
+	r.bytes(r.u8()) // compression methods
+	extensionsData := r.bytes(r.u16())
+	if r.err != nil {
+		return "", r.err
+	}
+
+	var extensions, curves []uint16
+	var points []string
+	ext := &helloReader{data: extensionsData}
+	for len(ext.data) > 0 {
+		extType := uint16(ext.u16())
+		body := ext.bytes(ext.u16())
+		if ext.err != nil {
+			return "", ext.err
+		}
+		extensions = append(extensions, extType)
+		switch extType {
+		case 10: // supported_groups
+			list := &helloReader{data: body}
+			curves = uint16List(list.bytes(list.u16()))
+		case 11: // ec_point_formats
+			list := &helloReader{data: body}
+			for _, p := range list.bytes(list.u8()) {
+				points = append(points, strconv.Itoa(int(p)))
+			}
+		}
+	}
+	return fmt.Sprintf("%d,%s,%s,%s,%s", version, joinUint16(ciphers), joinUint16(extensions), joinUint16(curves), strings.Join(points, "-")), nil
+}
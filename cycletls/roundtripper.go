@@ -12,6 +12,9 @@ import (
 	http "github.com/Danny-Dasilva/fhttp"
 	http2 "github.com/Danny-Dasilva/fhttp/http2"
 	utls "github.com/refraction-networking/utls"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/proxy"
 )
 
@@ -28,8 +31,9 @@ type roundTripper struct {
 	cachedConnections  map[string]net.Conn
 	cachedTransports   map[string]http.RoundTripper
 
-	dialer     proxy.ContextDialer
-	forceHTTP1 bool
+	dialer        proxy.ContextDialer
+	forceHTTP1    bool
+	http2Settings *http2.HTTP2Settings
 }
 
 func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -82,7 +86,7 @@ func (rt *roundTripper) getTransport(req *http.Request, addr string) error {
 	return nil
 }
 
-func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (_ net.Conn, err error) {
 	rt.Lock()
 	defer rt.Unlock()
 
@@ -91,10 +95,26 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 	if conn := rt.cachedConnections[addr]; conn != nil {
 		return conn, nil
 	}
+
+	// Trace the TCP/proxy dial and the uTLS handshake. errProtocolNegotiated
+	// is the expected outcome of the first dial and not a failure.
+	ctx, span := tracer().Start(ctx, "cycletls.dial_tls", trace.WithAttributes(
+		attribute.String("server.address", addr),
+		attribute.Bool("http.force_http1", rt.forceHTTP1),
+	))
+	defer func() {
+		if err != nil && err != errProtocolNegotiated {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	rawConn, err := rt.dialer.DialContext(ctx, network, addr)
 	if err != nil {
 		return nil, err
 	}
+	span.AddEvent("tcp_connected")
 
 	var host string
 	if host, _, err = net.SplitHostPort(addr); err != nil {
@@ -107,17 +127,17 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 		return nil, err
 	}
 
-	conn := utls.UClient(rawConn, &utls.Config{ServerName: host, OmitEmptyPsk: true, InsecureSkipVerify: rt.InsecureSkipVerify}, // MinVersion:         tls.VersionTLS10,
+	uconn := utls.UClient(rawConn, &utls.Config{ServerName: host, OmitEmptyPsk: true, InsecureSkipVerify: rt.InsecureSkipVerify}, // MinVersion:         tls.VersionTLS10,
 		// MaxVersion:         tls.VersionTLS13,
 
 		utls.HelloCustom)
 
-	if err := conn.ApplyPreset(spec); err != nil {
+	if err := uconn.ApplyPreset(spec); err != nil {
 		return nil, err
 	}
 
-	if err = conn.Handshake(); err != nil {
-		_ = conn.Close()
+	if err = uconn.Handshake(); err != nil {
+		_ = uconn.Close()
 
 		if err.Error() == "tls: CurvePreferences includes unsupported curve" {
 			//fix this
@@ -126,13 +146,19 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 		return nil, fmt.Errorf("uTlsConn.Handshake() error: %+v", err)
 	}
 
+	state := uconn.ConnectionState()
+	span.SetAttributes(
+		attribute.String("tls.protocol", state.NegotiatedProtocol),
+		attribute.Int("tls.version", int(state.Version)),
+	)
+
 	if rt.cachedTransports[addr] != nil {
-		return conn, nil
+		return uconn, nil
 	}
 
 	// No http.Transport constructed yet, create one based on the results
 	// of ALPN.
-	switch conn.ConnectionState().NegotiatedProtocol {
+	switch state.NegotiatedProtocol {
 	case http2.NextProtoTLS:
 		parsedUserAgent := parseUserAgent(rt.UserAgent)
 
@@ -141,6 +167,9 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 			PushHandler: &http2.DefaultPushHandler{},
 			Navigator:   parsedUserAgent.UserAgent,
 		}
+		if rt.http2Settings != nil {
+			t2.HTTP2Settings = rt.http2Settings
+		}
 		rt.cachedTransports[addr] = &t2
 	default:
 		// Assume the remote peer is speaking HTTP 1.x + TLS.
@@ -150,7 +179,7 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 
 	// Stash the connection just established for use servicing the
 	// actual request (should be near-immediate).
-	rt.cachedConnections[addr] = conn
+	rt.cachedConnections[addr] = uconn
 
 	return nil, errProtocolNegotiated
 }
@@ -186,6 +215,7 @@ func newRoundTripper(browser Browser, dialer ...proxy.ContextDialer) http.RoundT
 			cachedConnections:  make(map[string]net.Conn),
 			InsecureSkipVerify: browser.InsecureSkipVerify,
 			forceHTTP1:         browser.forceHTTP1,
+			http2Settings:      browser.HTTP2Settings,
 		}
 	}
 
@@ -198,5 +228,6 @@ func newRoundTripper(browser Browser, dialer ...proxy.ContextDialer) http.RoundT
 		cachedConnections:  make(map[string]net.Conn),
 		InsecureSkipVerify: browser.InsecureSkipVerify,
 		forceHTTP1:         browser.forceHTTP1,
+		http2Settings:      browser.HTTP2Settings,
 	}
 }
@@ -0,0 +1,118 @@
+package cycletls
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SSEEvent is a single dispatched server-sent event as defined by the
+// WHATWG "Server-sent events" parsing rules.
+type SSEEvent struct {
+	Event string // event type, "message" when the stream did not set one
+	ID    string // last event id at the time of dispatch
+	Data  string // data lines joined with "\n"
+	Retry int    // reconnection time in milliseconds, 0 when not sent
+}
+
+// SSEParser reads SSEEvents from an event stream. Lines may be terminated by
+// CRLF, LF or a single CR, and may be split across arbitrary read boundaries.
+type SSEParser struct {
+	reader *bufio.Reader
+	skipLF bool // the previous line ended with CR, a leading LF belongs to it
+	lastID string
+}
+
+// NewSSEParser creates a parser reading from r
+func NewSSEParser(r io.Reader) *SSEParser {
+	return &SSEParser{reader: bufio.NewReader(r)}
+}
+
+// readLine returns the next line without its terminator. An unterminated
+// trailing line is dropped and io.EOF returned, as the spec requires.
+func (p *SSEParser) readLine() (string, error) {
+	var line []byte
+	for {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if p.skipLF {
+			p.skipLF = false
+			if b == '\n' {
+				continue
+			}
+		}
+		switch b {
+		case '\r':
+			p.skipLF = true
+			return string(line), nil
+		case '\n':
+			return string(line), nil
+		default:
+			line = append(line, b)
+		}
+	}
+}
+
+// Next blocks until the next event is dispatched. It returns io.EOF once the
+// stream ends; an event that was not terminated by a blank line is discarded.
+func (p *SSEParser) Next() (SSEEvent, error) {
+	var (
+		data      strings.Builder
+		eventType string
+		retry     int
+	)
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return SSEEvent{}, err
+		}
+
+		// blank line: dispatch the event
+		if line == "" {
+			if data.Len() == 0 {
+				eventType = ""
+				retry = 0
+				continue
+			}
+			if eventType == "" {
+				eventType = "message"
+			}
+			return SSEEvent{
+				Event: eventType,
+				ID:    p.lastID,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+				Retry: retry,
+			}, nil
+		}
+
+		// comment line
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if idx := strings.IndexByte(line, ':'); idx >= 0 {
+			field = line[:idx]
+			value = strings.TrimPrefix(line[idx+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				p.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 && strings.Trim(value, "0123456789") == "" {
+				retry = ms
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package cycletls
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func parseAll(r io.Reader) ([]SSEEvent, error) {
+	parser := NewSSEParser(r)
+	var events []SSEEvent
+	for {
+		event, err := parser.Next()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
+
+// chunkReader 按给定的长度依次返回数据, 模拟任意的读取边界
+type chunkReader struct {
+	data  string
+	sizes []int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, io.EOF
+	}
+	n := len(r.data)
+	if len(r.sizes) > 0 {
+		n = min(r.sizes[0], n)
+		r.sizes = r.sizes[1:]
+	}
+	n = copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestSSEParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []SSEEvent
+	}{
+		{
+			name:   "LF",
+			stream: "data: a\n\ndata: b\n\n",
+			want:   []SSEEvent{{Event: "message", Data: "a"}, {Event: "message", Data: "b"}},
+		},
+		{
+			name:   "CRLF",
+			stream: "data: a\r\n\r\ndata: b\r\n\r\n",
+			want:   []SSEEvent{{Event: "message", Data: "a"}, {Event: "message", Data: "b"}},
+		},
+		{
+			name:   "lone CR",
+			stream: "data: a\r\rdata: b\r\r",
+			want:   []SSEEvent{{Event: "message", Data: "a"}, {Event: "message", Data: "b"}},
+		},
+		{
+			name:   "mixed line endings",
+			stream: "event: x\rdata: a\r\n\ndata: b\n\r",
+			want:   []SSEEvent{{Event: "x", Data: "a"}, {Event: "message", Data: "b"}},
+		},
+		{
+			name:   "multi-line data",
+			stream: "data: line1\ndata: line2\ndata:\ndata: line4\n\n",
+			want:   []SSEEvent{{Event: "message", Data: "line1\nline2\n\nline4"}},
+		},
+		{
+			name:   "only the first space is removed",
+			stream: "data:no space\ndata:  two spaces\n\n",
+			want:   []SSEEvent{{Event: "message", Data: "no space\n two spaces"}},
+		},
+		{
+			name:   "comments and unknown fields are ignored",
+			stream: ": keep-alive\nfoo: bar\ndata: a\n: trailing\n\n",
+			want:   []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name:   "field without colon",
+			stream: "data\ndata\n\n",
+			want:   []SSEEvent{{Event: "message", Data: "\n"}},
+		},
+		{
+			name:   "event type resets after dispatch",
+			stream: "event: error\ndata: {\"message\":\"boom\"}\n\ndata: next\n\n",
+			want:   []SSEEvent{{Event: "error", Data: `{"message":"boom"}`}, {Event: "message", Data: "next"}},
+		},
+		{
+			name:   "event without data is not dispatched",
+			stream: "event: ping\n\ndata: a\n\n",
+			want:   []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name:   "id persists across events, NUL ids are ignored",
+			stream: "id: 1\ndata: a\n\ndata: b\n\nid: 2\x00\ndata: c\n\n",
+			want:   []SSEEvent{{Event: "message", ID: "1", Data: "a"}, {Event: "message", ID: "1", Data: "b"}, {Event: "message", ID: "1", Data: "c"}},
+		},
+		{
+			name:   "retry",
+			stream: "retry: 3000\ndata: a\n\nretry: 1x\ndata: b\n\n",
+			want:   []SSEEvent{{Event: "message", Data: "a", Retry: 3000}, {Event: "message", Data: "b"}},
+		},
+		{
+			name:   "unterminated trailing event is discarded",
+			stream: "data: a\n\ndata: b\n",
+			want:   []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name:   "unterminated trailing line is discarded",
+			stream: "data: a\n\ndata: b",
+			want:   []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name:   "done marker",
+			stream: "data: {\"x\":1}\n\ndata: [DONE]\n\n",
+			want:   []SSEEvent{{Event: "message", Data: `{"x":1}`}, {Event: "message", Data: "[DONE]"}},
+		},
+		{
+			name:   "empty stream",
+			stream: "",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readers := map[string]func() io.Reader{
+				"whole":    func() io.Reader { return strings.NewReader(tt.stream) },
+				"one byte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(tt.stream)) },
+			}
+			// 在每个位置切分一次, 覆盖 CR 与 LF 分在两次读取中的情况
+			for i := 1; i < len(tt.stream); i++ {
+				readers[fmt.Sprintf("split at %d", i)] = func() io.Reader {
+					return &chunkReader{data: tt.stream, sizes: []int{i}}
+				}
+			}
+			for name, reader := range readers {
+				got, err := parseAll(reader())
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("%s:\n got: %#v\nwant: %#v", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSSEParserReadError(t *testing.T) {
+	readErr := errors.New("connection reset")
+	parser := NewSSEParser(io.MultiReader(strings.NewReader("data: a\n\ndata: b\n"), iotest.ErrReader(readErr)))
+	if event, err := parser.Next(); err != nil || event.Data != "a" {
+		t.Fatalf("first event = %#v, %v", event, err)
+	}
+	if _, err := parser.Next(); !errors.Is(err, readErr) {
+		t.Fatalf("err = %v, want %v", err, readErr)
+	}
+}
+
+func collectSSE(t *testing.T, handler http.HandlerFunc) []SSEResponse {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	sseChan, err := Init().DoSSE(server.URL, Options{Headers: map[string]string{}, Timeout: 5}, http.MethodPost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var responses []SSEResponse
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case response, ok := <-sseChan:
+			if !ok {
+				return responses
+			}
+			response.RequestID, response.FinalUrl = "", ""
+			responses = append(responses, response)
+		case <-timeout:
+			t.Fatal("timeout reading SSE responses")
+		}
+	}
+}
+
+func TestDoSSE(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []SSEResponse
+	}{
+		{
+			name:   "done marker is forwarded and ends the stream",
+			status: http.StatusOK,
+			body:   "data: a\r\n\r\ndata: [DONE]\r\n\r\ndata: ignored\r\n\r\n",
+			want: []SSEResponse{
+				{Status: 200, Data: "a", Event: "message"},
+				{Status: 200, Data: "[DONE]", Event: "message"},
+				{Status: 200, Done: true},
+			},
+		},
+		{
+			name:   "clean EOF without done marker",
+			status: http.StatusOK,
+			body:   "data: line1\ndata: line2\n\n",
+			want: []SSEResponse{
+				{Status: 200, Data: "line1\nline2", Event: "message"},
+				{Status: 200, Done: true},
+			},
+		},
+		{
+			name:   "upstream error event",
+			status: http.StatusOK,
+			body:   "data: a\n\nevent: error\nid: 7\ndata: {\"message\":\"rate limit\"}\n\ndata: ignored\n\n",
+			want: []SSEResponse{
+				{Status: 200, Data: "a", Event: "message"},
+				{Status: 200, Data: `{"message":"rate limit"}`, Event: "error", ID: "7", Done: true},
+			},
+		},
+		{
+			name:   "error status",
+			status: http.StatusTooManyRequests,
+			body:   `{"error":"rate limit"}`,
+			want: []SSEResponse{
+				{Status: 429, Data: `{"error":"rate limit"}`, Done: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectSSE(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("\n got: %#v\nwant: %#v", got, tt.want)
+			}
+		})
+	}
+}
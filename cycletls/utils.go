@@ -16,8 +16,9 @@ import (
 )
 
 const (
-	chrome  = "chrome"  //chrome User agent enum
-	firefox = "firefox" //firefox User agent enum
+	chrome   = "chrome"  //chrome User agent enum
+	firefox  = "firefox" //firefox User agent enum
+	goClient = "go"      //go net/http client enum, only used for the TLS spec
 )
 
 type UserAgent struct {
@@ -38,6 +39,11 @@ func parseUserAgent(userAgent string) UserAgent {
 
 }
 
+// isGoClient reports whether userAgent belongs to the Go standard library HTTP client
+func isGoClient(userAgent string) bool {
+	return strings.HasPrefix(strings.ToLower(userAgent), "go-http-client")
+}
+
 // DecompressBody unzips compressed data
 func DecompressBody(Body []byte, encoding []string, content []string) (parsedBody string) {
 	if len(encoding) > 0 {
@@ -106,6 +112,10 @@ func unBrotliData(data []byte) (resData []byte, err error) {
 // StringToSpec creates a ClientHelloSpec based on a JA3 string
 func StringToSpec(ja3 string, userAgent string, forceHTTP1 bool) (*utls.ClientHelloSpec, error) {
 	parsedUserAgent := parseUserAgent(userAgent)
+	// the plain Go client shares chrome's HTTP/2 navigator but never sends GREASE values
+	if isGoClient(userAgent) {
+		parsedUserAgent.UserAgent = goClient
+	}
 	// if tlsExtensions == nil {
 	// 	tlsExtensions = &TLSExtensions{}
 	// }
@@ -0,0 +1,264 @@
+// Package hook 请求及响应的处理插件.
+//
+// 插件按阶段参与处理, 阶段按以下顺序执行:
+//
+//	pre_auth        校验 API-KEY 之前, 可以拒绝请求
+//	pre_upstream    发送到上游之前, 修改客户端的请求(一次)或发送到上游的请求体(每次发送)
+//	stream_chunk    发送给客户端之前, 处理上游返回的每段输出, 非流式请求处理完整的回答
+//	post_completion 回答结束之后
+//
+// 插件实现 Hook 及所参与阶段的接口, 在 init 中调用 Register 注册, 并通过配置按接口或 API-KEY 启用;
+// 同一阶段内按配置的顺序执行.
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"rovo2api/model"
+	"sort"
+	"sync"
+)
+
+// 处理阶段
+const (
+	StagePreAuth        = "pre_auth"
+	StagePreUpstream    = "pre_upstream"
+	StageStreamChunk    = "stream_chunk"
+	StagePostCompletion = "post_completion"
+)
+
+// Hook 插件, 名称用于配置中启用
+type Hook interface {
+	Name() string
+}
+
+// PreAuthHook 在校验 API-KEY 之前执行, 返回错误时拒绝请求
+type PreAuthHook interface {
+	Hook
+	PreAuth(req *Request) error
+}
+
+// RequestHook 在发送到上游之前修改客户端的请求, 每个请求执行一次
+type RequestHook interface {
+	Hook
+	PreUpstream(req *Request, chat *model.OpenAIChatCompletionRequest) error
+}
+
+// PayloadHook 修改发送到上游的请求体, 每次发送(包括重试及上下文摘要)前执行
+type PayloadHook interface {
+	Hook
+	PreUpstreamPayload(req *Request, payload map[string]interface{}) error
+}
+
+// StreamHook 为每次回答创建输出处理, 返回 nil 表示不处理
+type StreamHook interface {
+	Hook
+	NewStream(req *Request) Stream
+}
+
+// Stream 一次回答的输出处理
+type Stream interface {
+	// Write 处理一段输出, 返回可以发送的内容; stop 为 true 时结束回答, 不再调用 Flush
+	Write(delta string) (text string, stop bool)
+	// Flush 回答结束时返回保留的内容
+	Flush() string
+}
+
+// PostCompletionHook 在回答结束之后执行
+type PostCompletionHook interface {
+	Hook
+	PostCompletion(req *Request, completion Completion)
+}
+
+// Completion 回答的结果
+type Completion struct {
+	Model            string
+	Stream           bool
+	Content          string // 发送给客户端的内容
+	FinishReason     string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Error 插件拒绝请求时返回的错误, 其他错误按 500 处理
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Reject 返回拒绝请求的错误
+func Reject(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Request 一个请求的上下文, 在各阶段之间共享
+type Request struct {
+	HTTP   *http.Request
+	Header http.Header // 响应头, 开始响应后的修改无效
+	Route  string      // 接口路径, 不含 ROUTE_PREFIX
+	// API-KEY 的标识(key-xxxx); pre_auth 阶段为请求携带的 API-KEY, 之后为校验通过的 API-KEY
+	KeyID   string
+	ModelID string // 上游模型, pre_upstream 阶段起可用
+
+	values map[any]any
+}
+
+// NewRequest 创建请求的上下文
+func NewRequest(r *http.Request, header http.Header, route, keyID string) *Request {
+	return &Request{HTTP: r, Header: header, Route: route, KeyID: keyID, values: make(map[any]any)}
+}
+
+func (r *Request) Context() context.Context {
+	return r.HTTP.Context()
+}
+
+// Value 读取插件保存的状态, 键建议使用插件内未导出的类型以避免冲突
+func (r *Request) Value(key any) any {
+	return r.values[key]
+}
+
+// SetValue 保存插件在各阶段之间共享的状态
+func (r *Request) SetValue(key, value any) {
+	r.values[key] = value
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]Hook{}
+)
+
+// Register 注册插件, 通常在 init 中调用; 名称为空或重复时 panic
+func Register(h Hook) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	name := h.Name()
+	if name == "" {
+		panic("hook: empty name")
+	}
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("hook: %s registered twice", name))
+	}
+	registry[name] = h
+}
+
+// Lookup 按名称查找插件, 未注册时返回 nil
+func Lookup(name string) Hook {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return registry[name]
+}
+
+// Names 所有已注册插件的名称
+func Names() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stages 插件参与的阶段
+func Stages(h Hook) []string {
+	var stages []string
+	if _, ok := h.(PreAuthHook); ok {
+		stages = append(stages, StagePreAuth)
+	}
+	_, isRequest := h.(RequestHook)
+	_, isPayload := h.(PayloadHook)
+	if isRequest || isPayload {
+		stages = append(stages, StagePreUpstream)
+	}
+	if _, ok := h.(StreamHook); ok {
+		stages = append(stages, StageStreamChunk)
+	}
+	if _, ok := h.(PostCompletionHook); ok {
+		stages = append(stages, StagePostCompletion)
+	}
+	return stages
+}
+
+// Chain 按顺序执行的插件
+type Chain []Hook
+
+// Select 按名称选择已注册的插件, 跳过未注册的名称
+func Select(names []string) Chain {
+	chain := make(Chain, 0, len(names))
+	for _, name := range names {
+		if h := Lookup(name); h != nil {
+			chain = append(chain, h)
+		}
+	}
+	return chain
+}
+
+func (c Chain) PreAuth(req *Request) error {
+	for _, h := range c {
+		if h, ok := h.(PreAuthHook); ok {
+			if err := h.PreAuth(req); err != nil {
+				return fmt.Errorf("%s: %w", h.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c Chain) PreUpstream(req *Request, chat *model.OpenAIChatCompletionRequest) error {
+	for _, h := range c {
+		if h, ok := h.(RequestHook); ok {
+			if err := h.PreUpstream(req, chat); err != nil {
+				return fmt.Errorf("%s: %w", h.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c Chain) PreUpstreamPayload(req *Request, payload map[string]interface{}) error {
+	for _, h := range c {
+		if h, ok := h.(PayloadHook); ok {
+			if err := h.PreUpstreamPayload(req, payload); err != nil {
+				return fmt.Errorf("%s: %w", h.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c Chain) PostCompletion(req *Request, completion Completion) {
+	for _, h := range c {
+		if h, ok := h.(PostCompletionHook); ok {
+			h.PostCompletion(req, completion)
+		}
+	}
+}
+
+// ErrorResponse 插件返回错误时的响应, Error 以外的错误按 500 处理
+func ErrorResponse(err error) (int, model.OpenAIErrorResponse) {
+	var hookErr *Error
+	if errors.As(err, &hookErr) {
+		return hookErr.Status, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: hookErr.Message,
+				Type:    "invalid_request_error",
+				Code:    hookErr.Code,
+			},
+		}
+	}
+	return http.StatusInternalServerError, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: err.Error(),
+			Type:    "server_error",
+			Code:    "hook_error",
+		},
+	}
+}
@@ -0,0 +1,54 @@
+package hook
+
+// NewStream 创建按顺序处理输出的 Stream, 前一个插件的输出作为后一个插件的输入; 没有插件处理输出时返回 nil
+func (c Chain) NewStream(req *Request) Stream {
+	var streams chainStream
+	for _, h := range c {
+		if h, ok := h.(StreamHook); ok {
+			if stream := h.NewStream(req); stream != nil {
+				streams = append(streams, stream)
+			}
+		}
+	}
+	if len(streams) == 0 {
+		return nil
+	}
+	return streams
+}
+
+type chainStream []Stream
+
+func (s chainStream) Write(delta string) (string, bool) {
+	return s.write(0, delta)
+}
+
+// 从第 from 个插件开始处理; 某个插件结束回答时, 其输出仍经过之后的插件, 之后的插件保留的内容随之输出
+func (s chainStream) write(from int, text string) (string, bool) {
+	for i := from; i < len(s); i++ {
+		var stop bool
+		if text, stop = s[i].Write(text); stop {
+			if text, stop = s.write(i+1, text); stop {
+				return text, true
+			}
+			return text + s.flush(i+1), true
+		}
+	}
+	return text, false
+}
+
+func (s chainStream) Flush() string {
+	return s.flush(0)
+}
+
+// 依次输出第 from 个插件起保留的内容
+func (s chainStream) flush(from int) string {
+	var out string
+	for i := from; i < len(s); i++ {
+		rest, stop := s.write(i+1, s[i].Flush())
+		out += rest
+		if stop {
+			break
+		}
+	}
+	return out
+}
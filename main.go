@@ -5,24 +5,52 @@
 package main
 
 import (
+	"context"
+	"embed"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"rovo2api/check"
 	"rovo2api/common"
 	"rovo2api/common/config"
 	logger "rovo2api/common/loggger"
+	"rovo2api/common/shutdown"
+	"rovo2api/common/state"
+	"rovo2api/common/tracing"
+	"rovo2api/controller"
 	"rovo2api/middleware"
 	"rovo2api/model"
 	"rovo2api/router"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-//var buildFS embed.FS
+// 管理面板页面
+//
+//go:embed web/dist
+var buildFS embed.FS
+
+// 关闭超时取消请求后, 等待其发送结束事件及刷新追踪数据的时间
+const shutdownAbortGrace = 5 * time.Second
 
 func main() {
+	common.Init()
+	logger.LogDir = *common.LogDir
+
+	configFile := config.ConfigFile
+	if *common.ConfigFile != "" {
+		configFile = *common.ConfigFile
+	}
+	configErr := config.LoadConfigFile(configFile)
 	logger.SetupLogger()
 	logger.SysLog(fmt.Sprintf("rovo2api %s starting...", common.Version))
+	if configErr != nil {
+		logger.FatalLog(configErr.Error())
+	}
 
 	check.CheckEnvVariable()
 
@@ -32,33 +60,127 @@ func main() {
 
 	var err error
 
+	if err = tracing.Setup(context.Background(), tracing.Options{
+		Enabled:     config.TracingEnabled,
+		Endpoint:    config.TracingEndpoint,
+		ServiceName: config.TracingServiceName,
+		Version:     common.Version,
+		SampleRatio: config.TracingSampleRatio,
+	}); err != nil {
+		logger.FatalLog("failed to setup tracing: " + err.Error())
+	}
+
+	config.StateErrorHandler = func(err error) {
+		logger.SysError("state backend error: " + err.Error())
+	}
+	if err = config.InitStateBackend(); err != nil {
+		logger.FatalLog(fmt.Sprintf("failed to init state backend %s: %s", config.StateBackend, err.Error()))
+	}
+	logger.SysLog("using state backend: " + config.State.Name())
+
+	config.EventErrorHandler = func(err error) {
+		logger.SysError("event webhook error: " + err.Error())
+	}
 	model.InitTokenEncoders()
 	config.InitSGCookies()
+	go controller.MonitorCredentialPool()
+	if err = controller.InitBatches(); err != nil {
+		logger.FatalLog("failed to init batches: " + err.Error())
+	}
 
 	server := gin.New()
+	// 客户端 IP 由 ClientIP 中间件按 TRUSTED_PROXIES 解析
+	server.TrustedPlatform = middleware.ClientIPHeader
+	_ = server.SetTrustedProxies(nil)
+	server.Use(middleware.ClientIP())
+	server.Use(middleware.Drain())
 	server.Use(gin.Recovery())
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Tracing())
 	middleware.SetUpLogger(server)
 
 	// 设置API路由
 	router.SetApiRouter(server)
-	// 设置前端路由
-	//router.SetWebRouter(server, buildFS)
-
-	var port = os.Getenv("PORT")
-	if port == "" {
-		port = "10111"
-	}
+	// 设置管理面板路由
+	router.SetWebRouter(server, buildFS)
 
 	if config.DebugEnabled {
 		logger.SysLog("running in DEBUG mode.")
 	}
 
+	// 路由按启动时的配置创建后再开始热加载
+	go config.WatchConfigFile(func(reason string, err error) {
+		if err != nil {
+			logger.SysError(fmt.Sprintf("config reload (%s) failed, keeping current config: %s", reason, err.Error()))
+			return
+		}
+		if err := logger.SetLevel(config.LogLevel); err != nil {
+			logger.SysError("keeping current log level: " + err.Error())
+		}
+		logger.SysLog(fmt.Sprintf("config reloaded (%s) from %s", reason, config.ConfigFile))
+	})
+
+	srv := &http.Server{
+		Addr:    ":" + config.Port,
+		Handler: server,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+
 	logger.SysLog("rovo2api start success. enjoy it! ^_^\n")
 
-	err = server.Run(":" + port)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	// 恢复默认的信号处理, 关闭过程中再次收到信号时立即退出
+	stop()
+	gracefulShutdown(srv)
+}
+
+// gracefulShutdown 停止接收新请求并等待进行中的请求结束, 超过 SHUTDOWN_TIMEOUT 后取消剩余的请求(流式响应以错误事件结束);
+// 之后停止处理批量任务, 关闭审计日志、投递待发送的事件、保存运行状态并关闭链路追踪及日志
+func gracefulShutdown(srv *http.Server) {
+	timeout := time.Duration(config.ShutdownTimeout) * time.Second
+	logger.SysLog(fmt.Sprintf("shutting down, waiting up to %s for %d in-flight requests", timeout, shutdown.Inflight()))
+	shutdown.Begin()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.SysLog(fmt.Sprintf("aborting %d in-flight requests after %s", shutdown.Inflight(), timeout))
+		shutdown.Abort()
+		if !shutdown.Wait(shutdownAbortGrace) {
+			logger.SysError(fmt.Sprintf("%d requests did not finish after being aborted", shutdown.Inflight()))
+		}
+		_ = srv.Close()
+	}
 
-	if err != nil {
-		logger.FatalLog("failed to start HTTP server: " + err.Error())
+	batchCtx, batchCancel := context.WithTimeout(context.Background(), shutdownAbortGrace)
+	defer batchCancel()
+	if err := controller.CloseBatches(batchCtx); err != nil {
+		logger.SysError("failed to stop batch processing: " + err.Error())
+	}
+	if err := controller.CloseAuditLog(); err != nil {
+		logger.SysError("failed to close audit log: " + err.Error())
+	}
+	eventsCtx, eventsCancel := context.WithTimeout(context.Background(), shutdownAbortGrace)
+	defer eventsCancel()
+	if err := config.CloseEvents(eventsCtx); err != nil {
+		logger.SysError("failed to deliver pending events: " + err.Error())
 	}
+	if err := config.CloseStateBackend(); err != nil {
+		logger.SysError("failed to close state backend: " + err.Error())
+	} else if config.State.Name() == state.BackendMemory && config.StateFile != "" {
+		logger.SysLog("state saved to " + config.StateFile)
+	}
+	tracingCtx, tracingCancel := context.WithTimeout(context.Background(), shutdownAbortGrace)
+	defer tracingCancel()
+	if err := tracing.Shutdown(tracingCtx); err != nil {
+		logger.SysError("failed to flush traces: " + err.Error())
+	}
+
+	logger.SysLog("rovo2api stopped")
+	_ = logger.Close()
 }
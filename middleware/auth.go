@@ -1,33 +1,38 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
 	"net/http"
 	"rovo2api/common"
+	"rovo2api/common/audit"
 	"rovo2api/common/config"
 	logger "rovo2api/common/loggger"
 	"rovo2api/model"
 	"strings"
 )
 
-func isValidSecret(secret string) bool {
-	if config.ApiSecret == "" {
+func isValidSecret(settings *config.Settings, secret string) bool {
+	if settings.ApiSecret == "" {
 		return true
 	} else {
-		return lo.Contains(config.ApiSecrets, secret)
+		return lo.Contains(settings.ApiSecrets, secret)
 	}
 }
 
-func isValidBackendSecret(secret string) bool {
-	return config.BackendSecret != "" && !(config.BackendSecret == secret)
+// 未设置 BACKEND_SECRET 时管理接口不可用
+func isValidBackendSecret(settings *config.Settings, secret string) bool {
+	return settings.BackendSecret != "" && subtle.ConstantTimeCompare([]byte(settings.BackendSecret), []byte(secret)) == 1
 }
 
 func authHelperForOpenai(c *gin.Context) {
+	span := startSpan(c, "auth")
 	secret := c.Request.Header.Get("Authorization")
 	secret = strings.Replace(secret, "Bearer ", "", 1)
 
-	b := isValidSecret(secret)
+	b := isValidSecret(config.GetSettings(), secret)
+	span.End()
 
 	if !b {
 		c.JSON(http.StatusUnauthorized, model.OpenAIErrorResponse{
@@ -41,6 +46,8 @@ func authHelperForOpenai(c *gin.Context) {
 		return
 	}
 
+	logger.SetField(c.Request.Context(), logger.FieldAPIKey, audit.KeyID(secret))
+
 	//if config.ApiSecret == "" {
 	//	c.Request.Header.Set("Authorization", "")
 	//}
@@ -50,19 +57,23 @@ func authHelperForOpenai(c *gin.Context) {
 }
 
 func authHelperForBackend(c *gin.Context) {
+	span := startSpan(c, "auth")
 	secret := c.Request.Header.Get("Authorization")
 	secret = strings.Replace(secret, "Bearer ", "", 1)
-	if isValidBackendSecret(secret) {
-		logger.Debugf(c.Request.Context(), "BackendSecret is not empty, but not equal to %s", secret)
+	settings := config.GetSettings()
+	b := isValidBackendSecret(settings, secret)
+	span.End()
+	if !b {
+		if settings.BackendSecret == "" {
+			logger.Debugf(c.Request.Context(), "BackendSecret is not set, admin api rejected")
+		} else {
+			logger.Debugf(c.Request.Context(), "BackendSecret is not equal to %s", audit.KeyID(secret))
+		}
 		common.SendResponse(c, http.StatusUnauthorized, 1, "unauthorized", "")
 		c.Abort()
 		return
 	}
 
-	if config.BackendSecret == "" {
-		c.Request.Header.Set("Authorization", "")
-	}
-
 	c.Next()
 	return
 }
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rovo2api/common/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBackendAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name          string
+		backendSecret string
+		authorization string
+		want          int
+	}{
+		{"secret not set", "", "", http.StatusUnauthorized},
+		{"secret not set, any key", "", "Bearer anything", http.StatusUnauthorized},
+		{"missing key", "admin", "", http.StatusUnauthorized},
+		{"wrong key", "admin", "Bearer admin2", http.StatusUnauthorized},
+		{"valid key", "admin", "Bearer admin", http.StatusOK},
+		{"valid key without bearer", "admin", "admin", http.StatusOK},
+	}
+	previous := config.GetSettings()
+	t.Cleanup(func() { config.SetSettings(previous) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := *previous
+			settings.BackendSecret = tt.backendSecret
+			config.SetSettings(&settings)
+			router := gin.New()
+			router.GET("/api/status", BackendAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
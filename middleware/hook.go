@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"rovo2api/common/audit"
+	"rovo2api/common/config"
+	"rovo2api/common/helper"
+	logger "rovo2api/common/loggger"
+	"rovo2api/hook"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PreAuthHooks 创建请求的插件上下文, 并在校验 API-KEY 之前执行 pre_auth 阶段的插件
+func PreAuthHooks() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		route := config.TrimRoutePrefix(c.Request.URL.Path)
+		keyID := ""
+		if key := strings.Replace(c.Request.Header.Get("Authorization"), "Bearer ", "", 1); key != "" {
+			keyID = audit.KeyID(key)
+		}
+		req := hook.NewRequest(c.Request, c.Writer.Header(), route, keyID)
+		c.Set(helper.HookRequestKey, req)
+
+		if err := hook.Select(config.HookNames(route, keyID)).PreAuth(req); err != nil {
+			logger.Warnf(c.Request.Context(), "Request rejected by hook %v", err)
+			c.JSON(hook.ErrorResponse(err))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
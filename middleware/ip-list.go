@@ -1,28 +1,60 @@
 package middleware
 
 import (
-	"github.com/gin-gonic/gin"
 	"net/http"
 	"rovo2api/common/config"
-	"strings"
+	"rovo2api/common/ipfilter"
+	logger "rovo2api/common/loggger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIPHeader 解析后的客户端 IP, 由 ClientIP 中间件写入, 作为 gin 的 TrustedPlatform 供 c.ClientIP() 使用
+const ClientIPHeader = "X-Rovo2api-Client-Ip"
+
+// 访问控制作用的接口分组
+const (
+	IPGroupAll   = ""
+	IPGroupApi   = "api"
+	IPGroupAdmin = "admin"
 )
 
-// IPBlacklistMiddleware 检查请求的IP是否在黑名单中
-func IPBlacklistMiddleware() gin.HandlerFunc {
+// IPAllowed 判断 ip 能否访问该分组的接口, 需同时满足全局及分组的规则
+func IPAllowed(group string, ip string) bool {
+	access := config.GetIPAccess()
+	addr := ipfilter.ParseAddr(ip)
+	if !access.Global.Allowed(addr) {
+		return false
+	}
+	switch group {
+	case IPGroupApi:
+		return access.Api.Allowed(addr)
+	case IPGroupAdmin:
+		return access.Admin.Allowed(addr)
+	}
+	return true
+}
+
+// ClientIP 按受信任的代理解析客户端 IP, 需在其他中间件之前使用; 客户端传入的同名请求头会被覆盖
+func ClientIP() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 获取请求的IP地址
-		clientIP := c.ClientIP()
+		ip := ipfilter.ClientIP(c.Request.RemoteAddr, c.Request.Header, config.GetIPAccess().Trusted)
+		c.Request.Header.Set(ClientIPHeader, ip)
+		c.Next()
+	}
+}
 
-		// 检查IP是否在黑名单中
-		for _, blockedIP := range config.IpBlackList {
-			if strings.TrimSpace(blockedIP) == clientIP {
-				// 如果在黑名单中，返回403 Forbidden
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
-				return
-			}
+// IPAccess 检查客户端 IP 是否允许访问该分组的接口, 不允许时返回 403
+func IPAccess(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		span := startSpan(c, "ip_filter")
+		allowed := IPAllowed(group, c.ClientIP())
+		span.End()
+		if !allowed {
+			logger.Warnf(c.Request.Context(), "Forbidden client ip %s, group:%q", c.ClientIP(), group)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
 		}
-
-		// 如果不在黑名单中，继续处理请求
 		c.Next()
 	}
 }
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"rovo2api/common/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setTestIPAccess(t *testing.T, lists config.IPAccessLists) {
+	t.Helper()
+	access, err := config.ParseIPAccess(lists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.SetIPAccess(access)
+}
+
+func TestIPAllowed(t *testing.T) {
+	previous := config.GetIPAccess()
+	t.Cleanup(func() { config.SetIPAccess(previous) })
+	setTestIPAccess(t, config.IPAccessLists{
+		Deny:  []string{"203.0.113.0/24"},
+		Admin: config.IPLists{Allow: []string{"10.0.0.0/8"}},
+		Api:   config.IPLists{Deny: []string{"198.51.100.7"}},
+	})
+
+	tests := []struct {
+		group string
+		ip    string
+		want  bool
+	}{
+		{IPGroupAll, "192.0.2.1", true},
+		{IPGroupAll, "203.0.113.5", false},
+		{IPGroupApi, "192.0.2.1", true},
+		{IPGroupApi, "198.51.100.7", false},
+		{IPGroupAdmin, "10.1.2.3", true},
+		{IPGroupAdmin, "192.0.2.1", false},
+		{IPGroupAdmin, "203.0.113.5", false},
+	}
+	for _, tt := range tests {
+		if got := IPAllowed(tt.group, tt.ip); got != tt.want {
+			t.Errorf("IPAllowed(%q, %s) = %v, want %v", tt.group, tt.ip, got, tt.want)
+		}
+	}
+}
+
+// 管理接口修改访问控制时, 进行中的请求读取到的是完整的旧配置或新配置
+func TestIPAccessConcurrentUpdate(t *testing.T) {
+	previous := config.GetIPAccess()
+	t.Cleanup(func() { config.SetIPAccess(previous) })
+	open, err := config.ParseIPAccess(config.IPAccessLists{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := config.ParseIPAccess(config.IPAccessLists{Deny: []string{"0.0.0.0/0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if i%2 == 0 {
+				config.SetIPAccess(closed)
+			} else {
+				config.SetIPAccess(open)
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		IPAllowed(IPGroupAdmin, "192.0.2.1")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// 客户端传入的 X-Rovo2api-Client-Ip 被解析结果覆盖, 不能借此伪造 c.ClientIP()
+func TestClientIPOverwritesHeader(t *testing.T) {
+	previous := config.GetIPAccess()
+	t.Cleanup(func() { config.SetIPAccess(previous) })
+	setTestIPAccess(t, config.IPAccessLists{TrustedProxies: []string{"10.0.0.0/8"}})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.TrustedPlatform = ClientIPHeader
+	router.Use(ClientIP())
+	router.GET("/ip", func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	})
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"untrusted remote", "203.0.113.9:5000", "", "203.0.113.9"},
+		{"untrusted remote with X-Forwarded-For", "203.0.113.9:5000", "198.51.100.20", "203.0.113.9"},
+		{"trusted proxy", "10.0.0.1:5000", "198.51.100.20", "198.51.100.20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set(ClientIPHeader, "192.0.2.66")
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("client ip = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
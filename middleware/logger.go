@@ -4,22 +4,47 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"rovo2api/common/helper"
+	logger "rovo2api/common/loggger"
+	"strconv"
 )
 
 func SetUpLogger(server *gin.Engine) {
 	server.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 		var requestID string
 		if param.Keys != nil {
-			requestID = param.Keys[helper.RequestIdKey].(string)
+			requestID, _ = param.Keys[helper.RequestIdKey].(string)
 		}
-		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %7s %s\n",
-			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
-			requestID,
-			param.StatusCode,
-			param.Latency,
-			param.ClientIP,
-			param.Method,
-			param.Path,
-		)
+		var fields []logger.Field
+		if param.Request != nil {
+			fields = logger.ContextFields(param.Request.Context())
+		}
+		if logger.Format() == logger.FormatText {
+			return logger.FormatEntry(logger.Entry{
+				Time:      param.TimeStamp,
+				Tag:       "GIN",
+				RequestID: requestID,
+				Msg: fmt.Sprintf("%3d | %13v | %15s | %7s %s",
+					param.StatusCode,
+					param.Latency,
+					param.ClientIP,
+					param.Method,
+					param.Path,
+				),
+				Fields: fields,
+			})
+		}
+		return logger.FormatEntry(logger.Entry{
+			Time:      param.TimeStamp,
+			Level:     "info",
+			RequestID: requestID,
+			Msg:       "access",
+			Fields: append([]logger.Field{
+				{Key: "status", Value: strconv.Itoa(param.StatusCode)},
+				{Key: "latency_ms", Value: strconv.FormatInt(param.Latency.Milliseconds(), 10)},
+				{Key: "client_ip", Value: param.ClientIP},
+				{Key: "method", Value: param.Method},
+				{Key: "path", Value: param.Path},
+			}, fields...),
+		})
 	}))
 }
@@ -1,36 +1,56 @@
 package middleware
 
 import (
-	"github.com/gin-gonic/gin"
 	"net/http"
 	"rovo2api/common"
+	"rovo2api/common/audit"
 	"rovo2api/common/config"
-)
-
-var timeFormat = "2006-01-02T15:04:05.000Z"
+	"rovo2api/common/helper"
+	"rovo2api/model"
+	"strings"
 
-var inMemoryRateLimiter common.InMemoryRateLimiter
+	"github.com/gin-gonic/gin"
+)
 
-func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
-	key := mark + c.ClientIP()
-	if !inMemoryRateLimiter.Request(key, maxRequestNum, duration) {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"success": false,
-			"message": "请求过于频繁,请稍后再试",
-		})
-		c.Abort()
-		return
+// 限流标识: 携带有效的 API-KEY 时按 API-KEY 计算, 否则(含未配置 API_SECRET)按客户端 IP
+func rateLimitIdentity(c *gin.Context) string {
+	if settings := config.GetSettings(); settings.ApiSecret != "" {
+		secret := strings.Replace(c.Request.Header.Get("Authorization"), "Bearer ", "", 1)
+		if secret != "" && isValidSecret(settings, secret) {
+			return audit.KeyID(secret)
+		}
 	}
+	return "ip-" + c.ClientIP()
 }
 
-func rateLimitFactory(maxRequestNum int, duration int64, mark string) func(c *gin.Context) {
-	// It's safe to call multi times.
-	inMemoryRateLimiter.Init(config.RateLimitKeyExpirationDuration)
+// RequestRateLimit 每分钟请求数的令牌桶限流, 令牌桶保存在状态后端中, 多实例部署时共享; 状态后端不可用时放行.
+// 限流标识写入 helper.RateLimitKey, 供按 token 数限流使用
+func RequestRateLimit() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		memoryRateLimiter(c, maxRequestNum, duration, mark)
-	}
-}
+		key := rateLimitIdentity(c)
+		c.Set(helper.RateLimitKey, key)
 
-func RequestRateLimit() func(c *gin.Context) {
-	return rateLimitFactory(config.RequestRateLimitNum, config.RequestRateLimitDuration, "REQUEST_RATE_LIMIT")
+		// 每次请求时读取, 以便配置热加载后立即生效
+		limit := config.GetSettings().RequestRateLimitNum
+		if limit <= 0 {
+			return
+		}
+		span := startSpan(c, "rate_limit")
+		result, ok := config.TakeRateLimit("rpm:"+key, limit, 1, false)
+		span.End()
+		if !ok {
+			return
+		}
+		common.SetRateLimitHeaders(c, "requests", limit, result)
+		if !result.Allowed {
+			c.JSON(http.StatusTooManyRequests, model.OpenAIErrorResponse{
+				OpenAIError: model.OpenAIError{
+					Message: "请求过于频繁,请稍后再试",
+					Type:    "requests",
+					Code:    "rate_limit_exceeded",
+				},
+			})
+			c.Abort()
+		}
+	}
 }
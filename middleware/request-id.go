@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/gin-gonic/gin"
 	"rovo2api/common/helper"
+	logger "rovo2api/common/loggger"
 )
 
 func RequestId() func(c *gin.Context) {
@@ -11,7 +12,7 @@ func RequestId() func(c *gin.Context) {
 		id := helper.GenRequestID()
 		c.Set(helper.RequestIdKey, id)
 		ctx := context.WithValue(c.Request.Context(), helper.RequestIdKey, id)
-		c.Request = c.Request.WithContext(ctx)
+		c.Request = c.Request.WithContext(logger.WithFields(ctx))
 		c.Header(helper.RequestIdKey, id)
 		c.Next()
 	}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"rovo2api/common/shutdown"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Drain 统计进行中的请求, 关闭时等待其结束; 超过 SHUTDOWN_TIMEOUT 后请求上下文被取消
+func Drain() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx, done := shutdown.Track(c.Request.Context())
+		defer done()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	logger "rovo2api/common/loggger"
+	"rovo2api/common/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 为每个请求创建根 span, 请求头中带有 traceparent 时作为其子 span
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		propagator := otel.GetTextMapPropagator()
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := tracing.Start(ctx, name,
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(c.Request.URL.Path),
+			semconv.ClientAddress(c.ClientIP()),
+			semconv.UserAgentOriginal(c.Request.UserAgent()),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		propagator.Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
+		logger.SetField(ctx, logger.FieldTraceID, tracing.TraceID(ctx))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
+
+// startSpan 为中间件的校验逻辑创建 span, 需在 c.Next() 之前结束
+func startSpan(c *gin.Context, name string) trace.Span {
+	_, span := tracing.Start(c.Request.Context(), name)
+	return span
+}
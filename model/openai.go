@@ -15,6 +15,8 @@ type OpenAIChatCompletionRequest struct {
 	FrequencyPenalty float64             `json:"frequency_penalty,omitempty"`
 	PresencePenalty  float64             `json:"presence_penalty,omitempty"`
 	TopP             float64             `json:"top_p,omitempty"`
+	User             string              `json:"user,omitempty"`
+	Stop             interface{}         `json:"stop,omitempty"` // 字符串或字符串数组
 }
 
 type OpenAIChatMessage struct {
@@ -219,6 +221,30 @@ func processMessageContent(content interface{}) (interface{}, error) {
 	return string(contentBytes), nil
 }
 
+// StopSequences 返回非空的停止序列
+func (r *OpenAIChatCompletionRequest) StopSequences() []string {
+	var sequences []string
+	switch stop := r.Stop.(type) {
+	case string:
+		sequences = append(sequences, stop)
+	case []interface{}:
+		for _, item := range stop {
+			if sequence, ok := item.(string); ok {
+				sequences = append(sequences, sequence)
+			}
+		}
+	case []string:
+		sequences = append(sequences, stop...)
+	}
+	result := sequences[:0]
+	for _, sequence := range sequences {
+		if sequence != "" {
+			result = append(result, sequence)
+		}
+	}
+	return result
+}
+
 func (r *OpenAIChatCompletionRequest) AddMessage(message OpenAIChatMessage) {
 	r.Messages = append([]OpenAIChatMessage{message}, r.Messages...)
 }
@@ -239,8 +265,11 @@ func (r *OpenAIChatCompletionRequest) PrependMessagesFromJSON(jsonString string)
 		}
 	}
 
-	// 将 newMessages 插入到找到的索引后面
-	r.Messages = append(r.Messages[:insertIndex], append(newMessages, r.Messages[insertIndex:]...)...)
+	// 将 newMessages 插入到找到的索引后面, 使用新的切片以免修改共享的底层数组
+	messages := make([]OpenAIChatMessage, 0, len(r.Messages)+len(newMessages))
+	messages = append(messages, r.Messages[:insertIndex]...)
+	messages = append(messages, newMessages...)
+	r.Messages = append(messages, r.Messages[insertIndex:]...)
 	return nil
 }
 
@@ -351,24 +380,62 @@ type GetUserContent interface {
 }
 
 type OpenAIModerationRequest struct {
-	Input string `json:"input"`
+	Input interface{} `json:"input"` // 字符串、字符串数组或 [{"type":"text","text":"..."}]
+	Model string      `json:"model,omitempty"`
+}
+
+// Texts 需要审核的文本, 忽略非文本的输入
+func (r OpenAIModerationRequest) Texts() ([]string, error) {
+	switch input := r.Input.(type) {
+	case string:
+		return []string{input}, nil
+	case []interface{}:
+		var texts []string
+		for _, item := range input {
+			switch value := item.(type) {
+			case string:
+				texts = append(texts, value)
+			case map[string]interface{}:
+				if value["type"] == "text" {
+					text, _ := value["text"].(string)
+					texts = append(texts, text)
+				}
+			default:
+				return nil, fmt.Errorf("unsupported input item %v", item)
+			}
+		}
+		return texts, nil
+	}
+	return nil, fmt.Errorf("input must be a string or an array")
 }
 
 type OpenAIModerationResponse struct {
-	ID      string `json:"id"`
-	Model   string `json:"model"`
-	Results []struct {
-		Flagged        bool               `json:"flagged"`
-		Categories     map[string]bool    `json:"categories"`
-		CategoryScores map[string]float64 `json:"category_scores"`
-	} `json:"results"`
+	ID      string                   `json:"id"`
+	Model   string                   `json:"model"`
+	Results []OpenAIModerationResult `json:"results"`
+}
+
+type OpenAIModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
 }
 
 type OpenaiModelResponse struct {
-	ID     string `json:"id"`
-	Object string `json:"object"`
-	//Created time.Time `json:"created"`
-	//OwnedBy string    `json:"owned_by"`
+	ID              string                  `json:"id"`
+	Object          string                  `json:"object"`
+	Created         int64                   `json:"created"`
+	OwnedBy         string                  `json:"owned_by"`
+	Root            string                  `json:"root"`
+	Parent          string                  `json:"parent,omitempty"`
+	ContextWindow   int                     `json:"context_window"`
+	MaxOutputTokens int                     `json:"max_output_tokens"`
+	Capabilities    OpenaiModelCapabilities `json:"capabilities"`
+}
+
+type OpenaiModelCapabilities struct {
+	Vision bool `json:"vision"`
+	Tools  bool `json:"tools"`
 }
 
 // ModelList represents a list of models.
@@ -459,3 +526,10 @@ func (r *OpenAIChatCompletionRequest) RemoveEmptyContentMessages() *OpenAIChatCo
 	r.Messages = filteredMessages
 	return r
 }
+
+type OpenAICreateBatchRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"rovo2api/common/config"
+	logger "rovo2api/common/loggger"
 	"rovo2api/controller"
 	"rovo2api/middleware"
 	"strings"
@@ -16,25 +17,71 @@ import (
 )
 
 func SetApiRouter(router *gin.Engine) {
+	// 健康检查不经过 IP 访问控制及限流, 供容器编排及负载均衡探测
+	router.GET("/", controller.Healthz)
+	router.GET("/healthz", controller.Healthz)
+	router.GET("/readyz", controller.Readyz)
+
 	router.Use(middleware.CORS())
-	router.Use(middleware.IPBlacklistMiddleware())
+	router.Use(middleware.IPAccess(middleware.IPGroupAll))
 	router.Use(middleware.RequestRateLimit())
 
 	if config.SwaggerEnable == "" || config.SwaggerEnable == "1" {
 		router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	}
 
-	// *有静态资源时注释此行
-	router.GET("/")
-
 	v1Router := router.Group(fmt.Sprintf("%s/v1", ProcessPath(config.RoutePrefix)))
 
+	v1Router.Use(middleware.IPAccess(middleware.IPGroupApi))
+	v1Router.Use(middleware.PreAuthHooks())
 	if !config.CustomHeaderKeyEnabled == true {
 		v1Router.Use(middleware.OpenAIAuth())
 	}
 	v1Router.POST("/chat/completions", controller.ChatForOpenAI)
 	//v1Router.POST("/images/generations", controller.ImagesForOpenAI)
 	v1Router.GET("/models", controller.OpenaiModels)
+	v1Router.POST("/moderations", controller.Moderations)
+	if config.BatchEnabled {
+		v1Router.POST("/files", controller.UploadFile)
+		v1Router.GET("/files", controller.ListFiles)
+		v1Router.GET("/files/:file_id", controller.GetFile)
+		v1Router.GET("/files/:file_id/content", controller.GetFileContent)
+		v1Router.DELETE("/files/:file_id", controller.DeleteFile)
+		v1Router.POST("/batches", controller.CreateBatch)
+		v1Router.GET("/batches", controller.ListBatches)
+		v1Router.GET("/batches/:batch_id", controller.GetBatch)
+		v1Router.POST("/batches/:batch_id/cancel", controller.CancelBatch)
+	}
+
+	if config.BackendApiEnable == 1 {
+		if config.BackendSecret == "" {
+			logger.SysLog("admin api requires BACKEND_SECRET, all /api requests will be rejected")
+		}
+		apiRouter := router.Group(fmt.Sprintf("%s/api", ProcessPath(config.RoutePrefix)))
+		apiRouter.Use(middleware.IPAccess(middleware.IPGroupAdmin))
+		apiRouter.Use(middleware.BackendAuth())
+		apiRouter.GET("/status", controller.Status)
+		apiRouter.GET("/cache/stats", controller.ResponseCacheStats)
+		apiRouter.DELETE("/cache", controller.PurgeResponseCache)
+		apiRouter.GET("/log/level", controller.GetLogLevel)
+		apiRouter.PUT("/log/level", controller.SetLogLevel)
+		apiRouter.GET("/credentials", controller.CredentialStatuses)
+		apiRouter.POST("/credentials", controller.AddCredential)
+		apiRouter.DELETE("/credentials/invalid", controller.ClearInvalidCredentials)
+		apiRouter.POST("/credentials/:key/disable", controller.DisableCredential)
+		apiRouter.POST("/credentials/:key/enable", controller.EnableCredential)
+		apiRouter.POST("/credentials/:key/validate", controller.ValidateCredential)
+		apiRouter.GET("/requests", controller.MonitorRequests)
+		apiRouter.GET("/usage", controller.MonitorUsage)
+		apiRouter.GET("/config", controller.DashboardConfig)
+		apiRouter.GET("/scheduler", controller.SchedulerStats)
+		apiRouter.GET("/prompts", controller.GetPromptPolicies)
+		apiRouter.PUT("/prompts", controller.SetPromptPolicies)
+		apiRouter.POST("/prompts/preview", controller.PreviewPrompt)
+		apiRouter.GET("/ip-access", controller.GetIPAccess)
+		apiRouter.PUT("/ip-access", controller.SetIPAccess)
+		apiRouter.POST("/events/test", controller.TestEvent)
+	}
 
 }
 
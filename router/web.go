@@ -2,54 +2,42 @@ package router
 
 import (
 	"embed"
+	"fmt"
 	"net/http"
 	"rovo2api/common"
+	"rovo2api/common/config"
 	logger "rovo2api/common/loggger"
 	"rovo2api/middleware"
-	"strings"
 
 	"github.com/gin-contrib/gzip"
-	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 )
 
+// SetWebRouter 管理面板, 页面嵌入在程序中, 挂载于 <ROUTE_PREFIX>/dashboard/;
+// 页面本身不含数据, 数据通过需要 BACKEND_SECRET 的 /api 管理接口获取
 func SetWebRouter(router *gin.Engine, buildFS embed.FS) {
-	// 尝试从嵌入的文件系统中读取前端首页文件
-	indexPageData, err := buildFS.ReadFile("web/dist/index.html")
-	if err != nil {
-		logger.Errorf(nil, "Failed to read web index.html: %s", err.Error())
-		logger.SysLog("Frontend will not be available!")
+	if !config.DashboardEnable || config.BackendApiEnable != 1 {
+		return
+	}
+	if config.BackendSecret == "" {
+		logger.SysLog("dashboard disabled: BACKEND_SECRET is not set")
+		return
+	}
+	if _, err := buildFS.ReadFile("web/dist/index.html"); err != nil {
+		logger.SysError("dashboard disabled, failed to read web index.html: " + err.Error())
 		return
 	}
 
-	router.Use(gzip.Gzip(gzip.DefaultCompression))
-	//router.Use(middleware.GlobalWebRateLimit())
-	router.Use(middleware.Cache())
-	router.Use(static.Serve("/", common.EmbedFolder(buildFS, "web/dist")))
-
-	// 处理所有非API路由，将它们重定向到前端应用
-	router.NoRoute(func(c *gin.Context) {
-		path := c.Request.URL.Path
-
-		// 处理 API 请求，让它们返回404
-		if strings.HasPrefix(path, "/v1") || strings.HasPrefix(path, "/api") {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "API endpoint not found",
-				"path":  path,
-				"code":  404,
-			})
-			return
-		}
-
-		// 处理静态资源请求
-		if strings.Contains(path, ".") {
-			// 可能是静态资源请求 (.js, .css, .png 等)
-			c.Status(http.StatusNotFound)
-			return
-		}
+	prefix := fmt.Sprintf("%s/dashboard", ProcessPath(config.RoutePrefix))
+	files := http.StripPrefix(prefix, http.FileServer(common.EmbedFolder(buildFS, "web/dist")))
 
-		// 所有其他请求都返回前端入口页面，让前端路由处理
+	webRouter := router.Group(prefix)
+	webRouter.Use(middleware.IPAccess(middleware.IPGroupAdmin))
+	webRouter.Use(gzip.Gzip(gzip.DefaultCompression))
+	webRouter.GET("/*filepath", func(c *gin.Context) {
+		// 文件随程序版本变化, 每次都需重新校验
 		c.Header("Cache-Control", "no-cache")
-		c.Data(http.StatusOK, "text/html; charset=utf-8", indexPageData)
+		files.ServeHTTP(c.Writer, c.Request)
 	})
+	logger.SysLog("dashboard available at " + prefix + "/")
 }
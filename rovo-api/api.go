@@ -1,9 +1,9 @@
 package rovo_api
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
-	"github.com/gin-gonic/gin"
 	"rovo2api/common"
 	"rovo2api/common/config"
 	logger "rovo2api/common/loggger"
@@ -11,14 +11,15 @@ import (
 )
 
 const (
-	atlassianAPIEndpoint = "https://api.atlassian.com/rovodev/v2/proxy/ai"
-	unifiedChatPath      = "/v2/beta/chat"
+	UnifiedChatPath = "/v2/beta/chat"
 )
 
-func MakeStreamChatRequest(c *gin.Context, client cycletls.CycleTLS, jsonData []byte, cookie string, modelInfo common.ModelInfo) (<-chan cycletls.SSEResponse, error) {
+// MakeStreamChatRequest 发起一次上游对话请求, ctx 结束时中断上游连接
+func MakeStreamChatRequest(ctx context.Context, client cycletls.CycleTLS, jsonData []byte, cookie string, modelInfo common.ModelInfo) (<-chan cycletls.SSEResponse, error) {
 	encoded := base64.StdEncoding.EncodeToString([]byte(cookie))
 
-	endpoint := atlassianAPIEndpoint + unifiedChatPath
+	settings := config.GetSettings()
+	endpoint := settings.RovoApiBaseUrl + UnifiedChatPath
 	headers := map[string]string{
 		"Content-Type":             "application/json",
 		"Accept":                   "application/json",
@@ -27,18 +28,21 @@ func MakeStreamChatRequest(c *gin.Context, client cycletls.CycleTLS, jsonData []
 	}
 
 	options := cycletls.Options{
-		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
-		Body:    string(jsonData),
-		Method:  "POST",
-		Headers: headers,
+		Timeout:   settings.UpstreamTimeout,
+		Proxy:     settings.ProxyUrl, // 在每个请求中设置代理
+		Body:      string(jsonData),
+		Method:    "POST",
+		Headers:   headers,
+		Profile:   settings.ResolveTLSProfile(cookie),
+		UserAgent: settings.UserAgent,
+		Context:   ctx,
 	}
 
-	logger.Debug(c.Request.Context(), fmt.Sprintf("cookie: %v", cookie))
+	logger.Debug(ctx, fmt.Sprintf("credential: %s", config.CredentialName(cookie)))
 
 	sseChan, err := client.DoSSE(endpoint, options, "POST")
 	if err != nil {
-		logger.Errorf(c, "Failed to make stream request: %v", err)
+		logger.Errorf(ctx, "Failed to make stream request: %v", err)
 		return nil, fmt.Errorf("Failed to make stream request: %v", err)
 	}
 	return sseChan, nil
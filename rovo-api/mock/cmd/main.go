@@ -0,0 +1,52 @@
+// Command mock runs the mock Rovo upstream as a standalone server, e.g.
+//
+//	go run ./rovo-api/mock/cmd -addr :18080 -script "a@b.com:token=rate_limit,reply"
+//	RV_API_BASE_URL=http://127.0.0.1:18080 go run .
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"rovo2api/rovo-api/mock"
+)
+
+func main() {
+	addr := flag.String("addr", ":18080", "listen address")
+	defaultBehavior := flag.String("default", "reply", "behavior for credentials without a script: reply, rate_limit, usage_exceeded, invalid_token, unavailable, drop, unfinished, slow")
+	var scripts []string
+	flag.Func("script", "credential=behavior[,behavior...], may be repeated", func(value string) error {
+		scripts = append(scripts, value)
+		return nil
+	})
+	flag.Parse()
+
+	server := mock.NewHandler()
+
+	behavior, err := mock.ParseBehavior(*defaultBehavior)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.SetDefault(behavior)
+
+	for _, script := range scripts {
+		idx := strings.LastIndex(script, "=")
+		if idx <= 0 {
+			log.Fatalf("invalid script %q, expected credential=behavior", script)
+		}
+		var behaviors []mock.Behavior
+		for _, name := range strings.Split(script[idx+1:], ",") {
+			behavior, err := mock.ParseBehavior(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			behaviors = append(behaviors, behavior)
+		}
+		server.Script(script[:idx], behaviors...)
+	}
+
+	log.Printf("mock rovo upstream listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
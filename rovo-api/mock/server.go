@@ -0,0 +1,310 @@
+// Package mock provides a local stand-in for the Rovo `/v2/beta/chat` endpoint.
+// Point RV_API_BASE_URL at Server.URL and script per-credential responses to
+// exercise streaming, failover and upstream error handling without real
+// Atlassian accounts.
+package mock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	rovoapi "rovo2api/rovo-api"
+)
+
+// 上游返回的错误体, 与 common.IsRateLimit 等判断保持一致
+const (
+	RateLimitBody          = `{"error":"Too many concurrent requests","message":"You have reached your maximum concurrent request limit. Please try again later."}`
+	UsageExceededBody      = `{"error":"Usage limit exceeded","message":"You have exceeded your usage limit. Please try again later."}`
+	InvalidTokenBody       = `{"error":"Invalid token"}`
+	ServiceUnavailableBody = `{"error":"Service Unavailable","message":"The service is temporarily unavailable. Please try again later."}`
+)
+
+// Behavior describes how the mock answers a single chat request
+type Behavior struct {
+	Status    int           // 非 2xx 时直接返回 Body
+	Body      string        // 错误响应体
+	Chunks    []string      // 流式返回的文本片段
+	DropAfter int           // 发送 DropAfter 个片段后直接断开连接, 0 表示不断开
+	Delay     time.Duration // 每个片段之间的间隔
+	NoFinish  bool          // 不发送 end_turn 及 [DONE], 正常结束响应
+	Fail      string        // 发送片段后以 error 事件返回该错误体
+}
+
+// Reply streams chunks as assistant text and finishes with end_turn
+func Reply(chunks ...string) Behavior {
+	return Behavior{Status: http.StatusOK, Chunks: chunks}
+}
+
+// RateLimit answers like an account that has too many concurrent requests
+func RateLimit() Behavior {
+	return Behavior{Status: http.StatusTooManyRequests, Body: RateLimitBody}
+}
+
+// UsageExceeded answers like an account whose quota is used up
+func UsageExceeded() Behavior {
+	return Behavior{Status: http.StatusTooManyRequests, Body: UsageExceededBody}
+}
+
+// InvalidToken answers like a revoked or malformed credential
+func InvalidToken() Behavior {
+	return Behavior{Status: http.StatusUnauthorized, Body: InvalidTokenBody}
+}
+
+// ServiceUnavailable answers like an upstream outage
+func ServiceUnavailable() Behavior {
+	return Behavior{Status: http.StatusServiceUnavailable, Body: ServiceUnavailableBody}
+}
+
+// DropMidStream sends chunks and then closes the connection without finishing the stream
+func DropMidStream(chunks ...string) Behavior {
+	return Behavior{Status: http.StatusOK, Chunks: chunks, DropAfter: len(chunks)}
+}
+
+// Unfinished sends chunks and ends the response normally without end_turn or [DONE]
+func Unfinished(chunks ...string) Behavior {
+	return Behavior{Status: http.StatusOK, Chunks: chunks, NoFinish: true}
+}
+
+// FailMidStream sends chunks and then reports body as an SSE error event, like an outage mid-answer
+func FailMidStream(body string, chunks ...string) Behavior {
+	return Behavior{Status: http.StatusOK, Chunks: chunks, Fail: body}
+}
+
+// SlowReply streams chunks with delay between them, like a long completion
+func SlowReply(delay time.Duration, chunks ...string) Behavior {
+	return Behavior{Status: http.StatusOK, Chunks: chunks, Delay: delay}
+}
+
+// ParseBehavior maps a behavior name to a Behavior, used by the standalone mock command
+func ParseBehavior(name string) (Behavior, error) {
+	switch strings.TrimSpace(strings.ToLower(name)) {
+	case "reply", "":
+		return Reply("Hello", " from", " mock", " Rovo."), nil
+	case "rate_limit":
+		return RateLimit(), nil
+	case "usage_exceeded":
+		return UsageExceeded(), nil
+	case "invalid_token":
+		return InvalidToken(), nil
+	case "unavailable":
+		return ServiceUnavailable(), nil
+	case "drop":
+		return DropMidStream("Hello", " from"), nil
+	case "unfinished":
+		return Unfinished("Hello", " from"), nil
+	case "slow":
+		return SlowReply(time.Second, "Hello", " from", " slow", " mock", " Rovo."), nil
+	default:
+		return Behavior{}, fmt.Errorf("unknown mock behavior: %s", name)
+	}
+}
+
+// Request is a chat request received by the mock
+type Request struct {
+	Credential string
+	Body       map[string]interface{}
+}
+
+// Server is a scriptable mock Rovo upstream
+type Server struct {
+	URL string
+
+	server          *httptest.Server
+	mu              sync.Mutex
+	defaultBehavior Behavior
+	scripts         map[string][]Behavior
+	sequence        []Behavior
+	requests        []Request
+}
+
+// NewServer starts a mock upstream listening on a random local port
+func NewServer() *Server {
+	s := NewHandler()
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+// NewHandler creates a mock upstream without starting a listener
+func NewHandler() *Server {
+	return &Server{
+		defaultBehavior: Reply("Hello", " from", " mock", " Rovo."),
+		scripts:         make(map[string][]Behavior),
+	}
+}
+
+// Close shuts the listener down
+func (s *Server) Close() {
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// SetDefault sets the behavior used for credentials without a script
+func (s *Server) SetDefault(behavior Behavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultBehavior = behavior
+}
+
+// Script queues behaviors for a credential (email:token). Each request takes
+// the next behavior, the last one is repeated once the queue is drained.
+func (s *Server) Script(credential string, behaviors ...Behavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[credential] = behaviors
+}
+
+// Sequence queues behaviors for the next requests whichever credential they
+// use, ahead of the per-credential scripts. Tests use it to fail the first
+// attempt without depending on which credential the proxy picks.
+func (s *Server) Sequence(behaviors ...Behavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sequence = behaviors
+}
+
+// Requests returns a copy of all chat requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+func (s *Server) nextBehavior(credential string) Behavior {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sequence) > 0 {
+		behavior := s.sequence[0]
+		s.sequence = s.sequence[1:]
+		return behavior
+	}
+	queue, ok := s.scripts[credential]
+	if !ok || len(queue) == 0 {
+		return s.defaultBehavior
+	}
+	behavior := queue[0]
+	if len(queue) > 1 {
+		s.scripts[credential] = queue[1:]
+	}
+	return behavior
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != rovoapi.UnifiedChatPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	credential, ok := decodeCredential(r)
+	if !ok {
+		writeError(w, InvalidToken())
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"Invalid request body"}`))
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Credential: credential, Body: body})
+	s.mu.Unlock()
+
+	behavior := s.nextBehavior(credential)
+	if behavior.Status != 0 && behavior.Status != http.StatusOK {
+		writeError(w, behavior)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	for i, chunk := range behavior.Chunks {
+		if behavior.Delay > 0 {
+			time.Sleep(behavior.Delay)
+		}
+		writeEvent(w, chunkPayload(chunk, nil))
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if behavior.DropAfter > 0 && i+1 >= behavior.DropAfter {
+			// 不发送结束事件, 直接中断连接
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	if behavior.Fail != "" {
+		_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", behavior.Fail)
+		return
+	}
+	if behavior.NoFinish {
+		return
+	}
+	finishReason := "end_turn"
+	writeEvent(w, chunkPayload("", &finishReason))
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func decodeCredential(r *http.Request) (string, bool) {
+	encoded := strings.TrimPrefix(r.Header.Get("Authorization"), "Basic ")
+	if encoded == "" || encoded != r.Header.Get("X-Atlassian-EncodedToken") {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !strings.Contains(string(decoded), ":") {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+func writeError(w http.ResponseWriter, behavior Behavior) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(behavior.Status)
+	_, _ = w.Write([]byte(behavior.Body))
+}
+
+func chunkPayload(text string, finishReason *string) map[string]interface{} {
+	content := []interface{}{}
+	if text != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": text})
+	}
+	return map[string]interface{}{
+		"response_payload": map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{
+					"index": 0,
+					"message": map[string]interface{}{
+						"role":    "assistant",
+						"content": content,
+					},
+					"finish_reason": finishReason,
+				},
+			},
+		},
+	}
+}
+
+func writeEvent(w http.ResponseWriter, payload map[string]interface{}) {
+	data, _ := json.Marshal(payload)
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+}
@@ -0,0 +1,344 @@
+(function () {
+  'use strict';
+
+  // 管理接口与面板共用 ROUTE_PREFIX: <prefix>/dashboard/ -> <prefix>/api
+  var API = location.pathname.replace(/\/dashboard(\/.*)?$/, '') + '/api';
+  var SECRET_KEY = 'rovo2api_backend_secret';
+  var REFRESH_INTERVAL = 10000;
+  var COLORS = ['#2563eb', '#16a34a', '#d97706', '#dc2626', '#7c3aed', '#0891b2', '#db2777', '#65a30d', '#9ca3af'];
+
+  var $ = function (id) { return document.getElementById(id); };
+  var secret = localStorage.getItem(SECRET_KEY) || '';
+  var timer = null;
+
+  function escape(value) {
+    return String(value == null ? '' : value).replace(/[&<>"']/g, function (c) {
+      return { '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c];
+    });
+  }
+
+  function api(method, path, body) {
+    var options = { method: method, headers: { Authorization: 'Bearer ' + secret } };
+    if (body !== undefined) {
+      options.headers['Content-Type'] = 'application/json';
+      options.body = JSON.stringify(body);
+    }
+    return fetch(API + path, options).then(function (res) {
+      if (res.status === 401) {
+        logout('BACKEND_SECRET 错误');
+        throw new Error('unauthorized');
+      }
+      return res.json().then(function (result) {
+        if (result.code !== 0) {
+          throw new Error(result.message || ('HTTP ' + res.status));
+        }
+        return result.data;
+      });
+    });
+  }
+
+  function formatTime(value) {
+    return value ? new Date(value).toLocaleTimeString() : '';
+  }
+
+  function formatMs(ms) {
+    return ms >= 1000 ? (ms / 1000).toFixed(1) + 's' : ms + 'ms';
+  }
+
+  function formatNumber(n) {
+    if (n >= 1e6) return (n / 1e6).toFixed(1) + 'M';
+    if (n >= 1e4) return (n / 1e3).toFixed(1) + 'k';
+    return String(n);
+  }
+
+  function table(columns, rows, empty) {
+    if (!rows.length) {
+      return '<p class="muted">' + (empty || '暂无数据') + '</p>';
+    }
+    var html = '<table><thead><tr>';
+    columns.forEach(function (col) { html += '<th>' + col[0] + '</th>'; });
+    html += '</tr></thead><tbody>';
+    rows.forEach(function (row) {
+      html += '<tr>';
+      columns.forEach(function (col) { html += col[1](row); });
+      html += '</tr>';
+    });
+    return html + '</tbody></table>';
+  }
+
+  function td(value) {
+    return '<td>' + escape(value) + '</td>';
+  }
+
+  function badge(kind, text) {
+    return '<span class="badge ' + kind + '">' + escape(text) + '</span>';
+  }
+
+  // 凭证状态: 失效 > 冷却 > 可用
+  function credentialState(cred) {
+    if (cred.invalid === 'disabled') return badge('bad', '已停用');
+    if (cred.invalid) return badge('bad', '失效: ' + cred.invalid);
+    var now = Date.now();
+    var cooling = Object.keys(cred.cooldowns || {}).filter(function (m) {
+      return new Date(cred.cooldowns[m]).getTime() > now;
+    });
+    if (cooling.length) return badge('warn', '冷却 ' + cooling.length + ' 个模型');
+    return badge('ok', '可用');
+  }
+
+  function cooldownText(cred) {
+    var now = Date.now();
+    return Object.keys(cred.cooldowns || {}).filter(function (m) {
+      return new Date(cred.cooldowns[m]).getTime() > now;
+    }).map(function (m) {
+      return m + ' 至 ' + formatTime(cred.cooldowns[m]);
+    }).join(', ');
+  }
+
+  var requestColumns = [
+    ['开始', function (r) { return td(formatTime(r.time)); }],
+    ['调用方', function (r) { return td(r.key); }],
+    ['模型', function (r) { return td(r.used_model ? r.model + ' → ' + r.used_model : r.model); }],
+    ['凭证', function (r) { return td(r.credential); }],
+    ['流式', function (r) { return td(r.stream ? '是' : '否'); }],
+    ['耗时', function (r) { return td(formatMs(r.latency_ms)); }],
+    ['token', function (r) { return td(r.prompt_tokens + ' / ' + r.completion_tokens); }]
+  ];
+
+  var recentColumns = requestColumns.concat([
+    ['状态', function (r) {
+      var text = r.status + (r.cache ? ' ' + r.cache : '');
+      return '<td>' + badge(r.error ? 'bad' : 'ok', text) + '</td>';
+    }]
+  ]);
+
+  // ---- 视图 ----
+
+  var views = {
+    overview: function () {
+      return Promise.all([api('GET', '/credentials'), api('GET', '/requests?limit=100'), api('GET', '/scheduler')]).then(function (results) {
+        var creds = results[0].credentials || [];
+        var requests = results[1];
+        var scheduler = results[2];
+        var available = creds.filter(function (c) { return !c.invalid; }).length;
+        var today = creds.reduce(function (sum, c) { return sum + c.requests_today; }, 0);
+        var errors = requests.recent.filter(function (r) { return r.error; }).length;
+        var stats = [
+          ['可用凭证', available + ' / ' + creds.length],
+          ['进行中', requests.live.length],
+          ['排队中', scheduler.queued],
+          ['今日请求', formatNumber(today)],
+          ['最近错误', errors + ' / ' + requests.recent.length]
+        ];
+        $('overview-stats').innerHTML = stats.map(function (s) {
+          return '<div class="stat"><div class="value">' + escape(s[1]) + '</div><div class="label">' + s[0] + '</div></div>';
+        }).join('');
+        $('overview-credentials').innerHTML = table([
+          ['名称', function (c) { return td(c.name); }],
+          ['状态', function (c) { return '<td>' + credentialState(c) + '</td>'; }],
+          ['进行中', function (c) { return td(c.inflight); }],
+          ['今日请求', function (c) { return td(c.requests_today); }],
+          ['今日 token', function (c) { return td(formatNumber(c.tokens_today)); }]
+        ], creds, '未配置凭证');
+        $('overview-live').innerHTML = table(requestColumns, requests.live, '当前没有进行中的请求');
+      });
+    },
+
+    credentials: function () {
+      return api('GET', '/credentials').then(function (data) {
+        $('credentials-backend').textContent = '状态后端: ' + data.backend;
+        $('credentials-table').innerHTML = table([
+          ['名称', function (c) { return td(c.name); }],
+          ['标识', function (c) { return td(c.key); }],
+          ['状态', function (c) { return '<td>' + credentialState(c) + (c.runtime ? ' ' + badge('warn', '未持久化') : '') + '</td>'; }],
+          ['冷却', function (c) { return td(cooldownText(c)); }],
+          ['进行中', function (c) { return td(c.inflight); }],
+          ['今日请求', function (c) { return td(c.requests_today); }],
+          ['今日 token', function (c) { return td(formatNumber(c.tokens_today)); }],
+          ['操作', function (c) {
+            var toggle = c.invalid
+              ? '<button data-action="enable" data-key="' + escape(c.key) + '">启用</button>'
+              : '<button data-action="disable" data-key="' + escape(c.key) + '">停用</button>';
+            return '<td class="actions">' + toggle +
+              '<button data-action="validate" data-key="' + escape(c.key) + '">重新校验</button></td>';
+          }]
+        ], data.credentials || [], '未配置凭证');
+      });
+    },
+
+    requests: function () {
+      return api('GET', '/requests?limit=200').then(function (data) {
+        $('requests-live').innerHTML = table(requestColumns, data.live, '当前没有进行中的请求');
+        $('requests-recent').innerHTML = table(recentColumns, data.recent, '暂无请求');
+      });
+    },
+
+    usage: function () {
+      var metric = $('usage-metric').value;
+      return api('GET', '/usage?window=' + $('usage-window').value).then(function (series) {
+        $('usage-key').innerHTML = chart(series, series.by_key, metric);
+        $('usage-model').innerHTML = chart(series, series.by_model, metric);
+      });
+    },
+
+    config: function () {
+      return api('GET', '/config').then(function (data) {
+        $('config-view').textContent = JSON.stringify(data, null, 2);
+      });
+    }
+  };
+
+  // 堆叠柱状图, 只显示用量最多的 8 个分组, 其余合并为"其他"
+  function chart(series, groups, metric) {
+    var names = Object.keys(groups || {});
+    if (!names.length) {
+      return '<p class="muted">暂无数据</p>';
+    }
+    var total = function (name) {
+      return groups[name].reduce(function (sum, u) { return sum + u[metric]; }, 0);
+    };
+    names.sort(function (a, b) { return total(b) - total(a); });
+    var shown = names.slice(0, 8);
+    var data = shown.map(function (name) { return groups[name].map(function (u) { return u[metric]; }); });
+    if (names.length > 8) {
+      var other = series.total.map(function () { return 0; });
+      names.slice(8).forEach(function (name) {
+        groups[name].forEach(function (u, i) { other[i] += u[metric]; });
+      });
+      shown.push('其他');
+      data.push(other);
+    }
+
+    var points = series.total.length;
+    var sums = series.total.map(function (_, i) {
+      return data.reduce(function (sum, values) { return sum + values[i]; }, 0);
+    });
+    var maxValue = Math.max.apply(null, sums.concat([1]));
+    var width = 1000, height = 220, left = 48, bottom = 20;
+    var plotW = width - left, plotH = height - bottom - 8;
+    var barW = plotW / points;
+
+    var svg = '<svg viewBox="0 0 ' + width + ' ' + height + '" preserveAspectRatio="none">';
+    for (var g = 0; g <= 4; g++) {
+      var y = 8 + plotH - plotH * g / 4;
+      svg += '<line class="axis" x1="' + left + '" x2="' + width + '" y1="' + y + '" y2="' + y + '"/>';
+      svg += '<text x="' + (left - 6) + '" y="' + (y + 4) + '" text-anchor="end">' + formatNumber(Math.round(maxValue * g / 4)) + '</text>';
+    }
+    for (var i = 0; i < points; i++) {
+      var base = 8 + plotH;
+      var x = left + i * barW;
+      var time = new Date(new Date(series.start).getTime() + i * series.step * 1000);
+      data.forEach(function (values, s) {
+        if (!values[i]) return;
+        var h = plotH * values[i] / maxValue;
+        base -= h;
+        svg += '<rect x="' + (x + barW * 0.1) + '" y="' + base + '" width="' + (barW * 0.8) + '" height="' + h +
+          '" fill="' + COLORS[s % COLORS.length] + '"><title>' + escape(shown[s]) + ' ' +
+          time.toLocaleTimeString() + ': ' + values[i] + '</title></rect>';
+      });
+      if (i % Math.ceil(points / 8) === 0) {
+        svg += '<text x="' + (x + barW / 2) + '" y="' + (height - 4) + '" text-anchor="middle">' +
+          time.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' }) + '</text>';
+      }
+    }
+    svg += '</svg>';
+
+    var legend = shown.map(function (name, s) {
+      return '<span><i style="background:' + COLORS[s % COLORS.length] + '"></i>' + escape(name) + '</span>';
+    }).join('');
+    return '<div class="chart">' + svg + '<div class="legend">' + legend + '</div></div>';
+  }
+
+  // ---- 路由及刷新 ----
+
+  function currentView() {
+    var name = location.hash.replace('#', '');
+    return views[name] ? name : 'overview';
+  }
+
+  function refresh() {
+    var name = currentView();
+    document.querySelectorAll('.view').forEach(function (el) { el.hidden = el.id !== 'view-' + name; });
+    document.querySelectorAll('#tabs a').forEach(function (el) {
+      el.classList.toggle('active', el.getAttribute('href') === '#' + name);
+    });
+    views[name]().then(function () {
+      $('status').textContent = '更新于 ' + new Date().toLocaleTimeString();
+    }).catch(function (err) {
+      $('status').textContent = '加载失败: ' + err.message;
+    });
+  }
+
+  function start() {
+    $('login').hidden = true;
+    $('app').hidden = false;
+    refresh();
+    clearInterval(timer);
+    timer = setInterval(function () {
+      // 配置不会频繁变化, 不自动刷新
+      if (currentView() !== 'config' && !document.hidden) refresh();
+    }, REFRESH_INTERVAL);
+  }
+
+  function logout(message) {
+    secret = '';
+    localStorage.removeItem(SECRET_KEY);
+    clearInterval(timer);
+    $('app').hidden = true;
+    $('login').hidden = false;
+    $('login-error').textContent = message || '';
+  }
+
+  $('login-form').addEventListener('submit', function (e) {
+    e.preventDefault();
+    secret = $('secret').value;
+    api('GET', '/credentials').then(function () {
+      localStorage.setItem(SECRET_KEY, secret);
+      $('secret').value = '';
+      start();
+    }).catch(function (err) {
+      if (err.message !== 'unauthorized') $('login-error').textContent = err.message;
+    });
+  });
+
+  $('logout').addEventListener('click', function () { logout(); });
+  window.addEventListener('hashchange', refresh);
+  $('usage-window').addEventListener('change', refresh);
+  $('usage-metric').addEventListener('change', refresh);
+
+  $('clear-invalid').addEventListener('click', function () {
+    if (!confirm('清除所有失效标记(手动停用的除外)?')) return;
+    api('DELETE', '/credentials/invalid').then(refresh).catch(function (err) { alert(err.message); });
+  });
+
+  $('credentials-table').addEventListener('click', function (e) {
+    var button = e.target.closest('button[data-action]');
+    if (!button) return;
+    var action = button.dataset.action;
+    if (action === 'disable' && !confirm('停用后所有实例都不再使用该凭证, 确定停用?')) return;
+    button.disabled = true;
+    api('POST', '/credentials/' + encodeURIComponent(button.dataset.key) + '/' + action).then(function (data) {
+      if (action === 'validate') {
+        alert('校验结果 (' + data.model + '): ' + data.result + (data.detail ? '\n' + data.detail : ''));
+      }
+      refresh();
+    }).catch(function (err) {
+      alert(err.message);
+      button.disabled = false;
+    });
+  });
+
+  $('add-credential').addEventListener('submit', function (e) {
+    e.preventDefault();
+    api('POST', '/credentials', { value: $('credential-value').value }).then(function () {
+      $('credential-value').value = '';
+      refresh();
+    }).catch(function (err) { alert(err.message); });
+  });
+
+  if (secret) {
+    start();
+  } else {
+    logout();
+  }
+})();